@@ -0,0 +1,80 @@
+package cmdparse
+
+// Alias makes ‘alias’ another spelling of the keyword ‘keyword’ in every command, as if
+// each definition that has the keyword wrote it as keyword!alias(alias). For example, after
+//
+//    cmds.Alias("rm", "remove")
+//    cmds.Alias("del", "remove")
+//
+// the input ‘rm a’ and ‘del a’ run ‘remove <file>’, and Match.KeywordPresent("remove")
+// returns true for either. The alias applies to the commands already added and those
+// added later. Like the keyword, the alias may be abbreviated unless the keyword must be
+// entered in full.
+func (c *Cmds) Alias(alias, keyword string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.aliases == nil {
+		c.aliases = make(map[string][]string)
+	}
+	c.aliases[keyword] = appendUnique(c.aliases[keyword], alias)
+
+	c.parseTree = nil
+	for _, cmd := range c.commands {
+		if t, changed := withAliases(cmd.tree, c.aliases); changed {
+			cmd.tree = t
+			cmd.prog = prog{}
+		}
+		c.addParseTree(cmd.tree, cmd)
+	}
+	c.relink()
+}
+
+// withAliases returns the parse tree ‘tree’ with the aliases in ‘aliases’, which maps
+// keywords to their aliases, added to its keywords. changed is false if it has none of
+// the keywords.
+func withAliases(tree interface{}, aliases map[string][]string) (t interface{}, changed bool) {
+	switch node := tree.(type) {
+	case word:
+		if a := aliases[string(node)]; len(a) > 0 {
+			return aliasedWord{Keyword: string(node), Aliases: append([]string{}, a...)}, true
+		}
+	case exactWord:
+		if a := aliases[string(node)]; len(a) > 0 {
+			return aliasedWord{Keyword: string(node), Aliases: append([]string{}, a...), Exact: true}, true
+		}
+	case aliasedWord:
+		merged := append([]string{}, node.Aliases...)
+		for _, a := range aliases[node.Keyword] {
+			merged = appendUnique(merged, a)
+		}
+		if len(merged) > len(node.Aliases) {
+			node.Aliases = merged
+			return node, true
+		}
+	case alts:
+		l, lc := withAliases(node.Left, aliases)
+		r, rc := withAliases(node.Right, aliases)
+		return alts{Left: l, Right: r}, lc || rc
+	case terms:
+		l, lc := withAliases(node.Left, aliases)
+		r, rc := withAliases(node.Right, aliases)
+		return terms{Left: l, Right: r}, lc || rc
+	case rep:
+		node.Term, changed = withAliases(node.Term, aliases)
+		return node, changed
+	case group:
+		node.Term, changed = withAliases(node.Term, aliases)
+		return node, changed
+	case set:
+		opts := make([]interface{}, len(node.Options))
+		for i, opt := range node.Options {
+			var c bool
+			opts[i], c = withAliases(opt, aliases)
+			changed = changed || c
+		}
+		node.Options = opts
+		return node, changed
+	}
+	return tree, false
+}
@@ -0,0 +1,89 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		syntax   string
+		keywords []string
+	}{
+		{"keyword", "remove a", "remove!alias(rm|del) <file>", []string{"remove"}},
+		{"alias", "rm a", "remove!alias(rm|del) <file>", []string{"remove"}},
+		{"abbreviated alias", "de a", "remove!alias(rm|del) <file>", []string{"remove"}},
+		{"exact alias", "show fo", "", nil},
+		{"exact alias in full", "show force", "show !all!alias(force)", []string{"show", "all"}},
+		{"Alias", "ls x", "list <dir>", []string{"list"}},
+		{"Alias of a later command", "ls", "list", []string{"list"}},
+		{"Alias of an aliased keyword", "sh all", "show !all!alias(force)", []string{"show", "all"}},
+	}
+
+	for _, mode := range []string{"compiled", "lazy", "optimized"} {
+		for _, tc := range tests {
+			t.Run(mode+" "+tc.name, func(t *testing.T) {
+				var syntax string
+				cmds := &Cmds{}
+				add := func(cmd string) {
+					cmds.Add(cmd, func(m Match, ctx interface{}) {
+						syntax = cmd
+						var kws []string
+						for _, kw := range m.Keywords() {
+							kws = append(kws, kw.Name)
+						}
+						if !reflect.DeepEqual(kws, tc.keywords) {
+							t.Fatalf("the keywords are %v but expected %v", kws, tc.keywords)
+						}
+					})
+				}
+
+				add("remove!alias(rm|del) <file>")
+				add("show !all!alias(force)")
+				add("list <dir>")
+				cmds.SetLazyCompilation(mode == "lazy")
+				if mode == "optimized" {
+					cmds.Optimize()
+				}
+				cmds.Compile()
+				cmds.Alias("ls", "list")
+				cmds.Alias("sh", "show")
+				add("list")
+
+				cmds.Parse(tc.input, nil)
+				if syntax != tc.syntax {
+					t.Fatalf("the input ran ‘%s’ but expected ‘%s’", syntax, tc.syntax)
+				}
+			})
+		}
+	}
+}
+
+func TestCompleteAliases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "remove(keyword) show(keyword)"},
+		{"r", "remove(keyword)"},
+		{"d", "del(keyword)"},
+		{"show f", "force(keyword)"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+			cmds.Add("remove!alias(rm|del) <file>", cback)
+			cmds.Add("show !all!alias(force)", cback)
+			cmds.Compile()
+
+			comps := completionsToStr(cmds.Complete(tc.input).Items)
+			if comps != tc.expected {
+				t.Fatalf("Expected completions ‘%s’ but got ‘%s’", tc.expected, comps)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AmbiguityError describes input that matches more than one command, and where the
+// interpretations of the input diverge. It's returned by Ambiguity.
+type AmbiguityError struct {
+	// Word is the index of the first input word that the interpretations treat
+	// differently.
+	Word int
+	// Input is the input word at Word.
+	Input string
+	// Candidates are the interpretations of the input, one for each matched command.
+	Candidates []AmbiguityCandidate
+}
+
+// AmbiguityCandidate is one interpretation of ambiguous input.
+type AmbiguityCandidate struct {
+	// Syntax is the definition of the command as it was passed to Add.
+	Syntax string
+	// Element is what the command matched the word at AmbiguityError.Word with: a
+	// keyword, or a variable in angle brackets such as <file>.
+	Element string
+	// IsKeyword is true if Element is a keyword.
+	IsKeyword bool
+}
+
+func (c AmbiguityCandidate) describe() string {
+	if c.IsKeyword {
+		return fmt.Sprintf("keyword '%s'", c.Element)
+	}
+	return "value for " + c.Element
+}
+
+// Error returns a message such as:
+//
+//    'v' is ambiguous at argument 2: could be keyword 'verbose' or value for <file>
+func (e *AmbiguityError) Error() string {
+	var descs []string
+	seen := make(map[string]bool)
+	for _, c := range e.Candidates {
+		d := c.describe()
+		if !seen[d] {
+			seen[d] = true
+			descs = append(descs, d)
+		}
+	}
+	return fmt.Sprintf("'%s' is ambiguous at argument %d: could be %s", e.Input, e.Word+1, strings.Join(descs, " or "))
+}
+
+// Ambiguity returns an AmbiguityError describing how the input ‘cmd’ is ambiguous, or
+// nil if it doesn't match more than one command. When Parse returns false this tells
+// whether it was because the input was ambiguous, and can be used to explain why.
+func (c *Cmds) Ambiguity(cmd string) *AmbiguityError {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	toks, err := c.scanInput(cmd)
+	if err != nil {
+		return nil
+	}
+
+	return c.ambiguityOf(toks, c.match(toks, ParseOptions{}))
+}
+
+// ambiguityOf returns an AmbiguityError for the ‘matches’ of the input words ‘toks’, or nil
+// if there are less than two matches.
+func (c *Cmds) ambiguityOf(toks []string, matches []match) *AmbiguityError {
+	if len(matches) < 2 {
+		return nil
+	}
+
+	c.sortByAddOrder(matches)
+
+	// Find the first word where the matches bound different elements. If they all bound
+	// the same elements the commands differ only after the input, so the last word is
+	// reported.
+	word := -1
+	for i := 0; i < len(toks) && word < 0; i++ {
+		first := elementAt(matches[0], i)
+		for _, m := range matches[1:] {
+			if elementAt(m, i) != first {
+				word = i
+				break
+			}
+		}
+	}
+	if word < 0 {
+		word = len(toks) - 1
+	}
+	if word < 0 {
+		word = 0
+	}
+
+	e := &AmbiguityError{Word: word}
+	if word < len(toks) {
+		e.Input = toks[word]
+	}
+	for _, m := range matches {
+		cand := elementAt(m, word)
+		cand.Syntax = m.meta.(*command).syntax
+		e.Candidates = append(e.Candidates, cand)
+	}
+	return e
+}
+
+// elementAt returns the element of the command that matched the input word at index
+// ‘word’ in the match ‘m’. Only the Element and IsKeyword fields are set.
+func elementAt(m match, word int) AmbiguityCandidate {
+	// An item may match several words, such as a variable matched by a custom instruction
+	// or one that consumes the rest of the input, so the item is found by its span.
+	var cand AmbiguityCandidate
+	for _, item := range m.items {
+		var span Span
+		switch v := item.(type) {
+		case keywordValue:
+			span, cand = v.Span, AmbiguityCandidate{Element: v.Name, IsKeyword: true}
+		case VarValue:
+			span, cand = v.Span, AmbiguityCandidate{Element: "<" + v.Name + ">"}
+		default:
+			continue
+		}
+		if word < span.Word+span.Words {
+			break
+		}
+	}
+	return cand
+}
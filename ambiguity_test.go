@@ -0,0 +1,55 @@
+package cmdparse
+
+import (
+	"testing"
+)
+
+func TestAmbiguity(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		error string
+	}{
+		{"keyword or variable", "get v", "'v' is ambiguous at argument 2: could be keyword 'verbose' or value for <file>"},
+		{"abbreviated keyword", "s", "'s' is ambiguous at argument 1: could be keyword 'start' or keyword 'stop'"},
+		{"same elements", "set x", "'x' is ambiguous at argument 2: could be value for <name>"},
+		{"after several words", "fly new york now", "'now' is ambiguous at argument 4: could be keyword 'now' or value for <when>"},
+		{"not ambiguous", "sta", ""},
+		{"no match", "bogus", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+
+			cmds.Add("get verbose", cback)
+			cmds.Add("get <file>", cback)
+			cmds.Add("start", cback)
+			cmds.Add("stop", cback)
+			cmds.Add("set <name>", cback)
+			cmds.Add("set <name> now?", cback)
+			cmds.AddInstruction(cityInstr{})
+			cmds.Add("fly <to:@city> now", cback)
+			cmds.Add("fly <to:@city> <when>", cback)
+			cmds.Compile()
+
+			err := cmds.Ambiguity(tc.input)
+			if tc.error == "" {
+				if err != nil {
+					t.Fatalf("Expected no ambiguity but got: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected the input to be ambiguous")
+			}
+			if err.Error() != tc.error {
+				t.Fatalf("Expected error '%s' but got '%s'", tc.error, err.Error())
+			}
+			if len(err.Candidates) != 2 {
+				t.Fatalf("Expected 2 candidates but got %d", len(err.Candidates))
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxAnalysisPaths is the most paths through a command that Analyze tries.
+const maxAnalysisPaths = 1000
+
+// maxAnalysisVisits is the most times a path through a command may pass through the same
+// instruction, which bounds the number of repetitions that are tried.
+const maxAnalysisVisits = 3
+
+// FindingReason is why an element of the grammar can't be matched.
+type FindingReason int
+
+const (
+	// ShadowedElement is an element that is only reached by inputs that also match
+	// something else, and so are ambiguous.
+	ShadowedElement FindingReason = iota
+	// AfterRestElement is an element that follows a variable that consumes the rest of the
+	// input, such as a cmdline.
+	AfterRestElement
+)
+
+func (r FindingReason) String() string {
+	switch r {
+	case ShadowedElement:
+		return "shadowed"
+	case AfterRestElement:
+		return "after rest"
+	}
+	return "<unknown>"
+}
+
+// Finding is a problem with the grammar found by Analyze.
+type Finding struct {
+	Reason FindingReason
+	// Syntax is the definition of the command containing the element.
+	Syntax string
+	// Element is the keyword, or the variable in angle brackets, that can't be matched.
+	Element string
+	// PC is the address of the element's instruction in the compiled program.
+	PC int
+	// Example is an input that reaches the element but is ambiguous. It's empty for
+	// AfterRestElement findings.
+	Example string
+	// Conflicts are the definitions of the other commands that the example also matches.
+	// It's empty when the example matches the same command in more than one way.
+	Conflicts []string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s in ‘%s’ can never be matched: %s", f.Element, f.Syntax, f.why())
+}
+
+// why returns why the element can never be matched.
+func (f Finding) why() string {
+	if f.Reason == AfterRestElement {
+		return "it follows a variable that consumes the rest of the input"
+	}
+	if len(f.Conflicts) == 0 {
+		return fmt.Sprintf("input such as ‘%s’ matches the command in more than one way", f.Example)
+	}
+	return fmt.Sprintf("input such as ‘%s’ also matches ‘%s’", f.Example, strings.Join(f.Conflicts, "’, ‘"))
+}
+
+// Analyze looks for keywords and variables that can never be part of a successful match,
+// because every input that reaches them also matches something else and so is ambiguous.
+// This catches mistakes such as duplicate alternatives, as in ‘(show | show)’, a keyword
+// that is an abbreviation of another alternative, as in ‘(show | sh)’, or a command that
+// is the same as another. It also reports elements that follow a variable that consumes
+// the rest of the input. Compile must be called first.
+//
+// Analyze tries inputs made from the paths through each command, with repetitions tried
+// a few times, so it may not examine every path of very large commands. Variables are given
+// sample values; variables whose type doesn't list its values using Complete and isn't
+// one of the built-in types are not checked.
+func (c *Cmds) Analyze() []Finding {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prog := c.program().instrs
+	sample := analysisStrSample(prog)
+
+	var findings []Finding
+	for _, cmd := range c.commands {
+		paths := analysisPaths(prog, c.spanOf(cmd).Start)
+
+		// live are the elements that are part of an unambiguous match for some path, and
+		// dead are those that were only on paths that were ambiguous
+		live := make(map[*instr]bool)
+		dead := make(map[*instr]Finding)
+		var order []*instr
+
+		for _, path := range paths {
+			if i := restIndex(path); i >= 0 && i < len(path)-1 {
+				for _, in := range path[i+1:] {
+					if _, ok := dead[in]; !ok {
+						order = append(order, in)
+						dead[in] = Finding{
+							Reason:  AfterRestElement,
+							Syntax:  cmd.syntax,
+							Element: analysisElement(in),
+							PC:      instrIndex(prog, in),
+						}
+					}
+				}
+				continue
+			}
+
+			input, ok := analysisInput(path, sample)
+			if !ok {
+				continue
+			}
+			matches := c.match(input, ParseOptions{})
+
+			if len(matches) == 1 && sameInstrs(matches[0].instrs, path) {
+				for _, in := range path {
+					live[in] = true
+				}
+				continue
+			}
+			if len(matches) < 2 {
+				// The path doesn't match the input it was made from, for example because
+				// a variable's sample value is also a keyword
+				continue
+			}
+
+			var conflicts []string
+			for _, m := range matches {
+				other := m.meta.(*command)
+				if other != cmd {
+					conflicts = appendUnique(conflicts, other.syntax)
+				}
+			}
+			for _, in := range path {
+				if _, ok := dead[in]; !ok {
+					order = append(order, in)
+					dead[in] = Finding{
+						Reason:    ShadowedElement,
+						Syntax:    cmd.syntax,
+						Element:   analysisElement(in),
+						PC:        instrIndex(prog, in),
+						Example:   strings.Join(input, " "),
+						Conflicts: conflicts,
+					}
+				}
+			}
+		}
+
+		for _, in := range order {
+			if !live[in] {
+				findings = append(findings, dead[in])
+			}
+		}
+	}
+	return findings
+}
+
+// analysisPaths returns the sequences of opCmp, opSave, opSaveRest and opCustom
+// instructions that a thread could match starting at ‘pc’.
+func analysisPaths(prog []instr, pc int) [][]*instr {
+	var paths [][]*instr
+	visits := make(map[int]int)
+
+	var walk func(pc int, path []*instr)
+	walk = func(pc int, path []*instr) {
+		if len(paths) >= maxAnalysisPaths || pc >= len(prog) || visits[pc] >= maxAnalysisVisits {
+			return
+		}
+		visits[pc]++
+		defer func() { visits[pc]-- }()
+
+		in := &prog[pc]
+		switch in.opcode {
+		case opMatch:
+			paths = append(paths, append([]*instr{}, path...))
+		case opSplit:
+			walk(in.ints[0], path)
+			walk(in.ints[1], path)
+		case opJmp:
+			walk(in.ints[0], path)
+		case opCmp, opSave, opSaveRest, opCustom:
+			walk(pc+1, append(path, in))
+		default:
+			walk(pc+1, path)
+		}
+	}
+
+	walk(pc, nil)
+	return paths
+}
+
+// analysisSamples are valid values of the built-in types.
+var analysisSamples = map[string]string{
+	"int":       "1",
+	"float":     "1.5",
+	"bool":      "true",
+	"map":       "k=v",
+	"json":      "{}",
+	"hex":       "00",
+	"base64":    "AA==",
+	"duration":  "1s",
+	"cmdline":   "x",
+	"rest":      "x",
+	"freq":      "1Hz",
+	"bandwidth": "1bps",
+}
+
+// analysisInput returns the input words that follow ‘path’, using ‘str’ as the value of
+// untyped variables. ok is false if a variable has no known sample value, which is
+// always the case for variables matched by custom instructions.
+func analysisInput(path []*instr, str string) (input []string, ok bool) {
+	for _, in := range path {
+		if in.opcode == opCmp {
+			input = append(input, in.strs[0])
+			continue
+		}
+		if in.opcode == opCustom {
+			return nil, false
+		}
+
+		t, typed := in.intf.(Type)
+		if !typed {
+			input = append(input, str)
+			continue
+		}
+
+		var val string
+		if vals := t.Complete(""); len(vals) > 0 {
+			val = vals[0]
+		} else if s, known := analysisSamples[t.Name()]; known {
+			val = s
+		} else if _, list := t.(listType); list {
+			val = "[]"
+		}
+		if val == "" || t.Validate(val) != nil {
+			return nil, false
+		}
+		input = append(input, val)
+	}
+	return input, true
+}
+
+// analysisStrSample returns a word that isn't a prefix of any keyword in ‘prog’, to use as
+// the value of untyped variables.
+func analysisStrSample(prog []instr) string {
+	for i := 0; ; i++ {
+		s := fmt.Sprintf("value%d", i)
+		clash := false
+		for j := range prog {
+			if prog[j].opcode != opCmp {
+				continue
+			}
+			for _, kw := range prog[j].spellings() {
+				clash = clash || strings.HasPrefix(kw, s)
+			}
+		}
+		if !clash {
+			return s
+		}
+	}
+}
+
+func analysisElement(in *instr) string {
+	if in.opcode == opCmp {
+		return in.strs[0]
+	}
+	return "<" + in.strs[0] + ">"
+}
+
+// restIndex returns the index of the first instruction in ‘path’ that consumes the rest of
+// the input, or -1 if there isn't one.
+func restIndex(path []*instr) int {
+	for i, in := range path {
+		if in.opcode == opSaveRest {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameInstrs(a, b []*instr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// instrIndex returns the address of ‘in’ in ‘prog’.
+func instrIndex(prog []instr, in *instr) int {
+	for i := range prog {
+		if &prog[i] == in {
+			return i
+		}
+	}
+	return -1
+}
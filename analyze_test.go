@@ -0,0 +1,66 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmds     []string
+		expected []string
+	}{
+		{"clean", []string{"show (status | version)", "set <name> <value>", "a | a b"}, nil},
+		{"abbreviated alternative", []string{"(show | sh) status"}, []string{"sh"}},
+		{"duplicate alternative", []string{"get (a | a)"}, []string{"get", "a", "a"}},
+		{"duplicate command", []string{"stop now", "stop now"}, []string{"stop", "now", "stop", "now"}},
+		{"keyword after variable", []string{"open (<file> | latest)"}, []string{"latest"}},
+		{"after rest", []string{"run <cmd:cmdline> later"}, []string{"later"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.AddType(cmdlineType{})
+			for _, syntax := range tc.cmds {
+				if err := cmds.Add(syntax, func(match Match, ctx interface{}) {}); err != nil {
+					t.Fatalf("Adding ‘%s’ failed: %v", syntax, err)
+				}
+			}
+			cmds.Compile()
+
+			var elems []string
+			for _, f := range cmds.Analyze() {
+				elems = append(elems, f.Element)
+			}
+			if !reflect.DeepEqual(elems, tc.expected) {
+				t.Fatalf("Expected findings for %v but got %v", tc.expected, cmds.Analyze())
+			}
+		})
+	}
+}
+
+func TestAnalyzeFinding(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("show status", func(match Match, ctx interface{}) {})
+	cmds.Add("(show | sh) status", func(match Match, ctx interface{}) {})
+	cmds.Compile()
+
+	findings := cmds.Analyze()
+	if len(findings) != 5 {
+		t.Fatalf("Expected 5 findings but got %v", findings)
+	}
+
+	f := findings[0]
+	if f.Reason != ShadowedElement || f.Syntax != "show status" || f.Element != "show" || f.Example != "show status" {
+		t.Fatalf("Unexpected finding %#v", f)
+	}
+	if !reflect.DeepEqual(f.Conflicts, []string{"(show | sh) status"}) {
+		t.Fatalf("Unexpected conflicts %v", f.Conflicts)
+	}
+	expected := "show in ‘show status’ can never be matched: input such as ‘show status’ also matches ‘(show | sh) status’"
+	if f.String() != expected {
+		t.Fatalf("Expected ‘%s’ but got ‘%s’", expected, f.String())
+	}
+}
@@ -0,0 +1,151 @@
+package cmdparse
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// syntheticCmds generates ‘n’ command definitions that look like those of a real CLI,
+// along with an input that matches each. The same ‘seed’ always generates the same
+// commands.
+func syntheticCmds(n int, seed int64) (defs, inputs []string) {
+	rnd := rand.New(rand.NewSource(seed))
+	verbs := []string{"show", "set", "add", "delete", "list", "start", "stop", "reset"}
+
+	for i := 0; i < n; i++ {
+		verb := verbs[rnd.Intn(len(verbs))]
+		// The suffix keeps any noun from being a prefix of another
+		noun := fmt.Sprintf("object%dx", i)
+
+		def := []string{verb, noun}
+		input := []string{verb, noun}
+		for j := rnd.Intn(4); j > 0; j-- {
+			switch rnd.Intn(3) {
+			case 0:
+				v := fmt.Sprintf("<v%d>", j)
+				def = append(def, v)
+				input = append(input, "value")
+			case 1:
+				def = append(def, fmt.Sprintf("(on%d | off%d)", j, j))
+				input = append(input, fmt.Sprintf("off%d", j))
+			case 2:
+				def = append(def, fmt.Sprintf("(verbose%d)?", j))
+			}
+		}
+
+		defs = append(defs, strings.Join(def, " "))
+		inputs = append(inputs, strings.Join(input, " "))
+	}
+	return
+}
+
+func benchmarkCmds(b *testing.B, defs []string, lazy bool) *Cmds {
+	var cmds Cmds
+	cmds.SetLazyCompilation(lazy)
+	for _, d := range defs {
+		if err := cmds.Add(d, func(match Match, ctx interface{}) {}); err != nil {
+			b.Fatalf("Adding ‘%s’ failed: %v", d, err)
+		}
+	}
+	cmds.Compile()
+	return &cmds
+}
+
+func benchmarkCompile(b *testing.B, n int) {
+	defs, _ := syntheticCmds(n, 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkCmds(b, defs, false)
+	}
+}
+
+func benchmarkParse(b *testing.B, n int, lazy bool) {
+	defs, inputs := syntheticCmds(n, 1)
+	benchmarkParseInputs(b, benchmarkCmds(b, defs, lazy), inputs)
+}
+
+func benchmarkParseInputs(b *testing.B, cmds *Cmds, inputs []string) {
+	b.ReportAllocs()
+	cmds.ResetStats()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		input := inputs[i%len(inputs)]
+		if !cmds.Parse(input, nil) {
+			b.Fatalf("Parsing ‘%s’ failed", input)
+		}
+	}
+	reportStats(b, cmds)
+}
+
+// reportStats adds the work done by the VM for each parse to the benchmark results.
+func reportStats(b *testing.B, cmds *Cmds) {
+	threads, instrs, matches := cmds.Stats().PerInput()
+	b.ReportMetric(threads, "threads/op")
+	b.ReportMetric(instrs, "instrs/op")
+	b.ReportMetric(matches, "matches/op")
+}
+
+func BenchmarkCompileSmall(b *testing.B)  { benchmarkCompile(b, 10) }
+func BenchmarkCompileMedium(b *testing.B) { benchmarkCompile(b, 100) }
+func BenchmarkCompileLarge(b *testing.B)  { benchmarkCompile(b, 500) }
+func BenchmarkCompileHuge(b *testing.B)   { benchmarkCompile(b, 2000) }
+
+func BenchmarkParseSmall(b *testing.B)    { benchmarkParse(b, 10, false) }
+func BenchmarkParseMedium(b *testing.B)   { benchmarkParse(b, 100, false) }
+func BenchmarkParseLarge(b *testing.B)    { benchmarkParse(b, 500, false) }
+func BenchmarkParseHuge(b *testing.B)     { benchmarkParse(b, 2000, false) }
+func BenchmarkParseHugeLazy(b *testing.B) { benchmarkParse(b, 2000, true) }
+
+func BenchmarkParseHugeOptimized(b *testing.B) {
+	defs, inputs := syntheticCmds(2000, 1)
+	cmds := benchmarkCmds(b, defs, false)
+	cmds.Optimize()
+	benchmarkParseInputs(b, cmds, inputs)
+}
+
+func BenchmarkParseLongInput(b *testing.B) {
+	var cmds Cmds
+	cmds.Add("load <file>* (verbose)?", func(match Match, ctx interface{}) {})
+	cmds.Compile()
+
+	input := "load" + strings.Repeat(" file.txt", 1000)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !cmds.Parse(input, nil) {
+			b.Fatalf("Parsing failed")
+		}
+	}
+	reportStats(b, &cmds)
+}
+
+func BenchmarkParseLongInputLarge(b *testing.B) {
+	defs, _ := syntheticCmds(500, 1)
+	defs = append(defs, "load <file>* (verbose)?")
+	cmds := benchmarkCmds(b, defs, false)
+	benchmarkParseInputs(b, cmds, []string{"load" + strings.Repeat(" file.txt", 100)})
+}
+
+// BenchmarkIncrementalLongInput feeds a long input a word at a time, checking it after each
+// word as a line editor would.
+func BenchmarkIncrementalLongInput(b *testing.B) {
+	var cmds Cmds
+	cmds.Add("load <file>* (verbose)?", func(match Match, ctx interface{}) {})
+	cmds.Compile()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p := cmds.NewIncrementalParser()
+		p.Feed("load")
+		for j := 0; j < 1000; j++ {
+			if !p.Feed("file.txt") {
+				b.Fatalf("Feeding failed")
+			}
+		}
+		if !p.Valid() {
+			b.Fatalf("Parsing failed")
+		}
+	}
+}
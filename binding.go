@@ -0,0 +1,251 @@
+package cmdparse
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// bindTag is the struct tag that names the variable or keyword a field is set from.
+const bindTag = "cmd"
+
+var (
+	ctxType        = reflect.TypeOf((*interface{})(nil)).Elem()
+	bytesType      = reflect.TypeOf([]byte(nil))
+	durationGoType = reflect.TypeOf(time.Duration(0))
+)
+
+// AddBound registers the command definition ‘cmd’ like Add, but with a handler that is
+// passed the matched variables in a struct rather than a Match. ‘handler’ must be a function
+// of the form
+//
+//    func(args T, ctx interface{})
+//
+// or return a Result like the callbacks of AddWithResult, where T is a struct. Each field of T that is tagged with `cmd:"name"` is set from the
+// variable ‘name’ converted to the type of the field, for example:
+//
+//    type copyArgs struct {
+//        Src   string `cmd:"src"`
+//        Count int    `cmd:"n"`
+//        Force bool   `cmd:"force"`
+//    }
+//    cmds.AddBound("copy <src> <n:int> force?", func(args copyArgs, ctx interface{}) { ... })
+//
+// Fields may be strings, integers, floating point numbers, booleans, time.Duration, []byte,
+// or slices of these, which are filled from a repeated variable or from the elements of a
+// list. A field whose type is the same as the VarValue.Converted value of the variable, such
+// as the pointer for types added with AddJSONType, is set to it. A bool field may instead be
+// tagged with a keyword of the command, and is set to whether the keyword was entered.
+// Fields of variables that weren't matched are left as the zero value.
+//
+// If a value can't be converted to the type of its field, for example because it's out of
+// range, the input is treated as not matching and Parse returns false.
+func (c *Cmds) AddBound(cmd string, handler interface{}) error {
+	h := reflect.ValueOf(handler)
+	ht := h.Type()
+	if ht.Kind() != reflect.Func || ht.NumIn() != 2 || ht.NumOut() > 1 ||
+		ht.In(0).Kind() != reflect.Struct || ht.In(1) != ctxType ||
+		ht.NumOut() == 1 && ht.Out(0) != resultType {
+		return fmt.Errorf("the handler must be a func(args T, ctx interface{}) where T is a struct, not %v", ht)
+	}
+
+	t, err := c.scanAndParse(cmd)
+	if err != nil {
+		return err
+	}
+
+	b := &binder{handler: h, args: ht.In(0)}
+	vars, keywords := elementNames(t)
+	for i := 0; i < b.args.NumField(); i++ {
+		f := b.args.Field(i)
+		name, ok := f.Tag.Lookup(bindTag)
+		if !ok {
+			continue
+		}
+		switch {
+		case vars[name]:
+			b.fields = append(b.fields, boundField{index: i, name: name})
+		case keywords[name] && f.Type.Kind() == reflect.Bool:
+			b.fields = append(b.fields, boundField{index: i, name: name, keyword: true})
+		case keywords[name]:
+			return fmt.Errorf("the field %s is set from the keyword ‘%s’ so it must be a bool", f.Name, name)
+		default:
+			return fmt.Errorf("the field %s is tagged with ‘%s’, which is not a variable or keyword of the command", f.Name, name)
+		}
+	}
+
+	c.addCommand(&command{syntax: cmd, binder: b, tree: t})
+	return nil
+}
+
+// binder calls the handler of a command added with AddBound.
+type binder struct {
+	handler reflect.Value
+	// args is the type of the struct passed to the handler
+	args   reflect.Type
+	fields []boundField
+}
+
+// boundField is a field of the args struct that is set from the match.
+type boundField struct {
+	index int
+	// name is the variable or keyword the field is set from
+	name    string
+	keyword bool
+}
+
+// bind returns the args struct filled in from ‘m’, or an error if a value can't be
+// converted to the type of its field.
+func (b *binder) bind(m Match) (reflect.Value, error) {
+	args := reflect.New(b.args).Elem()
+	for _, bf := range b.fields {
+		f := args.Field(bf.index)
+		if bf.keyword {
+			f.SetBool(m.KeywordPresent(bf.name))
+			continue
+		}
+		if err := setField(f, m.Var(bf.name)); err != nil {
+			return args, fmt.Errorf("the variable ‘%s’: %v", bf.name, err)
+		}
+	}
+	return args, nil
+}
+
+// call calls the handler and returns its Result, if it returns one.
+func (b *binder) call(args reflect.Value, ctx interface{}) Result {
+	ctxVal := reflect.New(ctxType).Elem()
+	if ctx != nil {
+		ctxVal.Set(reflect.ValueOf(ctx))
+	}
+	out := b.handler.Call([]reflect.Value{args, ctxVal})
+	if len(out) == 0 {
+		return Result{}
+	}
+	return out[0].Interface().(Result)
+}
+
+// setField sets ‘f’ from the values of a variable.
+func setField(f reflect.Value, vals []*VarValue) error {
+	if len(vals) == 0 {
+		return nil
+	}
+
+	if conv := vals[0].converted(); conv != nil && reflect.TypeOf(conv).AssignableTo(f.Type()) {
+		f.Set(reflect.ValueOf(conv))
+		return nil
+	}
+
+	switch {
+	case f.Type() == bytesType:
+		if vals[0].Bytes != nil {
+			f.SetBytes(vals[0].Bytes)
+		} else {
+			f.SetBytes([]byte(vals[0].Value))
+		}
+		return nil
+	case f.Kind() == reflect.Slice:
+		var words []string
+		if len(vals) == 1 && vals[0].Elems != nil {
+			words = vals[0].Elems
+		} else {
+			for _, v := range vals {
+				words = append(words, v.Value)
+			}
+		}
+
+		s := reflect.MakeSlice(f.Type(), len(words), len(words))
+		for i, w := range words {
+			if err := setScalar(s.Index(i), w); err != nil {
+				return err
+			}
+		}
+		f.Set(s)
+		return nil
+	}
+
+	// Like Match.Map, the last value of a repeated variable wins
+	return setScalar(f, vals[len(vals)-1].Value)
+}
+
+// setScalar sets ‘f’ to the word ‘w’ converted to the type of ‘f’.
+func setScalar(f reflect.Value, w string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(w)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.Type() == durationGoType {
+			d, err := time.ParseDuration(w)
+			if err != nil {
+				return err
+			}
+			f.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(w, 0, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("‘%s’ is not a %v", w, f.Type())
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(w, 0, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("‘%s’ is not a %v", w, f.Type())
+		}
+		f.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(w, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("‘%s’ is not a %v", w, f.Type())
+		}
+		f.SetFloat(x)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(w)
+		if err != nil {
+			return fmt.Errorf("‘%s’ is not true or false", w)
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("fields of type %v are not supported", f.Type())
+	}
+	return nil
+}
+
+// elementNames returns the names of the variables and the keywords in the parse tree
+// ‘tree’.
+func elementNames(tree interface{}) (vars, keywords map[string]bool) {
+	vars = make(map[string]bool)
+	keywords = make(map[string]bool)
+
+	var walk func(tree interface{})
+	walk = func(tree interface{}) {
+		switch node := tree.(type) {
+		case word:
+			keywords[string(node)] = true
+		case exactWord:
+			keywords[string(node)] = true
+		case aliasedWord:
+			keywords[node.Keyword] = true
+		case variable:
+			vars[node.Name] = true
+		case custom:
+			vars[node.Name] = true
+		case alts:
+			walk(node.Left)
+			walk(node.Right)
+		case terms:
+			walk(node.Left)
+			walk(node.Right)
+		case rep:
+			walk(node.Term)
+		case group:
+			walk(node.Term)
+		case set:
+			for _, opt := range node.Options {
+				walk(opt)
+			}
+		}
+	}
+	walk(tree)
+	return
+}
@@ -0,0 +1,101 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type boundArgs struct {
+	Name     string        `cmd:"name"`
+	Count    int           `cmd:"n"`
+	Small    int8          `cmd:"small"`
+	Ratio    float64       `cmd:"ratio"`
+	Every    time.Duration `cmd:"every"`
+	Tags     []string      `cmd:"tag"`
+	Ports    []uint16      `cmd:"ports"`
+	Force    bool          `cmd:"force"`
+	Untagged string
+}
+
+func TestAddBound(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected boundArgs
+	}{
+		{"all", "run x 3 5 0.5 1m tag a tag b [80, 443] force", true,
+			boundArgs{Name: "x", Count: 3, Small: 5, Ratio: 0.5, Every: time.Minute, Tags: []string{"a", "b"}, Ports: []uint16{80, 443}, Force: true}},
+		{"optional missing", "run x 3 5 0.5 1m []", true,
+			boundArgs{Name: "x", Count: 3, Small: 5, Ratio: 0.5, Every: time.Minute, Ports: []uint16{}}},
+		{"out of range", "run x 3 500 0.5 1m []", false, boundArgs{}},
+		{"element out of range", "run x 3 5 0.5 1m [70000]", false, boundArgs{}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.SetListLiterals(true)
+			cmds.AddType(durationType{})
+
+			var args boundArgs
+			var gotCtx interface{}
+			err := cmds.AddBound("run <name> <n:int> <small:int> <ratio:float> <every:duration> (tag <tag>)* <ports:list-int> force?",
+				func(a boundArgs, ctx interface{}) {
+					args = a
+					gotCtx = ctx
+				})
+			if err != nil {
+				t.Fatalf("AddBound failed: %v", err)
+			}
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, "ctx")
+			if ok != tc.ok {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if !reflect.DeepEqual(args, tc.expected) {
+				t.Fatalf("Expected args %+v but got %+v", tc.expected, args)
+			}
+			if gotCtx != "ctx" {
+				t.Fatalf("The handler was passed the context %v", gotCtx)
+			}
+		})
+	}
+}
+
+func TestAddBoundErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler interface{}
+		error   string
+	}{
+		{"not a func", 5, "the handler must be a func(args T, ctx interface{}) where T is a struct, not int"},
+		{"not a struct", func(s string, ctx interface{}) {}, "the handler must be a func(args T, ctx interface{}) where T is a struct, not func(string, interface {})"},
+		{"unknown name", func(a struct {
+			X string `cmd:"x"`
+		}, ctx interface{}) {
+		}, "the field X is tagged with ‘x’, which is not a variable or keyword of the command"},
+		{"keyword not bool", func(a struct {
+			Force string `cmd:"force"`
+		}, ctx interface{}) {
+		}, "the field Force is set from the keyword ‘force’ so it must be a bool"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			err := cmds.AddBound("copy <src> force?", tc.handler)
+			if err == nil {
+				t.Fatalf("AddBound succeeded when it should have failed")
+			}
+			if err.Error() != tc.error {
+				t.Fatalf("Expected error ‘%s’ but got ‘%s’", tc.error, err.Error())
+			}
+		})
+	}
+}
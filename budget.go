@@ -0,0 +1,109 @@
+package cmdparse
+
+import (
+	"fmt"
+	"time"
+)
+
+// Phase is a part of running input that can be timed with SetTimingBudget.
+type Phase int
+
+const (
+	// MatchPhase is splitting the input into words and matching them against the
+	// commands.
+	MatchPhase Phase = iota
+	// CallbackPhase is running the callback of the matched command.
+	CallbackPhase
+)
+
+func (p Phase) String() string {
+	switch p {
+	case MatchPhase:
+		return "match"
+	case CallbackPhase:
+		return "callback"
+	}
+	return "<unknown>"
+}
+
+// SlowInput describes input that took longer than its budget, as passed to a
+// SlowInputHandler. It doesn't contain the input itself, since it may hold sensitive
+// values.
+type SlowInput struct {
+	Phase Phase
+	// Syntax is the definition of the matched command, or empty if the input didn't match
+	// exactly one command.
+	Syntax string
+	// Words and Bytes are the size of the input.
+	Words int
+	Bytes int
+	// Duration is how long the phase took, and Budget how long it was allowed to take.
+	Duration time.Duration
+	Budget   time.Duration
+}
+
+// String returns a message such as:
+//
+//    callback of ‘get <file>’ took 120ms, over the budget of 100ms, for input of 2 words (9 bytes)
+func (s SlowInput) String() string {
+	what := "input"
+	if s.Syntax != "" {
+		what = fmt.Sprintf("‘%s’", s.Syntax)
+	}
+	return fmt.Sprintf("%s of %s took %v, over the budget of %v, for input of %d words (%d bytes)",
+		s.Phase, what, s.Duration, s.Budget, s.Words, s.Bytes)
+}
+
+// SlowInputHandler is called with input whose matching or callback took longer than the
+// budget set with SetTimingBudget, for example to log a warning.
+type SlowInputHandler func(s SlowInput)
+
+// SetTimingBudget sets the longest that matching input and running the callback of the
+// matched command should take, so that grammars and handlers that have become too slow to
+// be responsive are noticed in production. When either takes longer ‘h’ is called after
+// it finishes; running the input isn't interrupted. A zero budget isn't checked, and a nil
+// handler removes the budgets.
+//
+// Matching is timed for Parse and the other methods that match input, such as
+// ParseToMatch, but doesn't include a resolver choosing between ambiguous matches, since
+// it may ask the user.
+func (c *Cmds) SetTimingBudget(match, callback time.Duration, h SlowInputHandler) {
+	c.matchBudget = match
+	c.callbackBudget = callback
+	c.slowHandler = h
+}
+
+// timed returns true if the budget of the phase ‘p’ is checked.
+func (c *Cmds) timed(p Phase) bool {
+	if c.slowHandler == nil {
+		return false
+	}
+	if p == MatchPhase {
+		return c.matchBudget > 0
+	}
+	return c.callbackBudget > 0
+}
+
+// checkBudget calls the handler set with SetTimingBudget if the phase ‘p’ of running the
+// input ‘input’ split into ‘toks’, which matched the command ‘cmd’ if it's not nil, took
+// longer than its budget since ‘start’.
+func (c *Cmds) checkBudget(p Phase, start time.Time, input string, toks []string, cmd *command) {
+	if !c.timed(p) {
+		return
+	}
+
+	budget := c.matchBudget
+	if p == CallbackPhase {
+		budget = c.callbackBudget
+	}
+	d := time.Since(start)
+	if d <= budget {
+		return
+	}
+
+	s := SlowInput{Phase: p, Words: len(toks), Bytes: len(input), Duration: d, Budget: budget}
+	if cmd != nil {
+		s.Syntax = cmd.syntax
+	}
+	c.slowHandler(s)
+}
@@ -0,0 +1,67 @@
+package cmdparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimingBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		match    time.Duration
+		callback time.Duration
+		// expected are the phases reported, with the syntax matched
+		expected []string
+	}{
+		{"both", "get a.txt", time.Nanosecond, time.Nanosecond, []string{"match get <file>", "callback get <file>"}},
+		{"match", "get a.txt", time.Nanosecond, 0, []string{"match get <file>"}},
+		{"callback", "get a.txt", 0, time.Nanosecond, []string{"callback get <file>"}},
+		{"within budget", "get a.txt", time.Hour, time.Hour, nil},
+		{"no match", "zap", time.Nanosecond, time.Nanosecond, []string{"match "}},
+		{"ambiguous", "ge", time.Nanosecond, time.Nanosecond, []string{"match "}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+			cmds.Add("get <file>", cback)
+			cmds.Add("get", cback)
+			cmds.Add("gen", cback)
+			cmds.Compile()
+
+			var got []string
+			cmds.SetTimingBudget(tc.match, tc.callback, func(s SlowInput) {
+				words := len(strings.Fields(tc.input))
+				if s.Words != words || s.Bytes != len(tc.input) {
+					t.Fatalf("Expected the input size to be %d words (%d bytes) but got %d (%d)",
+						words, len(tc.input), s.Words, s.Bytes)
+				}
+				got = append(got, s.Phase.String()+" "+s.Syntax)
+			})
+
+			cmds.Parse(tc.input, nil)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("Expected %v to be reported but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSlowInputString(t *testing.T) {
+	s := SlowInput{
+		Phase:    CallbackPhase,
+		Syntax:   "get <file>",
+		Words:    2,
+		Bytes:    9,
+		Duration: 120 * time.Millisecond,
+		Budget:   100 * time.Millisecond,
+	}
+	expected := "callback of ‘get <file>’ took 120ms, over the budget of 100ms, for input of 2 words (9 bytes)"
+	if s.String() != expected {
+		t.Fatalf("Expected ‘%s’ but got ‘%s’", expected, s.String())
+	}
+}
@@ -0,0 +1,139 @@
+package cmdparse
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxSourceDepth is the maximum number of files that may be sourced within each other.
+const maxSourceDepth = 16
+
+// InstallBuiltins registers the built-in commands. It must be called before Compile.
+// The built-in commands are:
+//
+//    source <path>                          run the commands in the file at ‘path’ using ParseReader
+//    repeat <n:int> <command:cmdline>       run ‘command’ ‘n’ times
+//    watch <interval:duration> <command:cmdline>
+//                                           run ‘command’ every ‘interval’
+//
+// The commands run by repeat and watch are parsed using Parse. watch runs its command until
+// it fails, or until the context passed to Parse is done if it's a context.Context.
+// InstallBuiltins also adds the types used by the builtins: cmdline, which is the rest of
+// the input as it was entered, and duration, which is a duration such as 1m30s converted
+// to a time.Duration.
+//
+// When a builtin fails, ParseErr returns a *CallbackError with its error, and Parse returns
+// false. When a builtin is run by ParseReader its error is returned from ParseReader.
+func (c *Cmds) InstallBuiltins() error {
+	c.AddType(cmdlineType{})
+	c.AddType(durationType{})
+
+	if err := c.addBuiltin("source <path>", c.source); err != nil {
+		return err
+	}
+	if err := c.addBuiltin("repeat <n:int> <command:cmdline>", c.repeat); err != nil {
+		return err
+	}
+	return c.addBuiltin("watch <interval:duration> <command:cmdline>", c.watch)
+}
+
+// addBuiltin registers the builtin command definition ‘cmd’ with the callback ‘cback’,
+// which is passed the context value of the call like the callbacks of Add, and the state
+// of the calls it makes. Its error is returned like those of AddWithContext.
+func (c *Cmds) addBuiltin(cmd string, cback func(match Match, ctx interface{}, call *callState) error) error {
+	t, err := c.scanAndParse(cmd)
+	if err != nil {
+		return err
+	}
+
+	c.addCommand(&command{syntax: cmd, ecback: cback, tree: t})
+	return nil
+}
+
+func (c *Cmds) source(match Match, ctx interface{}, call *callState) error {
+	return c.sourceFile(match.Var("path")[0].Value, ctx, call)
+}
+
+func (c *Cmds) sourceFile(path string, ctx interface{}, call *callState) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// The files being sourced are those of the calls this one is nested in
+	for _, p := range call.sourcing {
+		if p == abs {
+			return fmt.Errorf("%s is already being sourced", path)
+		}
+	}
+
+	if len(call.sourcing) >= maxSourceDepth {
+		return fmt.Errorf("sourcing %s would nest files more than %d deep", path, maxSourceDepth)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The stack is copied, since other calls nested in the same one may share it
+	inner := *call
+	inner.sourcing = append(call.sourcing[:len(call.sourcing):len(call.sourcing)], abs)
+	return c.parseReader(f, path, ctx, ParseOptions{call: &inner})
+}
+
+func (c *Cmds) repeat(match Match, ctx interface{}, call *callState) error {
+	n, _ := match.Var("n")[0].Int()
+	if n < 0 {
+		return fmt.Errorf("‘%d’ is not a valid number of times to repeat", n)
+	}
+
+	cmd := match.Var("command")[0].Value
+	for i := int64(0); i < n; i++ {
+		if err := c.runNested(cmd, ctx, ParseOptions{call: call}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cmds) watch(match Match, ctx interface{}, call *callState) error {
+	interval := match.Var("interval")[0].converted().(time.Duration)
+	cmd := match.Var("command")[0].Value
+	if interval <= 0 {
+		return fmt.Errorf("the interval must be greater than zero")
+	}
+
+	var done <-chan struct{}
+	if cctx, ok := ctx.(context.Context); ok {
+		done = cctx.Done()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.runNested(cmd, ctx, ParseOptions{call: call}); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNested parses ‘cmd’ from within a builtin or ParseReader according to ‘opts’, and
+// returns the error of ParseErr, or the error of the callback if that failed.
+func (c *Cmds) runNested(cmd string, ctx interface{}, opts ParseOptions) error {
+	_, _, err := c.parseErr(cmd, ctx, opts)
+	if cerr, ok := err.(*CallbackError); ok {
+		return cerr.Err
+	}
+	return err
+}
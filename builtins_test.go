@@ -0,0 +1,281 @@
+package cmdparse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmdparse")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(contents), 0600)
+		if err != nil {
+			t.Fatalf("Writing %s failed: %v", name, err)
+		}
+		return path
+	}
+
+	inner := write("inner.txt", "say inner\n")
+	outer := write("outer.txt", "# outer\nsay outer\nsource "+inner+"\n\nsay done\n")
+	bad := write("bad.txt", "say one\nbogus\n")
+	badOuter := write("badouter.txt", "say start\nsource "+bad+"\n")
+	loop := filepath.Join(dir, "loop.txt")
+	write("loop.txt", "source "+loop+"\n")
+
+	tests := []struct {
+		name     string
+		input    string
+		async    bool
+		error    string
+		expected []string
+	}{
+		{
+			name:     "nested",
+			input:    "source " + outer,
+			expected: []string{"outer", "inner", "done"},
+		},
+		{
+			name:     "callbacks in other goroutines",
+			input:    "source " + outer,
+			async:    true,
+			expected: []string{"outer", "inner", "done"},
+		},
+		{
+			name:  "loop in other goroutines",
+			input: "source " + loop,
+			async: true,
+			error: loop + ":1: " + loop + " is already being sourced",
+		},
+		{
+			name:     "bad line",
+			input:    "source " + bad,
+			error:    bad + ":2: unexpected word 'bogus' at position 1, expected one of: say, source, repeat, watch",
+			expected: []string{"one"},
+		},
+		{
+			name:     "bad nested line",
+			input:    "source " + badOuter,
+			error:    badOuter + ":2: " + bad + ":2: unexpected word 'bogus' at position 1, expected one of: say, source, repeat, watch",
+			expected: []string{"start", "one"},
+		},
+		{
+			name:  "loop",
+			input: "source " + loop,
+			error: loop + ":1: " + loop + " is already being sourced",
+		},
+		{
+			name:  "missing",
+			input: "source " + filepath.Join(dir, "missing.txt"),
+			error: "open " + filepath.Join(dir, "missing.txt") + ": no such file or directory",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var said []string
+
+			cmds.Add("say <what>", func(match Match, ctx interface{}) {
+				said = append(said, match.Var("what")[0].Value)
+			})
+			err := cmds.InstallBuiltins()
+			if err != nil {
+				t.Fatalf("InstallBuiltins failed: %v", err)
+			}
+			if tc.async {
+				// Run each callback in a goroutine of its own, as middleware may
+				cmds.Use(func(next Callback) Callback {
+					return func(match Match, ctx interface{}) {
+						done := make(chan struct{})
+						go func() {
+							next(match, ctx)
+							close(done)
+						}()
+						<-done
+					}
+				})
+			}
+			cmds.Compile()
+
+			err = builtinError(cmds.ParseErr(tc.input, nil))
+			if tc.error == "" && err != nil {
+				t.Fatalf("source failed when it should succeed. Error: %v", err)
+			}
+			if tc.error != "" && (err == nil || err.Error() != tc.error) {
+				t.Fatalf("Expected error '%s' but got '%v'", tc.error, err)
+			}
+
+			if strings.Join(said, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("Expected %v to be said but %v was", tc.expected, said)
+			}
+		})
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	tests := []struct {
+		name     string
+		posix    bool
+		input    string
+		error    string
+		expected []string
+	}{
+		{"repeat", false, "repeat 3 say hi", "", []string{"hi", "hi", "hi"}},
+		{"quoted words", false, `repeat 2 say "a b"`, "", []string{"a b", "a b"}},
+		{"escaped quotes", false, `repeat 1 say "he said \"hi there\""`, "", []string{`he said "hi there"`}},
+		{"posix backslash", true, `repeat 1 say 'a\b'`, "", []string{`a\b`}},
+		{"nested", false, "repeat 2 repeat 2 say x", "", []string{"x", "x", "x", "x"}},
+		{"zero", false, "repeat 0 say hi", "", nil},
+		{"bad count", false, "repeat -1 say hi", "‘-1’ is not a valid number of times to repeat", nil},
+		{"bad command", false, "repeat 2 bogus", "unexpected word 'bogus' at position 1, expected one of: say, get, source, repeat, watch", nil},
+		{"ambiguous command", false, "repeat 2 get v", "'v' is ambiguous at argument 2: could be keyword 'verbose' or value for <file>", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var said []string
+
+			cmds.Add("say <what>", func(match Match, ctx interface{}) {
+				said = append(said, match.Var("what")[0].Value)
+			})
+			cmds.Add("get verbose", func(match Match, ctx interface{}) {})
+			cmds.Add("get <file>", func(match Match, ctx interface{}) {})
+			cmds.InstallBuiltins()
+			cmds.SetPosixSplitting(tc.posix)
+			cmds.Compile()
+
+			err := builtinError(cmds.ParseErr(tc.input, nil))
+			if tc.error == "" && err != nil {
+				t.Fatalf("The builtin failed when it should succeed. Error: %v", err)
+			}
+			if tc.error != "" && (err == nil || err.Error() != tc.error) {
+				t.Fatalf("Expected the error '%s' but got '%v'", tc.error, err)
+			}
+
+			if strings.Join(said, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("Expected %v to be said but %v was", tc.expected, said)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	var cmds Cmds
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := 0
+	cmds.Add("tick", func(match Match, ctx interface{}) {
+		count++
+		if count == 3 {
+			cancel()
+		}
+	})
+	cmds.InstallBuiltins()
+	cmds.Compile()
+
+	if err := cmds.ParseErr("watch 1ms tick", ctx); err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected the command to run 3 times but it ran %d times", count)
+	}
+
+	if cmds.Parse("repeat x tick", ctx) {
+		t.Fatalf("Parse succeeded with an invalid count")
+	}
+
+	if cmds.Parse("watch soon tick", ctx) {
+		t.Fatalf("Parse succeeded with an invalid duration")
+	}
+
+	if err := builtinError(cmds.ParseErr("watch 1ms bogus", ctx)); !errors.As(err, new(*NoMatchError)) {
+		t.Fatalf("Expected watch to fail on an unknown command but got %v", err)
+	}
+}
+
+// builtinError returns the error of the builtin that ‘err’ returned by ParseErr says
+// failed, or ‘err’ if it isn't a *CallbackError.
+func builtinError(err error) error {
+	if cerr, ok := err.(*CallbackError); ok {
+		return cerr.Err
+	}
+	return err
+}
+
+// TestConcurrentBuiltins checks that builtins run at the same time in different
+// goroutines don't affect each other.
+func TestConcurrentBuiltins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmdparse")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each file sources the next, so that the sourced files nest while the others run
+	var files []string
+	for i := 0; i < 4; i++ {
+		files = append(files, filepath.Join(dir, fmt.Sprintf("%d.txt", i)))
+	}
+	for i, f := range files {
+		contents := "tick\n"
+		if i+1 < len(files) {
+			contents += "source " + files[i+1] + "\n"
+		}
+		if err := ioutil.WriteFile(f, []byte(contents), 0600); err != nil {
+			t.Fatalf("Writing %s failed: %v", f, err)
+		}
+	}
+
+	var cmds Cmds
+	var ticks int32
+	cmds.Add("tick", func(match Match, ctx interface{}) {
+		atomic.AddInt32(&ticks, 1)
+	})
+	cmds.InstallBuiltins()
+	cmds.Compile()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for g := 0; g < n; g++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := cmds.ParseErr("source "+files[0], nil); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := builtinError(cmds.ParseErr("repeat 3 bogus", nil)); !errors.As(err, new(*NoMatchError)) {
+				errs <- fmt.Errorf("repeat returned %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("a builtin failed: %v", err)
+	default:
+	}
+	if ticks != n*int32(len(files)) {
+		t.Fatalf("ticked %d times, expected %d", ticks, n*len(files))
+	}
+}
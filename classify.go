@@ -0,0 +1,105 @@
+package cmdparse
+
+// Classification labels the words of an input with the elements of the command they
+// matched, as returned by Classify.
+type Classification struct {
+	// Syntax is the definition of the command of the interpretation, or empty if no
+	// command matched the start of the input.
+	Syntax string
+	// Complete is true if all of the words matched the command.
+	Complete bool
+	// Words are the input words with what each matched.
+	Words []WordClass
+}
+
+// WordClass is the element of the command that a word matched.
+type WordClass struct {
+	Word string
+	// Element is the keyword, or the variable in angle brackets as in <file>, that the
+	// word matched. It's empty if the word wasn't matched.
+	Element   string
+	IsKeyword bool
+}
+
+// Classify labels each of the already split ‘words’ with the keyword or variable it
+// matched, so that the grammar can be used to turn recorded commands, such as those in
+// logs, into structured records. If the words match more than one command the first one
+// added is used. If they don't match any command completely, the interpretation that
+// matches the most words is used and the words after them are left without an element.
+// Classify doesn't call any callbacks.
+func (c *Cmds) Classify(words []string) Classification {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cl := Classification{Words: make([]WordClass, len(words))}
+	for i, w := range words {
+		cl.Words[i].Word = w
+	}
+
+	matches := c.match(words, ParseOptions{})
+	if len(matches) > 0 {
+		c.sortByAddOrder(matches)
+		cl.Complete = true
+		cl.label(matches[0])
+		return cl
+	}
+
+	// Use the first thread, in the order the commands were added, that matched the most
+	var v vm
+	prog := c.program()
+	pos := len(words)
+	for ; pos > 0; pos-- {
+		v = vm{exactKeywords: c.keywordMatching == ExactMatching, version: c.version}
+		if len(v.expectations(prog, words[:pos])) > 0 {
+			break
+		}
+	}
+	if pos == 0 {
+		return cl
+	}
+
+	partial := make([]match, len(v.expectedBy))
+	for i, t := range v.expectedBy {
+		partial[i] = t.toMatch(nil)
+	}
+	c.sortByAddOrder(partial)
+	cl.label(partial[0])
+	return cl
+}
+
+// label sets the syntax and the elements of the words from the match ‘m’.
+func (cl *Classification) label(m match) {
+	cl.Syntax = m.meta.(*command).syntax
+
+	pos := 0
+	for i, item := range m.items {
+		if pos >= len(cl.Words) {
+			break
+		}
+
+		var elem string
+		words := 1
+		switch w := item.(type) {
+		case keywordValue:
+			elem = w.Name
+			cl.Words[pos].IsKeyword = true
+		case VarValue:
+			elem = "<" + w.Name + ">"
+			if w.Span.Words > 1 {
+				words = w.Span.Words
+			}
+		}
+
+		if m.instrs[i].opcode == opSaveRest {
+			// The variable consumed the rest of the input
+			for ; pos < len(cl.Words); pos++ {
+				cl.Words[pos].Element = elem
+			}
+			break
+		}
+		// A custom instruction may have consumed several words
+		for end := pos + words; pos < end && pos < len(cl.Words); pos++ {
+			cl.Words[pos].Element = elem
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name     string
+		words    []string
+		syntax   string
+		complete bool
+		elements []string
+	}{
+		{"complete", []string{"copy", "a", "b"}, "copy <src> <dst> force?", true, []string{"copy", "<src>", "<dst>"}},
+		{"abbreviated", []string{"co", "a", "b", "f"}, "copy <src> <dst> force?", true, []string{"copy", "<src>", "<dst>", "force"}},
+		{"ambiguous", []string{"get", "verbose"}, "get verbose", true, []string{"get", "verbose"}},
+		{"rest", []string{"run", "ls", "-l"}, "run <cmd:cmdline>", true, []string{"run", "<cmd>", "<cmd>"}},
+		{"partial", []string{"copy", "a", "b", "bogus"}, "copy <src> <dst> force?", false, []string{"copy", "<src>", "<dst>", ""}},
+		{"no match", []string{"bogus", "x"}, "", false, []string{"", ""}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+			cmds.AddType(cmdlineType{})
+			cmds.Add("copy <src> <dst> force?", cback)
+			cmds.Add("get verbose", cback)
+			cmds.Add("get <file>", cback)
+			cmds.Add("run <cmd:cmdline>", cback)
+			cmds.Compile()
+
+			cl := cmds.Classify(tc.words)
+			if cl.Syntax != tc.syntax || cl.Complete != tc.complete {
+				t.Fatalf("Expected syntax ‘%s’ and complete=%v but got ‘%s’ and %v", tc.syntax, tc.complete, cl.Syntax, cl.Complete)
+			}
+
+			var elems []string
+			for i, w := range cl.Words {
+				if w.Word != tc.words[i] {
+					t.Fatalf("Expected word %d to be ‘%s’ but it was ‘%s’", i, tc.words[i], w.Word)
+				}
+				if w.IsKeyword != (w.Element != "" && w.Element[0] != '<') {
+					t.Fatalf("Word %d has the element %s but IsKeyword is %v", i, w.Element, w.IsKeyword)
+				}
+				elems = append(elems, w.Element)
+			}
+			if !reflect.DeepEqual(elems, tc.elements) {
+				t.Fatalf("Expected elements %q but got %q", tc.elements, elems)
+			}
+		})
+	}
+}
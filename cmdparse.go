@@ -1,9 +1,17 @@
 package cmdparse
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
@@ -13,7 +21,7 @@ import (
 // To use Cmds, first call Cmds.Add multiple times to register command definitions and their
 // callbacks, then call Cmds.Compile to compile the parsing VM. Now it's ready to parse
 // user-entered commands. Next call Parse at will to parse a command, and call LongestMatches
-// after a failing Parse if needed.
+// with the same input after a failing Parse if needed.
 //
 // Command definitions use a simple grammar to define the syntax (keywords and variables)
 // in the command. The grammar for the command definitions is:
@@ -21,10 +29,99 @@ import (
 //    command → alternatives EOF
 //    alternatives → terms ( '|' alternatives )?
 //    terms → repetition ( terms )?
-//    repetition → group (  '*' |  '+' |  '?' )?
-//    group → '(' alternatives ')' | term
-//    term → var | WORD
-//    var → '<' WORD (':' WORD)? '>'
+//    repetition → group (  '*' |  '+' |  '?' | count )?
+//    count → '{' NUMBER ( ',' NUMBER? )? '}'
+//    group → '(' alternatives ')' ( ':' WORD )? | set | term
+//    set → '{' repetition+ '}'
+//    term → var | '!'? WORD aliases?
+//    aliases → '(' WORD ( '|' WORD )* ')'
+//    var → '<' WORD (':' ( WORD | enum ))? ( '!' WORD )* '>' | '<' WORD ':' '@' WORD enum? '>'
+//    enum → '(' WORD ( '|' WORD )* ')'
+//
+// The word after the colon in a variable is its type. A variable without a type has the
+// type str, which matches any word. Variables of the types int, float, bool, list, map,
+// json, hex and base64 only match words that are valid values of the type, and the
+// decoded value is available in the VarValue of a match. Variables of the types freq, as
+// in ‘2.4GHz’, and bandwidth, as in ‘100Mbps’, match numbers with units and convert them
+// to Hz and bit/s; AddUnitType adds more such types. A variable of the type expr
+// matches the rest of the input when it's an expression, such as ‘len > 64 && !done’,
+// which is available already parsed; see Expr. A variable of the type rest, as in
+// ‘comment <text:rest>’, matches the rest of the input as one value, which is the text as
+// it was entered including its spacing and any quotes. More types can be added using
+// AddType.
+//
+// The type may instead list the values the variable matches, as in <mode:(fast|slow)>.
+// The values must be entered in full, and are completed by Complete. Unlike writing the
+// values as alternative keywords, the value entered is bound to the variable.
+//
+// A type that begins with @, as in <from:@city> or <title:@catalog(films|series)>, names a
+// custom Instruction added with AddInstruction, which decides how many words the variable
+// matches. The words in parentheses are the arguments of the instruction.
+//
+// A variable may be followed by flags that tell an interactive frontend how to treat it.
+// The flag ‘prompt’ marks a variable that should be asked for, and ‘secret’ marks a
+// variable that should be entered with hidden echo and never be recorded, for example
+// <password:str!secret>. The flag ‘sensitive’ marks a variable whose value should be
+// replaced by a placeholder wherever the input is recorded; secret variables are always
+// sensitive. The flag ‘nokeyword’ makes a variable not match a word that is exactly a
+// keyword that could be matched at the same position, so that in
+//
+//    get verbose
+//    get <file!nokeyword>
+//
+// the input ‘get verbose’ runs the first command rather than being ambiguous. The flags
+// are available in the VarValue of a match.
+//
+// A flag may instead list words in parentheses that the variable doesn't match, so that a
+// variable doesn't take a word reserved for a keyword that follows it, as in
+//
+//    delete <name!(all|none)>* (all | none)?
+//
+// where ‘delete all’ matches the keyword and not a name. Unlike ‘nokeyword’ the words are
+// excluded wherever the variable is, and must be entered exactly to be excluded.
+//
+// A count repeats what precedes it a number of times: ‘<ip:int>{4}’ matches exactly four
+// ints, ‘<arg>{1,3}’ matches one to three words and ‘<arg>{2,}’ matches two or more.
+// The brace of a count directly follows what it repeats.
+//
+// A set lists options in braces that may be entered in any order, each at most once, as
+// in
+//
+//    copy <src> <dst> { verbose? force? limit <n:int>? }
+//
+// which matches ‘copy a b force limit 5 verbose’ and ‘copy a b limit 5’. Each keyword or
+// group begins an option, and variables belong to the option before them, so ‘limit
+// <n:int>’ is one option. An option ending with ‘?’ may be left out, and the others must
+// be entered; to make only a variable of an option optional, put the option in
+// parentheses, as in ‘(limit <n:int>?)?’. The brace of a set follows a space. A set may
+// have at most 32 options.
+//
+// A group may be named by following it with a colon and a name, as in
+//
+//    get (from <host>):src?
+//
+// and the keywords and variables it matched are returned by Match.Group.
+//
+// A keyword may be written in double quotes, in which case it can contain spaces and any
+// other characters, as in ‘say "hello world"’. The input must then quote the keyword too
+// so that it's a single word. Within quotes, and in keywords that aren't quoted, a
+// backslash makes the next character part of the keyword, as in ‘a\|b’ or ‘"say \"hi\""’.
+//
+// A keyword may be followed directly by !alias and other spellings of it in parentheses,
+// its aliases, as in
+//
+//    remove!alias(rm|del) <file>
+//
+// which matches ‘remove a’, ‘rm a’ and ‘del a’. Whichever is entered, the match reports
+// the keyword, so callbacks don't need to handle each spelling; compare (remove|rm|del),
+// where each alternative is a keyword of its own, and remove(rm|del), which is ‘remove’
+// followed by one of the keywords ‘rm’ and ‘del’. Alias adds aliases to a keyword in all
+// the commands.
+//
+// A keyword may be abbreviated to any prefix of it in the input, unless it's preceded by
+// a ‘!’, as in ‘!delete’, in which case it must be entered in full. This guards
+// destructive commands against accidental abbreviations while leaving the others easy to
+// type. SetKeywordMatching requires all keywords to be entered in full.
 //
 // For example the following syntax defines a command that would match ‘load’, ‘load file.txt’, and ‘load file.txt other.txt’:
 //
@@ -32,21 +129,145 @@ import (
 //
 // If a command is matched the command handler is called with the match from which it can extract
 // the matched variables.
+//
+// Once compiled, Cmds may be used to parse input from many goroutines at once, and commands
+// may be added with Add, AddNamed and AddBound, or removed with Remove, while that input is
+// parsed; each input is matched against the commands as they were when it was parsed. The
+// other settings, such as the types and the resolver, must be set before parsing starts.
 type Cmds struct {
-	parseTree interface{}
-	prog      prog
-	trace     io.Writer
+	// mu guards the commands and what is built from them: the parse tree, the program and
+	// the index. Callbacks and resolvers are called without it held.
+	mu sync.RWMutex
+	// compileMu guards compiling commands and the program when lazy compilation is
+	// enabled, which happens while mu is only held for reading.
+	compileMu sync.Mutex
+	// compiled is set once Compile has been called, after which adding or removing a
+	// command updates the program
+	compiled bool
+
+	parseTree   interface{}
+	prog        prog
+	trace       io.Writer
+	pprofLabels bool
+
+	maxAmbiguity int
+	types        map[string]Type
+	instructions map[string]Instruction
+
+	completionLess CompletionLess
+	posixWords     bool
+	listLiterals   bool
+	jsonLiterals   bool
+	controlChars   ControlCharacters
+
+	// varCompleters and typeCompleters list the values of variables by name and by type
+	varCompleters  map[string]VarCompleter
+	typeCompleters map[string]VarCompleter
+
+	// commands are the registered commands in the order they were added
+	commands []*command
+	// avoidKeywords is set when no variable matches a word that is exactly a keyword
+	avoidKeywords bool
+	// keywordMatching is how input words are compared to every keyword
+	keywordMatching KeywordMatching
+	// aliases are the aliases of keywords added with Alias, by keyword
+	aliases map[string][]string
+	// resolver chooses the command to run for ambiguous input
+	resolver Resolver
+	// collisionPolicy is what happens when input matches more than one command
+	collisionPolicy CollisionPolicy
+	// preferences choose between the matches of ambiguous input
+	preferences []MatchPreference
+	// version is the version of the software the commands are running for
+	version string
+	// middleware wraps the callbacks of every command
+	middleware []Middleware
+	// helpHandler is called for input that ends with a ‘?’ word and doesn't match
+	helpHandler HelpHandler
+	// keywordHelp are the descriptions of keywords set with SetKeywordHelp
+	keywordHelp map[string]string
+	// recorder, if set, is passed the commands to run instead of calling their callbacks
+	recorder Recorder
+	// repetitionGuard is called before running a command that binds more than
+	// repetitionLimit values to a variable
+	repetitionGuard RepetitionGuard
+	repetitionLimit int
+	// matchBudget and callbackBudget are how long matching and callbacks may take before
+	// slowHandler is called
+	matchBudget    time.Duration
+	callbackBudget time.Duration
+	slowHandler    SlowInputHandler
+	// profiles are the profiles defined with SetProfile
+	profiles map[string]ParseOptions
+	// lazy is set when each command is compiled separately when it's first needed
+	lazy bool
+	// lazyConversion is set when values are converted when the callback asks for them
+	lazyConversion bool
+	// index finds the commands that may match an input by its first word
+	index *firstWordIndex
+	// optimized is set by Optimize, after which trie finds the commands that may match an
+	// input by its leading keywords
+	optimized bool
+	trie      *keywordTrie
+	// vms are VMs kept between matches so that their threads and buffers are reused
+	vms sync.Pool
+	// scanners are input scanners kept between calls so that their word buffer is reused
+	scanners sync.Pool
+	// stats are the counts returned by Stats, guarded by statsMu since Parse may be
+	// called from many goroutines
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// callState is the state of a call to Parse that the calls nested in its callback build
+// on. It's passed down to the builtins and the calls they make, and to the other
+// callbacks in the context they're passed. It isn't changed once made, so a callback may
+// use it from any goroutine.
+type callState struct {
+	// depth is the number of callbacks the call is nested in
+	depth int
+	// sourcing is the stack of files being run by the source builtin
+	sourcing []string
+}
+
+// nested returns the state of the calls made by the callback of the call ‘s’, which is
+// nil for a call that isn't nested in another.
+func (s *callState) nested() *callState {
+	if s == nil {
+		return &callState{depth: 1}
+	}
+	return &callState{depth: s.depth + 1, sourcing: s.sourcing}
 }
 
 // Add registers the command definition ‘cmd’. When this command is matched, the
 // callback ‘cback’ is called.
 func (c *Cmds) Add(cmd string, cback Callback) error {
+	return c.AddWithHelp(cmd, "", cback)
+}
+
+// AddNamed registers the command definition ‘cmd’ with the identifier ‘id’ instead of a
+// callback. Use ParseToMatch to find out which named command input matches; Parse
+// succeeds for named commands without doing anything.
+func (c *Cmds) AddNamed(id string, cmd string) error {
+	t, err := c.scanAndParse(cmd)
+	if err != nil {
+		return err
+	}
+
+	c.addCommand(&command{id: id, syntax: cmd, tree: t})
+	return nil
+}
+
+// AddWithHelp is like Add, but also sets the help text of the command, which is returned
+// by Describe and Commands. The help may be written in the markdown understood by
+// RenderHelp.
+func (c *Cmds) AddWithHelp(cmd, help string, cback Callback) error {
 	// Each command that Add is passed is added as a branch in an alternative (alt)
 	// at the top level of a parse tree. After all the commands are added we have a
 	// parse tree that represents that any of the commands can cause a match:
 	//      command1 | command2 | ...
-	// Just below each alternative we add a metadata node that contains the callback
-	// to call if that command is matched. That metadata node when compiled updates
+	// Just below each alternative we add a metadata node that contains the command,
+	// including the callback to call if that command is matched. That metadata node when compiled updates
 	// the metadata register stored in the thread.
 
 	t, err := c.scanAndParse(cmd)
@@ -54,11 +275,68 @@ func (c *Cmds) Add(cmd string, cback Callback) error {
 		return err
 	}
 
-	c.addParseTree(t, cback)
-
+	c.addCommand(&command{syntax: cmd, help: help, cback: cback, tree: t})
 	return nil
 }
 
+// addCommand registers ‘added’. If the commands are already compiled only the new command
+// is compiled, and then linked with the others.
+func (c *Cmds) addCommand(added *command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.aliases) > 0 {
+		added.tree, _ = withAliases(added.tree, c.aliases)
+	}
+	c.commands = append(c.commands, added)
+	c.addParseTree(added.tree, added)
+	c.relink()
+}
+
+// Remove removes the command with the identifier ‘id’ given to AddNamed, or for commands
+// without an identifier, whose definition is ‘id’ exactly as it was passed to Add. If
+// more than one command has it the last one added is removed. Input parsed after Remove
+// returns no longer matches the command; the other commands aren't recompiled.
+func (c *Cmds) Remove(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := len(c.commands) - 1; i >= 0; i-- {
+		cmd := c.commands[i]
+		if cmd.id != id && (cmd.id != "" || cmd.syntax != id) {
+			continue
+		}
+
+		c.commands = append(c.commands[:i:i], c.commands[i+1:]...)
+		c.parseTree = nil
+		for _, cmd := range c.commands {
+			c.addParseTree(cmd.tree, cmd)
+		}
+		c.relink()
+		return nil
+	}
+	return fmt.Errorf("there is no command ‘%s’", id)
+}
+
+// relink rebuilds the indexes and program after the commands changed, if they were
+// compiled. The commands that aren't compiled yet are compiled unless compilation is lazy.
+func (c *Cmds) relink() {
+	if !c.compiled {
+		return
+	}
+
+	c.index = newFirstWordIndex(c.commands)
+	if c.optimized {
+		c.trie = newKeywordTrie(c.commands)
+	}
+	if c.lazy {
+		c.prog = prog{}
+		return
+	}
+	c.compileCommands(c.commands)
+	c.prog = link(c.commands)
+}
+
 func (c *Cmds) scanAndParse(cmd string) (tree interface{}, err error) {
 	var s scanner
 	tokens, ok := s.Scan(cmd)
@@ -72,10 +350,10 @@ func (c *Cmds) scanAndParse(cmd string) (tree interface{}, err error) {
 	return
 }
 
-func (c *Cmds) addParseTree(tree interface{}, cback Callback) {
+func (c *Cmds) addParseTree(tree interface{}, cmd *command) {
 	var m meta
 	m.ch = tree
-	m.data = cback
+	m.data = cmd
 	if c.parseTree == nil {
 		c.parseTree = m
 	} else {
@@ -83,6 +361,62 @@ func (c *Cmds) addParseTree(tree interface{}, cback Callback) {
 	}
 }
 
+// command is a registered command. It's the data of the meta node above the command's
+// parse tree.
+type command struct {
+	// id is the identifier of a command added with AddNamed
+	id     string
+	syntax string
+	help   string
+	cback  Callback
+	// binder calls the handler of a command added with AddBound
+	binder *binder
+	// tree is the parse tree of the command, without the meta node
+	tree interface{}
+	// prog is the program that matches only this command. It's compiled when it's first
+	// needed if lazy compilation is enabled.
+	prog prog
+	// span is the range of the command's instructions in the program for all the commands.
+	// It's set by link, which runs under compileMu when lazy compilation is enabled, so it's
+	// read with spanOf.
+	span ProgramRange
+	// examples are the example inputs added with AddExample
+	examples []string
+	// grammars are the names of the grammars the command is in. When nil the command is
+	// in every grammar.
+	grammars map[string]bool
+	// priority is the priority of the command for the HighestPriorityWins policy
+	priority int
+	// groupPath are the prefixes of the groups the command was added in
+	groupPath []string
+	// constraints are the relations between variables added with AddConstraint
+	constraints []varConstraint
+	// validator checks matches of the command before its callback is called
+	validator Validator
+	// rcback is the callback of a command added with AddWithResult
+	rcback ResultCallback
+	// ccback is the callback of a command added with AddWithContext
+	ccback ContextCallback
+	// ecback is the callback of a builtin command, whose error is returned like that of
+	// a ContextCallback. It's passed the state of the calls it makes.
+	ecback func(match Match, ctx interface{}, call *callState) error
+	// middleware wraps the callback of the command, inside the middleware of the Cmds
+	middleware []Middleware
+	// versions are the versions the command is available in, and groupVersions those its
+	// named groups are available in
+	versions      versionRange
+	groupVersions map[string]versionRange
+}
+
+func (c *command) String() string {
+	return c.syntax
+}
+
+// inGrammar returns true if the command is matched when the grammar ‘name’ is selected.
+func (c *command) inGrammar(name string) bool {
+	return c.grammars == nil || c.grammars[name]
+}
+
 // Callback is a function that gets called when Cmds.Parse succeeds. It is called with
 // a Match representing the parsed command.
 type Callback func(match Match, ctx interface{})
@@ -94,8 +428,38 @@ type Match interface {
 	// from the command. If no variables were found that match the name an empty slice
 	// is returned.
 	Var(name string) (value []*VarValue)
+	// VarIter returns an iterator over the values of the variables with the name ‘name’,
+	// in the order they were entered. Unlike Var it doesn't make a slice of all of them,
+	// so commands that bind thousands of values can process them, or a page of them,
+	// without a copy of each.
+	VarIter(name string) *VarIterator
+	// VarCount returns the number of values of the variables with the name ‘name’.
+	VarCount(name string) int
 	// KeywordPresent retuurns true if the keyword ‘name’ was entered in the input.
 	KeywordPresent(name string) bool
+	// Keywords returns the keywords that were entered, in the order they were entered,
+	// with where each is in the input.
+	Keywords() []Keyword
+	// Map collects the values of all the variables with the name ‘name’ and the type
+	// map into a map. Each value is a key=value pair; when a key appears more than once
+	// the last value wins. If no variables were found an empty map is returned.
+	Map(name string) map[string]string
+	// Redacted returns the matched input with the values of sensitive variables replaced
+	// by a placeholder. This is the form of the command that should be stored in
+	// history or sent to telemetry.
+	Redacted() string
+	// Group returns the keywords and variables matched by the group named ‘name’, and
+	// whether the group was matched. If the group was matched more than once, because it's
+	// repeated, the returned Match contains what was matched each time.
+	Group(name string) (group Match, ok bool)
+	// GroupPath returns the prefixes of the CommandGroups the matched command was added
+	// in, outermost first, or nil if it wasn't added in a group.
+	GroupPath() []string
+	// Syntax returns the definition of the matched command as it was passed to Add.
+	Syntax() string
+	// ID returns the identifier the matched command was added with using AddNamed, or
+	// empty if it has none.
+	ID() string
 }
 
 // meta is used as a node in the parse tree that applies metadata to it's child
@@ -123,39 +487,909 @@ func (s ScanError) Error() string {
 	return buf.String()
 }
 
-// Compile the registered commands into a VM.
-func (c *Cmds) Compile() {
-	var cmp compiler
-	cmp.compile(c.parseTree)
-	c.prog = cmp.prog()
+// AddPattern adds the variable type ‘typ’ whose values are matched by the regular
+// expression ‘expr’. A variable with a pattern type consumes all the remaining words of
+// the input, which are joined with single spaces and must match ‘expr’ entirely. The values
+// of the capture groups are available in VarValue.Groups. Patterns are an escape hatch for
+// syntax that can't be expressed using words, for example:
+//
+//    cmds.AddPattern("assignment", `(\w+)\s*=\s*(.*)`)
+//    cmds.Add("let <a:assignment>", cback)
+//
+// Patterns must be added before Compile is called.
+func (c *Cmds) AddPattern(typ, expr string) error {
+	re, err := regexp.Compile(`^(?:` + expr + `)$`)
+	if err != nil {
+		return err
+	}
+
+	c.AddType(patternType{name: typ, re: re})
+	return nil
+}
+
+// AddJSONType adds the variable type ‘typ’ whose values are JSON that decodes into a value
+// of the same Go type as ‘example’. Only input that decodes successfully matches, and a
+// pointer to the decoded value is available in VarValue.Converted. For example:
+//
+//    cmds.AddJSONType("user", User{})
+//    cmds.Add("create <u:user>", cback)
+//
+// JSON types must be added before Compile is called.
+func (c *Cmds) AddJSONType(typ string, example interface{}) {
+	c.AddType(jsonGoType{name: typ, typ: reflect.TypeOf(example)})
+}
+
+// RegisterType adds the variable type ‘typ’ whose values are checked by ‘validate’, which
+// returns the converted value to make available in VarValue.Converted, or an error if the
+// word isn't a valid value. A word that fails validation doesn't match the variable, so
+// another interpretation of the input can match instead. For example:
+//
+//    cmds.RegisterType("ipv4", func(s string) (interface{}, error) {
+//        ip := net.ParseIP(s).To4()
+//        if ip == nil {
+//            return nil, fmt.Errorf("‘%s’ is not an IPv4 address", s)
+//        }
+//        return ip, nil
+//    })
+//    cmds.Add("ping <addr:ipv4>", cback)
+//
+// Types must be registered before Compile is called.
+func (c *Cmds) RegisterType(typ string, validate func(string) (interface{}, error)) {
+	c.AddType(funcType{name: typ, validate: validate})
+}
+
+// AddType adds the variable type ‘t’, which is used by variables whose type is t.Name().
+// A type added with AddType replaces a built-in type with the same name. Types must be
+// added before Compile is called.
+func (c *Cmds) AddType(t Type) {
+	if c.types == nil {
+		c.types = make(map[string]Type)
+	}
+	c.types[t.Name()] = t
+}
+
+// Compile the registered commands into a VM. The commands are compiled concurrently, so
+// compiling thousands of commands makes use of all the CPUs; the resulting program doesn't
+// depend on the order they finish in.
+//
+// Compile returns warnings about command definitions that are likely to be mistakes, such
+// as an alternative that is an abbreviation of another, but that can still be used, and
+// about examples added with AddExample that don't match their command. They can be logged
+// or ignored; use Analyze for a more thorough check.
+//
+// Compile doesn't return an error for commands that can't be used; CompileStrict does.
+// Programs range over the warnings Compile returns, which a second result would break,
+// and the checks try the paths through every command, which takes much longer than
+// compiling them and would compile the commands that lazy compilation leaves until
+// they're needed.
+//
+// Compile only needs to be called once. Commands added after it are compiled when they
+// are added, and linked with the others that are already compiled.
+func (c *Cmds) Compile() (warnings Warnings) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		warnings = append(warnings, cmd.warnings(c.keywordMatching == ExactMatching)...)
+		warnings = append(warnings, c.instructionWarnings(cmd)...)
+	}
+
+	// The commands are compiled separately, which can be done concurrently, and then
+	// linked into one program
+	c.compiled = true
+	c.relink()
+
+	warnings = append(warnings, c.exampleWarnings()...)
+	if c.collisionPolicy == ReportCollisions {
+		warnings = append(warnings, c.collisionWarnings(nil)...)
+	}
 	return
 }
 
+func (c *Cmds) compileTree(tree interface{}) prog {
+	var cmp compiler
+	cmp.types = c.types
+	cmp.instructions = c.instructions
+	cmp.compile(tree)
+	return cmp.prog()
+}
+
+// program returns the program that matches all the commands. When lazy compilation is
+// enabled it's compiled the first time it's needed.
+func (c *Cmds) program() prog {
+	if !c.lazy {
+		return c.prog
+	}
+
+	c.compileMu.Lock()
+	defer c.compileMu.Unlock()
+	if c.prog.instrs == nil {
+		c.compileCommands(c.commands)
+		c.prog = link(c.commands)
+	}
+	return c.prog
+}
+
+// spanOf returns the span of ‘cmd’ in the program returned by program. It takes
+// compileMu, since with lazy compilation the span is set while mu is only held for
+// reading.
+func (c *Cmds) spanOf(cmd *command) ProgramRange {
+	c.compileMu.Lock()
+	defer c.compileMu.Unlock()
+	return cmd.span
+}
+
 // TraceExecutionTo sets the Writer to which execution logs are printed
 // when Parse is called.
 func (c *Cmds) TraceExecutionTo(w io.Writer) {
 	c.trace = w
 }
 
+// SetPosixSplitting sets whether the input to Parse is split into words following the
+// rules of a POSIX shell. When enabled, single quotes, backslash escapes and the
+// concatenation of adjacent quoted parts such as "a"'b'c behave as they do in sh, so
+// commands copied from shell scripts are split the same way. When disabled, the default,
+// only double quotes are special: a word may be quoted with them to contain spaces, and
+// within them \", \\, \n and \t stand for a double quote, a backslash, a newline and a
+// tab. The default deliberately leaves out single quotes, so that words such as don't can
+// be entered as they are, and the concatenation of quoted parts such as "foo"'bar': a
+// double quote only starts a quoted word at the beginning of a word. Either way, input
+// with an unterminated quote doesn't match any command.
+func (c *Cmds) SetPosixSplitting(enable bool) {
+	c.posixWords = enable
+}
+
+// SetListLiterals sets whether list literals such as [a, b, "c d"] in the input to Parse
+// are recognized. A list literal is a single word even if it contains spaces, and is
+// matched by variables with a list type. The type ‘list’ is a list of str, and a list
+// whose elements must be of another type is written as ‘list-’ followed by the element
+// type, for example:
+//
+//    set ports <ports:list-int>
+//
+// Elements are separated by commas and may be double-quoted. The element types are str,
+// int, float and bool. The elements are available in VarValue.Elems.
+//
+// Attributes can instead be given as repeated key=value words using the map type, as in
+// ‘set attrs <kv:map>*’, which doesn't need list literals to be enabled. Match.Map
+// collects them into a map.
+func (c *Cmds) SetListLiterals(enable bool) {
+	c.listLiterals = enable
+}
+
+// SetJSONLiterals sets whether JSON objects such as {"name": "a b"} in the input to Parse
+// are recognized. A JSON object is a single word even if it contains spaces. Variables of
+// the type ‘json’ match any valid JSON value, which is available in VarValue.Converted as
+// a json.RawMessage. JSON can also be given as a quoted word without enabling this.
+func (c *Cmds) SetJSONLiterals(enable bool) {
+	c.jsonLiterals = enable
+}
+
+// SetVariablesAvoidKeywords sets whether variables never match a word that is exactly a
+// keyword that could be matched at the same position, as if every variable had the flag
+// ‘nokeyword’. This removes the ambiguity between a keyword and a variable that follow the
+// same words, as in ‘get verbose’ and ‘get <file>’, without rewriting the grammar. It
+// doesn't apply to variables whose type consumes the rest of the input.
+func (c *Cmds) SetVariablesAvoidKeywords(enable bool) {
+	c.avoidKeywords = enable
+}
+
+// KeywordMatching is how words in the input are compared to keywords.
+type KeywordMatching int
+
+const (
+	// PrefixMatching lets a keyword be abbreviated to any prefix of it, except for
+	// keywords marked with a ‘!’ in the command definition.
+	PrefixMatching KeywordMatching = iota
+	// ExactMatching requires every keyword to be entered in full.
+	ExactMatching
+)
+
+func (m KeywordMatching) String() string {
+	switch m {
+	case PrefixMatching:
+		return "prefix"
+	case ExactMatching:
+		return "exact"
+	}
+	return "<unknown>"
+}
+
+// SetKeywordMatching sets how words in the input are compared to keywords by Parse and
+// the other functions that match input. The default is PrefixMatching. ExactMatching has
+// the same effect as ParseOptions.ExactKeywords for every call.
+func (c *Cmds) SetKeywordMatching(m KeywordMatching) {
+	c.keywordMatching = m
+}
+
+// SetMaxAmbiguity makes Parse stop matching as soon as more than ‘n’ interpretations of
+// the input are found, rather than finding all of them. This bounds the work done for
+// grammars where many commands overlap. Zero, the default, means there is no limit.
+func (c *Cmds) SetMaxAmbiguity(n int) {
+	c.maxAmbiguity = n
+}
+
+// LabelProfiles sets whether Parse applies pprof labels while it runs. When enabled, the
+// label ‘cmdparse’ is set to ‘match’ while the input is matched and to ‘callback’ while
+// the callback runs, so that CPU profiles can tell the two apart. Labels are not applied
+// when the package is built with TinyGo, which doesn't support pprof.
+func (c *Cmds) LabelProfiles(enable bool) {
+	c.pprofLabels = enable
+}
+
+// maxParseDepth is the most calls to Parse that may be nested by callbacks calling Parse.
+const maxParseDepth = 32
+
+// ParseOptions change how the input is matched by a single call to ParseWithOptions.
+type ParseOptions struct {
+	// ExactKeywords requires each keyword to be entered in full. Normally any prefix of a
+	// keyword matches it, so that keywords can be abbreviated. Scripts should use exact
+	// keywords so that they keep working when commands are added that would make their
+	// abbreviations ambiguous.
+	ExactKeywords bool
+	// Grammar limits the commands that are matched to those in the grammar with this
+	// name, as set with SetGrammars. When empty all the commands are matched.
+	Grammar string
+
+	// ctx, if set, stops matching when it's cancelled. It's set by ParseContext.
+	ctx context.Context
+	// call is the state of the call whose callback is making this one, or nil
+	call *callState
+}
+
+// The names of the predefined profiles.
+const (
+	// InteractiveProfile is the lenient profile for input typed by a user. Keywords
+	// may be abbreviated.
+	InteractiveProfile = "interactive"
+	// StrictProfile is the profile for scripts and automated pipelines. Keywords must be
+	// entered in full.
+	StrictProfile = "strict"
+)
+
+// builtinProfiles are the predefined profiles.
+var builtinProfiles = map[string]ParseOptions{
+	InteractiveProfile: {},
+	StrictProfile:      {ExactKeywords: true},
+}
+
+// SetProfile defines the profile ‘name’ as ‘opts’, replacing any profile with the same
+// name including the predefined profiles. Profiles let one Cmds serve both interactive
+// sessions and automated pipelines by selecting the ParseOptions for each call by name.
+func (c *Cmds) SetProfile(name string, opts ParseOptions) {
+	if c.profiles == nil {
+		c.profiles = make(map[string]ParseOptions)
+	}
+	c.profiles[name] = opts
+}
+
+// Profile returns the options of the profile ‘name’ to pass to ParseWithOptions, and
+// whether the profile exists. The profiles InteractiveProfile and StrictProfile are
+// always defined.
+func (c *Cmds) Profile(name string) (opts ParseOptions, ok bool) {
+	if opts, ok = c.profiles[name]; ok {
+		return
+	}
+	opts, ok = builtinProfiles[name]
+	return
+}
+
 // Parse attempts to parse the user-entered text ‘cmd’. If the input matches one of
 // the commands registered by Add it returns true.
+//
+// A callback may call Parse itself, for example to implement a command that runs another
+// command. Such calls may be nested at most 32 deep, after which Parse returns false, so
+// that commands that end up running themselves don't recurse forever. The calls are
+// counted through their context: when ‘ctx’ is a context.Context, the callback is passed
+// a context derived from it that records how deeply it's nested, and calls made with
+// that context count towards the limit from whichever goroutine they are made. The
+// commands run by the builtins and by the callbacks of AddWithContext, with the context
+// they're passed, are counted the same way. Calls passed another ‘ctx’ can't be told
+// apart from calls that aren't nested, so they start counting again.
 func (c *Cmds) Parse(cmd string, ctx interface{}) (ok bool) {
-	var s cmdScanner
-	toks := s.Scan(cmd)
+	return c.ParseWithOptions(cmd, ctx, ParseOptions{})
+}
+
+// ParseWithOptions is like Parse, but matches the input according to ‘opts’.
+func (c *Cmds) ParseWithOptions(cmd string, ctx interface{}, opts ParseOptions) (ok bool) {
+	ok, _, _, _, err := c.run(cmd, ctx, opts)
+	return ok && err == nil
+}
 
-	var v vm
-	v.traceWriter = c.trace
+// ParseWithMatch is like Parse, but also returns the command that was run and what it
+// matched, after its callback has returned, so that the caller can log or post-process
+// what ran without passing it through ‘ctx’. The MatchInfo is empty when ok is false, and
+// when the input was a request for help passed to the handler set with
+// SetHelpOnQuestionMark.
+func (c *Cmds) ParseWithMatch(cmd string, ctx interface{}) (info MatchInfo, ok bool) {
+	ok, matches, _, _, err := c.run(cmd, ctx, ParseOptions{})
+	if !ok || err != nil {
+		return MatchInfo{}, false
+	}
+	if len(matches) == 1 {
+		info = matchInfo(matches[0])
+	}
+	return info, true
+}
+
+// ParseErr is like Parse, but returns why the input wasn't run rather than false. If the
+// input has no words and no command matches it an *EmptyInputError is returned, if it
+// doesn't match any command a *NoMatchError is returned, or a *ConstraintError if only a
+// constraint added with AddConstraint stops it matching, and if it matches more than one
+// and a resolver doesn't choose one an *AmbiguityError is returned. Errors splitting the
+// input into words, binding the values of a command added with AddBound, and from the
+// resolver are returned as they are, errors from a validator set with SetValidator
+// are returned as a *ValidationError, and errors from the callback of a command added with
+// AddWithContext are returned as a *CallbackError.
+func (c *Cmds) ParseErr(cmd string, ctx interface{}) error {
+	return c.ParseErrWithOptions(cmd, ctx, ParseOptions{})
+}
+
+// ParseErrWithOptions is like ParseErr, but matches the input according to ‘opts’.
+func (c *Cmds) ParseErrWithOptions(cmd string, ctx interface{}, opts ParseOptions) error {
+	_, _, err := c.parseErr(cmd, ctx, opts)
+	return err
+}
+
+// ParseWithResult is like ParseErr, but also returns the command that was run, like
+// ParseWithMatch, and the Result returned by its callback. The Result is empty, which is
+// success, for commands whose callback doesn't return one.
+func (c *Cmds) ParseWithResult(cmd string, ctx interface{}) (info MatchInfo, res Result, err error) {
+	var matches []match
+	matches, res, err = c.parseErr(cmd, ctx, ParseOptions{})
+	if err == nil && len(matches) == 1 {
+		info = matchInfo(matches[0])
+	}
+	return
+}
+
+// parseErr runs the input ‘cmd’ like ParseErrWithOptions, and also returns the matches
+// and the Result of the callback.
+func (c *Cmds) parseErr(cmd string, ctx interface{}, opts ParseOptions) ([]match, Result, error) {
+	ok, matches, toks, res, err := c.run(cmd, ctx, opts)
+	switch {
+	case err != nil:
+		return nil, res, err
+	case ok:
+		return matches, res, nil
+	case len(matches) == 0 && len(toks) == 0:
+		return nil, res, &EmptyInputError{}
+	case len(matches) == 0:
+		return nil, res, &NoMatchError{c.LongestMatches(cmd)}
+	default:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return nil, res, c.ambiguityOf(toks, matches)
+	}
+}
+
+// run matches the input ‘cmd’ and, if it matches exactly one command, calls its callback.
+// ok is true if a callback was called or the input was a request for help. Otherwise the
+// matches and input words are returned so that the caller can describe why the input
+// wasn't run. res is the Result returned by the callback, if it returns one.
+func (c *Cmds) run(cmd string, ctx interface{}, opts ParseOptions) (ok bool, matches []match, toks []string, res Result, err error) {
+	parent := opts.call
+	if parent == nil {
+		parent = callOf(ctx)
+	}
+	if parent != nil && parent.depth >= maxParseDepth {
+		err = fmt.Errorf("commands are nested more than %d deep", maxParseDepth)
+		return
+	}
+
+	matches, toks, err = c.matchInput(cmd, opts)
+	if err == nil && len(matches) == 0 && c.isHelpRequest(toks) {
+		c.mu.RLock()
+		m := c.longestMatchOf(toks[:len(toks)-1])
+		c.mu.RUnlock()
+		c.helpHandler(m, ctx)
+		ok = true
+		return
+	}
+	if err != nil || len(matches) != 1 {
+		return
+	}
+
+	mm := matches[0]
+	if err = validate(mm); err != nil {
+		return
+	}
+	if err = c.guardRepetitions(cmd, mm); err != nil {
+		return
+	}
+	matched := mm.meta.(*command)
+	cback := matched.cback
+	if b := matched.binder; b != nil {
+		var args reflect.Value
+		if args, err = b.bind(cmdMatch(mm)); err != nil {
+			return
+		}
+		cback = func(match Match, ctx interface{}) { res = b.call(args, ctx) }
+	}
+	if rcback := matched.rcback; rcback != nil {
+		cback = func(match Match, ctx interface{}) { res = rcback(match, ctx) }
+	}
+	call := parent.nested()
+	if ecback := matched.ecback; ecback != nil {
+		cback = func(match Match, ctx interface{}) {
+			if cerr := ecback(match, ctx, call); cerr != nil {
+				err = &CallbackError{Syntax: matched.syntax, Err: cerr}
+			}
+		}
+	}
+	if ccback := matched.ccback; ccback != nil {
+		cback = func(match Match, ctx interface{}) {
+			if cerr := ccback(withCall(contextOf(ctx), call), match); cerr != nil {
+				err = &CallbackError{Syntax: matched.syntax, Err: cerr}
+			}
+		}
+	}
+	ok = true
+	if cback == nil {
+		// The command was added with AddNamed
+		return
+	}
+
+	c.mu.RLock()
+	rec := c.recorder
+	c.mu.RUnlock()
+	if rec != nil {
+		cback = recorded(rec, mm)
+	}
+
+	cback = c.wrap(matched, cback)
+	if cctx, ok := ctx.(context.Context); ok {
+		ctx = withCall(cctx, call)
+	}
+	start := time.Now()
+	c.withLabel("callback", func() {
+		cback(cmdMatch(mm), ctx)
+	})
+	if c.trace != nil {
+		fmt.Fprintf(c.trace, "trace: timing: callback took %v\n", time.Since(start))
+	}
+	c.checkBudget(CallbackPhase, start, cmd, toks, matched)
+	return
+}
+
+// EmptyInputError is the error returned by ParseErr when the input has no words and no
+// command matches it.
+type EmptyInputError struct{}
+
+func (e *EmptyInputError) Error() string {
+	return "empty input"
+}
+
+// NoMatchError is the error returned when input doesn't match any command. It describes
+// how far the input could be matched.
+type NoMatchError struct {
+	LongestMatch
+}
+
+func (e *NoMatchError) Error() string {
+	return e.LongestMatch.String()
+}
+
+// ParseToMatch matches the input ‘cmd’ like Parse, but instead of calling the callback
+// of the matched command it returns the identifier the command was added with using
+// AddNamed, and the match. The identifier is empty for commands added using Add. This
+// allows dispatching commands using a table or messages rather than callbacks.
+//
+// If the input doesn't match any command a *NoMatchError is returned, and if it matches
+// more than one and a resolver doesn't choose one an *AmbiguityError is returned. If the
+// validator of the command rejects the match a *ValidationError is returned.
+func (c *Cmds) ParseToMatch(cmd string) (id string, m Match, err error) {
+	matches, toks, err := c.matchInput(cmd, ParseOptions{})
+	if err != nil {
+		return
+	}
+
+	switch len(matches) {
+	case 0:
+		err = &NoMatchError{c.LongestMatches(cmd)}
+		return
+	case 1:
+		if err = validate(matches[0]); err != nil {
+			return
+		}
+		id = matches[0].meta.(*command).id
+		m = cmdMatch(matches[0])
+		return
+	default:
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		err = c.ambiguityOf(toks, matches)
+		return
+	}
+}
+
+// matchInput splits the input ‘cmd’ into words and matches them. If there is more than
+// one match and a resolver is set, the resolver chooses one. An error is returned if the
+// input can't be split or the resolver fails.
+func (c *Cmds) matchInput(cmd string, opts ParseOptions) (matches []match, toks []string, err error) {
+	var start time.Time
+	if c.timed(MatchPhase) {
+		start = time.Now()
+	}
+
+	toks, raw, err := c.scanRaw(cmd)
+	if err != nil {
+		return
+	}
+
+	var rejected error
+	c.mu.RLock()
+	c.withLabel("match", func() {
+		matches, rejected = c.matchRaw(toks, raw, opts)
+	})
+	if len(matches) > 1 {
+		c.sortByAddOrder(matches)
+		matches = c.applyCollisionPolicy(matches)
+		matches = c.applyPreferences(matches)
+	}
+	c.mu.RUnlock()
+
+	if c.timed(MatchPhase) {
+		var matched *command
+		if len(matches) == 1 {
+			matched = matches[0].meta.(*command)
+		}
+		c.checkBudget(MatchPhase, start, cmd, toks, matched)
+	}
+
+	if len(matches) == 0 && rejected != nil {
+		err = rejected
+		return
+	}
+
+	if len(matches) > 1 && c.resolver != nil {
+		matches, err = c.resolve(cmd, matches)
+	}
+	return
+}
+
+// match runs the program on the input words ‘toks’ and returns the maximal matches.
+func (c *Cmds) match(toks []string, opts ParseOptions) []match {
+	matches, _ := c.matchRaw(toks, nil, opts)
+	return matches
+}
+
+// matchRaw is like match, but variables of the type rest take their values from ‘raw’,
+// the text the words were split from, if it isn't nil. It also returns the
+// *ConstraintError for the first interpretation of all the input that was dropped
+// because it breaks a constraint, or the error of the context of ‘opts’ and no matches if
+// it was cancelled.
+func (c *Cmds) matchRaw(toks []string, raw *rawInput, opts ParseOptions) ([]match, error) {
+	c.statsMu.Lock()
+	c.stats.Inputs++
+	c.statsMu.Unlock()
+
+	if c.lazy || c.trie != nil {
+		return c.matchCandidates(toks, raw, opts)
+	}
+
+	v := c.newVM(opts)
+	v.raw = raw
 	v.execute(c.prog, toks)
+	matches, rejected := v.maximalMatches(), v.rejected
+	if v.err != nil {
+		matches, rejected = nil, v.err
+	}
+	c.releaseVM(v)
+	return matches, rejected
+}
 
-	if len(v.maximalMatches()) != 1 {
-		return false
+// newVM returns a VM set up to match according to the settings of the Cmds and ‘opts’.
+// It reuses the buffers of a VM released with releaseVM if there is one.
+func (c *Cmds) newVM(opts ParseOptions) *vm {
+	v, _ := c.vms.Get().(*vm)
+	if v == nil {
+		v = &vm{}
 	}
+	*v = vm{
+		currentThreads: v.currentThreads,
+		nextThreads:    v.nextThreads,
+		matches:        v.matches,
+		deferredSaves:  v.deferredSaves[:0],
+		free:           v.free,
+		gen:            v.gen,
 
-	mm := v.maximalMatches()[0]
-	cback := mm.meta.(Callback)
-	cback(cmdMatch(mm), ctx)
+		traceWriter:    c.trace,
+		maxAmbiguity:   c.maxAmbiguity,
+		exactKeywords:  opts.ExactKeywords || c.keywordMatching == ExactMatching,
+		avoidKeywords:  c.avoidKeywords,
+		lazyConversion: c.lazyConversion,
+		posix:          c.posixWords,
+		version:        c.version,
+		checkMatch:     checkConstraints,
+		ctx:            opts.ctx,
+	}
+	if opts.Grammar != "" {
+		v.metaFilter = func(meta interface{}) bool {
+			return meta.(*command).inGrammar(opts.Grammar)
+		}
+	}
+	return v
+}
 
-	return true
+// releaseVM keeps the VM ‘v’ for newVM to reuse. It must not be used afterwards; the
+// matches returned by maximalMatches are copies, so they may still be used.
+func (c *Cmds) releaseVM(v *vm) {
+	c.statsMu.Lock()
+	c.stats.Threads += int64(v.threads)
+	c.stats.Instructions += int64(v.instrs)
+	c.stats.Matches += int64(v.found)
+	c.statsMu.Unlock()
+
+	v.input, v.raw, v.thread = nil, nil, nil
+	c.vms.Put(v)
+}
+
+// checkConstraints returns the *ConstraintError for the match ‘m’ if it breaks a
+// constraint of its command.
+func checkConstraints(m match) error {
+	if err := m.meta.(*command).checkConstraints(m); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sortByAddOrder sorts ‘matches’ by the order their commands were added in.
+func (c *Cmds) sortByAddOrder(matches []match) {
+	order := make(map[*command]int)
+	for i, cmd := range c.commands {
+		order[cmd] = i
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return order[matches[i].meta.(*command)] < order[matches[j].meta.(*command)]
+	})
+}
+
+// Resolver is called by Parse when the input ‘input’ matches more than one command, with
+// the ‘candidates’ in the order their commands were added. It returns the index of the
+// candidate to run, or an error if none should be run.
+type Resolver func(input string, candidates []MatchInfo) (int, error)
+
+// SetResolver sets a function that chooses which command to run when the input to Parse is
+// ambiguous, for example by asking the user. Without a resolver, or when the resolver
+// returns an error, Parse fails for ambiguous input.
+func (c *Cmds) SetResolver(r Resolver) {
+	c.resolver = r
+}
+
+// resolve calls the resolver to choose one of the ambiguous ‘matches’ of ‘input’.
+func (c *Cmds) resolve(input string, matches []match) ([]match, error) {
+	cands := make([]MatchInfo, len(matches))
+	for i, m := range matches {
+		cands[i] = matchInfo(m)
+	}
+
+	i, err := c.resolver(input, cands)
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(matches) {
+		return nil, fmt.Errorf("the resolver chose candidate %d of %d", i, len(matches))
+	}
+	return matches[i : i+1], nil
+}
+
+// scanInput splits the input ‘cmd’ into words following the options set on the Cmds.
+func (c *Cmds) scanInput(cmd string) ([]string, error) {
+	toks, _, err := c.scanRaw(cmd)
+	return toks, err
+}
+
+// scanRaw is like scanInput, but also returns the input with where each word begins.
+func (c *Cmds) scanRaw(cmd string) ([]string, *rawInput, error) {
+	cmd, err := c.controlChars.clean(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s, _ := c.scanners.Get().(*cmdScanner)
+	if s == nil {
+		s = &cmdScanner{}
+	}
+	s.word.Reset()
+	s.words, s.starts, s.err = nil, nil, nil
+	s.posix = c.posixWords
+	s.lists = c.listLiterals
+	s.json = c.jsonLiterals
+
+	toks := s.Scan(cmd)
+	raw := &rawInput{text: s.runes, starts: s.starts}
+	err = s.err
+	// The words and runes are returned, so only the word buffer is kept
+	s.words, s.starts, s.runes = nil, nil, nil
+	c.scanners.Put(s)
+	return toks, raw, err
+}
+
+// rawInput is the text that input words were split from.
+type rawInput struct {
+	text []rune
+	// starts are the offsets in text where each word begins
+	starts []int
+}
+
+// span returns the Span of the ‘words’ input words from the one at index ‘word’.
+func (r *rawInput) span(word, words int) Span {
+	s := Span{Word: word, Words: words, Start: -1, End: -1}
+	last := word + words - 1
+	if r == nil || last >= len(r.starts) {
+		return s
+	}
+
+	s.Start = r.starts[word]
+	s.End = len(r.text)
+	if last+1 < len(r.starts) {
+		s.End = r.starts[last+1]
+	}
+	for s.End > r.starts[last]+1 && unicode.IsSpace(r.text[s.End-1]) {
+		s.End--
+	}
+	return s
+}
+
+// from returns the text from the beginning of the word at index ‘word’ to the end, without
+// trailing spaces.
+func (r *rawInput) from(word int) (string, bool) {
+	if r == nil || word >= len(r.starts) {
+		return "", false
+	}
+	return strings.TrimRightFunc(string(r.text[r.starts[word]:]), unicode.IsSpace), true
+}
+
+// MatchInfo is one interpretation of an input returned by Matches.
+type MatchInfo struct {
+	// Syntax is the definition of the matched command as it was passed to Add.
+	Syntax string
+	// ID is the identifier the command was added with using AddNamed, or empty.
+	ID    string
+	Match Match
+}
+
+func matchInfo(m match) MatchInfo {
+	cmd := m.meta.(*command)
+	return MatchInfo{Syntax: cmd.syntax, ID: cmd.id, Match: cmdMatch(m)}
+}
+
+// Matches returns every command that the input ‘cmd’ matches completely, without calling
+// any callbacks. Unlike Parse it succeeds when the input is ambiguous, so tools that
+// analyze inputs using the grammar of a CLI can see all the interpretations. An error is
+// returned only if the input can't be split into words.
+func (c *Cmds) Matches(cmd string) ([]MatchInfo, error) {
+	toks, raw, err := c.scanRaw(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	matches, _ := c.matchRaw(toks, raw, ParseOptions{})
+	infos := []MatchInfo{}
+	for _, m := range matches {
+		infos = append(infos, matchInfo(m))
+	}
+	return infos, nil
+}
+
+// ParseReader reads commands from ‘r’, one per line, and calls Parse on each. Blank lines
+// and lines beginning with # are skipped. It stops at the first line that doesn't match a
+// command or whose callback returns an error, as the callbacks of commands added with
+// AddWithContext and of the builtins do. It returns an error that includes ‘name’ and the
+// line number, and wraps the error ParseErr returned for the line, or that of the callback.
+func (c *Cmds) ParseReader(r io.Reader, name string, ctx interface{}) error {
+	return c.parseReader(r, name, ctx, ParseOptions{})
+}
+
+// parseReader runs the commands read from ‘r’ like ParseReader, matching them according
+// to ‘opts’.
+func (c *Cmds) parseReader(r io.Reader, name string, ctx interface{}, opts ParseOptions) error {
+	lineNo := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := c.runNested(line, ctx, opts); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, lineNo, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ParseSequence parses input containing several commands separated by ‘;’ or ‘&&’, calling
+// Parse on each command in turn. A command following ‘&&’ is only parsed if the previous
+// command succeeded, while a command following ‘;’ is parsed regardless. Separators inside
+// quotes are not treated as separators. Like a shell, the result is the result of
+// the last command that was parsed.
+func (c *Cmds) ParseSequence(cmd string, ctx interface{}) (ok bool) {
+	ok = true
+	for i, seg := range splitSequence(cmd, c.posixWords) {
+		if i > 0 && seg.sep == andSep && !ok {
+			continue
+		}
+		ok = c.Parse(seg.cmd, ctx)
+	}
+	return
+}
+
+type sequenceSep int
+
+const (
+	noSep sequenceSep = iota
+	semicolonSep
+	andSep
+)
+
+// sequenceSegment is one command in a sequence of commands, along with the separator
+// that preceded it.
+type sequenceSegment struct {
+	sep sequenceSep
+	cmd string
+}
+
+// splitSequence splits ‘cmd’ on the separators ‘;’ and ‘&&’, except within quotes. Empty
+// commands are dropped. If ‘posix’ is true, single quotes and backslash escapes are
+// respected as well; otherwise only the quotedEscapes within double quotes are.
+func splitSequence(cmd string, posix bool) []sequenceSegment {
+	var segs []sequenceSegment
+	var buf bytes.Buffer
+	sep := noSep
+	// quote is the quote character we are inside of, or 0
+	var quote rune
+
+	add := func(next sequenceSep) {
+		if strings.TrimSpace(buf.String()) != "" {
+			segs = append(segs, sequenceSegment{sep: sep, cmd: buf.String()})
+			sep = next
+		} else if next > sep {
+			// The command is empty. Keep the stronger separator so that
+			// ‘a && ; b’ still requires ‘a’ to succeed.
+			sep = next
+		}
+		buf.Reset()
+	}
+
+	runes := []rune(cmd)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case posix && r == '\\' && quote != '\'' && i+1 < len(runes):
+			buf.WriteRune(r)
+			i++
+			buf.WriteRune(runes[i])
+		case !posix && quote == '"' && r == '\\' && i+1 < len(runes) && quotedEscapes[runes[i+1]] != 0:
+			buf.WriteRune(r)
+			i++
+			buf.WriteRune(runes[i])
+		case r == quote:
+			quote = 0
+			buf.WriteRune(r)
+		case quote != 0:
+			buf.WriteRune(r)
+		case r == '"' || (posix && r == '\''):
+			quote = r
+			buf.WriteRune(r)
+		case r == ';':
+			add(semicolonSep)
+		case r == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			add(andSep)
+			i++
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	add(noSep)
+
+	return segs
 }
 
 type cmdMatch match
@@ -172,6 +1406,20 @@ func (c cmdMatch) Var(name string) (value []*VarValue) {
 	return
 }
 
+func (c cmdMatch) VarIter(name string) *VarIterator {
+	return &VarIterator{items: c.items, name: name, pos: -1, index: -1}
+}
+
+func (c cmdMatch) VarCount(name string) int {
+	n := 0
+	for _, w := range c.items {
+		if v, b := w.(VarValue); b && v.Name == name {
+			n++
+		}
+	}
+	return n
+}
+
 func (c cmdMatch) KeywordPresent(name string) bool {
 	for _, w := range c.items {
 		if v, b := w.(keywordValue); b {
@@ -183,19 +1431,156 @@ func (c cmdMatch) KeywordPresent(name string) bool {
 	return false
 }
 
-// Return the longest — not necessarily maximal —matches after Parse was called. This method is useful in case Parse couldn't find a single longest match (it returned false) so that the caller can look at all matches to attempt to print a helpful error message.
-func (c *Cmds) LongestMatches() {
+func (c cmdMatch) Keywords() []Keyword {
+	kws := make([]Keyword, 0)
+	for _, w := range c.items {
+		if v, b := w.(keywordValue); b {
+			kws = append(kws, Keyword(v))
+		}
+	}
+	return kws
+}
+
+func (c cmdMatch) Map(name string) map[string]string {
+	m := make(map[string]string)
+	for _, v := range c.Var(name) {
+		if v.Type != "map" {
+			continue
+		}
+		// The value was already checked when it was bound
+		key, value, _ := splitKeyValue(v.Value)
+		m[key] = value
+	}
+	return m
+}
+
+func (c cmdMatch) Group(name string) (group Match, ok bool) {
+	var g cmdMatch
+	g.meta = c.meta
+	for i, s := range c.groups {
+		if s.name != name {
+			continue
+		}
+		ok = true
+
+		// Keep the groups nested within this one, relative to where its items are added
+		off := len(g.items) - s.start
+		for j, inner := range c.groups {
+			if j != i && inner.start >= s.start && inner.end <= s.end {
+				inner.start += off
+				inner.end += off
+				g.groups = append(g.groups, inner)
+			}
+		}
+		g.items = append(g.items, c.items[s.start:s.end]...)
+		g.instrs = append(g.instrs, c.instrs[s.start:s.end]...)
+	}
+	return g, ok
+}
+
+func (c cmdMatch) GroupPath() []string {
+	if cmd, ok := c.meta.(*command); ok {
+		return cmd.groupPath
+	}
+	return nil
+}
+
+func (c cmdMatch) Syntax() string {
+	if cmd, ok := c.meta.(*command); ok {
+		return cmd.syntax
+	}
+	return ""
+}
+
+func (c cmdMatch) ID() string {
+	if cmd, ok := c.meta.(*command); ok {
+		return cmd.id
+	}
+	return ""
+}
+
+func (c cmdMatch) Redacted() string {
+	var buf bytes.Buffer
+	for i, w := range c.items {
+		if i > 0 {
+			buf.WriteRune(' ')
+		}
+		switch v := w.(type) {
+		case keywordValue:
+			buf.WriteString(quoteIfNeeded(v.Value))
+		case VarValue:
+			if v.Flags.IsSensitive() {
+				buf.WriteString(v.Redacted())
+			} else {
+				buf.WriteString(quoteIfNeeded(v.Value))
+			}
+		}
+	}
+	return buf.String()
+}
+
+// quoteIfNeeded quotes ‘s’ so that the cmdScanner would scan it as a single word, escaping
+// the double quotes and backslashes within it.
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.HasPrefix(s, `"`) || strings.IndexFunc(s, unicode.IsSpace) >= 0 {
+		return `"` + quotedEscaper.Replace(s) + `"`
+	}
+	return s
+}
+
+// quotedEscaper escapes the characters that end a double-quoted word or start an escape in
+// it.
+var quotedEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// posixQuoteIfNeeded quotes ‘s’ so that the cmdScanner would scan it as a single word
+// when POSIX splitting is enabled. It uses single quotes, within which nothing is special,
+// and ends them for each single quote in ‘s’.
+func posixQuoteIfNeeded(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"'\`, r)
+	}) < 0 {
+		return s
+	}
+	return `'` + strings.Replace(s, `'`, `'\''`, -1) + `'`
 }
 
 type cmdScanner struct {
 	runes []rune
 	word  bytes.Buffer
 	words []string
+	// posix is set to split words following the rules of a POSIX shell
+	posix bool
+	// lists is set to scan list literals such as [a, b, c] as a single word
+	lists bool
+	// json is set to scan JSON objects as a single word
+	json bool
+	// err is set when the input couldn't be split into words
+	err error
+	// starts are the rune offsets where each word begins, including any opening quote.
+	// It may have one more element than words if the input ends in an unterminated
+	// empty quoted word.
+	starts []int
 }
 
 func (t *cmdScanner) Scan(command string) []string {
 	t.runes = []rune(command)
-	t.innerTokenize()
+
+	// Size the words for the most there can be, to avoid growing them
+	n := 1
+	for _, r := range t.runes {
+		if unicode.IsSpace(r) {
+			n++
+		}
+	}
+	t.words = make([]string, 0, n)
+	t.starts = make([]int, 0, n+1)
+	t.word.Grow(len(command))
+
+	if t.posix {
+		t.posixTokenize()
+	} else {
+		t.innerTokenize()
+	}
 	return t.words
 }
 
@@ -208,16 +1593,32 @@ func (t *cmdScanner) innerTokenize() {
 
 	var state = Default
 	var terminator rune
-	for _, r := range t.runes {
+	for i := 0; i < len(t.runes); i++ {
+		r := t.runes[i]
 		switch state {
 		case Default:
 			if !unicode.IsSpace(r) {
+				t.markStart(i)
 				if r == '"' {
 					state = WaitingForTerminator
 					terminator = '"'
 					continue
 				}
 
+				if r == '[' && t.lists {
+					if i = t.scanList(i); t.err != nil {
+						return
+					}
+					continue
+				}
+
+				if r == '{' && t.json {
+					if i = t.scanJSON(i); t.err != nil {
+						return
+					}
+					continue
+				}
+
 				t.addRuneToWord(r)
 				state = InWord
 			}
@@ -234,15 +1635,178 @@ func (t *cmdScanner) innerTokenize() {
 				state = Default
 				continue
 			}
+			if r == '\\' && i+1 < len(t.runes) {
+				if esc, ok := quotedEscapes[t.runes[i+1]]; ok {
+					i++
+					r = esc
+				}
+			}
 			t.addRuneToWord(r)
 		}
 	}
 
+	if state == WaitingForTerminator {
+		// The partial word is kept for completion
+		t.err = fmt.Errorf("unterminated quote")
+	}
 	if !t.wordIsEmpty() {
 		t.addWord()
 	}
 }
 
+// quotedEscapes are the characters that may follow a backslash within double quotes when
+// POSIX splitting is disabled, and what the escape stands for. A backslash followed by
+// anything else is kept, so that paths such as "C:\dir" don't need escaping.
+var quotedEscapes = map[rune]rune{
+	'"':  '"',
+	'\\': '\\',
+	'n':  '\n',
+	't':  '\t',
+}
+
+// posixTokenize splits the input into words like a POSIX shell does, without performing
+// any expansions.
+func (t *cmdScanner) posixTokenize() {
+	const (
+		Unquoted = iota
+		InSingleQuotes
+		InDoubleQuotes
+	)
+
+	var state = Unquoted
+	// inWord is tracked separately from the word buffer since "" is an empty word
+	inWord := false
+	for i := 0; i < len(t.runes); i++ {
+		r := t.runes[i]
+		switch state {
+		case Unquoted:
+			if !inWord && !unicode.IsSpace(r) {
+				t.markStart(i)
+			}
+			switch {
+			case r == '[' && t.lists && !inWord:
+				if i = t.scanList(i); t.err != nil {
+					return
+				}
+			case r == '{' && t.json && !inWord:
+				if i = t.scanJSON(i); t.err != nil {
+					return
+				}
+			case unicode.IsSpace(r):
+				if inWord {
+					t.addWord()
+					inWord = false
+				}
+			case r == '\\' && i+1 < len(t.runes):
+				i++
+				if t.runes[i] == '\n' {
+					// Line continuation
+					continue
+				}
+				t.addRuneToWord(t.runes[i])
+				inWord = true
+			case r == '\'':
+				state = InSingleQuotes
+				inWord = true
+			case r == '"':
+				state = InDoubleQuotes
+				inWord = true
+			default:
+				t.addRuneToWord(r)
+				inWord = true
+			}
+		case InSingleQuotes:
+			if r == '\'' {
+				state = Unquoted
+				continue
+			}
+			t.addRuneToWord(r)
+		case InDoubleQuotes:
+			switch {
+			case r == '"':
+				state = Unquoted
+			case r == '\\' && i+1 < len(t.runes) && strings.ContainsRune("$`\"\\\n", t.runes[i+1]):
+				i++
+				if t.runes[i] != '\n' {
+					t.addRuneToWord(t.runes[i])
+				}
+			default:
+				t.addRuneToWord(r)
+			}
+		}
+	}
+
+	if state != Unquoted {
+		// The partial word is kept for completion
+		t.err = fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		t.addWord()
+	}
+}
+
+// scanList adds the list literal starting at the [ at index ‘start’ as a word, and
+// returns the index of the closing ].
+func (t *cmdScanner) scanList(start int) (end int) {
+	var quote rune
+	for end = start; end < len(t.runes); end++ {
+		r := t.runes[end]
+		t.addRuneToWord(r)
+		switch {
+		case r == quote:
+			quote = 0
+		case quote != 0:
+			continue
+		case r == '"' || (t.posix && r == '\''):
+			quote = r
+		case r == ']':
+			t.addWord()
+			return
+		}
+	}
+
+	t.err = fmt.Errorf("unterminated list")
+	return
+}
+
+// scanJSON adds the JSON object starting at the { at index ‘start’ as a word, and
+// returns the index of the closing }.
+func (t *cmdScanner) scanJSON(start int) (end int) {
+	depth := 0
+	inString := false
+	for end = start; end < len(t.runes); end++ {
+		r := t.runes[end]
+		t.addRuneToWord(r)
+		switch {
+		case inString && r == '\\' && end+1 < len(t.runes):
+			end++
+			t.addRuneToWord(t.runes[end])
+		case r == '"':
+			inString = !inString
+		case inString:
+			continue
+		case r == '{' || r == '[':
+			depth++
+		case r == '}' || r == ']':
+			depth--
+			if depth == 0 {
+				t.addWord()
+				return
+			}
+		}
+	}
+
+	t.err = fmt.Errorf("unterminated JSON object")
+	return
+}
+
+// markStart records that the current word begins at ‘i’, unless its start is already known.
+func (t *cmdScanner) markStart(i int) {
+	if len(t.starts) == len(t.words) {
+		t.starts = append(t.starts, i)
+	}
+}
+
 func (t *cmdScanner) addRuneToWord(r rune) {
 	t.word.WriteRune(r)
 }
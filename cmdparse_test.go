@@ -1,6 +1,17 @@
 package cmdparse
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestCmdScanner(t *testing.T) {
 
@@ -56,6 +67,11 @@ func TestCmdScanner(t *testing.T) {
 			input:    `"is this thing" this "thing"`,
 			expected: []string{"is this thing", "this", "thing"},
 		},
+		{
+			name:     "escapes in quotes",
+			input:    `say "a \"b\" \\ c\nd\te" "C:\dir" un\"quoted`,
+			expected: []string{"say", "a \"b\" \\ c\nd\te", `C:\dir`, `un\"quoted`},
+		},
 	}
 
 	for _, tc := range tests {
@@ -63,11 +79,32 @@ func TestCmdScanner(t *testing.T) {
 			var s cmdScanner
 			toks := s.Scan(tc.input)
 			ensureTokListsEqual(tc.expected, toks)
+			if s.err != nil {
+				t.Fatalf("Scan failed: %v", s.err)
+			}
 		})
 	}
 
 }
 
+func TestCmdScannerUnterminated(t *testing.T) {
+	var s cmdScanner
+	toks := s.Scan(`say "hello`)
+	if s.err == nil {
+		t.Fatalf("Scan succeeded for an unterminated quote")
+	}
+	if len(toks) != 2 || toks[1] != "hello" {
+		t.Fatalf("Expected the partial word to be kept but got %q", toks)
+	}
+
+	var cmds Cmds
+	cmds.Add("say <what>", func(match Match, ctx interface{}) {})
+	cmds.Compile()
+	if cmds.Parse(`say "hello`, nil) {
+		t.Fatalf("Parse succeeded for an unterminated quote")
+	}
+}
+
 func TestCmdParse(t *testing.T) {
 	type tcmd struct {
 		syntax string
@@ -240,3 +277,1201 @@ func TestCmdParse(t *testing.T) {
 	}
 
 }
+
+func TestMatchRedacted(t *testing.T) {
+	var cmds Cmds
+	var redacted string
+
+	cmds.Add("login <user> <password!secret> (token <tok!sensitive>)? <note>?", func(match Match, ctx interface{}) {
+		redacted = match.Redacted()
+	})
+	cmds.Compile()
+
+	var trace bytes.Buffer
+	cmds.TraceExecutionTo(&trace)
+
+	ok := cmds.Parse(`log bob hunter2 token abc123 "a note"`, nil)
+	if !ok {
+		t.Fatalf("Parse failed")
+	}
+
+	expected := `log bob <redacted> token <redacted> "a note"`
+	if redacted != expected {
+		t.Fatalf("Expected redacted input to be ‘%s’ but was ‘%s’", expected, redacted)
+	}
+
+	for _, secret := range []string{"hunter2", "abc123"} {
+		if strings.Contains(trace.String(), secret) {
+			t.Fatalf("The trace output contains the sensitive value ‘%s’", secret)
+		}
+	}
+}
+
+func TestSensitiveProgram(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(cmds *Cmds)
+	}{
+		{"compiled", func(cmds *Cmds) { cmds.Compile() }},
+		{"lazy", func(cmds *Cmds) { cmds.SetLazyCompilation(true) }},
+		{"optimized", func(cmds *Cmds) {
+			cmds.Compile()
+			cmds.Optimize()
+		}},
+		{"loaded", func(cmds *Cmds) {
+			cmds.Compile()
+			var buf bytes.Buffer
+			if err := cmds.ExportJSON(&buf); err != nil {
+				t.Fatalf("ExportJSON failed: %v", err)
+			}
+			if err := cmds.LoadJSON(&buf, nil); err != nil {
+				t.Fatalf("LoadJSON failed: %v", err)
+			}
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.Add("status", func(match Match, ctx interface{}) {})
+			cmds.Add("login <user> <password!secret>", func(match Match, ctx interface{}) {})
+			tc.setup(&cmds)
+
+			var trace bytes.Buffer
+			cmds.TraceExecutionTo(&trace)
+			cmds.Parse("login bob hunter2", nil)
+
+			if !cmds.program().sensitive {
+				t.Fatalf("The program isn't marked as saving sensitive variables")
+			}
+			if strings.Contains(trace.String(), "hunter2") {
+				t.Fatalf("The trace output contains the sensitive value")
+			}
+		})
+	}
+}
+
+func TestParseSequence(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		posix    bool
+		ok       bool
+		expected []string
+	}{
+		{
+			name:     "single",
+			input:    "add 1",
+			ok:       true,
+			expected: []string{"1"},
+		},
+		{
+			name:     "semicolons",
+			input:    "add 1; add 2;add 3",
+			ok:       true,
+			expected: []string{"1", "2", "3"},
+		},
+		{
+			name:     "semicolon continues after failure",
+			input:    "bogus; add 2",
+			ok:       true,
+			expected: []string{"2"},
+		},
+		{
+			name:     "and",
+			input:    "add 1 && add 2",
+			ok:       true,
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "and stops after failure",
+			input:    "bogus && add 2; add 3",
+			ok:       true,
+			expected: []string{"3"},
+		},
+		{
+			name:     "failure is last",
+			input:    "add 1 && bogus",
+			ok:       false,
+			expected: []string{"1"},
+		},
+		{
+			name:     "quoted separators",
+			input:    `add "1; 2 && 3"; add 4`,
+			ok:       true,
+			expected: []string{"1; 2 && 3", "4"},
+		},
+		{
+			name:     "escaped quote in separators",
+			input:    `add "a \" ; b"; add 2`,
+			ok:       true,
+			expected: []string{`a " ; b`, "2"},
+		},
+		{
+			name:     "posix quoted separators",
+			input:    `add '1;"2' && add \;3`,
+			posix:    true,
+			ok:       true,
+			expected: []string{`1;"2`, ";3"},
+		},
+		{
+			name:     "empty commands",
+			input:    ";; add 1 ;; ",
+			ok:       true,
+			expected: []string{"1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var added []string
+
+			cmds.Add("add <n>", func(match Match, ctx interface{}) {
+				added = append(added, match.Var("n")[0].Value)
+			})
+			cmds.Compile()
+			cmds.SetPosixSplitting(tc.posix)
+
+			ok := cmds.ParseSequence(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("ParseSequence returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if strings.Join(added, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("Expected the commands %v to run but %v ran", tc.expected, added)
+			}
+		})
+	}
+}
+
+func TestAddPattern(t *testing.T) {
+	var cmds Cmds
+	var value *VarValue
+
+	err := cmds.AddPattern("assignment", `(\w+)\s*=\s*(.*)`)
+	if err != nil {
+		t.Fatalf("AddPattern failed: %v", err)
+	}
+	cmds.Add("let <a:assignment>", func(match Match, ctx interface{}) {
+		value = match.Var("a")[0]
+	})
+	cmds.Add("let <n> be", func(match Match, ctx interface{}) {
+		value = match.Var("n")[0]
+	})
+	cmds.Compile()
+
+	if !cmds.Parse("let x  = 1 + 2", nil) {
+		t.Fatalf("Parse failed")
+	}
+	if value.Value != "x = 1 + 2" {
+		t.Fatalf("Expected the value to be ‘x = 1 + 2’ but it was ‘%s’", value.Value)
+	}
+	expected := []string{"x = 1 + 2", "x", "1 + 2"}
+	if strings.Join(value.Groups, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected the groups to be %v but they were %v", expected, value.Groups)
+	}
+
+	if !cmds.Parse("let y be", nil) {
+		t.Fatalf("Parse failed")
+	}
+	if value.Name != "n" || value.Groups != nil {
+		t.Fatalf("The wrong command was matched")
+	}
+
+	if cmds.Parse("let nothing", nil) {
+		t.Fatalf("Parse succeeded when the pattern should not match")
+	}
+
+	if err := cmds.AddPattern("bad", `(`); err == nil {
+		t.Fatalf("AddPattern succeeded with an invalid expression")
+	}
+}
+
+func TestCmdScannerPosix(t *testing.T) {
+	// The expected words are what sh produces for `set -- <input>`
+	tests := []struct {
+		input    string
+		expected []string
+		ok       bool
+	}{
+		{`a b  c`, []string{"a", "b", "c"}, true},
+		{`"a"'b'c`, []string{"abc"}, true},
+		{`a\ b c`, []string{"a b", "c"}, true},
+		{`'a\b'`, []string{`a\b`}, true},
+		{`"a\"b"`, []string{`a"b`}, true},
+		{`"a\nb"`, []string{`a\nb`}, true},
+		{`"a\\b"`, []string{`a\b`}, true},
+		{`"" x`, []string{"", "x"}, true},
+		{`a'' b`, []string{"a", "b"}, true},
+		{`"a b"c d`, []string{"a bc", "d"}, true},
+		{"a\\\nb", []string{"ab"}, true},
+		{"\"a\\\nb\"", []string{"ab"}, true},
+		{`"\$x"`, []string{"$x"}, true},
+		{`'"'`, []string{`"`}, true},
+		{`a\"b`, []string{`a"b`}, true},
+		{`'it''s'`, []string{"its"}, true},
+		{`"unterminated`, nil, false},
+		{`'unterminated`, nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var s cmdScanner
+			s.posix = true
+			words := s.Scan(tc.input)
+
+			if (s.err == nil) != tc.ok {
+				t.Fatalf("Expected ok to be %v but the error was %v", tc.ok, s.err)
+			}
+			if !tc.ok {
+				return
+			}
+
+			if len(words) != len(tc.expected) {
+				t.Fatalf("Expected words %q but got %q", tc.expected, words)
+			}
+			for i := range words {
+				if words[i] != tc.expected[i] {
+					t.Fatalf("Expected words %q but got %q", tc.expected, words)
+				}
+			}
+		})
+	}
+}
+
+func TestQuoteIfNeeded(t *testing.T) {
+	words := []string{"a", "", "a b", `a"b`, `"a`, `a\b`, `he said "hi there"`, `a\"b c`, `a\nb c`, "it's", `'a\b'`}
+
+	for _, posix := range []bool{false, true} {
+		quote := quoteIfNeeded
+		if posix {
+			quote = posixQuoteIfNeeded
+		}
+		for _, w := range words {
+			t.Run(fmt.Sprintf("%s posix %v", w, posix), func(t *testing.T) {
+				var s cmdScanner
+				s.posix = posix
+				got := s.Scan(quote(w))
+				if s.err != nil || len(got) != 1 || got[0] != w {
+					t.Fatalf("%q scanned as %q (%v), expected %q", quote(w), got, s.err, w)
+				}
+			})
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		posix    bool
+		err      bool
+		expected []string
+	}{
+		{"single", "stop", false, false, []string{"stop"}},
+		{"ambiguous", "st", false, false, []string{"start", "stop"}},
+		{"variables", "set x", false, false, []string{"set <name>:x", "set <what>:x"}},
+		{"none", "bogus", false, false, []string{}},
+		{"unterminated quote", "set 'x", true, true, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			called := false
+			cback := func(match Match, ctx interface{}) { called = true }
+
+			cmds.Add("start", cback)
+			cmds.Add("stop", cback)
+			cmds.Add("set <name>", cback)
+			cmds.Add("set <what>", cback)
+			cmds.SetPosixSplitting(tc.posix)
+			cmds.Compile()
+
+			infos, err := cmds.Matches(tc.input)
+			if called {
+				t.Fatalf("Matches called a callback")
+			}
+			if tc.err {
+				if err == nil {
+					t.Fatalf("Matches succeeded when it should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Matches failed: %v", err)
+			}
+
+			got := []string{}
+			for _, info := range infos {
+				s := info.Syntax
+				for _, name := range []string{"name", "what"} {
+					if v := info.Match.Var(name); len(v) > 0 {
+						s += ":" + v[0].Value
+					}
+				}
+				got = append(got, s)
+			}
+			sort.Strings(got)
+
+			if strings.Join(got, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("Expected matches %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNestedParse(t *testing.T) {
+	var cmds Cmds
+	var said []string
+	var nestedOk []bool
+
+	cmds.AddPattern("cmdline", `.+`)
+	cmds.Add("say <what>", func(match Match, ctx interface{}) {
+		said = append(said, match.Var("what")[0].Value)
+	})
+	cmds.Add("repeat <n> <cmd:cmdline>", func(match Match, ctx interface{}) {
+		n, _ := strconv.Atoi(match.Var("n")[0].Value)
+		for i := 0; i < n; i++ {
+			nestedOk = append(nestedOk, cmds.Parse(match.Var("cmd")[0].Value, ctx))
+		}
+	})
+	cmds.Add("forever", func(match Match, ctx interface{}) {
+		nestedOk = append(nestedOk, cmds.Parse("forever", ctx))
+	})
+	// elsewhere nests each call in a new goroutine, which is counted all the same
+	cmds.AddWithContext("elsewhere", func(ctx context.Context, match Match) error {
+		done := make(chan bool)
+		go func() { done <- cmds.ParseContext(ctx, "elsewhere") == nil }()
+		nestedOk = append(nestedOk, <-done)
+		return nil
+	})
+	cmds.Compile()
+
+	if !cmds.Parse("repeat 2 repeat 2 say hi", nil) {
+		t.Fatalf("Parse failed")
+	}
+	if strings.Join(said, ",") != "hi,hi,hi,hi" {
+		t.Fatalf("Expected hi to be said 4 times but got %v", said)
+	}
+
+	for _, input := range []string{"forever", "elsewhere"} {
+		nestedOk = nil
+		if !cmds.Parse(input, context.Background()) {
+			t.Fatalf("Parse failed")
+		}
+		if len(nestedOk) != maxParseDepth || nestedOk[0] {
+			t.Fatalf("Expected the nesting of ‘%s’ to stop after %d calls with a failure but got %v", input, maxParseDepth, nestedOk)
+		}
+	}
+
+	// The depth is only of the calls nested in one another
+	said = nil
+	ctx := context.Background()
+	if !cmds.Parse("say bye", ctx) || !cmds.Parse("say bye", ctx) || len(said) != 2 {
+		t.Fatalf("Parse failed after nesting")
+	}
+}
+
+func TestParseExactKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		exact    bool
+		ok       bool
+		expected string
+	}{
+		{"abbreviated", "sh res", false, true, "show results"},
+		{"abbreviated exact", "sh res", true, false, ""},
+		{"full exact", "show results", true, true, "show results"},
+		{"variable exact", "set x", true, true, "set <v>"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, lazy := range []bool{false, true} {
+				var cmds Cmds
+				var called string
+				for _, syntax := range []string{"show results", "set <v>"} {
+					syntax := syntax
+					cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+				}
+				cmds.SetLazyCompilation(lazy)
+				cmds.Compile()
+
+				ok := cmds.ParseWithOptions(tc.input, nil, ParseOptions{ExactKeywords: tc.exact})
+				if ok != tc.ok {
+					t.Fatalf("With lazy=%v expected ParseWithOptions to return %v but it returned %v", lazy, tc.ok, ok)
+				}
+				if called != tc.expected {
+					t.Fatalf("With lazy=%v expected ‘%s’ to be called but ‘%s’ was", lazy, tc.expected, called)
+				}
+			}
+		})
+	}
+}
+
+func TestKeywordMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		matching KeywordMatching
+		expected string
+	}{
+		{"abbreviated", "sh", PrefixMatching, "show"},
+		{"abbreviated exact keyword", "del x", PrefixMatching, ""},
+		{"full exact keyword", "delete x", PrefixMatching, "!delete <name> force?"},
+		{"abbreviated after exact keyword", "delete x f", PrefixMatching, "!delete <name> force?"},
+		{"abbreviated with exact matching", "sh", ExactMatching, ""},
+		{"full with exact matching", "show", ExactMatching, "show"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, lazy := range []bool{false, true} {
+				var cmds Cmds
+				var called string
+				for _, syntax := range []string{"show", "!delete <name> force?"} {
+					syntax := syntax
+					cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+				}
+				cmds.SetKeywordMatching(tc.matching)
+				cmds.SetLazyCompilation(lazy)
+				cmds.Compile()
+
+				ok := cmds.Parse(tc.input, nil)
+				if ok != (tc.expected != "") {
+					t.Fatalf("With lazy=%v expected Parse to return %v but it returned %v", lazy, tc.expected != "", ok)
+				}
+				if called != tc.expected {
+					t.Fatalf("With lazy=%v expected ‘%s’ to be called but ‘%s’ was", lazy, tc.expected, called)
+				}
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("show results", func(match Match, ctx interface{}) {})
+	cmds.SetProfile("pipeline", ParseOptions{ExactKeywords: true})
+	cmds.SetProfile(InteractiveProfile, ParseOptions{ExactKeywords: true})
+	cmds.Compile()
+
+	tests := []struct {
+		profile string
+		exists  bool
+		ok      bool
+	}{
+		{StrictProfile, true, false},
+		{"pipeline", true, false},
+		{InteractiveProfile, true, false},
+		{"nope", false, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.profile, func(t *testing.T) {
+			opts, exists := cmds.Profile(tc.profile)
+			if exists != tc.exists {
+				t.Fatalf("Expected the profile to exist to be %v but it was %v", tc.exists, exists)
+			}
+			if ok := cmds.ParseWithOptions("sh res", nil, opts); ok != tc.ok {
+				t.Fatalf("Expected ParseWithOptions to return %v but it returned %v", tc.ok, ok)
+			}
+		})
+	}
+}
+
+func TestResolver(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		choice   int
+		err      bool
+		ok       bool
+		expected string
+		asked    string
+	}{
+		{"choose first", "get v", 0, false, true, "get verbose", "get verbose,get <file>"},
+		{"choose second", "get v", 1, false, true, "get <file>", "get verbose,get <file>"},
+		{"error", "get v", 0, true, false, "", "get verbose,get <file>"},
+		{"bad index", "get v", 2, false, false, "", "get verbose,get <file>"},
+		{"not ambiguous", "get x", 0, false, true, "get <file>", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var called string
+			for _, syntax := range []string{"get verbose", "get <file>"} {
+				syntax := syntax
+				cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+			}
+
+			var asked []string
+			cmds.SetResolver(func(input string, cands []MatchInfo) (int, error) {
+				for _, c := range cands {
+					asked = append(asked, c.Syntax)
+				}
+				if tc.err {
+					return 0, fmt.Errorf("cancelled")
+				}
+				return tc.choice, nil
+			})
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.ok, ok)
+			}
+			if called != tc.expected {
+				t.Fatalf("Expected ‘%s’ to be called but ‘%s’ was", tc.expected, called)
+			}
+			if strings.Join(asked, ",") != tc.asked {
+				t.Fatalf("Expected the resolver to be asked about ‘%s’ but it was asked about %v", tc.asked, asked)
+			}
+		})
+	}
+}
+
+func TestVariablesAvoidKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		defs     []string
+		global   bool
+		input    string
+		ok       bool
+		expected string
+	}{
+		{"ambiguous by default", []string{"get verbose", "get <file>"}, false, "get verbose", false, ""},
+		{"global", []string{"get verbose", "get <file>"}, true, "get verbose", true, "get verbose"},
+		{"global other word", []string{"get verbose", "get <file>"}, true, "get x", true, "get <file>"},
+		{"global abbreviation", []string{"get verbose", "get <file>"}, true, "get verb", false, ""},
+		{"flag", []string{"get verbose", "get <file!nokeyword>"}, false, "get verbose", true, "get verbose"},
+		{"flag other word", []string{"get verbose", "get <file!nokeyword>"}, false, "get x", true, "get <file!nokeyword>"},
+		{"keyword later", []string{"get <file!nokeyword> verbose"}, false, "get verbose verbose", true, "get <file!nokeyword> verbose"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var called string
+			for _, syntax := range tc.defs {
+				syntax := syntax
+				cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+			}
+			cmds.SetVariablesAvoidKeywords(tc.global)
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.ok, ok)
+			}
+			if called != tc.expected {
+				t.Fatalf("Expected ‘%s’ to be called but ‘%s’ was", tc.expected, called)
+			}
+		})
+	}
+}
+
+func TestParseToMatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		id    string
+		value string
+		error string
+	}{
+		{"named", "copy a b", "copy", "a", ""},
+		{"other named", "del x", "delete", "x", ""},
+		{"callback", "say hi", "", "hi", ""},
+		{"no match", "copy a", "", "", "incomplete command at position 3, expected <dst>"},
+		{"ambiguous", "get v", "", "", "'v' is ambiguous at argument 2: could be keyword 'verbose' or value for <file>"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			called := false
+
+			cmds.AddNamed("copy", "copy <src> <dst>")
+			cmds.AddNamed("delete", "delete <src>")
+			cmds.AddNamed("verbose", "get verbose")
+			cmds.AddNamed("get", "get <file>")
+			cmds.Add("say <src>", func(match Match, ctx interface{}) { called = true })
+			cmds.Compile()
+
+			id, m, err := cmds.ParseToMatch(tc.input)
+			if called {
+				t.Fatalf("ParseToMatch called a callback")
+			}
+			if tc.error != "" {
+				if err == nil {
+					t.Fatalf("ParseToMatch succeeded when it should have failed")
+				}
+				if err.Error() != tc.error {
+					t.Fatalf("Expected error '%s' but got '%s'", tc.error, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseToMatch failed: %v", err)
+			}
+			if id != tc.id {
+				t.Fatalf("Expected the id ‘%s’ but got ‘%s’", tc.id, id)
+			}
+			if v := m.Var("src")[0].Value; v != tc.value {
+				t.Fatalf("Expected the value ‘%s’ but got ‘%s’", tc.value, v)
+			}
+		})
+	}
+
+	var cmds Cmds
+	cmds.AddNamed("stop", "stop")
+	cmds.Compile()
+	if !cmds.Parse("stop", nil) {
+		t.Fatalf("Parse failed for a named command")
+	}
+}
+
+func TestParseErr(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		called bool
+		errTyp string
+		error  string
+	}{
+		{"match", "copy a b", true, "<nil>", ""},
+		{"empty", "  ", false, "*cmdparse.EmptyInputError", "empty input"},
+		{"no match", "copy a", false, "*cmdparse.NoMatchError", "incomplete command at position 3, expected <dst>"},
+		{"ambiguous", "get v", false, "*cmdparse.AmbiguityError", "'v' is ambiguous at argument 2: could be keyword 'verbose' or value for <file>"},
+		{"bad input", `copy "a`, false, "*errors.errorString", "unterminated quote"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			called := false
+			cback := func(match Match, ctx interface{}) { called = true }
+			cmds.Add("copy <src> <dst>", cback)
+			cmds.Add("get verbose", cback)
+			cmds.Add("get <file>", cback)
+			cmds.Compile()
+
+			err := cmds.ParseErr(tc.input, nil)
+			if called != tc.called {
+				t.Fatalf("Expected the callback to be called to be %v but it was %v", tc.called, called)
+			}
+			if typ := fmt.Sprintf("%T", err); typ != tc.errTyp {
+				t.Fatalf("Expected an error of type %s but got %s", tc.errTyp, typ)
+			}
+			if err != nil && err.Error() != tc.error {
+				t.Fatalf("Expected error '%s' but got '%s'", tc.error, err.Error())
+			}
+		})
+	}
+}
+
+func TestParseWithMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		ok     bool
+		syntax string
+		id     string
+		value  string
+	}{
+		{"callback", "copy a b", true, "copy <src> <dst>", "", "a"},
+		{"named", "del x", true, "delete <src>", "delete", "x"},
+		{"no match", "copy a", false, "", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			called := false
+
+			cmds.Add("copy <src> <dst>", func(match Match, ctx interface{}) { called = true })
+			cmds.AddNamed("delete", "delete <src>")
+			cmds.Compile()
+
+			info, ok := cmds.ParseWithMatch(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("ParseWithMatch returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if called != (tc.ok && tc.id == "") {
+				t.Fatalf("Expected the callback to be called to be %v", !called)
+			}
+			if info.Syntax != tc.syntax || info.ID != tc.id {
+				t.Fatalf("Expected the command ‘%s’ with id ‘%s’ but got ‘%s’ with id ‘%s’", tc.syntax, tc.id, info.Syntax, info.ID)
+			}
+			if !ok {
+				if info.Match != nil {
+					t.Fatalf("A match was returned when ParseWithMatch failed")
+				}
+				return
+			}
+			if v := info.Match.Var("src")[0].Value; v != tc.value {
+				t.Fatalf("Expected the value ‘%s’ but got ‘%s’", tc.value, v)
+			}
+		})
+	}
+}
+
+func TestMatchGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		group string
+		ok    bool
+		hosts []string
+		ports []string
+	}{
+		{"matched", "get file from h1", "src", true, []string{"h1"}, nil},
+		{"not matched", "get file", "src", false, nil, nil},
+		{"repeated", "get file to h1 to h2 port 22", "dst", true, []string{"h1", "h2"}, []string{"22"}},
+		{"nested", "get file to h1 to h2 port 22", "port", true, nil, []string{"22"}},
+		{"unknown", "get file from h1", "bogus", false, nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var group Match
+			var ok bool
+
+			cmds.Add("get <file> (from <host>):src? (to <host> (port <port>):port?):dst*", func(match Match, ctx interface{}) {
+				group, ok = match.Group(tc.group)
+			})
+			cmds.Compile()
+
+			if !cmds.Parse(tc.input, nil) {
+				t.Fatalf("Parse failed")
+			}
+			if ok != tc.ok {
+				t.Fatalf("Expected Group to return %v but it returned %v", tc.ok, ok)
+			}
+
+			var hosts, ports []string
+			for _, v := range group.Var("host") {
+				hosts = append(hosts, v.Value)
+			}
+			for _, v := range group.Var("port") {
+				ports = append(ports, v.Value)
+			}
+			if !reflect.DeepEqual(hosts, tc.hosts) || !reflect.DeepEqual(ports, tc.ports) {
+				t.Fatalf("Expected hosts %v and ports %v but got %v and %v", tc.hosts, tc.ports, hosts, ports)
+			}
+			if len(group.Var("file")) != 0 {
+				t.Fatalf("The group contains a variable from outside it")
+			}
+
+			if tc.name == "repeated" {
+				if _, ok := group.Group("port"); !ok {
+					t.Fatalf("A group nested within the group wasn't found")
+				}
+			}
+		})
+	}
+}
+
+func TestCountedRepetition(t *testing.T) {
+	tests := []struct {
+		name   string
+		syntax string
+		input  string
+		ok     bool
+	}{
+		{"exact", "ip <ip:int>{4}", "ip 10 0 0 1", true},
+		{"exact too few", "ip <ip:int>{4}", "ip 10 0 0", false},
+		{"exact too many", "ip <ip:int>{4}", "ip 10 0 0 1 2", false},
+		{"range minimum", "run <arg>{1,3}", "run a", true},
+		{"range maximum", "run <arg>{1,3}", "run a b c", true},
+		{"range too few", "run <arg>{1,3}", "run", false},
+		{"range too many", "run <arg>{1,3}", "run a b c d", false},
+		{"no maximum", "run (<k> <v>){2,}", "run a 1 b 2 c 3", true},
+		{"no maximum too few", "run (<k> <v>){2,}", "run a 1", false},
+		{"zero minimum", "run <arg>{0,2}", "run", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			if err := cmds.Add(tc.syntax, func(match Match, ctx interface{}) {}); err != nil {
+				t.Fatalf("Adding the command failed: %v", err)
+			}
+			cmds.Compile()
+
+			// Each input must match in only one way, or Parse would fail as ambiguous
+			if ok := cmds.Parse(tc.input, nil); ok != tc.ok {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.ok, ok)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	copyCmd := "copy <src> <dst> { verbose? force? limit <n:int>? }"
+	tests := []struct {
+		name   string
+		syntax string
+		input  string
+		ok     bool
+		limit  string
+	}{
+		{"no options", copyCmd, "copy a b", true, ""},
+		{"in order", copyCmd, "copy a b verbose force limit 5", true, "5"},
+		{"any order", copyCmd, "copy a b limit 5 f v", true, "5"},
+		{"some", copyCmd, "copy a b limit 7", true, "7"},
+		{"repeated option", copyCmd, "copy a b force force", false, ""},
+		{"option without its variable", copyCmd, "copy a b limit", false, ""},
+		{"required", "set { <k> to <v> mode <m>? }", "set mode x a to b", true, ""},
+		{"required missing", "set { <k> to <v> mode <m>? }", "set mode x", false, ""},
+		{"repeated set", "add { a b? }+ end", "add b a a end", true, ""},
+		{"nested", "run { x? (sub { y? z? })? }", "run sub z y x", true, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var limit string
+			err := cmds.Add(tc.syntax, func(match Match, ctx interface{}) {
+				if v := match.Var("n"); len(v) > 0 {
+					limit = v[0].Value
+				}
+			})
+			if err != nil {
+				t.Fatalf("Adding the command failed: %v", err)
+			}
+			cmds.Compile()
+
+			// Each input must match in only one way, or Parse would fail as ambiguous
+			if ok := cmds.Parse(tc.input, nil); ok != tc.ok {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.ok, ok)
+			}
+			if limit != tc.limit {
+				t.Fatalf("Expected the limit ‘%s’ but got ‘%s’", tc.limit, limit)
+			}
+		})
+	}
+}
+
+func TestQuotedKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		redacted string
+	}{
+		{"full", `say "hello world"`, true, `say "hello world"`},
+		{"abbreviated", `say "hello w"`, true, `say "hello w"`},
+		{"not quoted", `say hello world`, false, ""},
+		{"punctuation", `sel a|b`, true, `sel a|b`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var redacted string
+			cback := func(match Match, ctx interface{}) { redacted = match.Redacted() }
+			if err := cmds.Add(`say "hello world"`, cback); err != nil {
+				t.Fatalf("Adding the quoted keyword failed: %v", err)
+			}
+			if err := cmds.Add(`sel a\|b`, cback); err != nil {
+				t.Fatalf("Adding the escaped keyword failed: %v", err)
+			}
+			cmds.Compile()
+
+			if ok := cmds.Parse(tc.input, nil); ok != tc.ok {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.ok, ok)
+			}
+			if redacted != tc.redacted {
+				t.Fatalf("Expected the match to be ‘%s’ but it was ‘%s’", tc.redacted, redacted)
+			}
+		})
+	}
+}
+
+func TestAddAndRemoveAfterCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		lazy bool
+	}{
+		{"compiled", false},
+		{"lazy", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var ran string
+			cback := func(name string) Callback {
+				return func(match Match, ctx interface{}) { ran = name }
+			}
+
+			cmds.SetLazyCompilation(tc.lazy)
+			cmds.Add("copy <src> <dst>", cback("copy"))
+			cmds.AddNamed("del", "delete <file>")
+			cmds.Compile()
+
+			cmds.Add("move <src> <dst>", cback("move"))
+			if !cmds.Parse("mo a b", nil) || ran != "move" {
+				t.Fatalf("A command added after Compile wasn't matched")
+			}
+			if !cmds.Parse("c a b", nil) || ran != "copy" {
+				t.Fatalf("A command added before Compile wasn't matched after adding another")
+			}
+
+			if err := cmds.Remove("copy <src> <dst>"); err != nil {
+				t.Fatalf("Remove failed: %v", err)
+			}
+			if err := cmds.Remove("del"); err != nil {
+				t.Fatalf("Remove of a named command failed: %v", err)
+			}
+			if cmds.Parse("c a b", nil) || cmds.Parse("delete a", nil) {
+				t.Fatalf("A removed command was matched")
+			}
+			if ran = ""; !cmds.Parse("m a b", nil) || ran != "move" {
+				t.Fatalf("The remaining command wasn't matched after removing the others")
+			}
+			if len(cmds.Commands()) != 1 || len(cmds.FirstKeywords().Keywords) != 1 {
+				t.Fatalf("Removed commands are still listed")
+			}
+
+			err := cmds.Remove("copy <src> <dst>")
+			if err == nil || err.Error() != "there is no command ‘copy <src> <dst>’" {
+				t.Fatalf("Remove of a missing command returned %v", err)
+			}
+		})
+	}
+}
+
+func TestConcurrentParse(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	for i := 0; i < 20; i++ {
+		cmds.Add(fmt.Sprintf("show%c <item>", 'a'+i), cback)
+	}
+	cmds.Compile()
+
+	var wg sync.WaitGroup
+	failed := make(chan string, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				input := fmt.Sprintf("show%c x", 'a'+(g+i)%20)
+				if !cmds.Parse(input, nil) {
+					failed <- input
+					return
+				}
+				cmds.Complete("sho")
+			}
+		}(g)
+	}
+
+	// Commands that are added and removed while the others are parsed don't affect them
+	for i := 0; i < 50; i++ {
+		syntax := fmt.Sprintf("hide%d <item>", i)
+		cmds.Add(syntax, cback)
+		if err := cmds.Remove(syntax); err != nil {
+			t.Fatalf("Remove failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	select {
+	case input := <-failed:
+		t.Fatalf("Parse of ‘%s’ failed while commands were added and removed", input)
+	default:
+	}
+}
+
+// TestConcurrentCallbacks checks that callbacks running at the same time in different
+// goroutines don't count towards the nesting limit.
+func TestConcurrentCallbacks(t *testing.T) {
+	const n = 2 * maxParseDepth
+	var cmds Cmds
+	var mu sync.Mutex
+	started := 0
+	all := make(chan struct{})
+	cmds.Add("wait", func(match Match, ctx interface{}) {
+		mu.Lock()
+		if started++; started == n {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all:
+		case <-time.After(5 * time.Second):
+		}
+	})
+	cmds.Compile()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cmds.ParseErr("wait", nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("ParseErr failed with %d callbacks running at once: %v", n, err)
+	default:
+	}
+	if started != n {
+		t.Fatalf("%d callbacks ran, expected %d", started, n)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Span
+	}{
+		{"words", "get a.html v", []Span{{0, 1, 0, 3}, {1, 1, 4, 10}, {2, 1, 11, 12}}},
+		{"spacing", "  get   a.html  ", []Span{{0, 1, 2, 5}, {1, 1, 8, 14}}},
+		{"quoted", `get "a b"v`, []Span{{0, 1, 0, 3}, {1, 1, 4, 9}, {2, 1, 9, 10}}},
+		{"unicode", "get ‘x’ v", []Span{{0, 1, 0, 3}, {1, 1, 4, 7}, {2, 1, 8, 9}}},
+		{"rest", "say  hi  there ", []Span{{0, 1, 0, 3}, {1, 2, 5, 14}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var spans []Span
+			cback := func(match Match, ctx interface{}) {
+				for i, kw := range match.Keywords() {
+					if i == 0 {
+						spans = append(spans, kw.Span)
+					}
+				}
+				for _, name := range []string{"file", "text"} {
+					for _, v := range match.Var(name) {
+						spans = append(spans, v.Span)
+					}
+				}
+				if kws := match.Keywords(); len(kws) > 1 {
+					spans = append(spans, kws[1].Span)
+				}
+			}
+			cmds.Add("get <file> verbose?", cback)
+			cmds.Add("say <text:rest>", cback)
+			cmds.Compile()
+
+			if !cmds.Parse(tc.input, nil) {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if !reflect.DeepEqual(spans, tc.expected) {
+				t.Fatalf("Expected the spans %v but got %v", tc.expected, spans)
+			}
+		})
+	}
+}
+
+func TestReuseBetweenParses(t *testing.T) {
+	var cmds Cmds
+	var got string
+	add := func(syntax string) {
+		cmds.Add(syntax, func(match Match, ctx interface{}) {
+			got = syntax
+			for _, v := range match.Var("file") {
+				got += " " + v.Value
+			}
+		})
+	}
+	add("get <file> verbose?")
+	add("get <file> <file> <file>")
+	add("put <file>+")
+	cmds.Compile()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"get a b c", "get <file> <file> <file> a b c"},
+		{"get a", "get <file> verbose? a"},
+		{"put a b c d", "put <file>+ a b c d"},
+		{"get b v", "get <file> verbose? b"},
+		{"put x", "put <file>+ x"},
+	}
+
+	// The threads and buffers of one parse are reused by the next, so running the inputs
+	// again in the same order checks that nothing is left over
+	for i := 0; i < 3; i++ {
+		for _, tc := range tests {
+			got = ""
+			if !cmds.Parse(tc.input, nil) {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if got != tc.expected {
+				t.Fatalf("Expected ‘%s’ to match ‘%s’ but got ‘%s’", tc.input, tc.expected, got)
+			}
+		}
+	}
+}
+
+func TestExcludedWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		defs  []string
+		input string
+		// expected are the values of the variable ‘name’ and the keywords entered, or
+		// empty if the input doesn't match exactly one command
+		expected string
+	}{
+		{"keyword after", []string{"delete <name!(all|none)>* (all | none)?"}, "delete all", "[] [delete all]"},
+		{"values", []string{"delete <name!(all|none)>* (all | none)?"}, "delete a b none", "[a b] [delete none]"},
+		{"abbreviation", []string{"delete <name!(all|none)>* (all | none)?"}, "delete al", ""},
+		{"without exclusion", []string{"delete <name>* (all | none)?"}, "delete all", ""},
+		{"other command", []string{"get <name!(all)>", "get all"}, "get all", "[] [get all]"},
+		{"typed", []string{"port <n:int!(0)>"}, "port 0", ""},
+		{"typed value", []string{"port <n:int!(0)>"}, "port 8", "[] [port]"},
+		{"rest", []string{"say <text:cmdline!(nothing)>"}, "say nothing", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.AddType(cmdlineType{})
+			var got string
+			for _, def := range tc.defs {
+				cmds.Add(def, func(match Match, ctx interface{}) {
+					var names, kws []string
+					for _, v := range match.Var("name") {
+						names = append(names, v.Value)
+					}
+					for _, kw := range match.Keywords() {
+						kws = append(kws, kw.Name)
+					}
+					got = fmt.Sprintf("%v %v", names, kws)
+				})
+			}
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if tc.expected == "" {
+				if ok {
+					t.Fatalf("Expected ‘%s’ not to run a command but it matched %s", tc.input, got)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if got != tc.expected {
+				t.Fatalf("Expected ‘%s’ to match %s but got %s", tc.input, tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Package cmdtest helps write tests for grammars defined with cmdparse.
+package cmdtest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jeffwilliams/cmdparse"
+)
+
+// AssertMatch fails the test ‘t’ unless ‘input’ matches exactly one of the compiled
+// ‘cmds’, whose definition is ‘syntax’, with the keywords and variables ‘expected’ in input
+// order. Keywords are written as the keyword and variables as their name in angle
+// brackets, as in BoundElement{"<file>", "a.txt"}. No callbacks are called. On failure
+// the expected and actual elements are listed side by side, along with the disassembled
+// program of the expected command, for example:
+//
+//    input ‘copy a’ matched ‘copy <src> <dst>?’ differently:
+//        copy = copy          copy = copy
+//      ! <src> = b            <src> = a
+//    program of ‘copy <src> <dst>?’:
+//    ...
+func AssertMatch(t testing.TB, cmds *cmdparse.Cmds, input, syntax string, expected ...cmdparse.BoundElement) {
+	t.Helper()
+
+	d, ok := cmds.Describe(input)
+	if !ok {
+		why := cmds.LongestMatches(input).String()
+		if amb := cmds.Ambiguity(input); amb != nil {
+			why = amb.Error()
+		}
+		t.Fatalf("input ‘%s’ didn't match ‘%s’: %s\n%s", input, syntax, why, program(cmds, syntax))
+		return
+	}
+
+	if d.Syntax != syntax {
+		t.Fatalf("input ‘%s’ matched ‘%s’ instead of ‘%s’\n%s", input, d.Syntax, syntax, program(cmds, syntax))
+		return
+	}
+
+	if diff := Diff(expected, d.Bound); diff != "" {
+		t.Fatalf("input ‘%s’ matched ‘%s’ differently:\n%s%s", input, syntax, diff, program(cmds, syntax))
+	}
+}
+
+// Diff returns the elements ‘exp’ and ‘act’ side by side, one pair per line with a ! at
+// the start of the lines that differ, or empty if they are the same.
+func Diff(exp, act []cmdparse.BoundElement) string {
+	n := len(exp)
+	if len(act) > n {
+		n = len(act)
+	}
+
+	var buf bytes.Buffer
+	differ := false
+	for i := 0; i < n; i++ {
+		var e, a string
+		if i < len(exp) {
+			e = fmt.Sprintf("%s = %s", exp[i].Element, exp[i].Value)
+		}
+		if i < len(act) {
+			a = fmt.Sprintf("%s = %s", act[i].Element, act[i].Value)
+		}
+
+		mark := " "
+		if i >= len(exp) || i >= len(act) || exp[i] != act[i] {
+			mark = "!"
+			differ = true
+		}
+		fmt.Fprintf(&buf, "  %s %-20s %s\n", mark, e, a)
+	}
+
+	if !differ {
+		return ""
+	}
+	return buf.String()
+}
+
+// program returns the disassembled instructions of the command ‘syntax’, or of all the
+// commands if there is no such command.
+func program(cmds *cmdparse.Cmds, syntax string) string {
+	var buf bytes.Buffer
+	for _, info := range cmds.Commands() {
+		if info.Syntax == syntax {
+			fmt.Fprintf(&buf, "program of ‘%s’:\n", syntax)
+			cmds.Disassemble(&buf, info.ProgramRange)
+			return buf.String()
+		}
+	}
+
+	buf.WriteString("program:\n")
+	cmds.Disassemble(&buf, cmdparse.ProgramRange{End: int(^uint(0) >> 1)})
+	return buf.String()
+}
+
+// Recording collects the commands that Parse would have run, as set up by Record.
+type Recording struct {
+	mu    sync.Mutex
+	calls []cmdparse.RecordedCall
+}
+
+// Record sets the recorder of ‘cmds’ so that Parse, instead of calling the callbacks of
+// the commands that the input matches, adds them to the returned Recording. It lets
+// integration tests check the commands that an application would run, for example:
+//
+//    rec := cmdtest.Record(app.Cmds)
+//    app.HandleLine("copy a b")
+//    calls := rec.Calls()
+//    if len(calls) != 1 || calls[0].Syntax != "copy <src> <dst>?" {
+//        ...
+//    }
+//
+// Call cmds.SetRecorder(nil) to make the commands run again.
+func Record(cmds *cmdparse.Cmds) *Recording {
+	r := &Recording{}
+	cmds.SetRecorder(r.record)
+	return r
+}
+
+func (r *Recording) record(call cmdparse.RecordedCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, call)
+}
+
+// Calls returns the commands recorded so far, in the order Parse matched them.
+func (r *Recording) Calls() []cmdparse.RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]cmdparse.RecordedCall(nil), r.calls...)
+}
+
+// Reset forgets the commands recorded so far.
+func (r *Recording) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+}
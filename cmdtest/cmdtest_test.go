@@ -0,0 +1,116 @@
+package cmdtest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jeffwilliams/cmdparse"
+)
+
+// recorder records the failure of an assertion instead of failing the test.
+type recorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+}
+
+func TestAssertMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		syntax   string
+		expected []cmdparse.BoundElement
+		failure  string
+	}{
+		{
+			"match",
+			"co a b",
+			"copy <src> <dst>?",
+			[]cmdparse.BoundElement{{Element: "copy", Value: "co"}, {Element: "<src>", Value: "a"}, {Element: "<dst>", Value: "b"}},
+			"",
+		},
+		{
+			"different values",
+			"copy a",
+			"copy <src> <dst>?",
+			[]cmdparse.BoundElement{{Element: "copy", Value: "copy"}, {Element: "<src>", Value: "b"}, {Element: "<dst>", Value: "c"}},
+			"input ‘copy a’ matched ‘copy <src> <dst>?’ differently:\n" +
+				"    copy = copy          copy = copy\n" +
+				"  ! <src> = b            <src> = a\n" +
+				"  ! <dst> = c            \n" +
+				"program of ‘copy <src> <dst>?’:\n",
+		},
+		{
+			"other command",
+			"del a",
+			"copy <src> <dst>?",
+			nil,
+			"input ‘del a’ matched ‘delete <src>’ instead of ‘copy <src> <dst>?’\n",
+		},
+		{
+			"no match",
+			"bogus",
+			"copy <src> <dst>?",
+			nil,
+			"input ‘bogus’ didn't match ‘copy <src> <dst>?’: unexpected word 'bogus' at position 1, expected one of: copy, delete\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds cmdparse.Cmds
+			cmds.Add("copy <src> <dst>?", nil)
+			cmds.Add("delete <src>", nil)
+			cmds.Compile()
+
+			var r recorder
+			AssertMatch(&r, &cmds, tc.input, tc.syntax, tc.expected...)
+			if tc.failure == "" {
+				if r.failure != "" {
+					t.Fatalf("The assertion failed: %s", r.failure)
+				}
+				return
+			}
+			if !strings.HasPrefix(r.failure, tc.failure) {
+				t.Fatalf("Expected the failure to begin with\n%s\nbut it was\n%s", tc.failure, r.failure)
+			}
+			if !strings.Contains(r.failure, "cmp") {
+				t.Fatalf("The failure doesn't include the program:\n%s", r.failure)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	ran := false
+	cmds := &cmdparse.Cmds{}
+	cmds.Add("copy <src> <dst>?", func(m cmdparse.Match, ctx interface{}) { ran = true })
+	cmds.Compile()
+
+	rec := Record(cmds)
+	cmds.Parse("copy a b", nil)
+	cmds.Parse("copy c", nil)
+
+	calls := rec.Calls()
+	if ran {
+		t.Fatalf("the callback ran while recording")
+	}
+	if len(calls) != 2 {
+		t.Fatalf("recorded %d calls, expected 2", len(calls))
+	}
+	exp := []cmdparse.BoundElement{{Element: "copy", Value: "copy"}, {Element: "<src>", Value: "c"}}
+	if diff := Diff(exp, calls[1].Bound); diff != "" {
+		t.Fatalf("recorded different elements:\n%s", diff)
+	}
+
+	rec.Reset()
+	if calls := rec.Calls(); len(calls) != 0 {
+		t.Fatalf("recorded %d calls after Reset, expected 0", len(calls))
+	}
+}
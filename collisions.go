@@ -0,0 +1,156 @@
+package cmdparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CollisionPolicy is what happens when the input to Parse matches more than one command,
+// as set with SetCollisionPolicy. This happens when commands registered by different parts
+// of a program overlap.
+type CollisionPolicy int
+
+const (
+	// AmbiguousCollisions makes input that matches more than one command ambiguous, so
+	// that Parse fails unless the Resolver chooses one. This is the default.
+	AmbiguousCollisions CollisionPolicy = iota
+	// FirstAddedWins runs the command that was added first.
+	FirstAddedWins
+	// HighestPriorityWins runs the command with the highest priority set with
+	// SetPriority. Input that matches more than one command with the highest priority is
+	// ambiguous.
+	HighestPriorityWins
+	// ReportCollisions makes Compile look for commands that overlap and return a
+	// CollisionWarning for each pair, so that a program can refuse to start rather than
+	// users finding the collisions. Input that matches more than one command is
+	// ambiguous.
+	ReportCollisions
+)
+
+func (p CollisionPolicy) String() string {
+	switch p {
+	case AmbiguousCollisions:
+		return "ambiguous"
+	case FirstAddedWins:
+		return "first added wins"
+	case HighestPriorityWins:
+		return "highest priority wins"
+	case ReportCollisions:
+		return "report"
+	}
+	return "<unknown>"
+}
+
+// SetCollisionPolicy sets what happens when the input to Parse or ParseToMatch matches
+// more than one command. The policy is applied before the Resolver, which is only called
+// if the input is still ambiguous. The policy must be set before Compile is called.
+func (c *Cmds) SetCollisionPolicy(p CollisionPolicy) {
+	c.collisionPolicy = p
+}
+
+// SetPriority sets the priority of the command whose definition is ‘syntax’, exactly as
+// it was passed to Add, for the HighestPriorityWins policy. Commands have priority 0
+// unless it's set.
+func (c *Cmds) SetPriority(syntax string, priority int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax == syntax {
+			cmd.priority = priority
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// applyCollisionPolicy returns the ‘matches’ that remain after applying the collision
+// policy. The matches must be sorted in the order their commands were added.
+func (c *Cmds) applyCollisionPolicy(matches []match) []match {
+	var keep func(cmd *command) bool
+	switch c.collisionPolicy {
+	case FirstAddedWins:
+		first := matches[0].meta.(*command)
+		keep = func(cmd *command) bool { return cmd == first }
+	case HighestPriorityWins:
+		highest := matches[0].meta.(*command).priority
+		for _, m := range matches {
+			if p := m.meta.(*command).priority; p > highest {
+				highest = p
+			}
+		}
+		keep = func(cmd *command) bool { return cmd.priority == highest }
+	default:
+		return matches
+	}
+
+	// The same command may match in more than one way, which is still ambiguous
+	var kept []match
+	for _, m := range matches {
+		if keep(m.meta.(*command)) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// collisionWarnings returns a CollisionWarning for each pair of commands that some input
+// matches both of, apart from pairs with a command in ‘skip’. The inputs are made from the
+// paths through each command like Analyze.
+func (c *Cmds) collisionWarnings(skip map[*command]bool) (w Warnings) {
+	prog := c.program().instrs
+	sample := analysisStrSample(prog)
+
+	order := make(map[*command]int)
+	for i, cmd := range c.commands {
+		order[cmd] = i
+	}
+	reported := make(map[[2]int]bool)
+
+	for _, cmd := range c.commands {
+		if skip[cmd] {
+			continue
+		}
+		for _, path := range analysisPaths(prog, c.spanOf(cmd).Start) {
+			if i := restIndex(path); i >= 0 && i < len(path)-1 {
+				continue
+			}
+			input, ok := analysisInput(path, sample)
+			if !ok {
+				continue
+			}
+
+			matches := c.match(input, ParseOptions{})
+			c.sortByAddOrder(matches)
+			for _, m := range matches {
+				other := m.meta.(*command)
+				pair := [2]int{order[cmd], order[other]}
+				sort.Ints(pair[:])
+				if other == cmd || reported[pair] || !cmd.sharesGrammar(other) || skip[other] {
+					continue
+				}
+				reported[pair] = true
+				w = append(w, Warning{
+					Kind:    CollisionWarning,
+					Syntax:  cmd.syntax,
+					Message: fmt.Sprintf("input such as ‘%s’ also matches ‘%s’", strings.Join(input, " "), other.syntax),
+				})
+			}
+		}
+	}
+	return
+}
+
+// sharesGrammar returns true if there is a grammar that both ‘cmd’ and ‘other’ are in.
+func (cmd *command) sharesGrammar(other *command) bool {
+	if cmd.grammars == nil || other.grammars == nil {
+		return true
+	}
+	for g := range cmd.grammars {
+		if other.grammars[g] {
+			return true
+		}
+	}
+	return false
+}
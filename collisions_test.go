@@ -0,0 +1,66 @@
+package cmdparse
+
+import (
+	"testing"
+)
+
+func TestCollisionPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   CollisionPolicy
+		input    string
+		expected string
+	}{
+		{"ambiguous", AmbiguousCollisions, "get verbose", ""},
+		{"first added", FirstAddedWins, "get verbose", "get <file>"},
+		{"highest priority", HighestPriorityWins, "get verbose", "get verbose"},
+		{"same priority", HighestPriorityWins, "set x", ""},
+		{"same command twice", FirstAddedWins, "set x", "set <a> <b>?"},
+		{"no collision", FirstAddedWins, "get other", "get <file>"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var called string
+			for _, syntax := range []string{"get <file>", "get verbose", "set <a> <b>?", "set <c>"} {
+				syntax := syntax
+				cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+			}
+			cmds.SetCollisionPolicy(tc.policy)
+			if err := cmds.SetPriority("get verbose", 1); err != nil {
+				t.Fatalf("SetPriority failed: %v", err)
+			}
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != (tc.expected != "") {
+				t.Fatalf("Expected Parse to return %v but it returned %v", tc.expected != "", ok)
+			}
+			if called != tc.expected {
+				t.Fatalf("Expected ‘%s’ to be called but ‘%s’ was", tc.expected, called)
+			}
+		})
+	}
+}
+
+func TestReportCollisions(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	cmds.Add("get <file>", cback)
+	cmds.Add("get verbose", cback)
+	cmds.Add("show <n:int>", cback)
+	cmds.Add("show <name>", cback)
+	cmds.Add("list v1", cback)
+	cmds.Add("list v1", cback)
+	cmds.Add("stop", cback)
+	cmds.SetGrammars("list v1", "v1")
+	cmds.SetCollisionPolicy(ReportCollisions)
+
+	expected := "collision in ‘get verbose’: input such as ‘get verbose’ also matches ‘get <file>’\n" +
+		"collision in ‘show <n:int>’: input such as ‘show 1’ also matches ‘show <name>’\n" +
+		"collision in ‘list v1’: input such as ‘list v1’ also matches ‘list v1’"
+	if w := cmds.Compile(); w.String() != expected {
+		t.Fatalf("Expected warnings:\n%s\nbut got:\n%s", expected, w)
+	}
+}
@@ -11,17 +11,34 @@ instructions:
 Alts: compile a split instruction: continue at all addresses
 Terms: concatenate all the instructions of the subterms
 Rep: split
-Word: match: take the current input word w and see if it is a prefix of the Word token
+Word: match: take the current input word w and see if it is a prefix of the Word token,
+      or equal to it for an exact word
 Var: collect the field into a list for that varname
 
 */
 
 type compiler struct {
-	instr prog
+	instr []instr
 	pc    int
+	// types are the types added with Cmds.AddType
+	types map[string]Type
+	// instructions are the custom instructions added with Cmds.AddInstruction
+	instructions map[string]Instruction
+	// sets is the number of sets emitted, which identifies the next one
+	sets int
 }
 
-type prog []instr
+// prog is a compiled program.
+type prog struct {
+	instrs []instr
+	// sensitive is set if the program saves any variable flagged as secret or sensitive
+	sensitive bool
+}
+
+// newProg returns the program of the instructions ‘instrs’.
+func newProg(instrs []instr) prog {
+	return prog{instrs: instrs, sensitive: hasSensitive(instrs)}
+}
 
 func (c *compiler) compile(ptree interface{}) {
 	if ptree == nil {
@@ -33,7 +50,7 @@ func (c *compiler) compile(ptree interface{}) {
 }
 
 func (c *compiler) prog() prog {
-	return c.instr
+	return newProg(c.instr)
 }
 
 func (c compiler) countinstrForProgram(ptree interface{}) int {
@@ -45,9 +62,9 @@ func (c compiler) countinstr(ptree interface{}) int {
 	switch node := ptree.(type) {
 	case alts:
 		return 2 + c.countinstr(node.Left) + c.countinstr(node.Right)
-	case word:
+	case word, exactWord, aliasedWord:
 		return 1
-	case variable:
+	case variable, custom:
 		return 1
 	case rep:
 		switch node.Op {
@@ -57,11 +74,21 @@ func (c compiler) countinstr(ptree interface{}) int {
 			return c.countinstr(node.Term) + 1
 		case repeatZeroOrOne:
 			return 1 + c.countinstr(node.Term)
+		case repeatCounted:
+			return c.countinstr(node.unrolled())
 		}
 	case terms:
 		return c.countinstr(node.Left) + c.countinstr(node.Right)
 	case meta:
 		return 1 + c.countinstr(node.ch)
+	case group:
+		return 2 + c.countinstr(node.Term)
+	case set:
+		n := 1
+		for _, opt := range node.Options {
+			n += 3 + c.countinstr(opt)
+		}
+		return n
 	default:
 		panic(fmt.Sprintf("Compiler.countinstr: unknown node type %T in parse tree", node))
 	}
@@ -74,14 +101,29 @@ func (c *compiler) emit(ptree interface{}) {
 		c.emitAlts(node)
 	case word:
 		c.emitWord(node)
+	case exactWord:
+		c.emitWord(word(node))
+		c.instr[c.pc-1].ints[0] = cmpExact
+	case aliasedWord:
+		c.emitWord(word(node.Keyword))
+		c.instr[c.pc-1].aliases = node.Aliases
+		if node.Exact {
+			c.instr[c.pc-1].ints[0] = cmpExact
+		}
 	case variable:
 		c.emitVar(node)
+	case custom:
+		c.emitCustom(node)
 	case terms:
 		c.emitTerms(node)
 	case rep:
 		c.emitRep(node)
 	case meta:
 		c.emitMeta(node)
+	case group:
+		c.emitGroup(node)
+	case set:
+		c.emitSet(node)
 	default:
 		panic(fmt.Sprintf("Compiler.emit: unknown node type %T in parse tree", node))
 	}
@@ -111,8 +153,33 @@ func (c *compiler) emitWord(w word) {
 
 func (c *compiler) emitVar(v variable) {
 	c.instr[c.pc].opcode = opSave
+	// Every word is a valid str, so variables of type str don't need their type
+	if t := lookupType(v.Type, c.types); t != nil && t.Name() != "str" {
+		c.instr[c.pc].intf = t
+		if _, ok := t.(restType); ok {
+			c.instr[c.pc].opcode = opSaveRest
+		}
+	}
 	c.instr[c.pc].strs[0] = v.Name
 	c.instr[c.pc].strs[1] = v.Type
+	c.instr[c.pc].ints[0] = int(v.Flags)
+	c.instr[c.pc].excluded = v.Exclude
+	c.pc++
+}
+
+// emitCustom emits the custom instruction that matches the variable ‘v’. If the
+// instruction isn't known or it fails to compile, it has no operand and never matches.
+func (c *compiler) emitCustom(v custom) {
+	in := &c.instr[c.pc]
+	in.opcode = opCustom
+	in.strs[0] = v.Name
+	in.strs[1] = "@" + v.Instr
+	in.args = v.Args
+	if inst, ok := c.instructions[v.Instr]; ok {
+		if operand, err := inst.Compile(v.Args); err == nil {
+			in.intf = compiledInstruction{inst: inst, operand: operand}
+		}
+	}
 	c.pc++
 }
 
@@ -129,6 +196,8 @@ func (c *compiler) emitRep(r rep) {
 		c.emitOneOrMore(r)
 	case repeatZeroOrOne:
 		c.emitZeroOrOne(r)
+	case repeatCounted:
+		c.emit(r.unrolled())
 	}
 }
 
@@ -185,8 +254,64 @@ func (c *compiler) emitMeta(m meta) {
 	c.emit(m.ch)
 }
 
+func (c *compiler) emitGroup(g group) {
+	c.instr[c.pc].opcode = opGroupStart
+	c.instr[c.pc].strs[0] = g.Name
+	c.pc++
+
+	c.emit(g.Term)
+
+	c.instr[c.pc].opcode = opGroupEnd
+	c.instr[c.pc].strs[0] = g.Name
+	c.pc++
+}
+
+// emitSet emits a loop that matches any option of the set that hasn't been matched yet, and
+// can be left once every option that isn't optional has been matched:
+//
+//    loop: split opt0, next0
+//    opt0: option set, 0
+//          ...
+//          jmp loop
+//   next0: split opt1, next1
+//          ...
+//   nextN: endset set, required
+func (c *compiler) emitSet(s set) {
+	id := c.sets
+	c.sets++
+
+	loop := c.pc
+	required := 0
+	for i, opt := range s.Options {
+		if !s.Optional[i] {
+			required |= 1 << uint(i)
+		}
+
+		split := &c.instr[c.pc]
+		split.opcode = opSplit
+		split.ints[0] = c.pc + 1
+		c.pc++
+
+		c.instr[c.pc].opcode = opSetOption
+		c.instr[c.pc].ints = [2]int{id, i}
+		c.pc++
+
+		c.emit(opt)
+
+		c.instr[c.pc].opcode = opJmp
+		c.instr[c.pc].ints[0] = loop
+		c.pc++
+
+		split.ints[1] = c.pc
+	}
+
+	c.instr[c.pc].opcode = opSetEnd
+	c.instr[c.pc].ints = [2]int{id, required}
+	c.pc++
+}
+
 func (c compiler) printinstr(w io.Writer) {
-	c.instr.Print(w)
+	c.prog().Print(w)
 }
 
 type opcode int
@@ -199,6 +324,17 @@ const (
 	opSave  // Save the value of the current token as a variable. NOTE: this is different from Russ Cox' code!
 	opMeta  // Set the metadata for the current thread
 	opMatch // All done, we matched the command
+	// Save the rest of the input as a variable, if it's valid for the type in intf
+	opSaveRest
+	// Mark the start and end of the items matched by a named group
+	opGroupStart
+	opGroupEnd
+	// Mark the option ints[1] of the set ints[0] as matched, unless it already is
+	opSetOption
+	// Leave the set ints[0] if the options in the bits of ints[1] have been matched
+	opSetEnd
+	// Save the words that the custom instruction in intf matches as a variable
+	opCustom
 )
 
 func (o opcode) String() string {
@@ -217,15 +353,27 @@ func (o opcode) String() string {
 		return "save"
 	case opMeta:
 		return "meta"
+	case opSaveRest:
+		return "saverest"
+	case opGroupStart:
+		return "group"
+	case opGroupEnd:
+		return "endgroup"
+	case opSetOption:
+		return "option"
+	case opSetEnd:
+		return "endset"
+	case opCustom:
+		return "custom"
 	}
 	return "unknown"
 }
 
 func (o opcode) NumArgs() int {
 	switch o {
-	case opSplit, opSave:
+	case opSplit, opSave, opSaveRest, opSetOption, opSetEnd, opCustom:
 		return 2
-	case opJmp, opCmp:
+	case opJmp, opCmp, opGroupStart, opGroupEnd:
 		return 1
 	case opMeta:
 		return 1
@@ -239,9 +387,9 @@ func (o opcode) Arg(n *instr, i int) interface{} {
 	switch o {
 	case opNop, opMatch:
 		return nil
-	case opSplit, opJmp:
+	case opSplit, opJmp, opSetOption, opSetEnd:
 		return n.ints[i]
-	case opCmp, opSave:
+	case opCmp, opSave, opSaveRest, opGroupStart, opGroupEnd, opCustom:
 		return "'" + n.strs[i] + "'"
 	case opMeta:
 		return n.intf
@@ -249,13 +397,40 @@ func (o opcode) Arg(n *instr, i int) interface{} {
 	return nil
 }
 
+// cmpExact is set in ints[0] of an opCmp that only matches the keyword spelled in full.
+const cmpExact = 1
+
 type instr struct {
 	opcode opcode
 	ints   [2]int
 	strs   [2]string
 	intf   interface{}
-	// gen is the generation of the instruction (set and used by the VM when executing)
-	gen int
+	// excluded are the words that an opSave or opSaveRest doesn't match
+	excluded []string
+	// aliases are the other spellings of the keyword of an opCmp
+	aliases []string
+	// args are the arguments an opCustom was compiled with
+	args []string
+}
+
+// spellings returns the keyword of an opCmp followed by its aliases.
+func (i *instr) spellings() []string {
+	return append([]string{i.strs[0]}, i.aliases...)
+}
+
+// excludes returns true if ‘val’ is one of the words the instruction doesn't match.
+func (i *instr) excludes(val string) bool {
+	return isExcluded(i.excluded, val)
+}
+
+// isExcluded returns true if ‘val’ is one of the ‘excluded’ words.
+func isExcluded(excluded []string, val string) bool {
+	for _, w := range excluded {
+		if w == val {
+			return true
+		}
+	}
+	return false
 }
 
 func (i instr) String() string {
@@ -270,8 +445,19 @@ func (i instr) String() string {
 	return s
 }
 
+// hasSensitive returns true if the instructions ‘instrs’ save any variable flagged as secret
+// or sensitive.
+func hasSensitive(instrs []instr) bool {
+	for i := range instrs {
+		if (instrs[i].opcode == opSave || instrs[i].opcode == opSaveRest) && VarFlags(instrs[i].ints[0]).IsSensitive() {
+			return true
+		}
+	}
+	return false
+}
+
 func (p prog) Print(w io.Writer) {
-	for i, instr := range p {
+	for i, instr := range p.instrs {
 		fmt.Fprintf(w, "%3d: %s\n", i, instr)
 	}
 }
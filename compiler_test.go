@@ -7,7 +7,7 @@ import (
 )
 
 type Comparer struct {
-	exp, act prog
+	exp, act []instr
 	t        *testing.T
 }
 
@@ -15,7 +15,7 @@ func (c *Comparer) setT(t *testing.T) {
 	c.t = t
 }
 
-func (c *Comparer) setCode(exp, act prog) {
+func (c *Comparer) setCode(exp, act []instr) {
 	c.exp = exp
 	c.act = act
 }
@@ -40,9 +40,9 @@ func (c Comparer) progsToStr() string {
 	var buf bytes.Buffer
 	buf.WriteString("programs:\n")
 	buf.WriteString("expected:\n")
-	c.exp.Print(&buf)
+	newProg(c.exp).Print(&buf)
 	buf.WriteString("actual:\n")
-	c.act.Print(&buf)
+	newProg(c.act).Print(&buf)
 	return buf.String()
 }
 
@@ -63,7 +63,7 @@ func TestCompiler(t *testing.T) {
 		{
 			name:  "show",
 			input: word("show"),
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opCmp, strs: [2]string{"show"}},
 				instr{opcode: opMatch},
 			},
@@ -74,7 +74,7 @@ func TestCompiler(t *testing.T) {
 				word("this"),
 				word("that"),
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opSplit, ints: [2]int{1, 3}},
 				instr{opcode: opCmp, strs: [2]string{"this"}},
 				instr{opcode: opJmp, ints: [2]int{4}},
@@ -91,7 +91,7 @@ func TestCompiler(t *testing.T) {
 					word("other"),
 				},
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opSplit, ints: [2]int{1, 3}},
 				instr{opcode: opCmp, strs: [2]string{"this"}},
 				instr{opcode: opJmp, ints: [2]int{7}},
@@ -110,7 +110,7 @@ func TestCompiler(t *testing.T) {
 				Term: word("this"),
 				Op:   repeatZeroOrMore,
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opSplit, ints: [2]int{1, 3}},
 				instr{opcode: opCmp, strs: [2]string{"this"}},
 				instr{opcode: opJmp, ints: [2]int{0}},
@@ -127,7 +127,7 @@ func TestCompiler(t *testing.T) {
 					word("that"),
 				},
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opSplit, ints: [2]int{1, 5}},
 
 				instr{opcode: opSplit, ints: [2]int{2, 4}},
@@ -144,7 +144,7 @@ func TestCompiler(t *testing.T) {
 				Op:   repeatOneOrMore,
 				Term: word("a"),
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opCmp, strs: [2]string{"a"}},
 				instr{opcode: opSplit, ints: [2]int{0, 2}},
 
@@ -157,7 +157,7 @@ func TestCompiler(t *testing.T) {
 				Left:  word("get"),
 				Right: word("hat"),
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opCmp, strs: [2]string{"get"}},
 				instr{opcode: opCmp, strs: [2]string{"hat"}},
 
@@ -168,12 +168,50 @@ func TestCompiler(t *testing.T) {
 			name: "get <var>",
 			input: terms{
 				Left:  word("get"),
-				Right: variable{"var", "string"},
+				Right: variable{Name: "var", Type: "string"},
 			},
-			expected: prog{
+			expected: []instr{
 				instr{opcode: opCmp, strs: [2]string{"get"}},
 				instr{opcode: opSave, strs: [2]string{"var", "string"}},
 
+				instr{opcode: opMatch},
+			},
+		},
+		{
+			name: "(from <host>):src",
+			input: group{
+				Name: "src",
+				Term: terms{
+					Left:  word("from"),
+					Right: variable{Name: "host", Type: "string"},
+				},
+			},
+			expected: []instr{
+				instr{opcode: opGroupStart, strs: [2]string{"src"}},
+				instr{opcode: opCmp, strs: [2]string{"from"}},
+				instr{opcode: opSave, strs: [2]string{"host", "string"}},
+				instr{opcode: opGroupEnd, strs: [2]string{"src"}},
+
+				instr{opcode: opMatch},
+			},
+		},
+		{
+			name: "{ a? b }",
+			input: set{
+				Options:  []interface{}{word("a"), word("b")},
+				Optional: []bool{true, false},
+			},
+			expected: []instr{
+				instr{opcode: opSplit, ints: [2]int{1, 4}},
+				instr{opcode: opSetOption, ints: [2]int{0, 0}},
+				instr{opcode: opCmp, strs: [2]string{"a"}},
+				instr{opcode: opJmp, ints: [2]int{0}},
+				instr{opcode: opSplit, ints: [2]int{5, 8}},
+				instr{opcode: opSetOption, ints: [2]int{0, 1}},
+				instr{opcode: opCmp, strs: [2]string{"b"}},
+				instr{opcode: opJmp, ints: [2]int{0}},
+				instr{opcode: opSetEnd, ints: [2]int{0, 2}},
+
 				instr{opcode: opMatch},
 			},
 		},
@@ -196,7 +234,7 @@ func TestCompiler(t *testing.T) {
 
 			var cmp Comparer
 			cmp.setT(t)
-			cmp.setCode(tc.expected, prog)
+			cmp.setCode(tc.expected, prog.instrs)
 			cmp.ensureCodeEqual()
 
 		})
@@ -0,0 +1,254 @@
+package cmdparse
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Completion is a suggestion for the word being typed, returned by Cmds.Complete.
+type Completion struct {
+	// Text is the suggested word. Keywords that contain spaces are quoted. For a
+	// PlaceholderCompletion it's the variable in angle brackets, such as <file>, and is not
+	// meant to be inserted.
+	Text string
+	Kind CompletionKind
+	// Var is the name of the variable for ValueCompletions and PlaceholderCompletions.
+	Var string
+}
+
+// CompletionKind tells where a Completion came from.
+type CompletionKind int
+
+const (
+	// KeywordCompletion is a keyword that begins with the word being typed.
+	KeywordCompletion CompletionKind = iota
+	// ValueCompletion is a value for a variable listed by the Type of the variable.
+	ValueCompletion
+	// PlaceholderCompletion stands for a variable whose values can't be listed.
+	PlaceholderCompletion
+	// FuzzyCompletion is a keyword that contains the letters of the word being typed in
+	// order, but doesn't begin with it.
+	FuzzyCompletion
+)
+
+func (k CompletionKind) String() string {
+	switch k {
+	case KeywordCompletion:
+		return "keyword"
+	case ValueCompletion:
+		return "value"
+	case PlaceholderCompletion:
+		return "placeholder"
+	case FuzzyCompletion:
+		return "fuzzy"
+	}
+	return "<unknown>"
+}
+
+// Completions are the suggestions returned by Cmds.Complete, along with the part of the
+// input they replace.
+type Completions struct {
+	Items []Completion
+	// InWord is true when the suggestions are for the word the input ends in, and false
+	// when they are for the next word because the input ends with a space.
+	InWord bool
+	// Start and End are the rune offsets of the text in the input that a suggestion
+	// replaces. When InWord is true this is the last word, including any opening quote.
+	// Otherwise Start and End are both the length of the input and a suggestion is
+	// inserted at the end.
+	Start, End int
+}
+
+// CompletionLess reports whether the Completion ‘a’ should be listed before ‘b’.
+type CompletionLess func(a, b Completion) bool
+
+// DefaultCompletionLess lists keywords first, then values for variables, then
+// placeholders and finally fuzzy suggestions. Completions of the same kind are sorted
+// alphabetically.
+func DefaultCompletionLess(a, b Completion) bool {
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	return a.Text < b.Text
+}
+
+// SetCompletionOrder sets the function used to order the results of Complete. By default
+// DefaultCompletionLess is used.
+func (c *Cmds) SetCompletionOrder(less CompletionLess) {
+	c.completionLess = less
+}
+
+// VarCompleter returns the values of a variable that begin with ‘prefix’, for example the
+// files in a directory or the hosts in an inventory.
+type VarCompleter func(prefix string) []string
+
+// CompleteVar sets the function that lists the values of the variables named ‘name’ for
+// Complete, in place of the values listed by the type of the variable. Values containing
+// spaces are quoted. Passing nil removes the function.
+func (c *Cmds) CompleteVar(name string, f VarCompleter) {
+	if c.varCompleters == nil {
+		c.varCompleters = make(map[string]VarCompleter)
+	}
+	c.varCompleters[name] = f
+}
+
+// CompleteType is like CompleteVar, but sets the function for the variables of the type
+// ‘typ’, as in <dst:host>. A function set with CompleteVar for the name of a variable
+// takes precedence.
+func (c *Cmds) CompleteType(typ string, f VarCompleter) {
+	if c.typeCompleters == nil {
+		c.typeCompleters = make(map[string]VarCompleter)
+	}
+	c.typeCompleters[typ] = f
+}
+
+// varCompleter returns the function set to list the values of the variable saved by
+// ‘instr’, or nil if there isn't one.
+func (c *Cmds) varCompleter(instr *instr) VarCompleter {
+	if f := c.varCompleters[instr.strs[0]]; f != nil {
+		return f
+	}
+	return c.typeCompleters[instr.strs[1]]
+}
+
+// Complete returns suggestions for the last word of the partially typed command ‘partial’.
+// If ‘partial’ ends with a space the suggestions are for the next word. Each suggestion is
+// returned once even if it's valid at several places in the grammar; when the same text is
+// suggested for different reasons only the one that orders first is kept.
+func (c *Cmds) Complete(partial string) Completions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	words, prefix, res := c.splitPartial(partial)
+
+	v := vm{exactKeywords: c.keywordMatching == ExactMatching, version: c.version}
+	expected := v.expectations(c.program(), words)
+
+	res.Items = c.completionsOf(expected, prefix)
+	return res
+}
+
+// completionsOf returns the ordered completions of the word beginning with ‘prefix’ for
+// the ‘expected’ instructions.
+func (c *Cmds) completionsOf(expected []*instr, prefix string) []Completion {
+	var comps []Completion
+	for _, instr := range expected {
+		switch instr.opcode {
+		case opCmp:
+			kw := instr.strs[0]
+			if strings.HasPrefix(kw, prefix) {
+				comps = append(comps, Completion{Text: quoteIfNeeded(kw), Kind: KeywordCompletion})
+			} else if alias := completedAlias(instr, prefix); alias != "" {
+				comps = append(comps, Completion{Text: quoteIfNeeded(alias), Kind: KeywordCompletion})
+			} else if prefix != "" && isSubsequence(prefix, kw) {
+				comps = append(comps, Completion{Text: quoteIfNeeded(kw), Kind: FuzzyCompletion})
+			}
+		case opSave, opSaveRest, opCustom:
+			name := instr.strs[0]
+			var vals []string
+			if f := c.varCompleter(instr); f != nil {
+				vals = f(prefix)
+			} else if t, ok := instr.intf.(Type); ok {
+				vals = t.Complete(prefix)
+			}
+			// The values are quoted like keywords, whether a completer or the type lists them
+			for _, val := range vals {
+				if !instr.excludes(val) {
+					comps = append(comps, Completion{Text: quoteIfNeeded(val), Kind: ValueCompletion, Var: name})
+				}
+			}
+			comps = append(comps, Completion{Text: "<" + name + ">", Kind: PlaceholderCompletion, Var: name})
+		}
+	}
+	return c.orderCompletions(comps)
+}
+
+// splitPartial splits the partially typed command into the words before the one being
+// typed, and the prefix of the word being typed. The returned Completions has its span
+// filled in.
+func (c *Cmds) splitPartial(partial string) (words []string, prefix string, res Completions) {
+	var s cmdScanner
+	s.posix = c.posixWords
+	s.lists = c.listLiterals
+	s.json = c.jsonLiterals
+	words = s.Scan(partial)
+
+	runes := []rune(partial)
+	res.Start = len(runes)
+	res.End = len(runes)
+
+	if s.err != nil {
+		// The input ends within a quote, list or JSON object, which is the word being
+		// typed even if it ends in a space. The scanner keeps the partial word, except that
+		// of a list or JSON object.
+		res.InWord = true
+		res.Start = s.starts[len(s.starts)-1]
+		if len(words) == len(s.starts) {
+			prefix = words[len(words)-1]
+			words = words[:len(words)-1]
+		}
+		return
+	}
+
+	endsWithSpace := len(runes) > 0 && unicode.IsSpace(runes[len(runes)-1])
+	if len(words) == 0 || endsWithSpace {
+		return
+	}
+
+	res.InWord = true
+	res.Start = s.starts[len(words)-1]
+	prefix = words[len(words)-1]
+	words = words[:len(words)-1]
+	return
+}
+
+// orderCompletions sorts the completions and removes duplicates.
+func (c *Cmds) orderCompletions(comps []Completion) []Completion {
+	less := c.completionLess
+	if less == nil {
+		less = DefaultCompletionLess
+	}
+
+	sort.SliceStable(comps, func(i, j int) bool {
+		return less(comps[i], comps[j])
+	})
+
+	seen := make(map[string]bool)
+	res := make([]Completion, 0, len(comps))
+	for _, comp := range comps {
+		if seen[comp.Text] {
+			continue
+		}
+		seen[comp.Text] = true
+		res = append(res, comp)
+	}
+	return res
+}
+
+// completedAlias returns the first alias of the keyword of the opCmp ‘instr’ that ‘prefix’
+// is a prefix of, or empty if there is none. Aliases are only completed when the keyword
+// itself isn't, so that a keyword is offered once.
+func completedAlias(instr *instr, prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	for _, alias := range instr.aliases {
+		if strings.HasPrefix(alias, prefix) {
+			return alias
+		}
+	}
+	return ""
+}
+
+// isSubsequence returns true if the runes of ‘s’ appear in ‘t’ in order.
+func isSubsequence(s, t string) bool {
+	rs := []rune(s)
+	i := 0
+	for _, r := range t {
+		if i < len(rs) && rs[i] == r {
+			i++
+		}
+	}
+	return i == len(rs)
+}
@@ -0,0 +1,246 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func completionsToStr(comps []Completion) string {
+	s := make([]string, len(comps))
+	for i, c := range comps {
+		s[i] = fmt.Sprintf("%s(%s)", c.Text, c.Kind)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "empty",
+			input:    "",
+			expected: "go(keyword) paint(keyword) say(keyword) set(keyword) show(keyword)",
+		},
+		{
+			name:     "prefix",
+			input:    "s",
+			expected: "say(keyword) set(keyword) show(keyword)",
+		},
+		{
+			name:     "fuzzy",
+			input:    "sw",
+			expected: "show(fuzzy)",
+		},
+		{
+			name:     "duplicates removed",
+			input:    "show ",
+			expected: "results(keyword) status(keyword)",
+		},
+		{
+			name:     "values before placeholders",
+			input:    "paint ",
+			expected: "blue(value) green(value) red(value) <c>(placeholder)",
+		},
+		{
+			name:     "value prefix",
+			input:    "paint gr",
+			expected: "green(value) <c>(placeholder)",
+		},
+		{
+			name:     "value quoted",
+			input:    "go n",
+			expected: `"new york"(value) <city>(placeholder)`,
+		},
+		{
+			name:     "keyword shadows value",
+			input:    "set r",
+			expected: "red(keyword) <c>(placeholder)",
+		},
+		{
+			name:     "no more words",
+			input:    "say hi ",
+			expected: "",
+		},
+		{
+			name:     "no match",
+			input:    "bogus ",
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+
+			cmds.AddType(colorType{})
+			cmds.Add("show results", cback)
+			cmds.Add("show results detail", cback)
+			cmds.Add("show status", cback)
+			cmds.Add("say <what>", cback)
+			cmds.Add("paint <c:color>", cback)
+			cmds.Add("set (red | <c:color>)", cback)
+			cmds.Add(`go <city:(paris|"new york")>`, cback)
+			cmds.Compile()
+
+			comps := completionsToStr(cmds.Complete(tc.input).Items)
+			if comps != tc.expected {
+				t.Fatalf("Expected completions ‘%s’ but got ‘%s’", tc.expected, comps)
+			}
+		})
+	}
+}
+
+func TestCompletionOrder(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+
+	cmds.Add("go (north | <place> | east)", cback)
+	cmds.Compile()
+
+	cmds.SetCompletionOrder(func(a, b Completion) bool {
+		if a.Kind != b.Kind {
+			return a.Kind > b.Kind
+		}
+		return a.Text > b.Text
+	})
+
+	comps := completionsToStr(cmds.Complete("go ").Items)
+	expected := "<place>(placeholder) north(keyword) east(keyword)"
+	if comps != expected {
+		t.Fatalf("Expected completions ‘%s’ but got ‘%s’", expected, comps)
+	}
+}
+
+func TestCompleteVar(t *testing.T) {
+	tests := []struct {
+		name     string
+		partial  string
+		expected string
+	}{
+		{"by name", "open re", `"report 2.txt"(value) readme.md(value) <file>(placeholder)`},
+		{"by type", "ping w", "web1(value) web2(value) <dst>(placeholder)"},
+		{"name over type", "copy ", "<file>(placeholder)"},
+		{"other variable", "open x ", "<mode>(placeholder)"},
+		{"excluded", "ssh ", "db1(value) <dst>(placeholder)"},
+	}
+
+	hosts := func(prefix string) []string {
+		var vals []string
+		for _, h := range []string{"db1", "web1", "web2"} {
+			if strings.HasPrefix(h, prefix) {
+				vals = append(vals, h)
+			}
+		}
+		return vals
+	}
+	files := func(prefix string) []string {
+		var vals []string
+		for _, f := range []string{"main.go", "readme.md", "report 2.txt"} {
+			if strings.HasPrefix(f, prefix) && prefix != "" {
+				vals = append(vals, f)
+			}
+		}
+		return vals
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+
+			cmds.Add("open <file> <mode>", cback)
+			cmds.Add("ping <dst:host>", cback)
+			cmds.Add("copy <file:host> <dst>", cback)
+			cmds.Add("ssh <dst:host!(web1|web2)>", cback)
+			cmds.CompleteVar("file", files)
+			cmds.CompleteType("host", hosts)
+			cmds.Compile()
+
+			comps := completionsToStr(cmds.Complete(tc.partial).Items)
+			if comps != tc.expected {
+				t.Fatalf("Expected completions ‘%s’ but got ‘%s’", tc.expected, comps)
+			}
+		})
+	}
+}
+
+func TestCompletionSpan(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		inWord     bool
+		start, end int
+		expected   string
+	}{
+		{"empty", "", false, 0, 0, "greet(keyword) say(keyword) show(keyword)"},
+		{"in first word", "sh", true, 0, 2, "show(keyword)"},
+		{"in first word after spaces", "  sh", true, 2, 4, "show(keyword)"},
+		{"next word", "show ", false, 5, 5, "results(keyword) status(keyword)"},
+		{"in second word", "show  st", true, 6, 8, "status(keyword) results(fuzzy)"},
+		{"in quoted word", `say "x y`, true, 4, 8, "<what>(placeholder)"},
+		{"in empty quoted word", `say "`, true, 4, 5, "<what>(placeholder)"},
+		{"in quoted word ending in a space", `say "hello `, true, 4, 11, "<what>(placeholder)"},
+		{"in quoted keyword ending in a space", `greet "good `, true, 6, 12, `"good morning"(keyword)`},
+		{"multibyte", "say ü", true, 4, 5, "<what>(placeholder)"},
+		{"quoted keyword", `greet "go`, true, 6, 9, `"good morning"(keyword)`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+
+			cmds.Add("show (results | status)", cback)
+			cmds.Add("say <what>", cback)
+			cmds.Add(`greet "good morning"`, cback)
+			cmds.Compile()
+
+			res := cmds.Complete(tc.input)
+			if res.InWord != tc.inWord {
+				t.Fatalf("Expected InWord to be %v but it was %v", tc.inWord, res.InWord)
+			}
+			if res.Start != tc.start || res.End != tc.end {
+				t.Fatalf("Expected the span to be %d-%d but it was %d-%d", tc.start, tc.end, res.Start, res.End)
+			}
+			comps := completionsToStr(res.Items)
+			if comps != tc.expected {
+				t.Fatalf("Expected completions ‘%s’ but got ‘%s’", tc.expected, comps)
+			}
+		})
+	}
+}
+
+func TestCompletionInPosixQuotes(t *testing.T) {
+	tests := []struct {
+		input    string
+		start    int
+		expected string
+	}{
+		{`greet 'good `, 6, `"good morning"(keyword)`},
+		{`greet "good `, 6, `"good morning"(keyword)`},
+		{`greet "go'od `, 6, ""},
+		{`greet '`, 6, `"good morning"(keyword)`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var cmds Cmds
+			cmds.Add(`greet "good morning"`, func(match Match, ctx interface{}) {})
+			cmds.SetPosixSplitting(true)
+			cmds.Compile()
+
+			res := cmds.Complete(tc.input)
+			if !res.InWord || res.Start != tc.start || res.End != len([]rune(tc.input)) {
+				t.Fatalf("Expected the word being typed to start at %d but the span was %d-%d (in word %v)", tc.start, res.Start, res.End, res.InWord)
+			}
+			if comps := completionsToStr(res.Items); comps != tc.expected {
+				t.Fatalf("Expected completions ‘%s’ but got ‘%s’", tc.expected, comps)
+			}
+		})
+	}
+}
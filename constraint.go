@@ -0,0 +1,160 @@
+package cmdparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AddConstraint adds a relation between the variables of the command whose definition is
+// ‘syntax’, exactly as it was passed to Add, that input must satisfy to match the command.
+// The ‘constraint’ is an expression in the language of ParseExpr whose identifiers are the
+// names of the command's variables, for example:
+//
+//    cmds.Add("range <start:int> <end:int>", cback)
+//    cmds.AddConstraint("range <start:int> <end:int>", "end >= start")
+//
+// Variables have their converted value if their type converts values, such as the number
+// of an int, or otherwise the word they matched; a variable bound more than once has its
+// last value. A constraint that refers to a variable the input didn't bind, such as an
+// optional one, isn't checked.
+//
+// Interpretations that break a constraint are dropped as they are matched, so they don't
+// make the input ambiguous. When they are the only reason the input doesn't match,
+// ParseErr returns a *ConstraintError.
+func (c *Cmds) AddConstraint(syntax, constraint string) error {
+	e, err := ParseExpr(constraint)
+	if err != nil {
+		return fmt.Errorf("invalid constraint ‘%s’: %v", constraint, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax != syntax {
+			continue
+		}
+		vars, _ := elementNames(cmd.tree)
+		idents := exprIdents(e)
+		for _, name := range idents {
+			if !vars[name] {
+				return fmt.Errorf("the command ‘%s’ has no variable ‘%s’", syntax, name)
+			}
+		}
+		cmd.constraints = append(cmd.constraints, varConstraint{text: constraint, expr: e, vars: idents})
+		return nil
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// varConstraint is a relation between the variables of a command added with AddConstraint.
+type varConstraint struct {
+	text string
+	expr Expr
+	// vars are the names of the variables the constraint refers to, sorted
+	vars []string
+}
+
+// exprIdents returns the identifiers in the expression ‘e’ returned by ParseExpr, sorted
+// and without duplicates.
+func exprIdents(e Expr) []string {
+	seen := make(map[string]bool)
+	var walk func(e Expr)
+	walk = func(e Expr) {
+		switch e := e.(type) {
+		case identExpr:
+			seen[string(e)] = true
+		case unaryExpr:
+			walk(e.x)
+		case binaryExpr:
+			walk(e.l)
+			walk(e.r)
+		}
+	}
+	walk(e)
+
+	idents := make([]string, 0, len(seen))
+	for name := range seen {
+		idents = append(idents, name)
+	}
+	sort.Strings(idents)
+	return idents
+}
+
+// checkConstraints returns a *ConstraintError for the first constraint of the command
+// matched by ‘m’ that the match breaks, or nil if it breaks none.
+func (cmd *command) checkConstraints(m match) *ConstraintError {
+	if len(cmd.constraints) == 0 {
+		return nil
+	}
+
+	vals := make(map[string]interface{})
+	bound := make(map[string]VarValue)
+	for _, item := range m.items {
+		if v, ok := item.(VarValue); ok {
+			bound[v.Name] = v
+			if conv := v.converted(); conv != nil {
+				vals[v.Name] = conv
+			} else {
+				vals[v.Name] = v.Value
+			}
+		}
+	}
+
+outer:
+	for _, cons := range cmd.constraints {
+		for _, name := range cons.vars {
+			if _, ok := bound[name]; !ok {
+				continue outer
+			}
+		}
+
+		val, err := cons.expr.Eval(vals)
+		if err == nil {
+			if b, ok := val.(bool); ok && b {
+				continue
+			} else if !ok {
+				err = fmt.Errorf("its value is %s rather than a boolean", exprTypeName(val))
+			}
+		}
+
+		cerr := &ConstraintError{Syntax: cmd.syntax, Constraint: cons.text, Err: err}
+		for _, name := range cons.vars {
+			cerr.Vars = append(cerr.Vars, BoundElement{Element: "<" + name + ">", Value: bound[name].Redacted()})
+		}
+		return cerr
+	}
+	return nil
+}
+
+// ConstraintError is the error returned by ParseErr when input would match a command but
+// for one of the constraints added with AddConstraint.
+type ConstraintError struct {
+	// Syntax is the definition of the command.
+	Syntax string
+	// Constraint is the constraint that the input breaks, as it was passed to
+	// AddConstraint.
+	Constraint string
+	// Vars are the variables the constraint refers to, with the values from the input.
+	// The values of sensitive variables are redacted.
+	Vars []BoundElement
+	// Err is the error evaluating the constraint, or nil if it was false.
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	vals := make([]string, len(e.Vars))
+	for i, v := range e.Vars {
+		vals[i] = v.Element + " is " + v.Value
+	}
+
+	msg := fmt.Sprintf("the constraint ‘%s’ of ‘%s’ is false", e.Constraint, e.Syntax)
+	if e.Err != nil {
+		msg = fmt.Sprintf("the constraint ‘%s’ of ‘%s’ failed: %v", e.Constraint, e.Syntax, e.Err)
+	}
+	if len(vals) > 0 {
+		msg += " when " + strings.Join(vals, " and ")
+	}
+	return msg
+}
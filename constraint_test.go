@@ -0,0 +1,91 @@
+package cmdparse
+
+import (
+	"testing"
+)
+
+func TestAddConstraint(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		error    string
+	}{
+		{"holds", "range 1 5", "range <start:int> <end:int>", ""},
+		{"equal", "range 5 5", "range <start:int> <end:int>", ""},
+		{"broken", "range 5 1", "",
+			"the constraint ‘end >= start’ of ‘range <start:int> <end:int>’ is false when <end> is 1 and <start> is 5"},
+		{"drops an interpretation", "copy a b", "copy <src> <dst>", ""},
+		{"resolves ambiguity", "copy a a", "copy <src> <dst:(a|b)>", ""},
+		{"unbound variable", "page 3", "page <n:int> <max:int>?", ""},
+		{"bound optional variable", "page 3 2", "",
+			"the constraint ‘n <= max’ of ‘page <n:int> <max:int>?’ is false when <max> is 2 and <n> is 3"},
+		{"sensitive", "login bob bob", "",
+			"the constraint ‘pw != user’ of ‘login <user> <pw:str!sensitive>’ is false when <pw> is <redacted> and <user> is bob"},
+		{"not a boolean", "scale 2", "",
+			"the constraint ‘n * 2’ of ‘scale <n:int>’ failed: its value is a number rather than a boolean when <n> is 2"},
+		{"no match", "nothing", "", "unexpected word 'nothing' at position 1, expected one of: range, copy, page, login, scale"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var syntax string
+			add := func(cmd, constraint string) {
+				cmds.Add(cmd, func(match Match, ctx interface{}) { syntax = cmd })
+				if constraint != "" {
+					if err := cmds.AddConstraint(cmd, constraint); err != nil {
+						t.Fatalf("AddConstraint failed: %v", err)
+					}
+				}
+			}
+
+			add("range <start:int> <end:int>", "end >= start")
+			add("copy <src> <dst>", "src != dst")
+			add("copy <src> <dst:(a|b)>", "src == dst")
+			add("page <n:int> <max:int>?", "n <= max")
+			add("login <user> <pw:str!sensitive>", "pw != user")
+			add("scale <n:int>", "n * 2")
+			cmds.Compile()
+
+			err := cmds.ParseErr(tc.input, nil)
+			if tc.error != "" {
+				if err == nil || err.Error() != tc.error {
+					t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseErr failed: %v", err)
+			}
+			if syntax != tc.expected {
+				t.Fatalf("Expected the command ‘%s’ but got ‘%s’", tc.expected, syntax)
+			}
+		})
+	}
+}
+
+func TestAddConstraintErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		syntax     string
+		constraint string
+		error      string
+	}{
+		{"invalid", "range <a> <b>", "a >", "invalid constraint ‘a >’: expression ends where a value was expected"},
+		{"unknown variable", "range <a> <b>", "a < c", "the command ‘range <a> <b>’ has no variable ‘c’"},
+		{"unknown command", "range <a>", "a < 1", "there is no command ‘range <a>’"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.Add("range <a> <b>", nil)
+
+			err := cmds.AddConstraint(tc.syntax, tc.constraint)
+			if err == nil || err.Error() != tc.error {
+				t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package cmdparse
+
+import (
+	"context"
+	"fmt"
+)
+
+// ContextCallback is the callback of a command added with AddWithContext. It's passed the
+// context the input was parsed with, and the error it returns is returned by ParseContext.
+type ContextCallback func(ctx context.Context, m Match) error
+
+// AddWithContext registers the command definition ‘cmd’ like Add, with a callback that is
+// passed a context and returns an error, so that long-running commands can be cancelled
+// and failures reported to the caller, for example:
+//
+//    cmds.AddWithContext("fetch <url>", func(ctx context.Context, m Match) error {
+//        req, err := http.NewRequestWithContext(ctx, "GET", m.Var("url")[0].Value, nil)
+//        if err != nil {
+//            return err
+//        }
+//        ...
+//    })
+//
+// The context is derived from the one passed to ParseContext. When the command is run by
+// the other Parse functions, it's derived from their ‘ctx’ if that is a context.Context,
+// and otherwise from context.Background(). Parsing commands with it from the callback
+// counts towards the nesting limit described by Parse.
+func (c *Cmds) AddWithContext(cmd string, cback ContextCallback) error {
+	t, err := c.scanAndParse(cmd)
+	if err != nil {
+		return err
+	}
+
+	c.addCommand(&command{syntax: cmd, ccback: cback, tree: t})
+	return nil
+}
+
+// ParseContext is like ParseErr, but stops matching the input when ‘ctx’ is cancelled, so
+// that pathological inputs can be given a deadline, and passes ‘ctx’ to the callback. It
+// returns the error of ‘ctx’ if matching was stopped, and a *CallbackError if the callback
+// of a command added with AddWithContext returns an error. Callbacks of commands added
+// with the other Add functions are passed ‘ctx’ as their context value.
+func (c *Cmds) ParseContext(ctx context.Context, cmd string) error {
+	return c.ParseContextWithOptions(ctx, cmd, ParseOptions{})
+}
+
+// ParseContextWithOptions is like ParseContext, but matches the input according to ‘opts’.
+func (c *Cmds) ParseContextWithOptions(ctx context.Context, cmd string, opts ParseOptions) error {
+	opts.ctx = ctx
+	_, _, err := c.parseErr(cmd, ctx, opts)
+	return err
+}
+
+// callKey is the key of the *callState in the contexts passed to callbacks.
+type callKey struct{}
+
+// withCall returns a context derived from ‘ctx’ that carries the state ‘call’ of the call
+// the callback it's passed to runs in.
+func withCall(ctx context.Context, call *callState) context.Context {
+	return context.WithValue(ctx, callKey{}, call)
+}
+
+// callOf returns the state of the call carried by the context value ‘ctx’, or nil if it
+// isn't a context that carries one.
+func callOf(ctx interface{}) *callState {
+	if cctx, ok := ctx.(context.Context); ok {
+		call, _ := cctx.Value(callKey{}).(*callState)
+		return call
+	}
+	return nil
+}
+
+// contextOf returns the context value ‘ctx’ passed to a Parse function as a
+// context.Context, or context.Background() if it isn't one.
+func contextOf(ctx interface{}) context.Context {
+	if c, ok := ctx.(context.Context); ok {
+		return c
+	}
+	return context.Background()
+}
+
+// CallbackError is the error returned when the callback of a command added with
+// AddWithContext returns an error.
+type CallbackError struct {
+	// Syntax is the definition of the command.
+	Syntax string
+	// Err is the error returned by the callback.
+	Err error
+}
+
+func (e *CallbackError) Error() string {
+	return fmt.Sprintf("‘%s’ failed: %v", e.Syntax, e.Err)
+}
+
+// Unwrap returns the error returned by the callback.
+func (e *CallbackError) Unwrap() error {
+	return e.Err
+}
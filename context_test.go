@@ -0,0 +1,80 @@
+package cmdparse
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestParseContext(t *testing.T) {
+	errMissing := errors.New("missing")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name  string
+		lazy  bool
+		ctx   context.Context
+		input string
+		err   error
+		value interface{}
+	}{
+		{"ok", false, context.WithValue(context.Background(), ctxKey{}, "v"), "fetch a", nil, "v"},
+		{"error", false, context.Background(), "fetch missing", errMissing, nil},
+		{"plain callback", false, context.WithValue(context.Background(), ctxKey{}, "v"), "get a", nil, "v"},
+		{"cancelled", false, cancelled, "fetch a", context.Canceled, nil},
+		{"cancelled lazy", true, cancelled, "fetch a", context.Canceled, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var value interface{}
+			cmds := &Cmds{}
+			cmds.AddWithContext("fetch <url>", func(ctx context.Context, m Match) error {
+				value = ctx.Value(ctxKey{})
+				if m.Var("url")[0].Value == "missing" {
+					return errMissing
+				}
+				return nil
+			})
+			cmds.Add("get <file>", func(m Match, ctx interface{}) {
+				value = ctx.(context.Context).Value(ctxKey{})
+			})
+			cmds.SetLazyCompilation(tc.lazy)
+			cmds.Compile()
+
+			err := cmds.ParseContext(tc.ctx, tc.input)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("ParseContext returned ‘%v’ but expected ‘%v’", err, tc.err)
+			}
+			if value != tc.value {
+				t.Fatalf("the callback got the value %v but expected %v", value, tc.value)
+			}
+		})
+	}
+}
+
+func TestCallbackError(t *testing.T) {
+	cmds := &Cmds{}
+	cmds.AddWithContext("fail", func(ctx context.Context, m Match) error {
+		return errors.New("broken")
+	})
+	cmds.Compile()
+
+	if cmds.Parse("fail", nil) {
+		t.Fatalf("Parse returned true for a failed callback")
+	}
+	_, res, err := cmds.ParseWithResult("fail", nil)
+	var cerr *CallbackError
+	if !errors.As(err, &cerr) || cerr.Syntax != "fail" {
+		t.Fatalf("ParseWithResult returned ‘%v’ but expected a *CallbackError", err)
+	}
+	if s := ExitStatus(res, err); s != StatusFailure {
+		t.Fatalf("exit status is %d but expected %d", s, StatusFailure)
+	}
+	if s := HTTPStatus(res, err); s != 500 {
+		t.Fatalf("HTTP status is %d but expected 500", s)
+	}
+}
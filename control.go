@@ -0,0 +1,99 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ControlCharacters is what Parse does with control characters and invalid UTF-8 in its
+// input. Spaces, tabs and newlines aren't control characters here; they separate words.
+type ControlCharacters int
+
+const (
+	// KeepControlCharacters leaves control characters in the words of the input, where
+	// they stop the words matching keywords, and replaces invalid UTF-8 with U+FFFD.
+	KeepControlCharacters ControlCharacters = iota
+	// StripControlCharacters removes control characters and invalid UTF-8 from the input
+	// before it's split into words. The offsets of Spans are then those in the stripped
+	// input.
+	StripControlCharacters
+	// RejectControlCharacters makes input that contains control characters or invalid
+	// UTF-8 fail to split into words with an *InvalidCharacterError.
+	RejectControlCharacters
+)
+
+func (h ControlCharacters) String() string {
+	switch h {
+	case KeepControlCharacters:
+		return "keep"
+	case StripControlCharacters:
+		return "strip"
+	case RejectControlCharacters:
+		return "reject"
+	}
+	return "<unknown>"
+}
+
+// SetControlCharacters sets what Parse and the other functions that match input do with
+// control characters and invalid UTF-8 in the input. The default is
+// KeepControlCharacters. Input pasted from a terminal often contains escape sequences and
+// other invisible characters, so that a word that looks like a keyword never matches it;
+// stripping or rejecting them makes that visible rather than puzzling.
+func (c *Cmds) SetControlCharacters(h ControlCharacters) {
+	c.controlChars = h
+}
+
+// InvalidCharacterError is the error returned for input that contains a control character
+// or invalid UTF-8 when control characters are rejected.
+type InvalidCharacterError struct {
+	// Position is the offset in runes of the character in the input, counting each byte
+	// of invalid UTF-8 as a rune.
+	Position int
+	// Rune is the control character, or utf8.RuneError for invalid UTF-8.
+	Rune rune
+}
+
+func (e *InvalidCharacterError) Error() string {
+	if e.Rune == utf8.RuneError {
+		return fmt.Sprintf("invalid UTF-8 at position %d", e.Position+1)
+	}
+	return fmt.Sprintf("control character %U at position %d", e.Rune, e.Position+1)
+}
+
+// isControl returns true if ‘r’ is a control character that doesn't separate words.
+func isControl(r rune) bool {
+	return unicode.IsControl(r) && !unicode.IsSpace(r)
+}
+
+// clean returns ‘input’ with its control characters and invalid UTF-8 handled as ‘h’ says.
+func (h ControlCharacters) clean(input string) (string, error) {
+	if h == KeepControlCharacters {
+		return input, nil
+	}
+
+	// Most input is clean, and is returned as it is
+	if strings.IndexFunc(input, isControl) < 0 && utf8.ValidString(input) {
+		return input, nil
+	}
+
+	var buf strings.Builder
+	pos := 0
+	for i := 0; i < len(input); pos++ {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		invalid := r == utf8.RuneError && size == 1
+		if invalid || isControl(r) {
+			if h == RejectControlCharacters {
+				if invalid {
+					r = utf8.RuneError
+				}
+				return "", &InvalidCharacterError{Position: pos, Rune: r}
+			}
+		} else {
+			buf.WriteString(input[i : i+size])
+		}
+		i += size
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,64 @@
+package cmdparse
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestControlCharacters(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  ControlCharacters
+		input   string
+		ok      bool
+		file    string
+		errRune rune
+		errPos  int
+	}{
+		{"keep clean", KeepControlCharacters, "show a", true, "a", 0, 0},
+		{"keep control", KeepControlCharacters, "sh\x1bow a", false, "", 0, 0},
+		{"strip escape", StripControlCharacters, "\x1bshow a\x7f", true, "a", 0, 0},
+		{"strip invalid UTF-8", StripControlCharacters, "show a\xffb", true, "ab", 0, 0},
+		{"strip keeps tabs", StripControlCharacters, "show\ta\n", true, "a", 0, 0},
+		{"strip keeps unicode", StripControlCharacters, "show é\x00", true, "é", 0, 0},
+		{"reject control", RejectControlCharacters, "show é\x07", false, "", '\a', 6},
+		{"reject invalid UTF-8", RejectControlCharacters, "sh\xc3ow", false, "", utf8.RuneError, 2},
+		{"reject clean", RejectControlCharacters, "show a", true, "a", 0, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var file string
+			var cmds Cmds
+			cmds.Add("show <file>", func(m Match, ctx interface{}) { file = m.Var("file")[0].Value })
+			cmds.SetControlCharacters(tc.handle)
+			cmds.Compile()
+
+			err := cmds.ParseErr(tc.input, nil)
+			if ok := err == nil; ok != tc.ok {
+				t.Fatalf("ParseErr returned %v", err)
+			}
+			if file != tc.file {
+				t.Fatalf("<file> was ‘%q’, expected ‘%q’", file, tc.file)
+			}
+
+			var ice *InvalidCharacterError
+			if errors.As(err, &ice) != (tc.errRune != 0) {
+				t.Fatalf("returned the error %v", err)
+			}
+			if ice != nil && (ice.Rune != tc.errRune || ice.Position != tc.errPos) {
+				t.Fatalf("returned %U at %d, expected %U at %d", ice.Rune, ice.Position, tc.errRune, tc.errPos)
+			}
+		})
+	}
+}
+
+func TestInvalidCharacterError(t *testing.T) {
+	if s := (&InvalidCharacterError{Position: 3, Rune: 0x1b}).Error(); s != "control character U+001B at position 4" {
+		t.Fatalf("unexpected message ‘%s’", s)
+	}
+	if s := (&InvalidCharacterError{Position: 0, Rune: utf8.RuneError}).Error(); s != "invalid UTF-8 at position 1" {
+		t.Fatalf("unexpected message ‘%s’", s)
+	}
+}
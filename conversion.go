@@ -0,0 +1,60 @@
+package cmdparse
+
+import "sync"
+
+// SetLazyConversion sets whether the values of variables are only validated while
+// matching, and converted when the callback asks for them using VarValue.Convert, rather
+// than being converted for every way the input could match. This saves converting the
+// values of commands such as ‘delete <id:int>+’ that are entered with thousands of ids,
+// when the callback only reads some of them or uses them as strings.
+//
+// When enabled, VarValue.Converted is left nil except for the types whose converted values
+// are also in VarValue.Elems, Bytes or Groups, such as lists and patterns, which are still
+// converted while matching. Int, Float, Bool and Expr, typed handlers added with AddBound,
+// and constraints all convert the values as needed. A type's Convert must then succeed
+// for every value its Validate accepts, since an error from it no longer stops the value
+// from matching; instead Convert returns it.
+func (c *Cmds) SetLazyConversion(enable bool) {
+	c.lazyConversion = enable
+}
+
+// lazyConversion converts a value the first time it's needed. It's shared by the copies of
+// a VarValue in a match, so each value is converted at most once.
+type lazyConversion struct {
+	typ  Type
+	once sync.Once
+	conv interface{}
+	err  error
+}
+
+// Convert returns the value converted to a Go value by its type, which is the same as
+// Converted unless conversion is lazy. When conversion is lazy the value is converted
+// the first time Convert is called, and the result is kept for later calls on the same
+// match. The error is always nil unless conversion is lazy.
+func (v VarValue) Convert() (interface{}, error) {
+	if v.lazy == nil {
+		return v.Converted, nil
+	}
+	v.lazy.once.Do(func() {
+		v.lazy.conv, v.lazy.err = v.lazy.typ.Convert(v.Value)
+	})
+	return v.lazy.conv, v.lazy.err
+}
+
+// converted returns the converted value, or nil if it can't be converted.
+func (v VarValue) converted() interface{} {
+	conv, err := v.Convert()
+	if err != nil {
+		return nil
+	}
+	return conv
+}
+
+// convertNow returns true if values of the type ‘t’ are converted while matching.
+func (v *vm) convertNow(t Type) bool {
+	if !v.lazyConversion {
+		return true
+	}
+	_, ok := t.(partsType)
+	return ok
+}
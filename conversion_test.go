@@ -0,0 +1,133 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// countingType is an int type that counts its conversions.
+type countingType struct {
+	intType
+	conversions *int
+}
+
+func (countingType) Name() string { return "counted" }
+
+func (t countingType) Convert(val string) (interface{}, error) {
+	*t.conversions++
+	return t.intType.Convert(val)
+}
+
+func TestLazyConversion(t *testing.T) {
+	ids := make([]string, 200)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	input := "delete " + strings.Join(ids, " ")
+
+	tests := []struct {
+		name string
+		lazy bool
+		// read is the number of values the callback converts, twice each
+		read int
+		// expected is the most conversions there may be
+		expected int
+	}{
+		{"eager", false, 0, -1},
+		{"lazy unread", true, 0, 0},
+		{"lazy read", true, 3, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			conversions := 0
+			cmds.AddType(countingType{conversions: &conversions})
+			cmds.SetLazyConversion(tc.lazy)
+
+			var sum int64
+			cmds.Add("delete <id:counted>+", func(match Match, ctx interface{}) {
+				vals := match.Var("id")
+				for i := 0; i < tc.read; i++ {
+					for j := 0; j < 2; j++ {
+						conv, err := vals[i].Convert()
+						if err != nil {
+							t.Fatalf("Convert failed: %v", err)
+						}
+						sum += conv.(int64)
+					}
+				}
+			})
+			cmds.Compile()
+
+			if !cmds.Parse(input, nil) {
+				t.Fatalf("Parse failed")
+			}
+			if tc.expected < 0 {
+				if conversions < len(ids) {
+					t.Fatalf("Expected at least %d conversions but there were %d", len(ids), conversions)
+				}
+				return
+			}
+			if conversions != tc.expected {
+				t.Fatalf("Expected %d conversions but there were %d", tc.expected, conversions)
+			}
+			if want := int64(2 * tc.read * (tc.read - 1) / 2); sum != want {
+				t.Fatalf("Expected the values to add up to %d but got %d", want, sum)
+			}
+		})
+	}
+}
+
+func TestLazyConversionValues(t *testing.T) {
+	var cmds Cmds
+	cmds.SetLazyConversion(true)
+	cmds.AddUnitType("len", map[string]float64{"m": 1, "km": 1000})
+
+	var got string
+	cback := func(match Match, ctx interface{}) {
+		var parts []string
+		for _, name := range []string{"n", "d", "l", "b"} {
+			for _, v := range match.Var(name) {
+				conv, _ := v.Convert()
+				parts = append(parts, fmt.Sprintf("%s=%v/%v/%v", name, v.Converted, conv, v.Elems))
+			}
+		}
+		got = strings.Join(parts, " ")
+	}
+	cmds.Add("set <n:int> <d:len>", cback)
+	cmds.Add("list <l:list-int>", cback)
+	cmds.Add("flag <b:bool>", cback)
+	cmds.SetListLiterals(true)
+	if err := cmds.AddConstraint("set <n:int> <d:len>", "n < 10"); err != nil {
+		t.Fatalf("AddConstraint failed: %v", err)
+	}
+	cmds.Compile()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Values are only converted when asked for, apart from lists
+		{"set 5 2km", "n=<nil>/5/[] d=<nil>/2000/[]"},
+		{"list [1, 2]", "l=[1 2]/[1 2]/[1 2]"},
+		{"flag true", "b=<nil>/true/[]"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got = ""
+			if !cmds.Parse(tc.input, nil) {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if got != tc.expected {
+				t.Fatalf("Expected ‘%s’ but got ‘%s’", tc.expected, got)
+			}
+		})
+	}
+
+	// Constraints convert the values they use
+	if err := cmds.ParseErr("set 50 2km", nil); err == nil {
+		t.Fatalf("Expected the constraint to reject ‘set 50 2km’")
+	}
+}
@@ -0,0 +1,76 @@
+package cmdparse
+
+// Description describes the command that an input matches, as returned by Describe. It's
+// meant for showing a preview of a command before it's run.
+type Description struct {
+	// Syntax is the definition of the matched command as it was passed to Add.
+	Syntax string
+	// Help is the help text of the command set using AddWithHelp.
+	Help string
+	// Examples are the examples of the command added with AddExample.
+	Examples []string
+	// Bound are the keywords and variables that matched the input, in input order.
+	Bound []BoundElement
+	// Remaining are the optional keywords and variables that could still be added to
+	// the end of the input. Variables are written in angle brackets, as in <file>.
+	Remaining []string
+}
+
+// BoundElement is a keyword or variable of a command along with the input word it matched.
+type BoundElement struct {
+	// Element is the keyword, or the name of the variable in angle brackets.
+	Element string
+	// Value is the input word. The values of sensitive variables are redacted.
+	Value string
+}
+
+// Describe matches ‘input’ like Parse, but instead of calling the callback of the matched
+// command it returns a Description of the command. Matches of ambiguous input are chosen
+// between by the collision policy, the match preferences and the resolver as they are by
+// Parse. ok is false if the input doesn't match exactly one command.
+func (c *Cmds) Describe(input string) (d Description, ok bool) {
+	d, _, ok = c.describe(input)
+	return
+}
+
+// describe returns the Description of ‘input’ like Describe, and the match it describes.
+func (c *Cmds) describe(input string) (d Description, mm match, ok bool) {
+	matches, toks, err := c.matchInput(input, ParseOptions{})
+	if err != nil || len(matches) != 1 {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	mm = matches[0]
+	cmd := mm.meta.(*command)
+
+	d.Syntax = cmd.syntax
+	d.Help = cmd.help
+	d.Examples = cmd.examples
+
+	d.Bound = boundElements(mm)
+
+	v2 := vm{exactKeywords: c.keywordMatching == ExactMatching, version: c.version}
+	v2.collectFor = cmd
+	seen := make(map[string]bool)
+	for _, instr := range v2.expectations(c.program(), toks) {
+		var elem string
+		switch instr.opcode {
+		case opCmp:
+			elem = instr.strs[0]
+		case opSave, opSaveRest, opCustom:
+			elem = "<" + instr.strs[0] + ">"
+		default:
+			continue
+		}
+		if !seen[elem] {
+			seen[elem] = true
+			d.Remaining = append(d.Remaining, elem)
+		}
+	}
+
+	ok = true
+	return
+}
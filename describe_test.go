@@ -0,0 +1,100 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		ok        bool
+		syntax    string
+		help      string
+		bound     string
+		remaining string
+	}{
+		{
+			name:      "optional elements remain",
+			input:     "co a b",
+			ok:        true,
+			syntax:    "copy <src> <dst> (force)? <extra>*",
+			help:      "Copy a file",
+			bound:     "copy=co <src>=a <dst>=b",
+			remaining: "force <extra>",
+		},
+		{
+			name:      "nothing remains",
+			input:     "login bob hunter2",
+			ok:        true,
+			syntax:    "login <user> <pass!secret>",
+			bound:     "login=login <user>=bob <pass>=<redacted>",
+			remaining: "",
+		},
+		{
+			name:  "incomplete",
+			input: "copy a",
+			ok:    false,
+		},
+		{
+			name:      "ambiguous input preferred",
+			input:     "get v",
+			ok:        true,
+			syntax:    "get verbose",
+			bound:     "get=get verbose=v",
+			remaining: "",
+		},
+		{
+			name:  "no match",
+			input: "bogus",
+			ok:    false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			called := false
+			cback := func(match Match, ctx interface{}) { called = true }
+
+			cmds.AddWithHelp("copy <src> <dst> (force)? <extra>*", "Copy a file", cback)
+			cmds.Add("login <user> <pass!secret>", cback)
+			cmds.Add("get <file>", cback)
+			cmds.Add("get verbose", cback)
+			cmds.SetMatchPreferences(PreferKeywordOverVariable)
+			cmds.Compile()
+
+			d, ok := cmds.Describe(tc.input)
+			if called {
+				t.Fatalf("Describe called the callback")
+			}
+			if ok != tc.ok {
+				t.Fatalf("Expected ok to be %v but it was %v", tc.ok, ok)
+			}
+			if !ok {
+				return
+			}
+
+			if d.Syntax != tc.syntax {
+				t.Fatalf("Expected syntax ‘%s’ but got ‘%s’", tc.syntax, d.Syntax)
+			}
+			if d.Help != tc.help {
+				t.Fatalf("Expected help ‘%s’ but got ‘%s’", tc.help, d.Help)
+			}
+
+			var bound []string
+			for _, b := range d.Bound {
+				bound = append(bound, fmt.Sprintf("%s=%s", b.Element, b.Value))
+			}
+			if s := strings.Join(bound, " "); s != tc.bound {
+				t.Fatalf("Expected bound elements ‘%s’ but got ‘%s’", tc.bound, s)
+			}
+
+			if s := strings.Join(d.Remaining, " "); s != tc.remaining {
+				t.Fatalf("Expected remaining elements ‘%s’ but got ‘%s’", tc.remaining, s)
+			}
+		})
+	}
+}
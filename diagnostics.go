@@ -0,0 +1,252 @@
+package cmdparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity is how serious a Diagnostic is. The values are those of the Language Server
+// Protocol.
+type Severity int
+
+const (
+	// ErrorSeverity is a definition that Add rejects.
+	ErrorSeverity Severity = 1
+	// WarningSeverity is a definition that Add accepts but that is likely to be a mistake.
+	WarningSeverity Severity = 2
+)
+
+func (s Severity) String() string {
+	switch s {
+	case ErrorSeverity:
+		return "error"
+	case WarningSeverity:
+		return "warning"
+	}
+	return "<unknown>"
+}
+
+// Position is a place in a file of command definitions. Line and Column are counted from
+// zero as in the Language Server Protocol, and Column is counted in runes.
+type Position struct {
+	Line, Column int
+}
+
+// Range is the part of a file of command definitions from Start up to End.
+type Range struct {
+	Start, End Position
+}
+
+// Fix is a suggested fix for a Diagnostic, which replaces the text in Range with NewText.
+type Fix struct {
+	// Title describes the fix, as in ‘insert )’.
+	Title   string
+	Range   Range
+	NewText string
+}
+
+// Diagnostic is a problem in a file of command definitions, as returned by Diagnose.
+type Diagnostic struct {
+	Range    Range
+	Severity Severity
+	Message  string
+	// Fix is a suggested fix, or nil if there is none.
+	Fix *Fix
+}
+
+// String returns the diagnostic with its position counted from 1, as in
+// ‘3:12: error: expected ) to close the group’.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Range.Start.Line+1, d.Range.Start.Column+1, d.Severity, d.Message)
+}
+
+// Diagnose checks the contents of a file of command definitions, and returns the problems
+// found in the order they appear, so that editors can show them while the file is edited,
+// for example from a language server. The file has one definition per line, as it would
+// be passed to Add; blank lines and lines beginning with # are ignored.
+//
+// Definitions that Add would reject are errors. Warnings are given for what Compile warns
+// about, for elements that Analyze finds can never be matched, for definitions that appear
+// more than once, and for variables whose type isn't known, which then match any word.
+// Diagnose only knows the built-in types; Cmds.Diagnose also knows the types added to a
+// Cmds.
+func Diagnose(contents string) []Diagnostic {
+	var c Cmds
+	return c.Diagnose(contents)
+}
+
+// Diagnose is like the function Diagnose, but uses the types added with AddType, the
+// aliases added with Alias and the keyword matching of ‘c’. The commands of ‘c’ aren't
+// affected.
+func (c *Cmds) Diagnose(contents string) []Diagnostic {
+	check := &Cmds{types: c.types, keywordMatching: c.keywordMatching}
+	for kw, aliases := range c.aliases {
+		for _, alias := range aliases {
+			check.Alias(alias, kw)
+		}
+	}
+
+	var diags []Diagnostic
+	// defs are the definitions that were added, with their line and the column they
+	// start at
+	type def struct{ line, col int }
+	defs := make(map[string]def)
+
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		syntax := strings.TrimSpace(line)
+		if syntax == "" || strings.HasPrefix(syntax, "#") {
+			continue
+		}
+		col := utf8.RuneCountInString(line[:strings.Index(line, syntax)])
+
+		if first, ok := defs[syntax]; ok {
+			diags = append(diags, Diagnostic{
+				Range:    definitionRange(i, col, syntax, 0, -1),
+				Severity: WarningSeverity,
+				Message:  fmt.Sprintf("the definition is the same as the one on line %d", first.line+1),
+				Fix: &Fix{
+					Title: "remove the line",
+					Range: Range{Start: Position{Line: i}, End: Position{Line: i + 1}},
+				},
+			})
+			continue
+		}
+
+		if err := check.Add(syntax, nil); err != nil {
+			diags = append(diags, errorDiagnostics(err, i, col, syntax)...)
+			continue
+		}
+		defs[syntax] = def{line: i, col: col}
+	}
+
+	warn := func(syntax, elem, msg string) {
+		d := defs[syntax]
+		start, end := 0, -1
+		if elem != "" {
+			start, end = elementRange(syntax, elem)
+		}
+		diags = append(diags, Diagnostic{
+			Range:    definitionRange(d.line, d.col, syntax, start, end),
+			Severity: WarningSeverity,
+			Message:  msg,
+		})
+	}
+
+	for _, cmd := range check.commands {
+		for _, v := range variables(cmd.tree) {
+			if lookupType(v.Type, check.types) == nil {
+				warn(cmd.syntax, "<"+v.Name+">", fmt.Sprintf("the type ‘%s’ isn't known, so <%s> matches any word", v.Type, v.Name))
+			}
+		}
+	}
+	for _, w := range check.Compile() {
+		warn(w.Syntax, "", w.Message)
+	}
+	for _, f := range check.Analyze() {
+		warn(f.Syntax, f.Element, fmt.Sprintf("%s can never be matched: %s", f.Element, f.why()))
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i].Range.Start, diags[j].Range.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return diags
+}
+
+// errorDiagnostics returns the diagnostics for the error ‘err’ returned by Add for the
+// definition ‘syntax’ on the line ‘line’ starting at the column ‘col’.
+func errorDiagnostics(err error, line, col int, syntax string) []Diagnostic {
+	var errs []error
+	switch e := err.(type) {
+	case ScanError:
+		errs = e
+	case Errors:
+		errs = e
+	default:
+		errs = []error{err}
+	}
+
+	diags := make([]Diagnostic, len(errs))
+	for i, err := range errs {
+		d := Diagnostic{Severity: ErrorSeverity, Message: err.Error(), Range: definitionRange(line, col, syntax, 0, -1)}
+		if de, ok := err.(*definitionError); ok {
+			d.Message = de.msg
+			d.Range = definitionRange(line, col, syntax, de.start, de.end)
+			if de.missing != "" {
+				at := Range{Start: d.Range.End, End: d.Range.End}
+				d.Fix = &Fix{Title: "insert " + de.missing, Range: at, NewText: de.missing}
+			}
+		}
+		diags[i] = d
+	}
+	return diags
+}
+
+// definitionRange returns the Range of the runes from ‘start’ up to ‘end’ of the definition
+// ‘syntax’ on the line ‘line’ starting at the column ‘col’. The offsets are limited to the
+// definition, and an ‘end’ of -1 is the end of the definition.
+func definitionRange(line, col int, syntax string, start, end int) Range {
+	n := utf8.RuneCountInString(syntax)
+	if end < 0 || end > n {
+		end = n
+	}
+	if start > end {
+		start = end
+	}
+	return Range{
+		Start: Position{Line: line, Column: col + start},
+		End:   Position{Line: line, Column: col + end},
+	}
+}
+
+// elementRange returns the offsets in runes of the first keyword or variable ‘elem’ in the
+// definition ‘syntax’, where variables are written in angle brackets as in <file>. The
+// whole definition, from 0 to -1, is returned if it isn't found.
+func elementRange(syntax, elem string) (start, end int) {
+	toks, _ := Tokenize(syntax)
+	inVar := false
+	for i, t := range toks {
+		switch t.Kind {
+		case LessThanToken:
+			inVar = true
+			if i+1 < len(toks) && "<"+toks[i+1].Value+">" == elem {
+				for _, u := range toks[i+1:] {
+					if u.Kind == GreaterThanToken {
+						return t.Start, u.End
+					}
+				}
+			}
+		case GreaterThanToken:
+			inVar = false
+		case WordToken:
+			if !inVar && t.Value == elem {
+				return t.Start, t.End
+			}
+		}
+	}
+	return 0, -1
+}
+
+// variables returns the variables in the parse tree ‘tree’, in order.
+func variables(tree interface{}) (vars []variable) {
+	switch node := tree.(type) {
+	case variable:
+		vars = append(vars, node)
+	case alts:
+		vars = append(variables(node.Left), variables(node.Right)...)
+	case terms:
+		vars = append(variables(node.Left), variables(node.Right)...)
+	case rep:
+		vars = variables(node.Term)
+	case group:
+		vars = variables(node.Term)
+	case set:
+		for _, opt := range node.Options {
+			vars = append(vars, variables(opt)...)
+		}
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected []string
+	}{
+		{
+			name:     "valid",
+			contents: "# file commands\n\nget <file>\nput <file> <dst>\n",
+			expected: nil,
+		},
+		{
+			name:     "unclosed group",
+			contents: "get <file>\n  show (logs | links\n",
+			expected: []string{"2:21: error: expected ) to close the group [insert ) at 2:21]"},
+		},
+		{
+			name:     "unterminated quote",
+			contents: "say \"hello\r\n",
+			expected: []string{"1:5: error: Unterminated quote starting at character 5 [insert \" at 1:11]"},
+		},
+		{
+			name:     "unclosed variable",
+			contents: "get <file",
+			expected: []string{"1:10: error: expected either : to specify variable type, or > to complete variable definition [insert > at 1:10]"},
+		},
+		{
+			name:     "duplicate",
+			contents: "get <file>\nput <file>\nget <file>\n",
+			expected: []string{"3:1: warning: the definition is the same as the one on line 1 [remove the line at 3:1]"},
+		},
+		{
+			name:     "unknown type",
+			contents: "set <level:loud>",
+			expected: []string{"1:5: warning: the type ‘loud’ isn't known, so <level> matches any word"},
+		},
+		{
+			name:     "shadowed alternative",
+			contents: "show (show | sh) <x>",
+			expected: []string{
+				"1:1: warning: the alternative ‘sh’ can't be entered without also matching ‘show’",
+				"1:14: warning: sh can never be matched: input such as ‘show sh value0’ matches the command in more than one way",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var diags []string
+			for _, d := range Diagnose(tc.contents) {
+				s := d.String()
+				if d.Fix != nil {
+					at := d.Fix.Range.Start
+					s += fmt.Sprintf(" [%s at %d:%d]", d.Fix.Title, at.Line+1, at.Column+1)
+				}
+				diags = append(diags, s)
+			}
+			if strings.Join(diags, "\n") != strings.Join(tc.expected, "\n") {
+				t.Fatalf("expected the diagnostics\n%s\nbut got\n%s", strings.Join(tc.expected, "\n"), strings.Join(diags, "\n"))
+			}
+		})
+	}
+}
+
+func TestDiagnoseTypes(t *testing.T) {
+	if diags := Diagnose("paint <c:color>"); len(diags) != 1 {
+		t.Fatalf("expected a warning about the unknown type but got %v", diags)
+	}
+
+	var cmds Cmds
+	cmds.AddType(colorType{})
+	if diags := cmds.Diagnose("paint <c:color>"); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics for an added type but got %v", diags)
+	}
+	if len(cmds.Commands()) != 0 {
+		t.Fatalf("Diagnose added commands")
+	}
+}
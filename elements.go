@@ -0,0 +1,156 @@
+package cmdparse
+
+// Element is a part of a command definition, as listed in CommandInfo.Elements. Together
+// the elements of a command describe what it accepts in enough detail to generate an
+// input form for it.
+type Element struct {
+	Kind ElementKind
+	// Keyword is the keyword of a KeywordElement.
+	Keyword string
+	// Exact is true if the keyword must be entered in full, as in !delete.
+	Exact bool
+	// Aliases are the other spellings of a KeywordElement, as in remove!alias(rm|del).
+	Aliases []string
+	// Var, Type and Flags are the name, type and flags of a VariableElement. The Type of a
+	// variable matched by a custom instruction is the name of the instruction after an @.
+	Var   string
+	Type  string
+	Flags VarFlags
+	// Describe is the description of the values of the type of a VariableElement, such as
+	// ‘an integer’, or empty if the type is unknown.
+	Describe string
+	// Values are the values of a VariableElement whose type lists them, as in
+	// <mode:(fast|slow)>.
+	Values []string
+	// Excluded are the words a VariableElement doesn't match, as in <name!(all|none)>.
+	Excluded []string
+	// Choices are the alternatives of a ChoiceElement, one of which is entered.
+	Choices [][]Element
+	// Elements are the elements of a SequenceElement, which are entered together, or the
+	// options of a SetElement.
+	Elements []Element
+	// Group is the name of a SequenceElement that is a named group, as in (from <host>):src.
+	Group string
+	// Min and Max are the number of times the element is entered. Max is negative when
+	// there is no maximum.
+	Min, Max int
+}
+
+// Optional returns true if the element may be left out.
+func (e Element) Optional() bool {
+	return e.Min == 0
+}
+
+// Repeated returns true if the element may be entered more than once.
+func (e Element) Repeated() bool {
+	return e.Max != 1
+}
+
+// ElementKind is the kind of an Element.
+type ElementKind int
+
+const (
+	// KeywordElement is a keyword.
+	KeywordElement ElementKind = iota
+	// VariableElement is a variable.
+	VariableElement
+	// ChoiceElement is a set of alternatives.
+	ChoiceElement
+	// SequenceElement is a parenthesized sequence of elements that is repeated or named.
+	SequenceElement
+	// SetElement is a set of options in braces, which may be entered in any order. Its
+	// Elements are the options, which are optional if their Min is zero.
+	SetElement
+)
+
+func (k ElementKind) String() string {
+	switch k {
+	case KeywordElement:
+		return "keyword"
+	case VariableElement:
+		return "variable"
+	case ChoiceElement:
+		return "choice"
+	case SequenceElement:
+		return "sequence"
+	case SetElement:
+		return "set"
+	}
+	return "<unknown>"
+}
+
+// elements returns the elements of the parse tree ‘tree’, in order.
+func (c *Cmds) elements(tree interface{}) []Element {
+	switch node := tree.(type) {
+	case word:
+		return []Element{{Kind: KeywordElement, Keyword: string(node), Min: 1, Max: 1}}
+	case exactWord:
+		return []Element{{Kind: KeywordElement, Keyword: string(node), Exact: true, Min: 1, Max: 1}}
+	case aliasedWord:
+		return []Element{{Kind: KeywordElement, Keyword: node.Keyword, Aliases: node.Aliases, Exact: node.Exact, Min: 1, Max: 1}}
+	case variable:
+		e := Element{Kind: VariableElement, Var: node.Name, Type: node.Type, Flags: node.Flags, Excluded: node.Exclude, Min: 1, Max: 1}
+		if t := lookupType(node.Type, c.types); t != nil {
+			e.Describe = t.Describe()
+			if et, ok := t.(enumType); ok {
+				for _, val := range et.values {
+					if !isExcluded(node.Exclude, val) {
+						e.Values = append(e.Values, val)
+					}
+				}
+			}
+		}
+		return []Element{e}
+	case custom:
+		e := Element{Kind: VariableElement, Var: node.Name, Type: "@" + node.Instr, Min: 1, Max: 1}
+		if inst, ok := c.instructions[node.Instr]; ok {
+			e.Describe = inst.Describe()
+		}
+		return []Element{e}
+	case terms:
+		return append(c.elements(node.Left), c.elements(node.Right)...)
+	case alts:
+		e := Element{Kind: ChoiceElement, Min: 1, Max: 1}
+		for _, ch := range alternatives(node) {
+			e.Choices = append(e.Choices, c.elements(ch))
+		}
+		return []Element{e}
+	case group:
+		return []Element{{Kind: SequenceElement, Group: node.Name, Elements: c.elements(node.Term), Min: 1, Max: 1}}
+	case rep:
+		inner := c.elements(node.Term)
+		var e Element
+		if len(inner) == 1 && inner[0].Min == 1 && inner[0].Max == 1 {
+			e = inner[0]
+		} else {
+			e = Element{Kind: SequenceElement, Elements: inner}
+		}
+		switch node.Op {
+		case repeatZeroOrOne:
+			e.Min, e.Max = 0, 1
+		case repeatZeroOrMore:
+			e.Min, e.Max = 0, -1
+		case repeatOneOrMore:
+			e.Min, e.Max = 1, -1
+		case repeatCounted:
+			e.Min, e.Max = node.Min, node.Max
+		}
+		return []Element{e}
+	case set:
+		e := Element{Kind: SetElement, Min: 1, Max: 1}
+		for i, opt := range node.Options {
+			o := Element{Kind: SequenceElement, Elements: c.elements(opt), Min: 1, Max: 1}
+			if len(o.Elements) == 1 && o.Elements[0].Min == 1 && o.Elements[0].Max == 1 {
+				o = o.Elements[0]
+			}
+			if node.Optional[i] {
+				o.Min = 0
+			}
+			e.Elements = append(e.Elements, o)
+		}
+		return []Element{e}
+	case meta:
+		return c.elements(node.ch)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// elementsToStr writes the elements in a compact form for comparing them.
+func elementsToStr(elems []Element) string {
+	var s []string
+	for _, e := range elems {
+		var str string
+		switch e.Kind {
+		case KeywordElement:
+			str = e.Keyword
+			if e.Exact {
+				str = "!" + str
+			}
+			if len(e.Aliases) > 0 {
+				str += "(" + strings.Join(e.Aliases, "|") + ")"
+			}
+		case VariableElement:
+			str = fmt.Sprintf("<%s:%s %q %v>", e.Var, e.Type, e.Describe, e.Values)
+			if len(e.Excluded) > 0 {
+				str += fmt.Sprintf("!%v", e.Excluded)
+			}
+		case ChoiceElement:
+			var chs []string
+			for _, ch := range e.Choices {
+				chs = append(chs, elementsToStr(ch))
+			}
+			str = "(" + strings.Join(chs, " | ") + ")"
+		case SequenceElement:
+			str = "(" + elementsToStr(e.Elements) + ")"
+			if e.Group != "" {
+				str += ":" + e.Group
+			}
+		case SetElement:
+			str = "{" + elementsToStr(e.Elements) + "}"
+		}
+		if e.Min != 1 || e.Max != 1 {
+			str += fmt.Sprintf("{%d,%d}", e.Min, e.Max)
+		}
+		s = append(s, str)
+	}
+	return strings.Join(s, " ")
+}
+
+func TestElements(t *testing.T) {
+	tests := []struct {
+		syntax   string
+		expected string
+	}{
+		{"copy <src> <dst>", `copy <src:str "a word" []> <dst:str "a word" []>`},
+		{"!delete <id:int>+", `!delete <id:int "an integer" []>{1,-1}`},
+		{"show (logs | links | <name>)", `show (logs | links | <name:str "a word" []>)`},
+		{"get (from <host>):src?", `get (from <host:str "a word" []>):src{0,1}`},
+		{"set <mode:(fast|slow)> verbose*", `set <mode:(fast|slow) "one of fast, slow" [fast slow]> verbose{0,-1}`},
+		{"set <mode:(fast|slow|off)!(off)>", `set <mode:(fast|slow|off) "one of fast, slow, off" [fast slow]>![off]`},
+		{"ip <n:int>{4}", `ip <n:int "an integer" []>{4,4}`},
+		{"pair (<k> <v>){1,3}", `pair (<k:str "a word" []> <v:str "a word" []>){1,3}`},
+		{"!remove!alias(rm|del) <f>?", `!remove(rm|del) <f:str "a word" []>{0,1}`},
+		{"cp { force? limit <n:int>? !all }", `cp {force{0,1} (limit <n:int "an integer" []>){0,1} !all}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.syntax, func(t *testing.T) {
+			var cmds Cmds
+			cmds.Add(tc.syntax, nil)
+			cmds.Compile()
+
+			elems := cmds.Commands()[0].Elements
+			if s := elementsToStr(elems); s != tc.expected {
+				t.Fatalf("Expected the elements\n%s\nbut got\n%s", tc.expected, s)
+			}
+		})
+	}
+}
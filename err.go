@@ -24,6 +24,23 @@ func (e *Errors) add(err error) {
 	*e = append(*e, err)
 }
 
+// definitionError is an error in a command definition that knows which part of the
+// definition it's about, so that Diagnose can point at it.
+type definitionError struct {
+	// start and end are the offsets in runes of the part of the definition
+	start, end int
+	// msg describes the error without its position
+	msg string
+	// missing is the text that is missing at end, if inserting it fixes the error
+	missing string
+	// err is the error as it's reported by Add
+	err error
+}
+
+func (e *definitionError) Error() string {
+	return e.err.Error()
+}
+
 func (e Errors) nilIfEmpty() error {
 	if len(e) == 0 {
 		return nil
@@ -0,0 +1,61 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddExample adds ‘example’ as an example of input for the command whose definition is
+// ‘syntax’, exactly as it was passed to Add. Examples are returned by Describe and
+// Commands for showing in help. Compile checks that each example matches its command and
+// only its command, and returns an InvalidExampleWarning for those that don't, so that
+// examples don't silently go out of date as the commands change.
+func (c *Cmds) AddExample(syntax, example string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax == syntax {
+			cmd.examples = append(cmd.examples, example)
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// exampleWarnings returns warnings for the examples that don't match only their command.
+func (c *Cmds) exampleWarnings() (w Warnings) {
+	for _, cmd := range c.commands {
+		for _, example := range cmd.examples {
+			if msg := c.checkExample(cmd, example); msg != "" {
+				w = append(w, Warning{Kind: InvalidExampleWarning, Syntax: cmd.syntax, Message: msg})
+			}
+		}
+	}
+	return
+}
+
+// checkExample returns why ‘example’ isn't a valid example of ‘cmd’, or the empty string
+// if it is.
+func (c *Cmds) checkExample(cmd *command, example string) string {
+	toks, err := c.scanInput(example)
+	if err != nil {
+		return fmt.Sprintf("the example ‘%s’ can't be split into words: %v", example, err)
+	}
+
+	matches := c.match(toks, ParseOptions{})
+	switch {
+	case len(matches) == 0:
+		return fmt.Sprintf("the example ‘%s’ doesn't match any command", example)
+	case len(matches) > 1:
+		c.sortByAddOrder(matches)
+		var syntaxes []string
+		for _, m := range matches {
+			syntaxes = appendUnique(syntaxes, m.meta.(*command).syntax)
+		}
+		return fmt.Sprintf("the example ‘%s’ is ambiguous: it matches ‘%s’", example, strings.Join(syntaxes, "’, ‘"))
+	case matches[0].meta.(*command) != cmd:
+		return fmt.Sprintf("the example ‘%s’ matches ‘%s’ instead", example, matches[0].meta.(*command).syntax)
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddExample(t *testing.T) {
+	tests := []struct {
+		name     string
+		example  string
+		expected string
+	}{
+		{"valid", "copy a b", ""},
+		{"no match", "copy a", "invalid example in ‘copy <src> <dst>’: the example ‘copy a’ doesn't match any command"},
+		{"other command", "delete a", "invalid example in ‘copy <src> <dst>’: the example ‘delete a’ matches ‘delete <file>’ instead"},
+		{"ambiguous", "copy a all", "invalid example in ‘copy <src> <dst>’: the example ‘copy a all’ is ambiguous: it matches ‘copy <src> <dst>’, ‘copy <src> all’"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, lazy := range []bool{false, true} {
+				var cmds Cmds
+				cback := func(match Match, ctx interface{}) {}
+				cmds.Add("copy <src> <dst>", cback)
+				cmds.Add("copy <src> all", cback)
+				cmds.Add("delete <file>", cback)
+				if err := cmds.AddExample("copy <src> <dst>", tc.example); err != nil {
+					t.Fatalf("AddExample failed: %v", err)
+				}
+				cmds.SetLazyCompilation(lazy)
+
+				warnings := cmds.Compile()
+				if warnings.String() != tc.expected {
+					t.Fatalf("With lazy=%v expected warnings ‘%s’ but got ‘%s’", lazy, tc.expected, warnings)
+				}
+
+				d, ok := cmds.Describe("copy x y")
+				if !ok || !reflect.DeepEqual(d.Examples, []string{tc.example}) {
+					t.Fatalf("With lazy=%v expected Describe to return the example but got %v", lazy, d.Examples)
+				}
+			}
+		})
+	}
+}
+
+func TestAddExampleUnknownCommand(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("copy <src> <dst>", func(match Match, ctx interface{}) {})
+	if err := cmds.AddExample("copy", "copy a b"); err == nil {
+		t.Fatalf("AddExample succeeded for a command that wasn't added")
+	}
+}
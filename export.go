@@ -0,0 +1,429 @@
+package cmdparse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// exportVersion is the version of the format written by ExportJSON.
+const exportVersion = 1
+
+// exportedProgram is the top-level object written by ExportJSON.
+type exportedProgram struct {
+	Version  int             `json:"version"`
+	Keywords []string        `json:"keywords"`
+	Commands []string        `json:"commands"`
+	IDs      []string        `json:"ids,omitempty"`
+	Program  [][]interface{} `json:"program"`
+}
+
+// ExportJSON writes the compiled program to ‘w’ as JSON, so that a client such as a web
+// frontend can check and complete input against exactly the same grammar. Compile must be
+// called first. The format is an object:
+//
+//    {
+//      "version": 1,
+//      "keywords": ["copy", "force"],
+//      "commands": ["copy <src> <dst> (force)?"],
+//      "program": [["meta", 0], ["cmp", 0], ["save", "src", "str", 0], ...]
+//    }
+//
+// keywords and commands are tables that instructions refer to by index. If any command was
+// added with AddNamed there is also an "ids" table with the identifier of each command,
+// or an empty string for commands added without one. The program is
+// a list of instructions for a Pike VM, each an array whose first element is the opcode:
+//
+//    ["split", x, y]              continue at both x and y
+//    ["jmp", x]                   continue at x
+//    ["cmp", k]                   consume a word that is a prefix of keyword k
+//    ["cmp", k, "exact"]          consume a word that is keyword k spelled in full
+//    ["cmp", k, aliases]          consume a word that is a prefix of keyword k or of one
+//                                 of its aliases; "exact" may precede the aliases
+//    ["save", name, type, flags]  consume a word as the variable name of type
+//    ["saverest", name, type, flags]
+//                                 consume the rest of the input, joined with spaces
+//    ["save", name, type, flags, excluded]
+//                                 as above, unless the value is one of the excluded
+//                                 words; saverest may also have them
+//    ["custom", name, instr, args]
+//                                 consume the words that the custom instruction instr,
+//                                 compiled with the words args, matches as the variable
+//                                 name
+//    ["meta", c]                  the thread is matching command c
+//    ["group", name]              the following words are matched by the group name
+//    ["endgroup", name]           the end of the words matched by the group name
+//    ["match"]                    the input matches if all of it was consumed
+//    ["nop"]                      do nothing
+//
+// Execution starts with one thread at instruction 0. The input matches when exactly one
+// thread reaches a match after consuming all the words. Values of typed variables aren't
+// checked by the exported program since types are implemented in Go; a client that needs
+// to validate them must know the types by name, and likewise implement the custom
+// instructions. flags are the VarFlags of the variable.
+func (c *Cmds) ExportJSON(w io.Writer) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prog := c.program().instrs
+
+	var e exportedProgram
+	e.Version = exportVersion
+	e.Keywords = []string{}
+	e.Commands = []string{}
+	e.Program = make([][]interface{}, len(prog))
+
+	keywords := make(map[string]int)
+	commands := make(map[*command]int)
+
+	for i := range prog {
+		instr := &prog[i]
+		var ex []interface{}
+		switch instr.opcode {
+		case opNop, opMatch:
+			ex = []interface{}{instr.opcode.String()}
+		case opSplit:
+			ex = []interface{}{instr.opcode.String(), instr.ints[0], instr.ints[1]}
+		case opJmp:
+			ex = []interface{}{instr.opcode.String(), instr.ints[0]}
+		case opCmp:
+			kw := instr.strs[0]
+			k, ok := keywords[kw]
+			if !ok {
+				k = len(e.Keywords)
+				keywords[kw] = k
+				e.Keywords = append(e.Keywords, kw)
+			}
+			ex = []interface{}{instr.opcode.String(), k}
+			if instr.ints[0] == cmpExact {
+				ex = append(ex, "exact")
+			}
+			if len(instr.aliases) > 0 {
+				ex = append(ex, instr.aliases)
+			}
+		case opSave, opSaveRest:
+			ex = []interface{}{instr.opcode.String(), instr.strs[0], instr.strs[1], instr.ints[0]}
+			if len(instr.excluded) > 0 {
+				ex = append(ex, instr.excluded)
+			}
+		case opCustom:
+			args := instr.args
+			if args == nil {
+				args = []string{}
+			}
+			ex = []interface{}{instr.opcode.String(), instr.strs[0], instr.strs[1][1:], args}
+		case opGroupStart, opGroupEnd:
+			ex = []interface{}{instr.opcode.String(), instr.strs[0]}
+		case opSetOption, opSetEnd:
+			ex = []interface{}{instr.opcode.String(), instr.ints[0], instr.ints[1]}
+		case opMeta:
+			cmd, ok := instr.intf.(*command)
+			if !ok {
+				return fmt.Errorf("instruction %d has unexpected metadata %v", i, instr.intf)
+			}
+			n, ok := commands[cmd]
+			if !ok {
+				n = len(e.Commands)
+				commands[cmd] = n
+				e.Commands = append(e.Commands, cmd.syntax)
+				e.IDs = append(e.IDs, cmd.id)
+			}
+			ex = []interface{}{instr.opcode.String(), n}
+		default:
+			return fmt.Errorf("instruction %d has unknown opcode %v", i, instr.opcode)
+		}
+		e.Program[i] = ex
+	}
+
+	hasIDs := false
+	for _, id := range e.IDs {
+		hasIDs = hasIDs || id != ""
+	}
+	if !hasIDs {
+		e.IDs = nil
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(e)
+}
+
+// LoadJSON replaces the commands with the compiled program written by ExportJSON, so that
+// a large command set can be compiled once, for example by a generator at build time, and
+// loaded quickly at startup without compiling it again. Functions can't be saved, so the
+// callback of each command is looked up in ‘cbacks’ by the identifier the command was
+// added with using AddNamed, or by its definition if it had none. Commands without a
+// callback are matched like commands added with AddNamed. Types used by variables other
+// than the built-in ones must be added before LoadJSON is called.
+//
+// The commands are ready to parse once LoadJSON returns; Compile must not be called, but
+// commands may be added and removed as after Compile. Since
+// the definitions aren't parsed again, Compile's warnings aren't produced, lazy
+// compilation is turned off, FirstKeywords lists every command as one that may match any
+// input, and Match.GroupPath is nil.
+func (c *Cmds) LoadJSON(r io.Reader, cbacks map[string]Callback) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var e exportedProgram
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return err
+	}
+	if e.Version != exportVersion {
+		return fmt.Errorf("unsupported program version %d", e.Version)
+	}
+	if e.IDs != nil && len(e.IDs) != len(e.Commands) {
+		return fmt.Errorf("there are %d ids for %d commands", len(e.IDs), len(e.Commands))
+	}
+
+	cmds := make([]*command, len(e.Commands))
+	for i, syntax := range e.Commands {
+		cmd := &command{syntax: syntax}
+		if e.IDs != nil {
+			cmd.id = e.IDs[i]
+		}
+		key := cmd.id
+		if key == "" {
+			key = syntax
+		}
+		cmd.cback = cbacks[key]
+		cmds[i] = cmd
+	}
+
+	prog := make([]instr, len(e.Program))
+	var metas []int
+	for i, ex := range e.Program {
+		l := loader{ex: ex, prog: e, cmds: cmds, types: c.types, instructions: c.instructions}
+		if err := l.load(&prog[i]); err != nil {
+			return fmt.Errorf("instruction %d: %v", i, err)
+		}
+		if prog[i].opcode == opMeta {
+			metas = append(metas, i)
+		}
+	}
+	for i, instr := range prog {
+		if (instr.opcode == opSplit || instr.opcode == opJmp) &&
+			(instr.ints[0] >= len(prog) || instr.ints[1] >= len(prog)) {
+			return fmt.Errorf("instruction %d: jump out of the program", i)
+		}
+	}
+
+	// The program is linked with the last command added first. Each command's
+	// instructions run from its meta up to the jmp to the shared match, which is followed
+	// by the split before the next command unless the next is the first added. The
+	// instructions of the first added run up to the shared match.
+	for k, pc := range metas {
+		end := len(prog) - 1
+		switch {
+		case k+2 < len(metas):
+			end = metas[k+1] - 2
+		case k+2 == len(metas):
+			end = metas[k+1] - 1
+		}
+		cmd := prog[pc].intf.(*command)
+		cmd.span = ProgramRange{Start: pc, End: end}
+		cmd.prog = unlink(prog, cmd.span)
+	}
+	for i, j := 0, len(cmds)-1; i < j; i, j = i+1, j-1 {
+		cmds[i], cmds[j] = cmds[j], cmds[i]
+	}
+
+	c.commands = cmds
+	c.prog = newProg(prog)
+	c.lazy = false
+	c.compiled = true
+	c.index = newFirstWordIndex(cmds)
+	return nil
+}
+
+// unlink returns the program of the command whose instructions are the range ‘r’ of the
+// linked program ‘p’, as it was before link combined it with the others, so that
+// commands can be added to or removed from a loaded program.
+func unlink(p []instr, r ProgramRange) prog {
+	frag := make([]instr, 0, r.End-r.Start+1)
+	for _, in := range p[r.Start:r.End] {
+		switch in.opcode {
+		case opSplit:
+			in.ints[0] -= r.Start
+			in.ints[1] -= r.Start
+		case opJmp:
+			in.ints[0] -= r.Start
+		}
+		frag = append(frag, in)
+	}
+	return newProg(append(frag, instr{opcode: opMatch}))
+}
+
+// loader loads one instruction written by ExportJSON.
+type loader struct {
+	ex    []interface{}
+	prog  exportedProgram
+	cmds  []*command
+	types map[string]Type
+	// instructions are the custom instructions added with Cmds.AddInstruction
+	instructions map[string]Instruction
+}
+
+func (l loader) load(instr *instr) error {
+	if len(l.ex) == 0 {
+		return fmt.Errorf("empty instruction")
+	}
+	op, ok := l.ex[0].(string)
+	if !ok {
+		return fmt.Errorf("the opcode isn't a string")
+	}
+
+	var err error
+	switch op {
+	case "nop":
+		instr.opcode = opNop
+	case "match":
+		instr.opcode = opMatch
+	case "split":
+		instr.opcode = opSplit
+		instr.ints[0], err = l.index(1, -1)
+		if err == nil {
+			instr.ints[1], err = l.index(2, -1)
+		}
+	case "jmp":
+		instr.opcode = opJmp
+		instr.ints[0], err = l.index(1, -1)
+	case "cmp":
+		instr.opcode = opCmp
+		var k int
+		if k, err = l.index(1, len(l.prog.Keywords)); err != nil {
+			break
+		}
+		instr.strs[0] = l.prog.Keywords[k]
+		for i := 2; i < len(l.ex) && err == nil; i++ {
+			switch l.ex[i].(type) {
+			case string:
+				if l.ex[i] != "exact" {
+					return fmt.Errorf("unknown keyword flag %v", l.ex[i])
+				}
+				instr.ints[0] = cmpExact
+			case []interface{}:
+				instr.aliases, err = l.strs(i)
+			default:
+				return fmt.Errorf("unknown keyword flag %v", l.ex[i])
+			}
+		}
+	case "save", "saverest":
+		instr.opcode = opSave
+		if op == "saverest" {
+			instr.opcode = opSaveRest
+		}
+		if instr.strs[0], err = l.str(1); err != nil {
+			break
+		}
+		if instr.strs[1], err = l.str(2); err != nil {
+			break
+		}
+		if instr.ints[0], err = l.index(3, -1); err != nil {
+			break
+		}
+		if len(l.ex) > 4 {
+			if instr.excluded, err = l.strs(4); err != nil {
+				break
+			}
+		}
+		if instr.strs[1] != "str" {
+			t := lookupType(instr.strs[1], l.types)
+			if t == nil {
+				return fmt.Errorf("unknown type ‘%s’", instr.strs[1])
+			}
+			instr.intf = t
+			if _, rest := t.(restType); rest != (op == "saverest") {
+				return fmt.Errorf("the type ‘%s’ doesn't match the opcode %s", instr.strs[1], op)
+			}
+		}
+	case "custom":
+		instr.opcode = opCustom
+		if instr.strs[0], err = l.str(1); err != nil {
+			break
+		}
+		var name string
+		if name, err = l.str(2); err != nil {
+			break
+		}
+		instr.strs[1] = "@" + name
+		if len(l.ex) > 3 {
+			if instr.args, err = l.strs(3); err != nil {
+				break
+			}
+		}
+		inst, ok := l.instructions[name]
+		if !ok {
+			return fmt.Errorf("unknown instruction ‘%s’", name)
+		}
+		var operand interface{}
+		if operand, err = inst.Compile(instr.args); err != nil {
+			return fmt.Errorf("the instruction ‘%s’ failed to compile: %v", name, err)
+		}
+		instr.intf = compiledInstruction{inst: inst, operand: operand}
+	case "group", "endgroup":
+		instr.opcode = opGroupStart
+		if op == "endgroup" {
+			instr.opcode = opGroupEnd
+		}
+		instr.strs[0], err = l.str(1)
+	case "option", "endset":
+		instr.opcode = opSetOption
+		if op == "endset" {
+			instr.opcode = opSetEnd
+		}
+		instr.ints[0], err = l.index(1, -1)
+		if err == nil {
+			instr.ints[1], err = l.index(2, -1)
+		}
+	case "meta":
+		instr.opcode = opMeta
+		var n int
+		if n, err = l.index(1, len(l.cmds)); err == nil {
+			instr.intf = l.cmds[n]
+		}
+	default:
+		return fmt.Errorf("unknown opcode %s", op)
+	}
+	return err
+}
+
+// index returns the argument ‘i’ of the instruction, which must be a non-negative integer
+// less than ‘limit’ unless ‘limit’ is negative.
+func (l loader) index(i, limit int) (int, error) {
+	if i >= len(l.ex) {
+		return 0, fmt.Errorf("missing argument %d", i)
+	}
+	f, ok := l.ex[i].(float64)
+	if !ok || f < 0 || f != float64(int(f)) || (limit >= 0 && int(f) >= limit) {
+		return 0, fmt.Errorf("argument %d is not a valid index: %v", i, l.ex[i])
+	}
+	return int(f), nil
+}
+
+// strs returns the argument ‘i’ of the instruction, which must be an array of strings.
+func (l loader) strs(i int) ([]string, error) {
+	arr, ok := l.ex[i].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("argument %d is not an array: %v", i, l.ex[i])
+	}
+	strs := make([]string, len(arr))
+	for j, e := range arr {
+		if strs[j], ok = e.(string); !ok {
+			return nil, fmt.Errorf("argument %d has an element that is not a string: %v", i, e)
+		}
+	}
+	return strs, nil
+}
+
+// str returns the argument ‘i’ of the instruction, which must be a string.
+func (l loader) str(i int) (string, error) {
+	if i >= len(l.ex) {
+		return "", fmt.Errorf("missing argument %d", i)
+	}
+	s, ok := l.ex[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d is not a string: %v", i, l.ex[i])
+	}
+	return s, nil
+}
@@ -0,0 +1,143 @@
+package cmdparse
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExportJSON(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	cmds.Add("go <where:str>", cback)
+	cmds.Add("stop now?", cback)
+	cmds.Compile()
+
+	var buf bytes.Buffer
+	err := cmds.ExportJSON(&buf)
+	if err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+
+	expected := `{"version":1,"keywords":["stop","now","go"],"commands":["stop now?","go <where:str>"],` +
+		`"program":[["split",1,6],["meta",0],["cmp",0],["split",4,5],["cmp",1],["jmp",9],` +
+		`["meta",1],["cmp",2],["save","where","str",0],["match"]]}` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	var orig Cmds
+	cback := func(match Match, ctx interface{}) {}
+	orig.Add("go <where:str>", cback)
+	orig.Add("stop !now?", cback)
+	orig.AddNamed("copy", "copy <src> <n:int>+ (to <dst>):target?")
+	orig.Add("run <cmd:cmdline>", cback)
+	orig.Add("sync { fast? !all? }", cback)
+	orig.Add("drop <name!(all)>* all?", cback)
+	orig.Add("erase!alias(rm) <f> !purge!alias(wipe)?", cback)
+	orig.AddType(cmdlineType{})
+	orig.Compile()
+
+	var buf bytes.Buffer
+	if err := orig.ExportJSON(&buf); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	exported := buf.String()
+
+	var cmds Cmds
+	var ran string
+	cmds.AddType(cmdlineType{})
+	err := cmds.LoadJSON(&buf, map[string]Callback{
+		"go <where:str>": func(match Match, ctx interface{}) { ran = "go " + match.Var("where")[0].Value },
+		"stop !now?":     func(match Match, ctx interface{}) { ran = "stop" },
+	})
+	if err != nil {
+		t.Fatalf("LoadJSON failed: %v", err)
+	}
+
+	if !cmds.Parse("g home", nil) || ran != "go home" {
+		t.Fatalf("Parse of a loaded command failed")
+	}
+	if cmds.Parse("stop n", nil) {
+		t.Fatalf("An exact keyword was abbreviated in a loaded command")
+	}
+	id, m, err := cmds.ParseToMatch("copy a 1 2 to b")
+	if err != nil || id != "copy" {
+		t.Fatalf("ParseToMatch of a loaded named command returned ‘%s’, %v", id, err)
+	}
+	if g, ok := m.Group("target"); !ok || g.Var("dst")[0].Value != "b" || len(m.Var("n")) != 2 {
+		t.Fatalf("The loaded command matched wrongly: %v", m)
+	}
+	if _, m, _ = cmds.ParseToMatch("run ls -l"); m == nil || m.Var("cmd")[0].Value != "ls -l" {
+		t.Fatalf("The loaded rest variable didn't match")
+	}
+	if _, m, _ = cmds.ParseToMatch("sync all f"); m == nil || !m.KeywordPresent("fast") {
+		t.Fatalf("The loaded set didn't match")
+	}
+	if _, _, err = cmds.ParseToMatch("sync all all"); err == nil {
+		t.Fatalf("An option of a loaded set matched twice")
+	}
+	if _, m, _ = cmds.ParseToMatch("drop a all"); m == nil || len(m.Var("name")) != 1 || !m.KeywordPresent("all") {
+		t.Fatalf("The loaded variable matched an excluded word")
+	}
+	if _, m, _ = cmds.ParseToMatch("rm a wipe"); m == nil || !m.KeywordPresent("erase") || !m.KeywordPresent("purge") {
+		t.Fatalf("The loaded aliases didn't match")
+	}
+	if _, _, err = cmds.ParseToMatch("rm a w"); err == nil {
+		t.Fatalf("An exact alias of a loaded command was abbreviated")
+	}
+
+	origInfo, info := orig.Commands(), cmds.Commands()
+	if len(origInfo) != len(info) {
+		t.Fatalf("Expected %d commands but loaded %d", len(origInfo), len(info))
+	}
+	for i := range info {
+		if info[i].Syntax != origInfo[i].Syntax || info[i].ProgramRange != origInfo[i].ProgramRange {
+			t.Fatalf("Expected command %d to be %s at %v but it's %s at %v", i,
+				origInfo[i].Syntax, origInfo[i].ProgramRange, info[i].Syntax, info[i].ProgramRange)
+		}
+	}
+
+	buf.Reset()
+	if err := cmds.ExportJSON(&buf); err != nil || buf.String() != exported {
+		t.Fatalf("Exporting the loaded program gave\n%s\ninstead of\n%s", buf.String(), exported)
+	}
+
+	cmds.Add("halt", func(match Match, ctx interface{}) { ran = "halt" })
+	if !cmds.Parse("halt", nil) || ran != "halt" || !cmds.Parse("g home", nil) {
+		t.Fatalf("Parse failed after adding a command to the loaded ones")
+	}
+	if err := cmds.Remove("go <where:str>"); err != nil || cmds.Parse("g home", nil) {
+		t.Fatalf("Removing a loaded command failed: %v", err)
+	}
+	if _, _, err = cmds.ParseToMatch("copy a 1 2 to b"); err != nil {
+		t.Fatalf("ParseToMatch of a loaded command failed after removing another: %v", err)
+	}
+}
+
+func TestLoadJSONErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		error string
+	}{
+		{"version", `{"version":2}`, "unsupported program version 2"},
+		{"opcode", `{"version":1,"program":[["bogus"]]}`, "instruction 0: unknown opcode bogus"},
+		{"keyword", `{"version":1,"keywords":["a"],"program":[["cmp",1]]}`, "instruction 0: argument 1 is not a valid index: 1"},
+		{"type", `{"version":1,"program":[["save","a","ipv4",0]]}`, "instruction 0: unknown type ‘ipv4’"},
+		{"jump", `{"version":1,"program":[["jmp",5],["match"]]}`, "instruction 0: jump out of the program"},
+		{"excluded", `{"version":1,"program":[["save","a","str",0,[1]]]}`, "instruction 0: argument 4 has an element that is not a string: 1"},
+		{"ids", `{"version":1,"commands":["a"],"ids":[],"program":[]}`, "there are 0 ids for 1 commands"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			err := cmds.LoadJSON(bytes.NewBufferString(tc.json), nil)
+			if err == nil || err.Error() != tc.error {
+				t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+			}
+		})
+	}
+}
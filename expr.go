@@ -0,0 +1,478 @@
+package cmdparse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is an expression matched by a variable of the type expr, as in
+//
+//    filter <cond:expr>
+//
+// which matches input such as ‘filter len > 64 && proto == 'tcp'’. The variable consumes
+// the rest of the input, and only matches if the expression is valid. The parsed
+// expression is available in VarValue.Converted, or from VarValue.Expr, so the callback
+// only has to evaluate it.
+type Expr interface {
+	// Eval returns the value of the expression when its identifiers have the values
+	// ‘vars’. It returns an error if an identifier isn't in ‘vars’ or an operator is
+	// applied to values of the wrong type.
+	Eval(vars map[string]interface{}) (interface{}, error)
+}
+
+// ExprParser parses the text of an expression, and returns an error if it isn't valid.
+type ExprParser func(text string) (Expr, error)
+
+// SetExprParser sets the parser used for variables of the type expr, so that an
+// application can use its own expression language. The default parser is ParseExpr.
+func (c *Cmds) SetExprParser(p ExprParser) {
+	c.AddType(exprType{parse: p})
+}
+
+// exprType is the type of the rest of the input when it's an expression. Its values
+// convert to an Expr.
+type exprType struct {
+	parse ExprParser
+}
+
+func (exprType) Name() string { return "expr" }
+
+func (t exprType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (t exprType) Convert(val string) (interface{}, error) {
+	parse := t.parse
+	if parse == nil {
+		parse = ParseExpr
+	}
+	return parse(val)
+}
+
+func (exprType) Complete(prefix string) []string { return nil }
+func (exprType) Describe() string                { return "an expression" }
+func (exprType) consumesRest()                   {}
+func (exprType) quotesWords()                    {}
+
+// Expr returns the value as an expression. For variables of the type expr this is the
+// converted value; otherwise the value is parsed with ParseExpr.
+func (v VarValue) Expr() (Expr, error) {
+	if e, ok := v.converted().(Expr); ok {
+		return e, nil
+	}
+	return ParseExpr(v.Value)
+}
+
+// ParseExpr parses ‘text’ as an expression of numbers, strings, booleans and identifiers
+// combined with the operators, from lowest to highest precedence:
+//
+//    ||
+//    &&
+//    == != < <= > >=
+//    + -
+//    * / %
+//    unary - and !
+//
+// and parentheses. Strings are written in single or double quotes, as in 'eth0', and the
+// strings true and false are booleans. Identifiers are letters, digits, underscores and
+// dots, beginning with a letter or underscore, such as pkt.len. Numbers evaluate to a
+// float64; when the expression is evaluated identifiers with integer values are
+// converted to float64 too. + also concatenates strings, and strings are compared in
+// lexical order.
+func ParseExpr(text string) (Expr, error) {
+	toks, err := lexExpr(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p := exprParser{toks: toks}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected ‘%s’ in expression", p.toks[p.pos].text)
+	}
+	return e, nil
+}
+
+type exprTokenKind int
+
+const (
+	exprNumTok exprTokenKind = iota
+	exprStrTok
+	exprIdentTok
+	exprOpTok
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+// exprOps are the operators, with those that begin with another operator first.
+var exprOps = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")"}
+
+// lexExpr splits the expression ‘text’ into tokens. The text of a string token is its
+// value without the quotes.
+func lexExpr(text string) (toks []exprToken, err error) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'e' || runes[j] == 'E' ||
+				(runes[j] == '-' || runes[j] == '+') && (runes[j-1] == 'e' || runes[j-1] == 'E')) {
+				j++
+			}
+			toks = append(toks, exprToken{exprNumTok, string(runes[i:j])})
+			i = j
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated string in expression")
+			}
+			toks = append(toks, exprToken{exprStrTok, string(runes[i+1 : j])})
+			i = j + 1
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			toks = append(toks, exprToken{exprIdentTok, string(runes[i:j])})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(string(runes[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected ‘%c’ in expression", r)
+			}
+			toks = append(toks, exprToken{exprOpTok, op})
+			i += len([]rune(op))
+		}
+	}
+	return
+}
+
+// exprParser parses expression tokens by recursive descent, with a method for each level
+// of precedence.
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+// accept consumes the next token and returns it if it's one of the operators ‘ops’.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	if p.pos == len(p.toks) || p.toks[p.pos].kind != exprOpTok {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.toks[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// binary parses operands with ‘operand’ separated by the left associative operators ‘ops’.
+func (p *exprParser) binary(operand func() (Expr, error), ops ...string) (Expr, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+}
+
+func (p *exprParser) or() (Expr, error)  { return p.binary(p.and, "||") }
+func (p *exprParser) and() (Expr, error) { return p.binary(p.cmp, "&&") }
+func (p *exprParser) sum() (Expr, error) { return p.binary(p.product, "+", "-") }
+
+func (p *exprParser) product() (Expr, error) { return p.binary(p.unary, "*", "/", "%") }
+
+// cmp parses a comparison, which unlike the other operators can't be chained.
+func (p *exprParser) cmp() (Expr, error) {
+	l, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return l, nil
+	}
+	r, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	return binaryExpr{op: op, l: l, r: r}, nil
+}
+
+func (p *exprParser) unary() (Expr, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (Expr, error) {
+	if p.pos == len(p.toks) {
+		return nil, fmt.Errorf("expression ends where a value was expected")
+	}
+
+	if _, ok := p.accept("("); ok {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, fmt.Errorf("expected ) in expression")
+		}
+		return e, nil
+	}
+
+	tok := p.toks[p.pos]
+	p.pos++
+	switch tok.kind {
+	case exprNumTok:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("‘%s’ is not a number", tok.text)
+		}
+		return literalExpr{f}, nil
+	case exprStrTok:
+		return literalExpr{tok.text}, nil
+	case exprIdentTok:
+		switch tok.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		}
+		return identExpr(tok.text), nil
+	}
+	return nil, fmt.Errorf("unexpected ‘%s’ in expression", tok.text)
+}
+
+type literalExpr struct {
+	val interface{}
+}
+
+func (e literalExpr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return e.val, nil
+}
+
+type identExpr string
+
+func (e identExpr) Eval(vars map[string]interface{}) (interface{}, error) {
+	val, ok := vars[string(e)]
+	if !ok {
+		return nil, fmt.Errorf("‘%s’ is not defined", string(e))
+	}
+	return exprValue(val), nil
+}
+
+// exprValue returns ‘val’ as one of the types that expressions operate on, converting
+// integers to float64.
+func exprValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	}
+	return val
+}
+
+type unaryExpr struct {
+	op string
+	x  Expr
+}
+
+func (e unaryExpr) Eval(vars map[string]interface{}) (interface{}, error) {
+	x, err := e.x.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := x.(type) {
+	case float64:
+		if e.op == "-" {
+			return -v, nil
+		}
+	case bool:
+		if e.op == "!" {
+			return !v, nil
+		}
+	}
+	return nil, fmt.Errorf("%s can't be applied to %s", e.op, exprTypeName(x))
+}
+
+type binaryExpr struct {
+	op   string
+	l, r Expr
+}
+
+func (e binaryExpr) Eval(vars map[string]interface{}) (interface{}, error) {
+	l, err := e.l.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only evaluate the right operand if it's needed
+	if e.op == "&&" || e.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s can't be applied to %s", e.op, exprTypeName(l))
+		}
+		if lb == (e.op == "||") {
+			return lb, nil
+		}
+		r, err := e.r.Eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		if rb, ok := r.(bool); ok {
+			return rb, nil
+		}
+		return nil, fmt.Errorf("%s can't be applied to %s", e.op, exprTypeName(r))
+	}
+
+	r, err := e.r.Eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "==" || e.op == "!=" {
+		if !isExprValue(l) || !isExprValue(r) {
+			return nil, fmt.Errorf("%s can't be applied to %s and %s", e.op, exprTypeName(l), exprTypeName(r))
+		}
+		return (l == r) == (e.op == "=="), nil
+	}
+
+	switch lv := l.(type) {
+	case float64:
+		if rv, ok := r.(float64); ok {
+			return evalNumbers(e.op, lv, rv)
+		}
+	case string:
+		if rv, ok := r.(string); ok {
+			return evalStrings(e.op, lv, rv)
+		}
+	}
+	return nil, fmt.Errorf("%s can't be applied to %s and %s", e.op, exprTypeName(l), exprTypeName(r))
+}
+
+func evalNumbers(op string, l, r float64) (interface{}, error) {
+	switch op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("%s can't be applied to numbers", op)
+}
+
+func evalStrings(op string, l, r string) (interface{}, error) {
+	switch op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	}
+	return nil, fmt.Errorf("%s can't be applied to strings", op)
+}
+
+// isExprValue returns true if ‘v’ is a number, string or boolean.
+func isExprValue(v interface{}) bool {
+	switch v.(type) {
+	case float64, string, bool:
+		return true
+	}
+	return false
+}
+
+// exprTypeName returns the name of the type of the value ‘v’ for errors.
+func exprTypeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("a %T", v)
+}
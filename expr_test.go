@@ -0,0 +1,167 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseExpr(t *testing.T) {
+	vars := map[string]interface{}{
+		"len":     100,
+		"proto":   "tcp",
+		"ok":      true,
+		"pkt.ttl": int64(3),
+		"list":    []int{1},
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected interface{}
+		error    string
+	}{
+		{"number", "42", 42.0, ""},
+		{"precedence", "1 + 2 * 3", 7.0, ""},
+		{"parentheses", "(1 + 2) * 3", 9.0, ""},
+		{"left associative", "10 - 4 - 3", 3.0, ""},
+		{"unary", "-2 * -(3)", 6.0, ""},
+		{"modulo", "7 % 4", 3.0, ""},
+		{"exponent", "1.5e2", 150.0, ""},
+		{"comparison", "len > 64", true, ""},
+		{"string", "proto == 'tcp'", true, ""},
+		{"double quoted string", `proto != "udp"`, true, ""},
+		{"concatenation", "proto + '6'", "tcp6", ""},
+		{"string order", "'a' < 'b'", true, ""},
+		{"logic", "len > 64 && !(proto == 'udp') || false", true, ""},
+		{"dotted identifier", "pkt.ttl <= 3", true, ""},
+		{"bool identifier", "ok && true", true, ""},
+		{"short circuit", "ok || missing", true, ""},
+		{"different types", "len == 'x'", false, ""},
+		{"undefined", "missing > 1", nil, "‘missing’ is not defined"},
+		{"type mismatch", "proto * 2", nil, "* can't be applied to a string and a number"},
+		{"not a bool", "len && ok", nil, "&& can't be applied to a number"},
+		{"negated string", "-proto", nil, "- can't be applied to a string"},
+		{"not comparable", "list == list", nil, "== can't be applied to a []int and a []int"},
+		{"division by zero", "1 / (len - 100)", nil, "division by zero"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := ParseExpr(tc.expr)
+			if err != nil {
+				t.Fatalf("ParseExpr failed: %v", err)
+			}
+
+			val, err := e.Eval(vars)
+			if tc.error != "" {
+				if err == nil || err.Error() != tc.error {
+					t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Eval failed: %v", err)
+			}
+			if val != tc.expected {
+				t.Fatalf("Expected %v (%T) but got %v (%T)", tc.expected, tc.expected, val, val)
+			}
+		})
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr  string
+		error string
+	}{
+		{"", "expression ends where a value was expected"},
+		{"1 +", "expression ends where a value was expected"},
+		{"(1", "expected ) in expression"},
+		{"1 2", "unexpected ‘2’ in expression"},
+		{"a < b < c", "unexpected ‘<’ in expression"},
+		{"'open", "unterminated string in expression"},
+		{"a = 1", "unexpected ‘=’ in expression"},
+		{"1.2.3", "‘1.2.3’ is not a number"},
+		{")", "unexpected ‘)’ in expression"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := ParseExpr(tc.expr)
+			if err == nil || err.Error() != tc.error {
+				t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+			}
+		})
+	}
+}
+
+func TestExprType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected string
+	}{
+		{"expression", "filter len > 64 && proto == 'tcp'", true, "true"},
+		{"quoted words", `filter proto + "v 6"`, true, "tcpv 6"},
+		{"invalid", "filter len >", false, ""},
+		{"missing", "filter", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var got string
+
+			cmds.Add("filter <cond:expr>", func(match Match, ctx interface{}) {
+				e, err := match.Var("cond")[0].Expr()
+				if err != nil {
+					got = err.Error()
+					return
+				}
+				val, err := e.Eval(map[string]interface{}{"len": 100, "proto": "tcp"})
+				got = fmt.Sprintf("%v %v", val, err)
+			})
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if ok && got != tc.expected+" <nil>" {
+				t.Fatalf("Expected the value %s but got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+// upperExpr is an Expr whose value is its text in upper case.
+type upperExpr string
+
+func (e upperExpr) Eval(vars map[string]interface{}) (interface{}, error) {
+	return strings.ToUpper(string(e)), nil
+}
+
+func TestSetExprParser(t *testing.T) {
+	var cmds Cmds
+	var got interface{}
+
+	cmds.SetExprParser(func(text string) (Expr, error) {
+		if strings.HasPrefix(text, "=") {
+			return nil, fmt.Errorf("invalid")
+		}
+		return upperExpr(text), nil
+	})
+	cmds.Add("filter <cond:expr>", func(match Match, ctx interface{}) {
+		got, _ = match.Var("cond")[0].Converted.(Expr).Eval(nil)
+	})
+	cmds.Compile()
+
+	if !cmds.Parse("filter a ~ b", nil) || got != "A ~ B" {
+		t.Fatalf("The custom expression parser wasn't used: got %v", got)
+	}
+	if cmds.Parse("filter = b", nil) {
+		t.Fatalf("An expression the custom parser rejected was matched")
+	}
+}
@@ -0,0 +1,349 @@
+package cmdparse
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// GeneratorOptions are the parameters of the grammars generated by a Generator. Zero
+// fields take their default.
+type GeneratorOptions struct {
+	// Seed makes the Generator deterministic: generators with the same options generate
+	// the same grammars and inputs.
+	Seed int64
+	// Commands is the number of commands in each grammar. The default is 20.
+	Commands int
+	// Elements is the most keywords, variables and groups in a row, at the top of a
+	// command or inside a group. The default is 4.
+	Elements int
+	// Depth is how deeply groups may be nested. The default is 2.
+	Depth int
+	// Keywords is the number of different keywords the commands are made of. The fewer
+	// there are the more the commands look alike, begin with the same keywords, and have
+	// keywords that are prefixes of each other, so that more inputs are ambiguous. The
+	// default is twice the number of commands.
+	Keywords int
+	// Types are the types of the typed variables, which are written with the name of the
+	// type as in <v1:ipv4>. Types that aren't built in must be added to the Cmds with
+	// AddType. If there are none every variable is untyped.
+	Types []Type
+	// Samples are the values used for the variables of each type, by the name of the type.
+	// Types without samples use the values listed by their Complete method, and the
+	// built-in types have samples of their own.
+	Samples map[string][]string
+}
+
+// Generator generates random grammars and inputs for stress testing. It helps harden
+// custom types and the options of a Cmds against edge cases that hand-written grammars
+// don't have, for example:
+//
+//    g := cmdparse.NewGenerator(cmdparse.GeneratorOptions{Seed: 1, Types: []cmdparse.Type{ipv4}})
+//    var cmds cmdparse.Cmds
+//    cmds.AddType(ipv4)
+//    defs := g.Grammar()
+//    for _, def := range defs {
+//        cmds.Add(def, cback)
+//    }
+//    cmds.Compile()
+//    for _, def := range defs {
+//        input, _ := g.Input(def)
+//        if _, _, err := cmds.ParseWithResult(input, nil); err != nil {
+//            ...
+//        }
+//    }
+//
+// A Generator isn't safe for concurrent use.
+type Generator struct {
+	opts  GeneratorOptions
+	rnd   *rand.Rand
+	types map[string]Type
+	// keywords is the vocabulary of the grammar being generated
+	keywords []string
+	// vars and groups are the number of variables and named groups in the command being
+	// generated
+	vars, groups int
+}
+
+// NewGenerator returns a Generator of grammars with the options ‘opts’.
+func NewGenerator(opts GeneratorOptions) *Generator {
+	if opts.Commands <= 0 {
+		opts.Commands = 20
+	}
+	if opts.Elements <= 0 {
+		opts.Elements = 4
+	}
+	if opts.Depth <= 0 {
+		opts.Depth = 2
+	}
+	if opts.Keywords <= 0 {
+		opts.Keywords = 2 * opts.Commands
+	}
+
+	g := &Generator{opts: opts, rnd: rand.New(rand.NewSource(opts.Seed)), types: make(map[string]Type)}
+	for _, t := range opts.Types {
+		g.types[t.Name()] = t
+	}
+	return g
+}
+
+// Grammar returns the definitions of the commands of a new random grammar. Every command
+// begins with a keyword, and no two definitions are the same, but the commands may match
+// the same input.
+func (g *Generator) Grammar() []string {
+	g.keywords = g.keywords[:0]
+	seen := make(map[string]bool)
+	for len(g.keywords) < g.opts.Keywords {
+		kw := g.keyword()
+		if !seen[kw] {
+			seen[kw] = true
+			g.keywords = append(g.keywords, kw)
+		}
+	}
+
+	var defs []string
+	seen = make(map[string]bool)
+	for tries := 0; len(defs) < g.opts.Commands && tries < 100*g.opts.Commands; tries++ {
+		g.vars, g.groups = 0, 0
+		def := g.pick(g.keywords)
+		if rest := g.sequence(g.opts.Depth, g.rnd.Intn(g.opts.Elements)); rest != "" {
+			def += " " + rest
+		}
+		if !seen[def] {
+			seen[def] = true
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// keyword returns a random keyword of lowercase letters.
+func (g *Generator) keyword() string {
+	const consonants, vowels = "bcdfghklmnprstvz", "aeiou"
+	var buf strings.Builder
+	for i := 1 + g.rnd.Intn(3); i > 0; i-- {
+		buf.WriteByte(consonants[g.rnd.Intn(len(consonants))])
+		buf.WriteByte(vowels[g.rnd.Intn(len(vowels))])
+	}
+	return buf.String()
+}
+
+// sequence returns ‘n’ random elements, with groups nested at most ‘depth’ deep.
+func (g *Generator) sequence(depth, n int) string {
+	elems := make([]string, n)
+	for i := range elems {
+		elems[i] = g.element(depth)
+	}
+	return strings.Join(elems, " ")
+}
+
+// element returns a random keyword, variable, or group nested at most ‘depth’ deep.
+func (g *Generator) element(depth int) string {
+	choices := 5
+	if depth > 0 {
+		choices = 10
+	}
+
+	switch g.rnd.Intn(choices) {
+	case 0, 1:
+		return g.pick(g.keywords)
+	case 2:
+		return "!" + g.pick(g.keywords)
+	case 3:
+		return g.variable()
+	case 4:
+		return g.pick(g.keywords) + "(" + g.pick(g.keywords) + ")"
+	case 5:
+		return "(" + g.sequence(depth-1, 1+g.rnd.Intn(g.opts.Elements)) + ")?"
+	case 6:
+		return "(" + g.sequence(depth-1, 1+g.rnd.Intn(g.opts.Elements)) + " | " +
+			g.sequence(depth-1, 1+g.rnd.Intn(g.opts.Elements)) + ")"
+	case 7:
+		return g.pick([]string{g.variable(), g.pick(g.keywords)}) + g.pick([]string{"*", "+", "{1,2}", "{2}"})
+	case 8:
+		opts := make([]string, 2+g.rnd.Intn(2))
+		for i := range opts {
+			opts[i] = g.pick(g.keywords) + g.pick([]string{"", "?"})
+		}
+		return "{" + strings.Join(opts, " ") + "}"
+	}
+	g.groups++
+	return fmt.Sprintf("(%s):g%d", g.sequence(depth-1, 1+g.rnd.Intn(g.opts.Elements)), g.groups)
+}
+
+// variable returns a new variable of a random type.
+func (g *Generator) variable() string {
+	g.vars++
+	if len(g.opts.Types) > 0 && g.rnd.Intn(2) == 0 {
+		return fmt.Sprintf("<v%d:%s>", g.vars, g.opts.Types[g.rnd.Intn(len(g.opts.Types))].Name())
+	}
+	return fmt.Sprintf("<v%d>", g.vars)
+}
+
+func (g *Generator) pick(list []string) string {
+	return list[g.rnd.Intn(len(list))]
+}
+
+// Input returns a random input that matches the command definition ‘syntax’, which may
+// also match other commands. It returns an error if ‘syntax’ isn't valid or it has a
+// variable of a type that the Generator has no values of.
+func (g *Generator) Input(syntax string) (string, error) {
+	var s scanner
+	tokens, ok := s.Scan(syntax)
+	if !ok {
+		return "", ScanError(s.errs)
+	}
+	var p parser
+	tree, err := p.Parse(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	in := generatedInput{g: g}
+	in.walk(tree)
+	if in.err != nil {
+		return "", in.err
+	}
+	return strings.Join(in.words, " "), nil
+}
+
+// generatedInput is the input being generated from a parse tree.
+type generatedInput struct {
+	g     *Generator
+	words []string
+	// rest is set once a variable has consumed the rest of the input
+	rest bool
+	err  error
+}
+
+func (in *generatedInput) walk(tree interface{}) {
+	if in.rest || in.err != nil {
+		return
+	}
+
+	rnd := in.g.rnd
+	switch node := tree.(type) {
+	case word:
+		in.words = append(in.words, quoteIfNeeded(string(node)))
+	case exactWord:
+		in.words = append(in.words, quoteIfNeeded(string(node)))
+	case aliasedWord:
+		spellings := append([]string{node.Keyword}, node.Aliases...)
+		in.words = append(in.words, quoteIfNeeded(in.g.pick(spellings)))
+	case variable:
+		in.variable(node)
+	case custom:
+		in.err = fmt.Errorf("there are no values for <%s>, which is matched by the instruction ‘%s’", node.Name, node.Instr)
+	case terms:
+		in.walk(node.Left)
+		in.walk(node.Right)
+	case alts:
+		if rnd.Intn(2) == 0 {
+			in.walk(node.Left)
+		} else {
+			in.walk(node.Right)
+		}
+	case group:
+		in.walk(node.Term)
+	case rep:
+		min, max := 0, 3
+		switch node.Op {
+		case repeatOneOrMore:
+			min = 1
+		case repeatZeroOrOne:
+			max = 1
+		case repeatCounted:
+			min, max = node.Min, node.Max
+			if max < 0 {
+				max = min + 2
+			}
+		}
+		for i := min + rnd.Intn(max-min+1); i > 0; i-- {
+			in.walk(node.Term)
+		}
+	case set:
+		for _, i := range rnd.Perm(len(node.Options)) {
+			if !node.Optional[i] || rnd.Intn(2) == 0 {
+				in.walk(node.Options[i])
+			}
+		}
+	case meta:
+		in.walk(node.ch)
+	}
+}
+
+// variable adds a random value of the variable ‘v’.
+func (in *generatedInput) variable(v variable) {
+	g := in.g
+	excluded := make(map[string]bool)
+	for _, w := range v.Exclude {
+		excluded[w] = true
+	}
+
+	var vals []string
+	t := lookupType(v.Type, g.types)
+	switch {
+	case t == nil:
+		in.err = fmt.Errorf("there is no type ‘%s’", v.Type)
+		return
+	case len(g.opts.Samples[v.Type]) > 0:
+		vals = g.opts.Samples[v.Type]
+	case v.Type == "str":
+		// Digits keep the value from being a prefix of the generated keywords
+		vals = []string{fmt.Sprintf("x%d", g.rnd.Intn(100))}
+	default:
+		vals = t.Complete("")
+		if s, known := analysisSamples[v.Type]; known {
+			vals = append(vals, s)
+		} else if _, list := t.(listType); list {
+			vals = append(vals, "[]")
+		}
+	}
+
+	var valid []string
+	for _, val := range vals {
+		if !excluded[val] && t.Validate(val) == nil {
+			valid = append(valid, val)
+		}
+	}
+	if len(valid) == 0 {
+		in.err = fmt.Errorf("there are no values of the type ‘%s’ for <%s>", v.Type, v.Name)
+		return
+	}
+
+	in.words = append(in.words, quoteIfNeeded(g.pick(valid)))
+	_, in.rest = t.(restType)
+}
+
+// Mutate returns ‘input’ changed by a random edit: a word is removed, repeated, swapped
+// with the next one, or cut short, or an unknown word is inserted. The result usually
+// doesn't match the command that ‘input’ matched, but it may match it or another command.
+func (g *Generator) Mutate(input string) string {
+	words := strings.Fields(input)
+	if len(words) == 0 {
+		return "zz9"
+	}
+
+	i := g.rnd.Intn(len(words))
+	switch g.rnd.Intn(5) {
+	case 0:
+		words = append(words[:i], words[i+1:]...)
+	case 1:
+		words = append(words[:i+1], words[i:]...)
+	case 2:
+		if i+1 < len(words) {
+			words[i], words[i+1] = words[i+1], words[i]
+		} else {
+			words = words[:i]
+		}
+	case 3:
+		if len(words[i]) > 1 {
+			words[i] = words[i][:len(words[i])-1]
+		} else {
+			words = words[:i]
+		}
+	default:
+		words = append(words[:i], append([]string{"zz9"}, words[i:]...)...)
+	}
+	return strings.Join(words, " ")
+}
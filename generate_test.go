@@ -0,0 +1,150 @@
+package cmdparse
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// outcome is what parsing an input did, for comparing the ways of matching.
+type outcome struct {
+	syntax string
+	bound  string
+	err    string
+}
+
+func parseOutcome(cmds *Cmds, input string) outcome {
+	var o outcome
+	d, ok := cmds.Describe(input)
+	if ok {
+		o.syntax = d.Syntax
+		o.bound = fmt.Sprint(d.Bound)
+	}
+	if _, _, err := cmds.ParseWithResult(input, nil); err != nil {
+		o.err = fmt.Sprintf("%T", err)
+	}
+	return o
+}
+
+// TestStress matches random inputs with random grammars, and checks that each input
+// generated from a command matches it, and that lazy compilation and Optimize don't
+// change the outcome.
+func TestStress(t *testing.T) {
+	tests := []struct {
+		name string
+		opts GeneratorOptions
+	}{
+		{"default", GeneratorOptions{}},
+		{"typed", GeneratorOptions{Types: []Type{intType{}, boolType{}, enumType{name: "(on|off)", values: []string{"on", "off"}}}}},
+		{"ambiguous", GeneratorOptions{Commands: 30, Keywords: 6}},
+		{"deep", GeneratorOptions{Commands: 10, Elements: 3, Depth: 4}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				tc.opts.Seed = seed
+				stress(t, NewGenerator(tc.opts))
+			}
+		})
+	}
+}
+
+func stress(t *testing.T, g *Generator) {
+	defs := g.Grammar()
+
+	var plain, lazy, optimized Cmds
+	lazy.SetLazyCompilation(true)
+	optimized.Optimize()
+	for _, cmds := range []*Cmds{&plain, &lazy, &optimized} {
+		for _, def := range defs {
+			if err := cmds.Add(def, func(m Match, ctx interface{}) {}); err != nil {
+				t.Fatalf("adding the generated ‘%s’ failed: %v", def, err)
+			}
+		}
+		cmds.Compile()
+	}
+
+	for _, def := range defs {
+		input, err := g.Input(def)
+		if err != nil {
+			t.Fatalf("generating input for ‘%s’ failed: %v", def, err)
+		}
+
+		o := parseOutcome(&plain, input)
+		if o.syntax != def && o.err != "*cmdparse.AmbiguityError" {
+			t.Fatalf("the input ‘%s’ generated from ‘%s’ matched ‘%s’ with error %s", input, def, o.syntax, o.err)
+		}
+
+		for _, in := range []string{input, g.Mutate(input)} {
+			o := parseOutcome(&plain, in)
+			if lo := parseOutcome(&lazy, in); lo != o {
+				t.Fatalf("with lazy compilation ‘%s’ gave %+v instead of %+v", in, lo, o)
+			}
+			if oo := parseOutcome(&optimized, in); oo != o {
+				t.Fatalf("optimized ‘%s’ gave %+v instead of %+v", in, oo, o)
+			}
+		}
+	}
+}
+
+func TestGeneratorDeterministic(t *testing.T) {
+	generate := func() (defs, inputs []string) {
+		g := NewGenerator(GeneratorOptions{Seed: 42, Commands: 5})
+		defs = g.Grammar()
+		for _, def := range defs {
+			input, err := g.Input(def)
+			if err != nil {
+				t.Fatalf("generating input for ‘%s’ failed: %v", def, err)
+			}
+			inputs = append(inputs, input, g.Mutate(input))
+		}
+		return
+	}
+
+	defs1, inputs1 := generate()
+	defs2, inputs2 := generate()
+	if len(defs1) != 5 {
+		t.Fatalf("generated %d commands, expected 5", len(defs1))
+	}
+	if !reflect.DeepEqual(defs1, defs2) || !reflect.DeepEqual(inputs1, inputs2) {
+		t.Fatalf("the same seed generated different grammars:\n%v %v\n%v %v", defs1, inputs1, defs2, inputs2)
+	}
+}
+
+func TestGeneratorInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		syntax  string
+		samples map[string][]string
+		input   string
+		err     string
+	}{
+		{"keywords", "copy !all", nil, "copy all", ""},
+		{"counted", "ping{2}", nil, "ping ping", ""},
+		{"typed", "set <n:int>", nil, "set 1", ""},
+		{"samples", "set <n:int> <name>", map[string][]string{"int": {"x", "7"}, "str": {"a b"}}, `set 7 "a b"`, ""},
+		{"excluded", "get <n:(on|off)!(on)>", nil, "get off", ""},
+		{"unknown type", "set <a:ipv4>", nil, "", "there is no type ‘ipv4’"},
+		{"no values", "set <n:int>", map[string][]string{"int": {"x"}}, "", "there are no values of the type ‘int’ for <n>"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGenerator(GeneratorOptions{Samples: tc.samples})
+			input, err := g.Input(tc.syntax)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("returned the error %v, expected %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("returned the error %v", err)
+			}
+			if input != tc.input {
+				t.Fatalf("generated ‘%s’, expected ‘%s’", input, tc.input)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package cmdparse
+
+import "fmt"
+
+// SetGrammars puts the command whose definition is ‘syntax’, exactly as it was passed to
+// Add, in the named ‘grammars’. Setting ParseOptions.Grammar then limits the commands that
+// are matched to those in that grammar, so that one Cmds can serve clients that use
+// different versions of a command set, for example:
+//
+//    cmds.Add("show <item>", showV1)
+//    cmds.Add("show <item> <format>?", showV2)
+//    cmds.SetGrammars("show <item>", "v1")
+//    cmds.SetGrammars("show <item> <format>?", "v2")
+//    cmds.ParseWithOptions("show x", ctx, ParseOptions{Grammar: "v1"})
+//
+// Commands whose grammars aren't set are in every grammar. Calling SetGrammars again
+// replaces the grammars of the command. Grammars can be combined with the other options in
+// a profile using SetProfile.
+func (c *Cmds) SetGrammars(syntax string, grammars ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax == syntax {
+			cmd.grammars = make(map[string]bool)
+			for _, g := range grammars {
+				cmd.grammars[g] = true
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
@@ -0,0 +1,55 @@
+package cmdparse
+
+import (
+	"testing"
+)
+
+func TestGrammars(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		grammar  string
+		expected string
+	}{
+		{"v1", "show x", "v1", "show <item>"},
+		{"v2", "show x", "v2", "show <item> <format>?"},
+		{"v2 only", "show x json", "v1", ""},
+		{"all grammars", "show x", "", ""},
+		{"shared", "quit", "v2", "quit"},
+		{"unknown grammar", "show x", "v3", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, lazy := range []bool{false, true} {
+				var cmds Cmds
+				var called string
+				for _, syntax := range []string{"show <item>", "show <item> <format>?", "quit"} {
+					syntax := syntax
+					cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+				}
+				if err := cmds.SetGrammars("show <item>", "v1"); err != nil {
+					t.Fatalf("SetGrammars failed: %v", err)
+				}
+				cmds.SetGrammars("show <item> <format>?", "v2", "beta")
+				cmds.SetLazyCompilation(lazy)
+				cmds.Compile()
+
+				ok := cmds.ParseWithOptions(tc.input, nil, ParseOptions{Grammar: tc.grammar})
+				if ok != (tc.expected != "") {
+					t.Fatalf("With lazy=%v expected ParseWithOptions to return %v but it returned %v", lazy, tc.expected != "", ok)
+				}
+				if called != tc.expected {
+					t.Fatalf("With lazy=%v expected ‘%s’ to be called but ‘%s’ was", lazy, tc.expected, called)
+				}
+			}
+		})
+	}
+}
+
+func TestSetGrammarsUnknownCommand(t *testing.T) {
+	var cmds Cmds
+	if err := cmds.SetGrammars("show", "v1"); err == nil {
+		t.Fatalf("SetGrammars succeeded for a command that wasn't added")
+	}
+}
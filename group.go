@@ -0,0 +1,118 @@
+package cmdparse
+
+// CommandGroup adds commands that all begin with the same prefix, such as the commands of
+// a configuration mode. Rather than repeating the prefix in every definition:
+//
+//    cmds.Add("interface <name> shutdown", shutdown)
+//    cmds.Add("interface <name> ip address <addr>", setAddr)
+//    cmds.Add("interface <name> ip mtu <n:int>", setMTU)
+//
+// the commands can be defined in groups, which may be nested:
+//
+//    iface := cmds.Group("interface <name>")
+//    iface.Add("shutdown", shutdown)
+//    ip := iface.Group("ip")
+//    ip.Add("address <addr>", setAddr)
+//    ip.Add("mtu <n:int>", setMTU)
+//
+// The commands are the same either way, except that Match.GroupPath returns the prefixes
+// of the groups a command was added in.
+type CommandGroup struct {
+	cmds *Cmds
+	// path are the prefixes of the enclosing groups and this one, outermost first
+	path []string
+	// tree is the parse tree of the prefixes
+	tree interface{}
+	// syntax is the prefixes joined into one definition
+	syntax string
+	// err is the error parsing the prefix, which is returned when adding commands
+	err error
+}
+
+// Group returns a group for adding commands that begin with ‘prefix’, which is written
+// like a command definition. An error in the prefix is returned when a command is added
+// to the group.
+func (c *Cmds) Group(prefix string) *CommandGroup {
+	g := &CommandGroup{cmds: c, path: []string{prefix}, syntax: groupSyntax(prefix)}
+	g.tree, g.err = c.scanAndParse(prefix)
+	return g
+}
+
+// Group returns a group nested in ‘g’ for adding commands that begin with the prefix of
+// ‘g’ followed by ‘prefix’.
+func (g *CommandGroup) Group(prefix string) *CommandGroup {
+	path := append(append([]string{}, g.path...), prefix)
+	inner := &CommandGroup{cmds: g.cmds, path: path, err: g.err}
+	if inner.err != nil {
+		return inner
+	}
+
+	var t interface{}
+	if t, inner.err = g.cmds.scanAndParse(prefix); inner.err == nil {
+		inner.tree = terms{Left: g.tree, Right: t}
+		inner.syntax = g.syntax + " " + groupSyntax(prefix)
+	}
+	return inner
+}
+
+// Add registers the command definition ‘cmd’ following the prefix of the group, like
+// Cmds.Add. The definition of the command returned by Commands, and that is passed to
+// methods such as Remove and SetPriority, is the prefixes and ‘cmd’ joined with spaces,
+// with parentheses added around any that have alternatives at the top level.
+func (g *CommandGroup) Add(cmd string, cback Callback) error {
+	return g.AddWithHelp(cmd, "", cback)
+}
+
+// AddWithHelp is like Add, but also sets the help text of the command like
+// Cmds.AddWithHelp.
+func (g *CommandGroup) AddWithHelp(cmd, help string, cback Callback) error {
+	return g.add(&command{help: help, cback: cback}, cmd)
+}
+
+// AddNamed registers the command definition ‘cmd’ following the prefix of the group with
+// the identifier ‘id’, like Cmds.AddNamed.
+func (g *CommandGroup) AddNamed(id, cmd string) error {
+	return g.add(&command{id: id}, cmd)
+}
+
+// add parses ‘cmd’ and registers ‘added’ with the prefix of the group before it.
+func (g *CommandGroup) add(added *command, cmd string) error {
+	if g.err != nil {
+		return g.err
+	}
+	t, err := g.cmds.scanAndParse(cmd)
+	if err != nil {
+		return err
+	}
+
+	added.syntax = g.syntax + " " + groupSyntax(cmd)
+	added.tree = terms{Left: g.tree, Right: t}
+	added.groupPath = g.path
+	g.cmds.addCommand(added)
+	return nil
+}
+
+// groupSyntax returns the definition ‘syntax’ in parentheses if it has alternatives at the
+// top level, so that it can be joined with others.
+func groupSyntax(syntax string) string {
+	var s scanner
+	tokens, ok := s.Scan(syntax)
+	if !ok {
+		return syntax
+	}
+
+	depth := 0
+	for _, tok := range tokens {
+		switch tok.typ {
+		case leftParenTok:
+			depth++
+		case rightParenTok:
+			depth--
+		case pipeTok:
+			if depth == 0 {
+				return "(" + syntax + ")"
+			}
+		}
+	}
+	return syntax
+}
@@ -0,0 +1,84 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandGroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		syntax string
+		path   []string
+		vars   map[string]string
+	}{
+		{"group", "interface eth0 shutdown", "interface <name> shutdown", []string{"interface <name>"},
+			map[string]string{"name": "eth0"}},
+		{"nested", "int eth1 ip mtu 9000", "interface <name> ip mtu <n:int>", []string{"interface <name>", "ip"},
+			map[string]string{"name": "eth1", "n": "9000"}},
+		{"alternatives", "int eth1 ip no", "interface <name> ip (no | off)", []string{"interface <name>", "ip"},
+			map[string]string{"name": "eth1"}},
+		{"prefix alternatives", "display version", "(show | display) version", []string{"show | display"}, nil},
+		{"outside a group", "exit", "exit", nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var path []string
+			cback := func(match Match, ctx interface{}) { path = match.GroupPath() }
+
+			iface := cmds.Group("interface <name>")
+			iface.Add("shutdown", cback)
+			ip := iface.Group("ip")
+			ip.Add("mtu <n:int>", cback)
+			ip.Add("no | off", cback)
+			cmds.Group("show | display").Add("version", cback)
+			cmds.Add("exit", cback)
+			cmds.Compile()
+
+			info, ok := cmds.ParseWithMatch(tc.input, nil)
+			if !ok {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if info.Syntax != tc.syntax {
+				t.Fatalf("Expected the command ‘%s’ but got ‘%s’", tc.syntax, info.Syntax)
+			}
+			if !reflect.DeepEqual(path, tc.path) {
+				t.Fatalf("Expected the group path %q but got %q", tc.path, path)
+			}
+			for name, val := range tc.vars {
+				if v := info.Match.Var(name); len(v) != 1 || v[0].Value != val {
+					t.Fatalf("Expected ‘%s’ to be ‘%s’ but got %v", name, val, v)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandGroupErrors(t *testing.T) {
+	var cmds Cmds
+
+	bad := cmds.Group("interface <name")
+	if err := bad.Add("shutdown", nil); err == nil {
+		t.Fatalf("Adding to a group with an invalid prefix succeeded")
+	}
+	if err := bad.Group("ip").AddNamed("mtu", "mtu <n>"); err == nil {
+		t.Fatalf("Adding to a group nested in one with an invalid prefix succeeded")
+	}
+	if err := cmds.Group("interface <name>").Add("ip (", nil); err == nil {
+		t.Fatalf("Adding an invalid command to a group succeeded")
+	}
+
+	if err := cmds.Group("interface <name>").AddNamed("down", "shutdown"); err != nil {
+		t.Fatalf("AddNamed failed: %v", err)
+	}
+	cmds.Compile()
+	if err := cmds.Remove("down"); err != nil {
+		t.Fatalf("Remove of a command added to a group failed: %v", err)
+	}
+	if len(cmds.Commands()) != 0 {
+		t.Fatalf("Invalid commands were added")
+	}
+}
@@ -0,0 +1,57 @@
+package cmdparse
+
+// Repetition is a variable that a repeated part of a command bound many values to, as
+// passed to a RepetitionGuard.
+type Repetition struct {
+	// Syntax is the definition of the matched command as it was passed to Add.
+	Syntax string
+	// Var is the name of the variable.
+	Var string
+	// Count is the number of values bound to the variable.
+	Count int
+}
+
+// RepetitionGuard is called by Parse before running a command whose input binds more
+// than the limit set with SetRepetitionGuard values to a variable, such as a paste of 500
+// ids into ‘delete <id>+’. ‘input’ is the input to Parse. The command is run only if the
+// guard returns nil, so the guard can ask the user to confirm, or reject the input.
+type RepetitionGuard func(input string, r Repetition) error
+
+// SetRepetitionGuard sets the function that is called before running a command whose input
+// binds more than ‘limit’ values to one variable, to guard against bulk operations entered
+// by mistake. When the guard returns an error Parse returns false and ParseErr returns the
+// error. Passing a nil guard removes it.
+func (c *Cmds) SetRepetitionGuard(limit int, guard RepetitionGuard) {
+	c.repetitionLimit = limit
+	c.repetitionGuard = guard
+}
+
+// guardRepetitions calls the repetition guard for each variable of the match ‘m’ of the
+// input ‘input’ that has more values than the limit, and returns the first error.
+func (c *Cmds) guardRepetitions(input string, m match) error {
+	if c.repetitionGuard == nil {
+		return nil
+	}
+
+	var names []string
+	counts := make(map[string]int)
+	for _, item := range m.items {
+		if v, ok := item.(VarValue); ok {
+			if counts[v.Name] == 0 {
+				names = append(names, v.Name)
+			}
+			counts[v.Name]++
+		}
+	}
+
+	syntax := m.meta.(*command).syntax
+	for _, name := range names {
+		if counts[name] <= c.repetitionLimit {
+			continue
+		}
+		if err := c.repetitionGuard(input, Repetition{Syntax: syntax, Var: name, Count: counts[name]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
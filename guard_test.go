@@ -0,0 +1,56 @@
+package cmdparse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRepetitionGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		reject  bool
+		ran     bool
+		guarded []Repetition
+	}{
+		{"under the limit", "delete 1 2 3", true, true, nil},
+		{"confirmed", "delete 1 2 3 4", false, true, []Repetition{{"delete <id>+", "id", 4}}},
+		{"rejected", "delete 1 2 3 4", true, false, []Repetition{{"delete <id>+", "id", 4}}},
+		{"several variables", "tag a b c d to x y z w", false, true, []Repetition{{"tag <name>+ to <host>+", "name", 4}, {"tag <name>+ to <host>+", "host", 4}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			ran := false
+			var guarded []Repetition
+
+			cback := func(match Match, ctx interface{}) { ran = true }
+			cmds.Add("delete <id>+", cback)
+			cmds.Add("tag <name>+ to <host>+", cback)
+			cmds.SetRepetitionGuard(3, func(input string, r Repetition) error {
+				if input != tc.input {
+					t.Fatalf("The guard was called with the input ‘%s’", input)
+				}
+				guarded = append(guarded, r)
+				if tc.reject {
+					return errors.New("too many")
+				}
+				return nil
+			})
+			cmds.Compile()
+
+			err := cmds.ParseErr(tc.input, nil)
+			if ran != tc.ran {
+				t.Fatalf("Expected the command to run to be %v", tc.ran)
+			}
+			if (err != nil) != !tc.ran {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(guarded, tc.guarded) {
+				t.Fatalf("Expected the guard to be called with %v but it was called with %v", tc.guarded, guarded)
+			}
+		})
+	}
+}
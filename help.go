@@ -0,0 +1,188 @@
+package cmdparse
+
+import (
+	"sort"
+	"strings"
+)
+
+// HelpHandler is called by Parse when the user asks for help by ending the input with a
+// ‘?’ word. ‘m’ describes how far the words before the ‘?’ matched and what could come
+// next, and ‘ctx’ is the context passed to Parse.
+type HelpHandler func(m LongestMatch, ctx interface{})
+
+// SetHelpOnQuestionMark sets a handler for input whose last word is ‘?’, which is how
+// many network device CLIs ask for the options at that point, as in:
+//
+//    show interface ?
+//
+// When such input doesn't match any command, the ‘?’ is removed and ‘h’ is called with
+// what could follow the rest of the input instead of Parse failing; Parse then returns
+// true. Input that does match a command, for example because a variable accepts ‘?’, is
+// parsed normally. Passing nil turns the handling off, which is the default.
+func (c *Cmds) SetHelpOnQuestionMark(h HelpHandler) {
+	c.helpHandler = h
+}
+
+// isHelpRequest returns true if the input words ‘toks’ ask for help and a handler is set.
+func (c *Cmds) isHelpRequest(toks []string) bool {
+	return c.helpHandler != nil && len(toks) > 0 && toks[len(toks)-1] == "?"
+}
+
+// HelpItem is something that may be entered next, as listed by HelpAt.
+type HelpItem struct {
+	Kind HelpItemKind
+	// Token is the keyword, the variable in angle brackets as in <file>, or <cr> for
+	// the end of the command.
+	Token string
+	// Description is the text set for the keyword with SetKeywordHelp, or else the first
+	// line of the help of the only command that accepts the keyword or may end. For a
+	// variable it's the description of its type, such as ‘an integer’. It's empty if
+	// there is nothing to describe it with.
+	Description string
+	// Commands are the definitions of the commands that accept it, in the order they
+	// were added.
+	Commands []string
+}
+
+// HelpItemKind is the kind of a HelpItem.
+type HelpItemKind int
+
+const (
+	// KeywordHelp is a keyword.
+	KeywordHelp HelpItemKind = iota
+	// VariableHelp is a variable.
+	VariableHelp
+	// EndHelp is the end of the command: the input may be run as it is.
+	EndHelp
+)
+
+func (k HelpItemKind) String() string {
+	switch k {
+	case KeywordHelp:
+		return "keyword"
+	case VariableHelp:
+		return "variable"
+	case EndHelp:
+		return "end"
+	}
+	return "<unknown>"
+}
+
+// HelpAt lists what may be entered at the end of the partially typed command ‘partial’,
+// with a description of each, like the context help of network device CLIs:
+//
+//    show ?
+//      interface  Show the state of interfaces
+//      ip         Show IP information
+//      <cr>       Show the system summary
+//
+// If ‘partial’ ends with a space the items are those that may follow it, and otherwise
+// those that the word being typed may be the start of, so ‘show i’ lists interface and ip.
+// A ‘?’ at the end of ‘partial’ is ignored, so that input such as ‘show ?’ or ‘show i?’
+// may be passed as it is. Keywords are listed first, then variables, then <cr> if the
+// input is a complete command, each sorted by their token.
+func (c *Cmds) HelpAt(partial string) []HelpItem {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	partial = strings.TrimSuffix(partial, "?")
+	words, prefix, _ := c.splitPartial(partial)
+
+	v := vm{exactKeywords: c.keywordMatching == ExactMatching, version: c.version}
+	expected := v.expectations(c.program(), words)
+
+	var items []HelpItem
+	index := make(map[string]int)
+	add := func(kind HelpItemKind, token, desc string, cmd *command) {
+		i, ok := index[token]
+		if !ok {
+			i = len(items)
+			index[token] = i
+			items = append(items, HelpItem{Kind: kind, Token: token, Description: desc})
+		}
+		items[i].Commands = appendUnique(items[i].Commands, cmd.syntax)
+	}
+
+	for i, instr := range expected {
+		cmd := v.expectedBy[i].meta.(*command)
+		switch instr.opcode {
+		case opCmp:
+			for _, kw := range instr.spellings() {
+				if strings.HasPrefix(kw, prefix) {
+					add(KeywordHelp, instr.strs[0], c.keywordHelp[instr.strs[0]], cmd)
+					break
+				}
+			}
+		case opSave, opSaveRest:
+			var desc string
+			if t, ok := instr.intf.(Type); ok {
+				if prefix != "" && t.Validate(prefix) != nil {
+					continue
+				}
+				desc = t.Describe()
+			} else {
+				desc = strType{}.Describe()
+			}
+			add(VariableHelp, "<"+instr.strs[0]+">", desc, cmd)
+		case opCustom:
+			var desc string
+			if ci, ok := instr.intf.(compiledInstruction); ok {
+				desc = ci.inst.Describe()
+			}
+			add(VariableHelp, "<"+instr.strs[0]+">", desc, cmd)
+		case opMatch:
+			if prefix == "" {
+				add(EndHelp, "<cr>", "", cmd)
+			}
+		}
+	}
+
+	order := make(map[string]int)
+	help := make(map[string]string)
+	for i, cmd := range c.commands {
+		order[cmd.syntax] = i
+		help[cmd.syntax] = cmd.help
+	}
+	for i := range items {
+		cmds := items[i].Commands
+		sort.SliceStable(cmds, func(i, j int) bool { return order[cmds[i]] < order[cmds[j]] })
+
+		// Keywords and the end of commands without their own description are described
+		// by the help of the command when only one accepts them
+		if items[i].Kind != VariableHelp && items[i].Description == "" && len(cmds) == 1 {
+			items[i].Description = firstLine(help[cmds[0]])
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Token < items[j].Token
+	})
+	return items
+}
+
+// SetKeywordHelp sets the description of the keyword ‘keyword’ that HelpAt lists it with,
+// in every command. Passing an empty ‘help’ removes it.
+func (c *Cmds) SetKeywordHelp(keyword, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keywordHelp == nil {
+		c.keywordHelp = make(map[string]string)
+	}
+	if help == "" {
+		delete(c.keywordHelp, keyword)
+		return
+	}
+	c.keywordHelp[keyword] = help
+}
+
+// firstLine returns the first line of ‘text’.
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
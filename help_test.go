@@ -0,0 +1,106 @@
+package cmdparse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHelpOnQuestionMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		help     bool
+		expected string
+		ran      string
+	}{
+		{"next keywords", "show ?", true, true, "logs interfaces", ""},
+		{"abbreviated", "sh logs ?", true, true, "source detail", ""},
+		{"first word", "?", true, true, "show set", ""},
+		{"value", "set ?", true, false, "", "?"},
+		{"no question mark", "show", false, false, "", ""},
+		{"question mark not last", "show ? logs", false, false, "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var ran string
+			var help *LongestMatch
+
+			cmds.Add("show logs (source | detail)", nil)
+			cmds.Add("show interfaces", nil)
+			cmds.Add("set <name>", func(match Match, ctx interface{}) {
+				ran = match.Var("name")[0].Value
+			})
+			cmds.SetHelpOnQuestionMark(func(m LongestMatch, ctx interface{}) {
+				help = &m
+			})
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if (help != nil) != tc.help {
+				t.Fatalf("Expected the help handler to be called to be %v", tc.help)
+			}
+			if help != nil {
+				if exp := strings.Join(help.Expected(), " "); exp != tc.expected {
+					t.Fatalf("Expected the options ‘%s’ but got ‘%s’", tc.expected, exp)
+				}
+			}
+			if ran != tc.ran {
+				t.Fatalf("Expected the command to run with ‘%s’ but it ran with ‘%s’", tc.ran, ran)
+			}
+		})
+	}
+
+	var cmds Cmds
+	cmds.Add("show interfaces", nil)
+	cmds.Compile()
+	if cmds.Parse("show ?", nil) {
+		t.Fatalf("Parse succeeded for a help request when no handler is set")
+	}
+}
+
+func TestHelpAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		partial  string
+		expected string
+	}{
+		{"first word", "", "ip[IP information] set[] show[]"},
+		{"next word", "show ", "interface[Show the state of interfaces] ip[IP information] <cr>[Show the system summary]"},
+		{"question mark", "show ?", "interface[Show the state of interfaces] ip[IP information] <cr>[Show the system summary]"},
+		{"word being typed", "show i?", "interface[Show the state of interfaces] ip[IP information]"},
+		{"variable", "show interface ", "brief[Show the state of interfaces] <name>[a word]"},
+		{"typed variable", "set mtu ", "<n>[an integer]"},
+		{"invalid value", "set mtu x", ""},
+		{"no match", "bogus ", ""},
+	}
+
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	cmds.AddWithHelp("show", "Show the system summary\nIncluding uptime.", cback)
+	cmds.AddWithHelp("show interface (<name> | brief)", "Show the state of interfaces", cback)
+	cmds.Add("show ip route", cback)
+	cmds.Add("show ip bgp", cback)
+	cmds.Add("ip", cback)
+	cmds.Add("set mtu <n:int>", cback)
+	cmds.SetKeywordHelp("ip", "IP information")
+	cmds.SetKeywordHelp("brief", "")
+	cmds.Compile()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var items []string
+			for _, item := range cmds.HelpAt(tc.partial) {
+				items = append(items, item.Token+"["+item.Description+"]")
+			}
+			if s := strings.Join(items, " "); s != tc.expected {
+				t.Fatalf("expected the help ‘%s’ but got ‘%s’", tc.expected, s)
+			}
+		})
+	}
+}
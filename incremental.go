@@ -0,0 +1,192 @@
+package cmdparse
+
+// IncrementalParser matches input a word at a time, keeping the state of the matching
+// between words. It's for line editors that check the input as it's typed: parsing the
+// whole input again on every keystroke takes time that grows with the square of its
+// length, while feeding each word once it's complete only matches the new word, for
+// example:
+//
+//    p := cmds.NewIncrementalParser()
+//    for _, word := range []string{"copy", "a.txt"} {
+//        if !p.Feed(word) {
+//            // Highlight the word as an error
+//        }
+//    }
+//    comps := p.Complete("")
+//
+// The parser only matches; it doesn't call callbacks. If commands are added or removed,
+// or the settings of the Cmds change, the parser must be Reset. An IncrementalParser isn't
+// safe for concurrent use.
+type IncrementalParser struct {
+	cmds *Cmds
+	// v holds the threads waiting for the next word
+	v     *vm
+	words []string
+}
+
+// NewIncrementalParser returns an IncrementalParser for the commands, with no words fed.
+func (c *Cmds) NewIncrementalParser() *IncrementalParser {
+	p := &IncrementalParser{cmds: c}
+	p.Reset()
+	return p
+}
+
+// Reset forgets the words fed so far, and picks up any change to the commands.
+func (p *IncrementalParser) Reset() {
+	c := p.cmds
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p.words = nil
+	p.v = p.newVM()
+	p.v.incremental = true
+	p.v.start(c.program(), nil)
+}
+
+// newVM returns a VM set up to match according to the settings of the Cmds.
+func (p *IncrementalParser) newVM() *vm {
+	c := p.cmds
+	return &vm{
+		exactKeywords:  c.keywordMatching == ExactMatching,
+		avoidKeywords:  c.avoidKeywords,
+		lazyConversion: c.lazyConversion,
+		version:        c.version,
+		checkMatch:     checkConstraints,
+	}
+}
+
+// Feed matches the next word of the input. It returns false if no command begins with
+// the words fed so far, in which case no words that follow can make them match.
+func (p *IncrementalParser) Feed(word string) bool {
+	p.cmds.mu.RLock()
+	defer p.cmds.mu.RUnlock()
+
+	p.words = append(p.words, word)
+	v := p.v
+	v.input = p.words
+	v.wordIndex = len(p.words) - 1
+	v.processWord(&p.words[v.wordIndex])
+	return p.viable()
+}
+
+// Back forgets the last word fed, as when it's deleted in the editor. Since the state
+// before each word isn't kept, the words before it are fed again.
+func (p *IncrementalParser) Back() {
+	if len(p.words) == 0 {
+		return
+	}
+
+	words := p.words[:len(p.words)-1]
+	p.Reset()
+	for _, w := range words {
+		p.Feed(w)
+	}
+}
+
+// Words returns the words fed so far.
+func (p *IncrementalParser) Words() []string {
+	return append([]string(nil), p.words...)
+}
+
+// Viable returns true if some command begins with, or is, the words fed so far.
+func (p *IncrementalParser) Viable() bool {
+	p.cmds.mu.RLock()
+	defer p.cmds.mu.RUnlock()
+
+	return p.viable()
+}
+
+func (p *IncrementalParser) viable() bool {
+	return len(*p.v.currentThreads) > 0 || len(p.v.parked) > 0
+}
+
+// Matches returns the commands that the words fed so far match completely, in the order
+// they were added.
+func (p *IncrementalParser) Matches() []MatchInfo {
+	c := p.cmds
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	matches := p.finished(false).maximalMatches()
+	c.sortByAddOrder(matches)
+	infos := []MatchInfo{}
+	for _, m := range matches {
+		infos = append(infos, matchInfo(m))
+	}
+	return infos
+}
+
+// Valid returns true if the words fed so far would run a command: they match exactly one
+// command, or the collision policy and match preferences choose one of those they match.
+// Validators and the resolver aren't consulted.
+func (p *IncrementalParser) Valid() bool {
+	c := p.cmds
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	matches := p.finished(false).maximalMatches()
+	if len(matches) > 1 {
+		c.sortByAddOrder(matches)
+		matches = c.applyCollisionPolicy(matches)
+		matches = c.applyPreferences(matches)
+	}
+	return len(matches) == 1
+}
+
+// Complete returns suggestions for the word after those fed so far, which begins with
+// ‘prefix’, like Cmds.Complete. Unlike Cmds.Complete, it doesn't suggest what follows a
+// variable that consumes the rest of the input once the variable has begun, since the
+// variable would consume those words too.
+func (p *IncrementalParser) Complete(prefix string) []Completion {
+	c := p.cmds
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.completionsOf(p.finished(true).expected, prefix)
+}
+
+// finished returns a VM that has run copies of the threads of the parser to the end of
+// the words fed so far, leaving the threads of the parser as they are. If ‘collect’ is
+// set the VM instead collects the instructions that could consume the next word.
+func (p *IncrementalParser) finished(collect bool) *vm {
+	v := p.newVM()
+	v.prog = p.v.prog
+	v.input = p.words
+	v.wordIndex = len(p.words)
+	v.makeThreadLists()
+
+	// A thread may be in the list more than once, and its copy must be too
+	copies := make(map[*thread]*thread)
+	for _, t := range *p.v.currentThreads {
+		t2, ok := copies[t]
+		if !ok {
+			t2 = t.clone()
+			copies[t] = t2
+		}
+		v.addThread(v.currentThreads, t2)
+	}
+
+	// The parked threads consume the rest of the input, which is now known
+	for _, t := range p.v.parked {
+		v.thread = t.clone()
+		if collect {
+			v.addThread(v.currentThreads, v.thread)
+			continue
+		}
+		v.wordIndex = v.thread.words
+		v.doSaveRest(v.currentinstr(), &v.input[v.wordIndex])
+		v.thread.wait = 0
+	}
+	*v.currentThreads = append(*v.currentThreads, *v.nextThreads...)
+	v.clear(v.nextThreads)
+	v.wordIndex = len(p.words)
+
+	if collect {
+		v.collecting = true
+		v.processWord(nil)
+		return v
+	}
+	v.processWord(nil)
+	v.finishThreads()
+	return v
+}
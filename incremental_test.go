@@ -0,0 +1,157 @@
+package cmdparse
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// matchSummaries describes ‘infos’ for comparison, in a fixed order.
+func matchSummaries(infos []MatchInfo) []string {
+	var s []string
+	for _, info := range infos {
+		s = append(s, fmt.Sprintf("%s %v", info.Syntax, boundElements(match(info.Match.(cmdMatch)))))
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestIncrementalParser(t *testing.T) {
+	var cmds Cmds
+	cback := func(m Match, ctx interface{}) {}
+	cmds.Add("copy <src> <dst>?", cback)
+	cmds.Add("copy all", cback)
+	cmds.Add("run <cmdline:rest>", cback)
+	cmds.Add("set {verbose? quiet?}", cback)
+	cmds.Compile()
+
+	tests := []struct {
+		name    string
+		words   []string
+		viable  bool
+		valid   bool
+		matches []string
+		comps   []string
+	}{
+		{"empty", nil, true, false, nil, []string{"copy", "run", "set"}},
+		{"keyword", []string{"co"}, true, false, nil, []string{"all", "<src>"}},
+		{"ambiguous", []string{"copy", "a"}, true, false, []string{"copy <src> <dst>? [{copy copy} {<src> a}]", "copy all [{copy copy} {all a}]"}, []string{"<dst>"}},
+		{"complete", []string{"copy", "x", "y"}, true, true, []string{"copy <src> <dst>? [{copy copy} {<src> x} {<dst> y}]"}, nil},
+		{"too long", []string{"copy", "x", "y", "z"}, false, false, nil, nil},
+		{"no command", []string{"bogus"}, false, false, nil, nil},
+		{"rest", []string{"run", "ls", "-l", "/"}, true, true, []string{`run <cmdline:rest> [{run run} {<cmdline> ls -l /}]`}, []string{"<cmdline>"}},
+		{"set", []string{"set", "q", "v"}, true, true, []string{"set {verbose? quiet?} [{set set} {quiet q} {verbose v}]"}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := cmds.NewIncrementalParser()
+			viable := true
+			for _, w := range tc.words {
+				viable = p.Feed(w)
+			}
+			if viable != tc.viable || p.Viable() != tc.viable {
+				t.Fatalf("viable was %v, expected %v", viable, tc.viable)
+			}
+			if p.Valid() != tc.valid {
+				t.Fatalf("valid was %v, expected %v", p.Valid(), tc.valid)
+			}
+			if m := matchSummaries(p.Matches()); !reflect.DeepEqual(m, tc.matches) {
+				t.Fatalf("matched %q, expected %q", m, tc.matches)
+			}
+
+			var comps []string
+			for _, comp := range p.Complete("") {
+				comps = append(comps, comp.Text)
+			}
+			if !reflect.DeepEqual(comps, tc.comps) {
+				t.Fatalf("completed %q, expected %q", comps, tc.comps)
+			}
+		})
+	}
+}
+
+func TestIncrementalParserBack(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("copy <src> <dst>", func(m Match, ctx interface{}) {})
+	cmds.Compile()
+
+	p := cmds.NewIncrementalParser()
+	for _, w := range []string{"copy", "a", "b", "c"} {
+		p.Feed(w)
+	}
+	if p.Viable() {
+		t.Fatalf("four words are viable")
+	}
+
+	p.Back()
+	if !p.Valid() || !reflect.DeepEqual(p.Words(), []string{"copy", "a", "b"}) {
+		t.Fatalf("after Back the words %v aren't valid", p.Words())
+	}
+
+	p.Reset()
+	if len(p.Words()) != 0 || p.Valid() {
+		t.Fatalf("after Reset the words are %v", p.Words())
+	}
+	p.Back()
+}
+
+// TestIncrementalParserStress checks that feeding random inputs a word at a time gives the
+// same matches and completions as matching them all at once.
+func TestIncrementalParserStress(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		g := NewGenerator(GeneratorOptions{Seed: seed, Keywords: 10, Types: []Type{intType{}, restLineType{}}})
+		var cmds Cmds
+		for _, def := range g.Grammar() {
+			cmds.Add(def, func(m Match, ctx interface{}) {})
+		}
+		cmds.Compile()
+
+		for _, def := range g.Grammar() {
+			input, err := g.Input(def)
+			if err != nil {
+				t.Fatalf("generating input for ‘%s’ failed: %v", def, err)
+			}
+			for _, in := range []string{input, g.Mutate(input)} {
+				words, err := cmds.scanInput(in)
+				if err != nil {
+					continue
+				}
+
+				p := cmds.NewIncrementalParser()
+				for i, w := range words {
+					p.Feed(w)
+					checkIncremental(t, &cmds, p, words[:i+1])
+				}
+			}
+		}
+	}
+}
+
+func checkIncremental(t *testing.T, cmds *Cmds, p *IncrementalParser, words []string) {
+	t.Helper()
+
+	input := ""
+	for _, w := range words {
+		input += quoteIfNeeded(w) + " "
+	}
+
+	exp, _ := cmds.Matches(input)
+	if m, e := matchSummaries(p.Matches()), matchSummaries(exp); !reflect.DeepEqual(m, e) {
+		t.Fatalf("‘%s’ incrementally matched %q instead of %q", input, m, e)
+	}
+
+	viable := cmds.LongestMatches(input).Position == len(words)
+	if p.Viable() != viable {
+		t.Fatalf("‘%s’ was viable %v, expected %v", input, p.Viable(), viable)
+	}
+
+	if len(p.v.parked) > 0 {
+		// Cmds.Complete suggests what follows a variable that consumes the rest
+		return
+	}
+	if c, e := p.Complete(""), cmds.Complete(input).Items; !reflect.DeepEqual(c, e) {
+		t.Fatalf("‘%s’ incrementally completed %v instead of %v", input, c, e)
+	}
+}
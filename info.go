@@ -0,0 +1,83 @@
+package cmdparse
+
+import (
+	"fmt"
+	"io"
+)
+
+// CommandInfo describes a registered command.
+type CommandInfo struct {
+	// Syntax is the definition of the command as it was passed to Add.
+	Syntax string
+	// Help is the help text of the command set using AddWithHelp.
+	Help string
+	// Examples are the examples of the command added with AddExample.
+	Examples []string
+	// ProgramRange is the range of the instructions compiled from the command in the
+	// program for all the commands.
+	ProgramRange ProgramRange
+	// Elements are the keywords, variables and how they may be combined, in the order
+	// they are entered, for generating a form for the command. They are nil for commands
+	// loaded with LoadJSON. Named groups that aren't available in the version set with
+	// SetVersion are left out.
+	Elements []Element
+	// Introduced and Removed are the versions the command is available in, as set with
+	// SetVersions, and Unavailable is true if the version set with SetVersion isn't one
+	// of them. Help should leave out the commands that are unavailable.
+	Introduced, Removed string
+	Unavailable         bool
+}
+
+// ProgramRange is a range of instructions in a compiled program, from Start up to but not
+// including End.
+type ProgramRange struct {
+	Start, End int
+}
+
+func (r ProgramRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// Commands returns information about the registered commands in the order they were
+// added. Compile must be called first.
+func (c *Cmds) Commands() []CommandInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Make sure the spans are known
+	c.program()
+
+	infos := make([]CommandInfo, len(c.commands))
+	for i, cmd := range c.commands {
+		infos[i] = CommandInfo{
+			Syntax:       cmd.syntax,
+			Help:         cmd.help,
+			Examples:     cmd.examples,
+			ProgramRange: c.spanOf(cmd),
+			Elements:     cmd.availableElements(c.elements(cmd.tree), c.version),
+			Introduced:   cmd.versions.introduced,
+			Removed:      cmd.versions.removed,
+			Unavailable:  !cmd.availableIn(c.version),
+		}
+	}
+	return infos
+}
+
+// Disassemble prints the instructions of the compiled program in the range ‘r’ to ‘w’,
+// one per line, along with their addresses. This is useful along with the ProgramRange of
+// a command to debug how that command is matched.
+func (c *Cmds) Disassemble(w io.Writer, r ProgramRange) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prog := c.program().instrs
+	if r.Start < 0 {
+		r.Start = 0
+	}
+	if r.End > len(prog) {
+		r.End = len(prog)
+	}
+	for i := r.Start; i < r.End; i++ {
+		fmt.Fprintf(w, "%3d: %s\n", i, prog[i])
+	}
+}
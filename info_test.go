@@ -0,0 +1,47 @@
+package cmdparse
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		var cmds Cmds
+		cback := func(match Match, ctx interface{}) {}
+		cmds.Add("stop now?", cback)
+		cmds.AddWithHelp("go <where>", "Go somewhere", cback)
+		cmds.AddExample("go <where>", "go home")
+		cmds.SetLazyCompilation(lazy)
+		cmds.Compile()
+
+		infos := cmds.Commands()
+		if len(infos) != 2 {
+			t.Fatalf("Expected 2 commands but got %d", len(infos))
+		}
+
+		expected := []CommandInfo{
+			{Syntax: "stop now?", ProgramRange: ProgramRange{5, 9}, Elements: []Element{
+				{Kind: KeywordElement, Keyword: "stop", Min: 1, Max: 1},
+				{Kind: KeywordElement, Keyword: "now", Min: 0, Max: 1},
+			}},
+			{Syntax: "go <where>", Help: "Go somewhere", Examples: []string{"go home"}, ProgramRange: ProgramRange{1, 4}, Elements: []Element{
+				{Kind: KeywordElement, Keyword: "go", Min: 1, Max: 1},
+				{Kind: VariableElement, Var: "where", Type: "str", Describe: "a word", Min: 1, Max: 1},
+			}},
+		}
+		for i := range expected {
+			if !reflect.DeepEqual(infos[i], expected[i]) {
+				t.Fatalf("With lazy=%v expected command %d to be %+v but it was %+v", lazy, i, expected[i], infos[i])
+			}
+		}
+
+		var buf bytes.Buffer
+		cmds.Disassemble(&buf, infos[1].ProgramRange)
+		exp := "  1: meta go <where>\n  2: cmp 'go'\n  3: save 'where', 'str'\n"
+		if buf.String() != exp {
+			t.Fatalf("Expected disassembly:\n%s\nbut got:\n%s", exp, buf.String())
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package cmdparse
+
+import "fmt"
+
+// Instruction is a custom instruction of the VM that matches input, for matching words
+// that keywords and types can't describe, such as names looked up in an external
+// dictionary, or values that span several words. A variable is matched by an instruction
+// added with AddInstruction when its type is the name of the instruction after an @,
+// optionally followed by the arguments of the instruction in parentheses:
+//
+//    route <from:@city> <to:@city>
+//    play <title:@catalog(films|series)>
+//
+// The instruction's value is the words it matched, joined by spaces. Its type in
+// VarValue.Type is the name of the instruction after the @.
+type Instruction interface {
+	// Name returns the name by which command definitions refer to the instruction.
+	Name() string
+	// Compile is called each time a command that uses the instruction is compiled, with
+	// the arguments given to it in that command, and returns the operand that is passed to
+	// Match, such as the dictionary the arguments name. If it returns an error that use of
+	// the instruction doesn't match any words, and Compile returns an InstructionWarning.
+	// It may be called more than once for the same use.
+	Compile(args []string) (operand interface{}, err error)
+	// Match returns the number of words at the start of ‘words’ that the instruction
+	// consumes, or 0 if it doesn't match them. ‘words’ are the words of the input from the
+	// one being matched to the end, but an IncrementalParser only passes those fed so far.
+	// Match is called from every goroutine that parses input, so it must be safe for
+	// concurrent use.
+	Match(operand interface{}, words []string) int
+	// Describe returns a description of the words that the instruction matches, for help.
+	Describe() string
+}
+
+// compiledInstruction is the operand of an opCustom: the instruction and the operand that
+// its Compile returned.
+type compiledInstruction struct {
+	inst    Instruction
+	operand interface{}
+}
+
+// AddInstruction adds the custom instruction ‘inst’, which matches the variables whose
+// type is @ followed by inst.Name(), as in <from:@city>. An instruction added with the
+// same name as an earlier one replaces it. Like types, instructions must be added before
+// the commands that use them are compiled; until then those commands don't match any
+// input.
+//
+// Custom instructions aren't sampled by Analyze and CompileStrict, which only check the
+// inputs they can make up, and Generator can't generate their values.
+func (c *Cmds) AddInstruction(inst Instruction) {
+	if c.instructions == nil {
+		c.instructions = make(map[string]Instruction)
+	}
+	c.instructions[inst.Name()] = inst
+}
+
+// instructionWarnings returns an InstructionWarning for each variable of the command
+// ‘cmd’ whose instruction isn't known or fails to compile.
+func (c *Cmds) instructionWarnings(cmd *command) (w Warnings) {
+	for _, v := range customs(cmd.tree) {
+		inst, ok := c.instructions[v.Instr]
+		if !ok {
+			w = append(w, Warning{
+				Kind:    InstructionWarning,
+				Syntax:  cmd.syntax,
+				Message: fmt.Sprintf("there is no instruction ‘%s’ for <%s>, so it matches no words", v.Instr, v.Name),
+			})
+			continue
+		}
+		if _, err := inst.Compile(v.Args); err != nil {
+			w = append(w, Warning{
+				Kind:    InstructionWarning,
+				Syntax:  cmd.syntax,
+				Message: fmt.Sprintf("the instruction ‘%s’ of <%s> failed to compile, so it matches no words: %v", v.Instr, v.Name, err),
+			})
+		}
+	}
+	return
+}
+
+// customs returns the variables matched by custom instructions in the parse tree ‘tree’,
+// in order.
+func customs(tree interface{}) (vars []custom) {
+	switch node := tree.(type) {
+	case custom:
+		vars = append(vars, node)
+	case alts:
+		vars = append(customs(node.Left), customs(node.Right)...)
+	case terms:
+		vars = append(customs(node.Left), customs(node.Right)...)
+	case rep:
+		vars = customs(node.Term)
+	case group:
+		vars = customs(node.Term)
+	case set:
+		for _, opt := range node.Options {
+			vars = append(vars, customs(opt)...)
+		}
+	}
+	return
+}
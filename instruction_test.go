@@ -0,0 +1,202 @@
+package cmdparse
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cityInstr matches the names of cities, which may be more than one word, in the
+// countries given as its arguments, or in all of them.
+type cityInstr struct{}
+
+var cities = map[string][]string{
+	"fr": {"paris", "lyon"},
+	"us": {"boston", "new york"},
+}
+
+func (cityInstr) Name() string { return "city" }
+
+func (cityInstr) Compile(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		args = []string{"fr", "us"}
+	}
+	var names []string
+	for _, a := range args {
+		c, ok := cities[a]
+		if !ok {
+			return nil, fmt.Errorf("no cities in ‘%s’", a)
+		}
+		names = append(names, c...)
+	}
+	return names, nil
+}
+
+func (cityInstr) Match(operand interface{}, words []string) int {
+	for _, name := range operand.([]string) {
+		n := len(strings.Fields(name))
+		if n <= len(words) && strings.Join(words[:n], " ") == name {
+			return n
+		}
+	}
+	return 0
+}
+
+func (cityInstr) Describe() string { return "a city" }
+
+func TestInstruction(t *testing.T) {
+	tests := []struct {
+		name  string
+		def   string
+		input string
+		vars  map[string]string
+	}{
+		{"one word", "route <from:@city> <to:@city>", "route paris boston", map[string]string{"from": "paris", "to": "boston"}},
+		{"several words", "route <from:@city> <to:@city>", "route new york lyon", map[string]string{"from": "new york", "to": "lyon"}},
+		{"unknown word", "route <from:@city> <to:@city>", "route rome lyon", nil},
+		{"arguments", "visit <c:@city(fr)>", "visit lyon", map[string]string{"c": "lyon"}},
+		{"excluded by the arguments", "visit <c:@city(fr)>", "visit boston", nil},
+		{"several arguments", "visit <c:@city(fr|us)>+", "visit lyon new york", map[string]string{"c": "lyon"}},
+		{"then a keyword", "fly <c:@city> now", "fly new york now", map[string]string{"c": "new york"}},
+		{"too few words", "fly <c:@city> now", "fly new", nil},
+		{"failed to compile", "visit <c:@city(mars)>", "visit paris", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.AddInstruction(cityInstr{})
+			cmds.Add(tc.def, func(m Match, ctx interface{}) {})
+			cmds.Compile()
+
+			_, m, err := cmds.ParseToMatch(tc.input)
+			if tc.vars == nil {
+				if err == nil {
+					t.Fatalf("‘%s’ matched", tc.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("‘%s’ didn't match: %v", tc.input, err)
+			}
+			for name, val := range tc.vars {
+				v := m.Var(name)
+				if len(v) == 0 || v[0].Value != val || v[0].Type != "@city" {
+					t.Fatalf("<%s> is %v, expected ‘%s’", name, v, val)
+				}
+			}
+		})
+	}
+}
+
+func TestInstructionWarnings(t *testing.T) {
+	var cmds Cmds
+	cmds.AddInstruction(cityInstr{})
+	cmds.Add("visit <c:@city(fr)>", func(m Match, ctx interface{}) {})
+	cmds.Add("visit <c:@city(mars)>", func(m Match, ctx interface{}) {})
+	cmds.Add("find <a:@airport>", func(m Match, ctx interface{}) {})
+
+	var got []string
+	for _, w := range cmds.Compile() {
+		got = append(got, w.String())
+	}
+	expected := []string{
+		"invalid instruction in ‘visit <c:@city(mars)>’: the instruction ‘city’ of <c> failed to compile, so it matches no words: no cities in ‘mars’",
+		"invalid instruction in ‘find <a:@airport>’: there is no instruction ‘airport’ for <a>, so it matches no words",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Compile returned %q, expected %q", got, expected)
+	}
+
+	if _, err := cmds.CompileStrict(); err == nil || len(err.(*CompileError).Problems) != 2 {
+		t.Fatalf("CompileStrict returned %v, expected the invalid instructions", err)
+	}
+}
+
+func TestInstructionSyntaxErrors(t *testing.T) {
+	tests := []string{
+		"visit <c:@>",
+		"visit <c:@city>>",
+		"visit <c:@city(fr>",
+		"visit <c:@city!secret>",
+	}
+
+	for _, def := range tests {
+		t.Run(def, func(t *testing.T) {
+			var cmds Cmds
+			if err := cmds.Add(def, func(m Match, ctx interface{}) {}); err == nil {
+				t.Fatalf("adding ‘%s’ didn't fail", def)
+			}
+		})
+	}
+}
+
+func TestInstructionFrontends(t *testing.T) {
+	var cmds Cmds
+	cmds.AddInstruction(cityInstr{})
+	cmds.Add("fly <c:@city> now", func(m Match, ctx interface{}) {})
+	cmds.Compile()
+
+	comps := cmds.Complete("fly ")
+	if len(comps.Items) != 1 || comps.Items[0].Text != "<c>" {
+		t.Fatalf("completed ‘fly ’ as %v, expected <c>", comps.Items)
+	}
+
+	help := cmds.HelpAt("fly ")
+	if len(help) != 1 || help[0].Token != "<c>" || help[0].Description != "a city" {
+		t.Fatalf("help for ‘fly ’ is %+v", help)
+	}
+
+	cl := cmds.Classify([]string{"fly", "new", "york", "now"})
+	var elems []string
+	for _, w := range cl.Words {
+		elems = append(elems, w.Element)
+	}
+	if expected := []string{"fly", "<c>", "<c>", "now"}; !reflect.DeepEqual(elems, expected) {
+		t.Fatalf("classified the words as %v, expected %v", elems, expected)
+	}
+
+	// The incremental parser only passes the words fed so far
+	p := cmds.NewIncrementalParser()
+	for _, w := range []string{"fly", "paris", "now"} {
+		p.Feed(w)
+	}
+	if !p.Valid() {
+		t.Fatalf("the incremental parser didn't match ‘fly paris now’")
+	}
+}
+
+func TestInstructionLoadJSON(t *testing.T) {
+	var orig Cmds
+	orig.AddInstruction(cityInstr{})
+	orig.Add("visit <c:@city(fr)>", func(m Match, ctx interface{}) {})
+	orig.Compile()
+
+	var buf bytes.Buffer
+	if err := orig.ExportJSON(&buf); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), `["custom","c","city",["fr"]]`) {
+		t.Fatalf("the exported program doesn't have the instruction: %s", buf.String())
+	}
+	exported := buf.String()
+
+	var missing Cmds
+	if err := missing.LoadJSON(strings.NewReader(exported), nil); err == nil {
+		t.Fatalf("loading without the instruction didn't fail")
+	}
+
+	var cmds Cmds
+	cmds.AddInstruction(cityInstr{})
+	if err := cmds.LoadJSON(strings.NewReader(exported), nil); err != nil {
+		t.Fatalf("LoadJSON failed: %v", err)
+	}
+	if _, m, err := cmds.ParseToMatch("visit lyon"); err != nil || m.Var("c")[0].Value != "lyon" {
+		t.Fatalf("‘visit lyon’ didn't match after loading: %v", err)
+	}
+	if _, _, err := cmds.ParseToMatch("visit boston"); err == nil {
+		t.Fatalf("‘visit boston’ matched after loading")
+	}
+}
@@ -0,0 +1,127 @@
+// Package interact connects a cmdparse.Cmds to line editors for building REPLs. An Adapter
+// provides completion and runs the lines entered, and is written against the interfaces
+// of github.com/chzyer/readline and github.com/c-bata/go-prompt without depending on
+// them. With readline:
+//
+//    a := interact.New(&cmds, ctx)
+//    rl, _ := readline.NewEx(&readline.Config{AutoComplete: a, DisableAutoSaveHistory: true})
+//    a.History = func(line string) { rl.SaveHistory(line) }
+//    for {
+//        line, err := rl.Readline()
+//        if err != nil {
+//            break
+//        }
+//        a.Execute(line)
+//    }
+//
+// and with go-prompt:
+//
+//    a := interact.New(&cmds, ctx)
+//    prompt.New(a.Execute, func(d prompt.Document) []prompt.Suggest {
+//        var s []prompt.Suggest
+//        for _, sg := range a.Suggest(d.TextBeforeCursor()) {
+//            s = append(s, prompt.Suggest{Text: sg.Text, Description: sg.Description})
+//        }
+//        return s
+//    }).Run()
+package interact
+
+import (
+	"strings"
+
+	"github.com/jeffwilliams/cmdparse"
+)
+
+// Adapter completes and runs the lines entered in a line editor using Cmds.
+type Adapter struct {
+	// Cmds are the compiled commands.
+	Cmds *cmdparse.Cmds
+	// Ctx is the context passed to the callbacks of the commands.
+	Ctx interface{}
+	// OnError, if set, is called with a line that wasn't run and the reason, as returned
+	// by cmdparse.Cmds.ParseErr. It's a *cmdparse.AmbiguityError if the line matched more
+	// than one command and a *cmdparse.NoMatchError if it matched none.
+	OnError func(line string, err error)
+	// OnResult, if set, is called with each line that ran and the Result returned by its
+	// command.
+	OnResult func(line string, res cmdparse.Result)
+	// Status is the exit status of the last line entered, as returned by
+	// cmdparse.ExitStatus, so that a REPL run from a script can exit with it.
+	Status int
+	// History, if set, is called with each line that ran, with the values of sensitive
+	// variables replaced by a placeholder, so that it can be saved in the history of the
+	// line editor.
+	History func(line string)
+}
+
+// New returns an Adapter that runs lines using ‘cmds’ with the context ‘ctx’.
+func New(cmds *cmdparse.Cmds, ctx interface{}) *Adapter {
+	return &Adapter{Cmds: cmds, Ctx: ctx}
+}
+
+// Execute parses ‘line’ and runs the matched command. Blank lines are ignored. It has the
+// signature of a go-prompt Executor.
+func (a *Adapter) Execute(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	info, res, err := a.Cmds.ParseWithResult(line, a.Ctx)
+	a.Status = cmdparse.ExitStatus(res, err)
+	if err != nil {
+		if a.OnError != nil {
+			a.OnError(line, err)
+		}
+		return
+	}
+
+	if a.History != nil && info.Match != nil {
+		a.History(info.Match.Redacted())
+	}
+	if a.OnResult != nil {
+		a.OnResult(line, res)
+	}
+}
+
+// Do returns the completions for the line ‘line’ with the cursor at the rune offset ‘pos’,
+// as the text to append to what is already typed of the word at the cursor, and the
+// length of that typed text. It implements the AutoCompleter interface of readline.
+// Completions that don't begin with what is typed, such as placeholders for variables,
+// are left out, and each completion ends with a space.
+func (a *Adapter) Do(line []rune, pos int) (newLine [][]rune, length int) {
+	comps := a.Cmds.Complete(string(line[:pos]))
+	typed := string(line[comps.Start:comps.End])
+
+	for _, c := range comps.Items {
+		if c.Kind != cmdparse.KeywordCompletion && c.Kind != cmdparse.ValueCompletion {
+			continue
+		}
+		if !strings.HasPrefix(c.Text, typed) {
+			continue
+		}
+		newLine = append(newLine, []rune(c.Text[len(typed):]+" "))
+	}
+	return newLine, comps.End - comps.Start
+}
+
+// Suggestion is a completion of the word before the cursor, with the fields of a
+// go-prompt Suggest.
+type Suggestion struct {
+	Text        string
+	Description string
+}
+
+// Suggest returns the completions of the word that ends ‘textBeforeCursor’, or of the
+// next word if it ends with a space. The description of each is what kind of completion
+// it is, such as keyword or value. Placeholders for variables are left out since they
+// can't be inserted.
+func (a *Adapter) Suggest(textBeforeCursor string) []Suggestion {
+	var s []Suggestion
+	for _, c := range a.Cmds.Complete(textBeforeCursor).Items {
+		if c.Kind == cmdparse.PlaceholderCompletion {
+			continue
+		}
+		s = append(s, Suggestion{Text: c.Text, Description: c.Kind.String()})
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package interact
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jeffwilliams/cmdparse"
+)
+
+func newCmds(ran *[]string) *cmdparse.Cmds {
+	var cmds cmdparse.Cmds
+	cback := func(match cmdparse.Match, ctx interface{}) {
+		*ran = append(*ran, match.Redacted())
+	}
+	cmds.Add("show (logs | links)", cback)
+	cmds.Add("login <user> <password!secret>", cback)
+	cmds.Add("get verbose", cback)
+	cmds.Add("get <file>", cback)
+	cmds.Compile()
+	return &cmds
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		pos      int
+		expected []string
+		length   int
+	}{
+		{"first word", "s", 1, []string{"how "}, 1},
+		{"next word", "show ", 5, []string{"links ", "logs "}, 0},
+		{"in word", "show l", 6, []string{"inks ", "ogs "}, 1},
+		{"cursor before end", "show lo xyz", 7, []string{"gs "}, 2},
+		{"no completions", "bogus ", 6, nil, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var ran []string
+			a := New(newCmds(&ran), nil)
+
+			newLine, length := a.Do([]rune(tc.line), tc.pos)
+			var act []string
+			for _, l := range newLine {
+				act = append(act, string(l))
+			}
+			if !reflect.DeepEqual(act, tc.expected) || length != tc.length {
+				t.Fatalf("Expected %q and length %d but got %q and %d", tc.expected, tc.length, act, length)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	var ran []string
+	a := New(newCmds(&ran), nil)
+
+	act := a.Suggest("get ")
+	expected := []Suggestion{{Text: "verbose", Description: "keyword"}}
+	if !reflect.DeepEqual(act, expected) {
+		t.Fatalf("Expected %v but got %v", expected, act)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		ran     []string
+		history []string
+		err     string
+	}{
+		{"run", "sh logs", []string{"sh logs"}, []string{"sh logs"}, ""},
+		{"secret", "login al hunter2", []string{"login al <redacted>"}, []string{"login al <redacted>"}, ""},
+		{"blank", "  ", nil, nil, ""},
+		{"no match", "show x", nil, nil, "*cmdparse.NoMatchError: unexpected word 'x' at position 2, expected one of: logs, links"},
+		{"ambiguous", "get v", nil, nil, "*cmdparse.AmbiguityError: 'v' is ambiguous at argument 2: could be keyword 'verbose' or value for <file>"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var ran, history []string
+			var errStr string
+
+			a := New(newCmds(&ran), nil)
+			a.History = func(line string) { history = append(history, line) }
+			a.OnError = func(line string, err error) { errStr = fmt.Sprintf("%T: %v", err, err) }
+
+			a.Execute(tc.line)
+			if !reflect.DeepEqual(ran, tc.ran) {
+				t.Fatalf("Expected the commands %q to run but %q ran", tc.ran, ran)
+			}
+			if !reflect.DeepEqual(history, tc.history) {
+				t.Fatalf("Expected the history %q but got %q", tc.history, history)
+			}
+			if errStr != tc.err {
+				t.Fatalf("Expected the error ‘%s’ but got ‘%s’", tc.err, errStr)
+			}
+		})
+	}
+}
+
+func TestExecuteStatus(t *testing.T) {
+	var cmds cmdparse.Cmds
+	cmds.AddWithResult("copy <src> <dst>", func(match cmdparse.Match, ctx interface{}) cmdparse.Result {
+		if match.Var("src")[0].Value == "missing" {
+			return cmdparse.Result{Status: 3, Message: "no such file"}
+		}
+		return cmdparse.Result{Message: "copied"}
+	})
+	cmds.Compile()
+
+	tests := []struct {
+		line    string
+		status  int
+		message string
+	}{
+		{"copy a b", 0, "copied"},
+		{"copy missing b", 3, "no such file"},
+		{"copy a", cmdparse.StatusUsage, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.line, func(t *testing.T) {
+			var message string
+			a := New(&cmds, nil)
+			a.OnResult = func(line string, res cmdparse.Result) { message = res.Message }
+
+			a.Execute(tc.line)
+			if a.Status != tc.status {
+				t.Fatalf("Expected the status %d but got %d", tc.status, a.Status)
+			}
+			if message != tc.message {
+				t.Fatalf("Expected the message ‘%s’ but got ‘%s’", tc.message, message)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package cmdparse
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Interpretation is one way that the start of an input, or all of it, could be matched by
+// a command, as returned by Interpretations.
+type Interpretation struct {
+	// Syntax is the definition of the command as it was passed to Add.
+	Syntax string
+	// Matched are the keywords and variables that matched the first Words input words.
+	Matched []BoundElement
+	// Words is the number of input words matched.
+	Words int
+	// Complete is true if the command could end after the matched words.
+	Complete bool
+	// Score is the confidence in the interpretation, from 0 to 1. It's the fraction of
+	// the input words that were matched, multiplied by how much of each matched keyword
+	// was typed, and halved if the command couldn't end after the matched words. An
+	// interpretation that matches all of the input with keywords typed in full scores 1.
+	Score float64
+}
+
+// Interpretations returns every way that the input ‘cmd’ could be read by the commands,
+// including the ones that only match the start of it and the ones that are cut short by
+// longer interpretations, with the highest scores first. Interpretations with the same
+// score are listed with the ones that match more words first, and then in the order the
+// commands were added. This is the lattice of partial interpretations that Parse chooses
+// from, and can be used by tools such as linters or intent classifiers. No callbacks are
+// called, and nil is returned if the input can't be split into words.
+func (c *Cmds) Interpretations(cmd string) []Interpretation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	toks, raw, err := c.scanRaw(cmd)
+	if err != nil {
+		return nil
+	}
+
+	prog := c.program()
+	order := make(map[string]int)
+	for i, cmd := range c.commands {
+		order[cmd.syntax] = i
+	}
+
+	var interps []Interpretation
+	index := make(map[string]int)
+
+	start := 1
+	if len(toks) == 0 {
+		start = 0
+	}
+	for pos := start; pos <= len(toks); pos++ {
+		v := vm{exactKeywords: c.keywordMatching == ExactMatching, version: c.version, raw: raw}
+		expected := v.expectations(prog, toks[:pos])
+
+		for i, instr := range expected {
+			m := v.expectedBy[i].toMatch(v.raw)
+
+			var in Interpretation
+			in.Syntax = m.meta.(*command).syntax
+			in.Matched = boundElements(m)
+			in.Words = m.words
+
+			key := fmt.Sprintf("%s\x00%d\x00%v", in.Syntax, in.Words, in.Matched)
+			j, ok := index[key]
+			if !ok {
+				j = len(interps)
+				index[key] = j
+				in.Score = typedFraction(m)
+				if len(toks) > 0 {
+					in.Score *= float64(in.Words) / float64(len(toks))
+				}
+				interps = append(interps, in)
+			}
+
+			if instr.opcode == opMatch {
+				interps[j].Complete = true
+			}
+		}
+	}
+
+	for i := range interps {
+		if !interps[i].Complete {
+			interps[i].Score /= 2
+		}
+	}
+
+	sort.SliceStable(interps, func(i, j int) bool {
+		a, b := interps[i], interps[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Words != b.Words {
+			return a.Words > b.Words
+		}
+		return order[a.Syntax] < order[b.Syntax]
+	})
+	return interps
+}
+
+// typedFraction returns the product of how much of each keyword matched by ‘m’ was typed.
+func typedFraction(m match) float64 {
+	f := 1.0
+	for _, item := range m.items {
+		if k, ok := item.(keywordValue); ok && len(k.Name) > 0 {
+			f *= float64(len(k.Value)) / float64(len(k.Name))
+		}
+	}
+	return f
+}
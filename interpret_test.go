@@ -0,0 +1,79 @@
+package cmdparse
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInterpretations(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"complete",
+			"copy a b",
+			[]string{
+				"copy <src> <dst> force?: [{copy copy} {<src> a} {<dst> b}] 3 true 1.00",
+				"copy <src> <dst> force?: [{copy copy} {<src> a}] 2 false 0.33",
+				"copy <src> <dst> force?: [{copy copy}] 1 false 0.17",
+			},
+		},
+		{
+			"abbreviated",
+			"co a",
+			[]string{
+				"copy <src> <dst> force?: [{copy co} {<src> a}] 2 false 0.25",
+				"copy <src> <dst> force?: [{copy co}] 1 false 0.12",
+			},
+		},
+		{
+			"shorter interpretations",
+			"get verbose",
+			[]string{
+				"get verbose: [{get get} {verbose verbose}] 2 true 1.00",
+				"get <file>: [{get get} {<file> verbose}] 2 true 1.00",
+				"get: [{get get}] 1 true 0.50",
+				"get verbose: [{get get}] 1 false 0.25",
+				"get <file>: [{get get}] 1 false 0.25",
+			},
+		},
+		{
+			"partial",
+			"get x y",
+			[]string{
+				"get <file>: [{get get} {<file> x}] 2 true 0.67",
+				"get: [{get get}] 1 true 0.33",
+				"get verbose: [{get get}] 1 false 0.17",
+				"get <file>: [{get get}] 1 false 0.17",
+			},
+		},
+		{
+			"no match",
+			"bogus",
+			nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+			cmds.Add("copy <src> <dst> force?", cback)
+			cmds.Add("get verbose", cback)
+			cmds.Add("get <file>", cback)
+			cmds.Add("get", cback)
+			cmds.Compile()
+
+			var act []string
+			for _, in := range cmds.Interpretations(tc.input) {
+				act = append(act, fmt.Sprintf("%s: %v %d %v %.2f", in.Syntax, in.Matched, in.Words, in.Complete, in.Score))
+			}
+			if !reflect.DeepEqual(act, tc.expected) {
+				t.Fatalf("Expected interpretations\n%q\nbut got\n%q", tc.expected, act)
+			}
+		})
+	}
+}
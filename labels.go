@@ -0,0 +1,21 @@
+//go:build !tinygo
+// +build !tinygo
+
+package cmdparse
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// withLabel calls ‘f’ with the pprof label cmdparse=‘phase’ applied if labels are enabled.
+func (c *Cmds) withLabel(phase string, f func()) {
+	if !c.pprofLabels {
+		f()
+		return
+	}
+
+	pprof.Do(context.Background(), pprof.Labels("cmdparse", phase), func(context.Context) {
+		f()
+	})
+}
@@ -0,0 +1,9 @@
+//go:build tinygo
+// +build tinygo
+
+package cmdparse
+
+// withLabel calls ‘f’. TinyGo doesn't support pprof, so labels are never applied.
+func (c *Cmds) withLabel(phase string, f func()) {
+	f()
+}
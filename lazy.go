@@ -0,0 +1,240 @@
+package cmdparse
+
+import (
+	"sort"
+	"strings"
+)
+
+// SetLazyCompilation sets whether each command is compiled separately the first time an
+// input that may match it is parsed, rather than all the commands being compiled together
+// by Compile. This reduces the startup cost of large command sets where most commands are
+// rarely used. When enabled, Compile only builds an index of the commands by the keywords
+// they may begin with, and Parse only runs the commands whose first keyword the first
+// input word could be an abbreviation of, along with commands that may begin with a
+// variable. Complete, Describe and ExportJSON still need the program for all the
+// commands, which is then compiled the first time one of them is called.
+//
+// Lazy compilation must be set before Compile is called.
+func (c *Cmds) SetLazyCompilation(enable bool) {
+	c.lazy = enable
+}
+
+// firstWordIndex finds the commands that may match an input by its first word.
+type firstWordIndex struct {
+	// keywords are the keywords commands may begin with, sorted
+	keywords []string
+	// byKeyword are the commands that may begin with each keyword
+	byKeyword map[string][]*command
+	// open are the commands that may begin with a variable, and so may match any input
+	open []*command
+	// order is the position of each command in the order they were added
+	order map[*command]int
+}
+
+func newFirstWordIndex(cmds []*command) *firstWordIndex {
+	x := &firstWordIndex{
+		byKeyword: make(map[string][]*command),
+		order:     make(map[*command]int),
+	}
+
+	for i, cmd := range cmds {
+		x.order[cmd] = i
+		words, nullable, open := firstWords(cmd.tree)
+		if nullable || open {
+			x.open = append(x.open, cmd)
+			continue
+		}
+		for _, w := range words {
+			if _, ok := x.byKeyword[w]; !ok {
+				x.keywords = append(x.keywords, w)
+			}
+			x.byKeyword[w] = append(x.byKeyword[w], cmd)
+		}
+	}
+
+	sort.Strings(x.keywords)
+	return x
+}
+
+// candidates returns the commands that may match an input beginning with ‘word’, in the
+// order they were added.
+func (x *firstWordIndex) candidates(word string) []*command {
+	seen := make(map[*command]bool)
+	var cands []*command
+	add := func(cmd *command) {
+		if !seen[cmd] {
+			seen[cmd] = true
+			cands = append(cands, cmd)
+		}
+	}
+
+	// Keywords that ‘word’ is a prefix of are sorted next to each other
+	for i := sort.SearchStrings(x.keywords, word); i < len(x.keywords); i++ {
+		if !strings.HasPrefix(x.keywords[i], word) {
+			break
+		}
+		for _, cmd := range x.byKeyword[x.keywords[i]] {
+			add(cmd)
+		}
+	}
+	for _, cmd := range x.open {
+		add(cmd)
+	}
+
+	sort.Slice(cands, func(i, j int) bool {
+		return x.order[cands[i]] < x.order[cands[j]]
+	})
+	return cands
+}
+
+// FirstKeywordIndex lists the commands by the keywords they may begin with, as returned
+// by FirstKeywords.
+type FirstKeywordIndex struct {
+	// Keywords maps each keyword that commands may begin with to the definitions of those
+	// commands, in the order they were added.
+	Keywords map[string][]string
+	// Open are the definitions of the commands that may begin with a variable or match no
+	// words, and so may match any input.
+	Open []string
+}
+
+// FirstKeywords returns the index of the commands by the keywords they may begin with that
+// is built by Compile. Applications can use it to route input, for example to different
+// workers or permission domains, before parsing it; CandidatesFor looks up an input word
+// in it the way Parse does. It's empty if Compile hasn't been called.
+func (c *Cmds) FirstKeywords() FirstKeywordIndex {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var fk FirstKeywordIndex
+	if c.index == nil {
+		return fk
+	}
+
+	fk.Keywords = make(map[string][]string, len(c.index.byKeyword))
+	for w, cmds := range c.index.byKeyword {
+		fk.Keywords[w] = syntaxes(cmds)
+	}
+	fk.Open = syntaxes(c.index.open)
+	return fk
+}
+
+// CandidatesFor returns the definitions of the commands that may match an input whose
+// first word is ‘word’, in the order they were added: those with a keyword that ‘word’
+// may be an abbreviation of, and those that may begin with a variable. Input beginning
+// with ‘word’ can't match any other command. CandidatesFor returns nil if Compile hasn't
+// been called.
+func (c *Cmds) CandidatesFor(word string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.index == nil {
+		return nil
+	}
+	return syntaxes(c.index.candidates(word))
+}
+
+func syntaxes(cmds []*command) []string {
+	s := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		s[i] = cmd.syntax
+	}
+	return s
+}
+
+// firstWords returns the keywords that the parse tree ‘tree’ may begin with. nullable is
+// true if the tree may match no words, and open is true if it may begin with a variable.
+func firstWords(tree interface{}) (words []string, nullable, open bool) {
+	switch node := tree.(type) {
+	case word:
+		return []string{string(node)}, false, false
+	case exactWord:
+		return []string{string(node)}, false, false
+	case aliasedWord:
+		return append([]string{node.Keyword}, node.Aliases...), false, false
+	case variable, custom:
+		return nil, false, true
+	case alts:
+		lw, ln, lo := firstWords(node.Left)
+		rw, rn, ro := firstWords(node.Right)
+		return append(lw, rw...), ln || rn, lo || ro
+	case terms:
+		words, nullable, open = firstWords(node.Left)
+		if nullable {
+			rw, rn, ro := firstWords(node.Right)
+			return append(words, rw...), rn, open || ro
+		}
+		return
+	case rep:
+		if node.Op == repeatCounted {
+			return firstWords(node.unrolled())
+		}
+		words, nullable, open = firstWords(node.Term)
+		if node.Op != repeatOneOrMore {
+			nullable = true
+		}
+		return
+	case meta:
+		return firstWords(node.ch)
+	case group:
+		return firstWords(node.Term)
+	case set:
+		// Any option may come first, and the set may match no words if every option
+		// may be left out
+		nullable = true
+		for i, opt := range node.Options {
+			ow, on, oo := firstWords(opt)
+			words = append(words, ow...)
+			open = open || oo
+			if !node.Optional[i] && !on {
+				nullable = false
+			}
+		}
+		return
+	}
+	return nil, true, true
+}
+
+// matchCandidates matches the input words ‘toks’ against the commands that may match
+// them, found using the trie built by Optimize or the first word index, compiling the
+// commands as needed. It returns the maximal matches and the first interpretation dropped
+// because it breaks a constraint, like matchRaw.
+func (c *Cmds) matchCandidates(toks []string, raw *rawInput, opts ParseOptions) (matches []match, rejected error) {
+	if c.index == nil {
+		return
+	}
+
+	var cands []*command
+	switch {
+	case c.trie != nil:
+		cands = c.trie.candidates(toks, opts.ExactKeywords || c.keywordMatching == ExactMatching)
+	case len(toks) == 0:
+		cands = c.index.open
+	default:
+		cands = c.index.candidates(toks[0])
+	}
+
+	for _, cmd := range cands {
+		c.compileMu.Lock()
+		if cmd.prog.instrs == nil {
+			c.compileCommands([]*command{cmd})
+		}
+		p := cmd.prog
+		c.compileMu.Unlock()
+
+		v := c.newVM(opts)
+		v.raw = raw
+		v.execute(p, toks)
+		if v.err != nil {
+			rejected = v.err
+			c.releaseVM(v)
+			return nil, rejected
+		}
+		matches = append(matches, v.maximalMatches()...)
+		if rejected == nil {
+			rejected = v.rejected
+		}
+		c.releaseVM(v)
+	}
+	return
+}
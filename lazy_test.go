@@ -0,0 +1,178 @@
+package cmdparse
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFirstWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   string
+		words    string
+		nullable bool
+		open     bool
+	}{
+		{"keyword", "show results", "show", false, false},
+		{"alternatives", "(show | list) results", "show list", false, false},
+		{"optional", "verbose? show", "verbose show", false, false},
+		{"repeated", "(a | b)+ c", "a b", false, false},
+		{"variable", "<file> open", "", false, true},
+		{"optional variable", "force? <file>", "force", false, true},
+		{"all optional", "a? b*", "a b", true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Cmds
+			tree, err := c.scanAndParse(tc.syntax)
+			if err != nil {
+				t.Fatalf("Parsing the syntax failed: %v", err)
+			}
+
+			words, nullable, open := firstWords(tree)
+			if strings.Join(words, " ") != tc.words {
+				t.Fatalf("Expected first words ‘%s’ but got %v", tc.words, words)
+			}
+			if nullable != tc.nullable || open != tc.open {
+				t.Fatalf("Expected nullable=%v open=%v but got nullable=%v open=%v", tc.nullable, tc.open, nullable, open)
+			}
+		})
+	}
+}
+
+func TestLazyCompilation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected string
+	}{
+		{"keyword", "sh res", true, "show results"},
+		{"other keyword", "stop", true, "stop"},
+		{"ambiguous", "st", false, ""},
+		{"variable first", "x.txt open", true, "<file> open"},
+		{"no match", "bogus", false, ""},
+		{"empty", "", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, lazy := range []bool{false, true} {
+				var cmds Cmds
+				var called string
+				for _, syntax := range []string{"show results", "stop", "start", "<file> open", "list things"} {
+					syntax := syntax
+					cmds.Add(syntax, func(match Match, ctx interface{}) { called = syntax })
+				}
+				cmds.SetLazyCompilation(lazy)
+				cmds.Compile()
+
+				ok := cmds.Parse(tc.input, nil)
+				if ok != tc.ok {
+					t.Fatalf("With lazy=%v expected Parse to return %v but it returned %v", lazy, tc.ok, ok)
+				}
+				if called != tc.expected {
+					t.Fatalf("With lazy=%v expected ‘%s’ to be called but ‘%s’ was", lazy, tc.expected, called)
+				}
+
+				if lazy {
+					for _, cmd := range cmds.commands {
+						if cmd.syntax == "list things" && cmd.prog.instrs != nil {
+							t.Fatalf("A command that can't match the input was compiled")
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFirstKeywords(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	cmds.Add("show results", cback)
+	cmds.Add("(show | list) files", cback)
+	cmds.Add("stop", cback)
+	cmds.Add("<file> open", cback)
+	cmds.Compile()
+
+	fk := cmds.FirstKeywords()
+	expected := FirstKeywordIndex{
+		Keywords: map[string][]string{
+			"show": {"show results", "(show | list) files"},
+			"list": {"(show | list) files"},
+			"stop": {"stop"},
+		},
+		Open: []string{"<file> open"},
+	}
+	if !reflect.DeepEqual(fk, expected) {
+		t.Fatalf("Expected the index %v but got %v", expected, fk)
+	}
+
+	tests := []struct {
+		word     string
+		expected []string
+	}{
+		{"sh", []string{"show results", "(show | list) files", "<file> open"}},
+		{"s", []string{"show results", "(show | list) files", "stop", "<file> open"}},
+		{"bogus", []string{"<file> open"}},
+	}
+	for _, tc := range tests {
+		if cands := cmds.CandidatesFor(tc.word); !reflect.DeepEqual(cands, tc.expected) {
+			t.Fatalf("Expected the candidates for ‘%s’ to be %q but got %q", tc.word, tc.expected, cands)
+		}
+	}
+}
+
+func TestLazyCompilationConcurrentInspection(t *testing.T) {
+	syntaxes := []string{"show results", "stop", "start", "<file> open", "list things"}
+
+	var eager Cmds
+	for _, syntax := range syntaxes {
+		eager.Add(syntax, func(match Match, ctx interface{}) {})
+	}
+	eager.Compile()
+
+	var cmds Cmds
+	for _, syntax := range syntaxes {
+		cmds.Add(syntax, func(match Match, ctx interface{}) {})
+	}
+	cmds.SetLazyCompilation(true)
+	cmds.Compile()
+
+	// The first of these to run links the program, which sets the spans of the commands
+	// while the others read them
+	const n = 8
+	var wg sync.WaitGroup
+	infos := make([][]CommandInfo, n)
+	for g := 0; g < n; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			switch g % 3 {
+			case 0:
+				infos[g] = cmds.Commands()
+			case 1:
+				cmds.Analyze()
+			default:
+				cmds.Parse("stop", nil)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	expected := eager.Commands()
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		for i := range expected {
+			if info[i].ProgramRange != expected[i].ProgramRange {
+				t.Fatalf("Expected ‘%s’ to span %v but it spans %v", expected[i].Syntax, expected[i].ProgramRange, info[i].ProgramRange)
+			}
+		}
+	}
+}
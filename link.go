@@ -0,0 +1,84 @@
+package cmdparse
+
+import (
+	"runtime"
+	"sync"
+)
+
+// compileCommands compiles the program of each command in ‘cmds’ that isn't compiled yet.
+// The commands are compiled concurrently by up to GOMAXPROCS goroutines.
+func (c *Cmds) compileCommands(cmds []*command) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(cmds) {
+		workers = len(cmds)
+	}
+
+	next := make(chan *command)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for cmd := range next {
+				cmd.prog = c.compileTree(meta{data: cmd, ch: cmd.tree})
+			}
+		}()
+	}
+
+	for _, cmd := range cmds {
+		if cmd.prog.instrs == nil {
+			next <- cmd
+		}
+	}
+	close(next)
+	wg.Wait()
+}
+
+// link combines the compiled programs of ‘cmds’ into one program that matches any of
+// them. The result is the same as compiling the alternatives of the commands with the last
+// command first, which is how Add builds the parse tree.
+func link(cmds []*command) prog {
+	if len(cmds) == 0 {
+		return prog{}
+	}
+
+	// Each command's program ends in an opMatch, which is shared in the linked program.
+	// Every command but the first added is preceded by a split and followed by a jmp
+	// to the shared opMatch.
+	size := 1 + 2*(len(cmds)-1)
+	for _, cmd := range cmds {
+		size += len(cmd.prog.instrs) - 1
+	}
+	end := size - 1
+
+	p := make([]instr, 0, size)
+	sensitive := false
+	for i := len(cmds) - 1; i >= 0; i-- {
+		sensitive = sensitive || cmds[i].prog.sensitive
+		frag := cmds[i].prog.instrs[:len(cmds[i].prog.instrs)-1]
+		if i > 0 {
+			next := len(p) + 1 + len(frag) + 1
+			p = append(p, instr{opcode: opSplit, ints: [2]int{len(p) + 1, next}})
+		}
+
+		off := len(p)
+		cmds[i].span = ProgramRange{Start: off, End: off + len(frag)}
+		for _, in := range frag {
+			switch in.opcode {
+			case opSplit:
+				in.ints[0] += off
+				in.ints[1] += off
+			case opJmp:
+				in.ints[0] += off
+			}
+			p = append(p, in)
+		}
+
+		if i > 0 {
+			p = append(p, instr{opcode: opJmp, ints: [2]int{end, 0}})
+		}
+	}
+	p = append(p, instr{opcode: opMatch})
+
+	return prog{instrs: p, sensitive: sensitive}
+}
@@ -0,0 +1,57 @@
+package cmdparse
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name string
+		defs []string
+	}{
+		{"one", []string{"stop"}},
+		{"two", []string{"stop", "go <where>"}},
+		{"many", []string{"stop now?", "go <where>+", "(show | list) (a | b)*", "set <k:map>", "x"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			for _, d := range tc.defs {
+				cmds.Add(d, func(match Match, ctx interface{}) {})
+			}
+			cmds.Compile()
+
+			expected := cmds.compileTree(cmds.parseTree)
+			if !reflect.DeepEqual(cmds.prog, expected) {
+				var got, exp bytes.Buffer
+				cmds.prog.Print(&got)
+				expected.Print(&exp)
+				t.Fatalf("Linked program differs from the program for the whole parse tree.\nExpected:\n%s\nGot:\n%s", exp.String(), got.String())
+			}
+		})
+	}
+}
+
+func TestLinkManyCommands(t *testing.T) {
+	defs, inputs := syntheticCmds(500, 2)
+
+	var cmds Cmds
+	for _, d := range defs {
+		cmds.Add(d, func(match Match, ctx interface{}) {})
+	}
+	cmds.Compile()
+
+	expected := cmds.compileTree(cmds.parseTree)
+	if !reflect.DeepEqual(cmds.prog, expected) {
+		t.Fatalf("Linked program differs from the program for the whole parse tree")
+	}
+
+	for _, input := range inputs {
+		if !cmds.Parse(input, nil) {
+			t.Fatalf("Parsing ‘%s’ failed", input)
+		}
+	}
+}
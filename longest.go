@@ -0,0 +1,214 @@
+package cmdparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LongestMatch describes how far input was matched by the commands, as returned by
+// LongestMatches.
+type LongestMatch struct {
+	// Position is the index of the first input word that no command could match. If it's
+	// the number of input words, all of the input matched but no command was complete.
+	Position int
+	// Word is the input word at Position, or empty if Position is past the end of the
+	// input.
+	Word string
+	// Partial are the ways the input before Position could be matched.
+	Partial []PartialMatch
+	// Suggestions are the keywords that could match at Position which Word may be a
+	// misspelling of, the closest first.
+	Suggestions []string
+}
+
+// PartialMatch is a way that the start of the input could be matched by a command.
+type PartialMatch struct {
+	// Syntax is the definition of the command as it was passed to Add.
+	Syntax string
+	// Matched are the keywords and variables that matched the input before
+	// LongestMatch.Position.
+	Matched []BoundElement
+	// Expected are the keywords and variables that could match the next word. Variables
+	// are written in angle brackets, as in <file>.
+	Expected []string
+	// Complete is true if the command could also end before the next word.
+	Complete bool
+}
+
+// Expected returns the keywords and variables that any of the partial matches could match
+// next, without duplicates.
+func (m LongestMatch) Expected() []string {
+	var exp []string
+	seen := make(map[string]bool)
+	for _, p := range m.Partial {
+		for _, e := range p.Expected {
+			if !seen[e] {
+				seen[e] = true
+				exp = append(exp, e)
+			}
+		}
+	}
+	return exp
+}
+
+// String returns a message such as:
+//
+//    unexpected word 'foo' at position 3, expected one of: source, detail
+//
+// Positions are counted from 1. If there are Suggestions they are added, as in:
+//
+//    unexpected word 'shwo' at position 1, expected one of: show, set; did you mean 'show'?
+func (m LongestMatch) String() string {
+	exp := m.Expected()
+	complete := false
+	for _, p := range m.Partial {
+		complete = complete || p.Complete
+	}
+	if complete {
+		exp = append(exp, "end of command")
+	}
+
+	var what string
+	switch len(exp) {
+	case 0:
+		what = "nothing"
+	case 1:
+		what = exp[0]
+	default:
+		what = "one of: " + strings.Join(exp, ", ")
+	}
+
+	if m.Word == "" {
+		return fmt.Sprintf("incomplete command at position %d, expected %s", m.Position+1, what)
+	}
+	msg := fmt.Sprintf("unexpected word '%s' at position %d, expected %s", m.Word, m.Position+1, what)
+	switch len(m.Suggestions) {
+	case 0:
+	case 1:
+		msg += fmt.Sprintf("; did you mean '%s'?", m.Suggestions[0])
+	default:
+		msg += "; did you mean one of: '" + strings.Join(m.Suggestions, "', '") + "'?"
+	}
+	return msg
+}
+
+// LongestMatches matches as much of the input ‘cmd’ as possible, and returns where
+// matching stopped along with what was expected there. This is useful when Parse returns
+// false because the input didn't match any command, so that the caller can print a helpful
+// error message. If the input can't be split into words, the Position is 0 and there are
+// no partial matches.
+func (c *Cmds) LongestMatches(cmd string) LongestMatch {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	toks, err := c.scanInput(cmd)
+	if err != nil {
+		return LongestMatch{}
+	}
+	return c.longestMatchOf(toks)
+}
+
+// longestMatchOf returns the LongestMatch of the input words ‘toks’.
+func (c *Cmds) longestMatchOf(toks []string) LongestMatch {
+	prog := c.program()
+
+	// Find the longest prefix of the input after which some thread is still running
+	var v vm
+	var expected []*instr
+	pos := len(toks)
+	for ; pos >= 0; pos-- {
+		v = vm{exactKeywords: c.keywordMatching == ExactMatching, version: c.version}
+		expected = v.expectations(prog, toks[:pos])
+		if len(expected) > 0 {
+			break
+		}
+	}
+
+	var m LongestMatch
+	if pos < 0 {
+		return m
+	}
+	m.Position = pos
+	if pos < len(toks) {
+		m.Word = toks[pos]
+	}
+
+	// List the commands in the order they were added
+	order := make(map[*command]int)
+	for i, cmd := range c.commands {
+		order[cmd] = i
+	}
+	idx := make([]int, len(expected))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return order[v.expectedBy[idx[i]].meta.(*command)] < order[v.expectedBy[idx[j]].meta.(*command)]
+	})
+
+	// Group the expectations of threads that matched the same things
+	index := make(map[string]int)
+	var keywords []string
+	seen := make(map[string]bool)
+	for _, i := range idx {
+		instr := expected[i]
+		t := v.expectedBy[i]
+		pm := t.toMatch(nil)
+
+		var p PartialMatch
+		p.Syntax = pm.meta.(*command).syntax
+		p.Matched = boundElements(pm)
+
+		key := fmt.Sprintf("%s\x00%v", p.Syntax, p.Matched)
+		j, ok := index[key]
+		if !ok {
+			j = len(m.Partial)
+			index[key] = j
+			m.Partial = append(m.Partial, p)
+		}
+
+		switch instr.opcode {
+		case opCmp:
+			m.Partial[j].Expected = appendUnique(m.Partial[j].Expected, instr.strs[0])
+			for _, kw := range instr.spellings() {
+				if !seen[kw] {
+					seen[kw] = true
+					keywords = append(keywords, kw)
+				}
+			}
+		case opSave, opSaveRest, opCustom:
+			m.Partial[j].Expected = appendUnique(m.Partial[j].Expected, "<"+instr.strs[0]+">")
+		case opMatch:
+			m.Partial[j].Complete = true
+		}
+	}
+
+	if m.Word != "" {
+		m.Suggestions = suggestions(m.Word, keywords)
+	}
+	return m
+}
+
+// boundElements returns the keywords and variables matched by ‘m’ with their values.
+func boundElements(m match) []BoundElement {
+	var bound []BoundElement
+	for _, item := range m.items {
+		switch w := item.(type) {
+		case keywordValue:
+			bound = append(bound, BoundElement{Element: w.Name, Value: w.Value})
+		case VarValue:
+			bound = append(bound, BoundElement{Element: "<" + w.Name + ">", Value: w.Redacted()})
+		}
+	}
+	return bound
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, e := range list {
+		if e == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,82 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLongestMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		position int
+		message  string
+		partial  int
+	}{
+		{"wrong word", "show logs foo", 2, "unexpected word 'foo' at position 3, expected one of: source, detail", 1},
+		{"first word", "bogus", 0, "unexpected word 'bogus' at position 1, expected one of: show, set", 2},
+		{"incomplete", "show logs", 2, "incomplete command at position 3, expected one of: source, detail", 1},
+		{"extra word", "set x y", 2, "unexpected word 'y' at position 3, expected end of command", 1},
+		{"empty", "", 0, "incomplete command at position 1, expected one of: show, set", 2},
+		{"misspelled", "shwo logs", 0, "unexpected word 'shwo' at position 1, expected one of: show, set; did you mean 'show'?", 2},
+		{"misspelled later", "show logs detial", 2, "unexpected word 'detial' at position 3, expected one of: source, detail; did you mean 'detail'?", 1},
+		{"misspelled alternative", "show logs sorce", 2, "unexpected word 'sorce' at position 3, expected one of: source, detail; did you mean 'source'?", 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+
+			cmds.Add("show logs (source | detail)", cback)
+			cmds.Add("set <name>", cback)
+			cmds.Compile()
+
+			m := cmds.LongestMatches(tc.input)
+			if m.Position != tc.position {
+				t.Fatalf("Expected position %d but got %d", tc.position, m.Position)
+			}
+			if m.String() != tc.message {
+				t.Fatalf("Expected message '%s' but got '%s'", tc.message, m.String())
+			}
+			if len(m.Partial) != tc.partial {
+				t.Fatalf("Expected %d partial matches but got %d: %+v", tc.partial, len(m.Partial), m.Partial)
+			}
+		})
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	tests := []struct {
+		name     string
+		word     string
+		keywords []string
+		expected []string
+	}{
+		{"swapped", "shwo", []string{"set", "show"}, []string{"show"}},
+		{"closest first", "stat", []string{"status", "start", "stop"}, []string{"start"}},
+		{"two edits", "interfce", []string{"internal", "interface"}, []string{"interface"}},
+		{"several", "lost", []string{"list", "last", "load"}, []string{"list", "last"}},
+		{"too short", "st", []string{"set"}, nil},
+		{"too far", "bogus", []string{"show", "set"}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if s := suggestions(tc.word, tc.keywords); !reflect.DeepEqual(s, tc.expected) {
+				t.Fatalf("suggested %v, expected %v", s, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSuggestionsAliases(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("remove!alias(rm|delete) <file>", func(match Match, ctx interface{}) {})
+	cmds.Compile()
+
+	m := cmds.LongestMatches("delte a")
+	if !reflect.DeepEqual(m.Suggestions, []string{"delete"}) {
+		t.Fatalf("suggested %v, expected the alias delete", m.Suggestions)
+	}
+}
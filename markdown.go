@@ -0,0 +1,159 @@
+package cmdparse
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// HelpFormat is the output format of RenderHelp.
+type HelpFormat int
+
+const (
+	// PlainHelp is text for terminals without styles. Markup is removed.
+	PlainHelp HelpFormat = iota
+	// ANSIHelp is text for terminals that are styled with ANSI escape sequences.
+	ANSIHelp
+	// HTMLHelp is HTML.
+	HTMLHelp
+)
+
+// RenderHelp renders the help text ‘help’, as passed to AddWithHelp, written in a
+// lightweight markdown, in the format ‘f’. This lets one help text look right in a
+// terminal and in a web console. The markdown supported is:
+//
+//    **strong**, *emphasis* or _emphasis_, and `code`
+//    paragraphs separated by blank lines
+//    lists whose items are lines beginning with ‘- ’ or ‘* ’
+//
+// Lines of a paragraph are joined with spaces, and other text is left as it is.
+func RenderHelp(help string, f HelpFormat) string {
+	var blocks []string
+	for _, b := range helpBlocks(help) {
+		blocks = append(blocks, b.render(f))
+	}
+
+	sep := "\n\n"
+	if f == HTMLHelp {
+		sep = "\n"
+	}
+	return strings.Join(blocks, sep)
+}
+
+// helpBlock is a paragraph, or a list with an item on each line.
+type helpBlock struct {
+	lines  []string
+	isList bool
+}
+
+// helpBlocks splits ‘help’ into paragraphs and lists.
+func helpBlocks(help string) []helpBlock {
+	var blocks []helpBlock
+	var cur *helpBlock
+	for _, line := range strings.Split(help, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			cur = nil
+			continue
+		}
+
+		item := strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")
+		if item {
+			line = strings.TrimSpace(line[2:])
+		}
+		if cur == nil || cur.isList != item {
+			blocks = append(blocks, helpBlock{isList: item})
+			cur = &blocks[len(blocks)-1]
+		}
+		cur.lines = append(cur.lines, line)
+	}
+	return blocks
+}
+
+func (b helpBlock) render(f HelpFormat) string {
+	if !b.isList {
+		text := renderInline(strings.Join(b.lines, " "), f)
+		if f == HTMLHelp {
+			return "<p>" + text + "</p>"
+		}
+		return text
+	}
+
+	items := make([]string, len(b.lines))
+	for i, line := range b.lines {
+		text := renderInline(line, f)
+		if f == HTMLHelp {
+			items[i] = "<li>" + text + "</li>"
+		} else {
+			items[i] = "  - " + text
+		}
+	}
+	if f == HTMLHelp {
+		return "<ul>\n" + strings.Join(items, "\n") + "\n</ul>"
+	}
+	return strings.Join(items, "\n")
+}
+
+// inlineStyles are the start and end of each inline style in each format, by the
+// markdown that marks it.
+var inlineStyles = map[string][3][2]string{
+	"**": {PlainHelp: {"", ""}, ANSIHelp: {"\x1b[1m", "\x1b[22m"}, HTMLHelp: {"<strong>", "</strong>"}},
+	"*":  {PlainHelp: {"", ""}, ANSIHelp: {"\x1b[3m", "\x1b[23m"}, HTMLHelp: {"<em>", "</em>"}},
+	"`":  {PlainHelp: {"", ""}, ANSIHelp: {"\x1b[36m", "\x1b[39m"}, HTMLHelp: {"<code>", "</code>"}},
+}
+
+// renderInline renders the inline styles in ‘text’. Markers that aren't closed, or that
+// are next to a space on the inside, are left as they are.
+func renderInline(text string, f HelpFormat) string {
+	var buf strings.Builder
+	literal := func(s string) {
+		if f == HTMLHelp {
+			s = html.EscapeString(s)
+		}
+		buf.WriteString(s)
+	}
+
+	for i := 0; i < len(text); {
+		var marker, style string
+		switch {
+		case text[i] == '`':
+			marker, style = "`", "`"
+		case strings.HasPrefix(text[i:], "**"):
+			marker, style = "**", "**"
+		case text[i] == '*':
+			marker, style = "*", "*"
+		case text[i] == '_' && (i == 0 || !isWordByte(text[i-1])):
+			marker, style = "_", "*"
+		}
+
+		end := -1
+		if marker != "" {
+			end = strings.Index(text[i+len(marker):], marker)
+		}
+		var inner string
+		if end > 0 {
+			inner = text[i+len(marker) : i+len(marker)+end]
+		}
+		if inner == "" || inner[0] == ' ' || inner[len(inner)-1] == ' ' {
+			// Like markdown, text styled with a marker can't begin or end with a space
+			literal(text[i : i+1])
+			i++
+			continue
+		}
+
+		st := inlineStyles[style][f]
+		buf.WriteString(st[0])
+		if style == "`" {
+			literal(inner)
+		} else {
+			buf.WriteString(renderInline(inner, f))
+		}
+		buf.WriteString(st[1])
+		i += 2*len(marker) + end
+	}
+	return buf.String()
+}
+
+func isWordByte(b byte) bool {
+	return b < 0x80 && (unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)))
+}
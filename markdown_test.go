@@ -0,0 +1,59 @@
+package cmdparse
+
+import "testing"
+
+func TestRenderHelp(t *testing.T) {
+	tests := []struct {
+		name  string
+		help  string
+		plain string
+		ansi  string
+		html  string
+	}{
+		{
+			"plain text",
+			"Copy a file",
+			"Copy a file",
+			"Copy a file",
+			"<p>Copy a file</p>",
+		},
+		{
+			"inline styles",
+			"Copy **all** of *src* to `dst`",
+			"Copy all of src to dst",
+			"Copy \x1b[1mall\x1b[22m of \x1b[3msrc\x1b[23m to \x1b[36mdst\x1b[39m",
+			"<p>Copy <strong>all</strong> of <em>src</em> to <code>dst</code></p>",
+		},
+		{
+			"nested and escaped",
+			"**very _big_** `a<b` & c",
+			"very big a<b & c",
+			"\x1b[1mvery \x1b[3mbig\x1b[23m\x1b[22m \x1b[36ma<b\x1b[39m & c",
+			"<p><strong>very <em>big</em></strong> <code>a&lt;b</code> &amp; c</p>",
+		},
+		{
+			"unclosed markers",
+			"2 * 3 and snake_case_name and **open",
+			"2 * 3 and snake_case_name and **open",
+			"2 * 3 and snake_case_name and **open",
+			"<p>2 * 3 and snake_case_name and **open</p>",
+		},
+		{
+			"paragraphs and lists",
+			"Copy files.\nOverwrites them.\n\nOptions:\n- *force* overwrites\n* `-n` copies nothing",
+			"Copy files. Overwrites them.\n\nOptions:\n\n  - force overwrites\n  - -n copies nothing",
+			"Copy files. Overwrites them.\n\nOptions:\n\n  - \x1b[3mforce\x1b[23m overwrites\n  - \x1b[36m-n\x1b[39m copies nothing",
+			"<p>Copy files. Overwrites them.</p>\n<p>Options:</p>\n<ul>\n<li><em>force</em> overwrites</li>\n<li><code>-n</code> copies nothing</li>\n</ul>",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for f, exp := range map[HelpFormat]string{PlainHelp: tc.plain, ANSIHelp: tc.ansi, HTMLHelp: tc.html} {
+				if act := RenderHelp(tc.help, f); act != exp {
+					t.Fatalf("In format %d expected\n%q\nbut got\n%q", f, exp, act)
+				}
+			}
+		})
+	}
+}
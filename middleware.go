@@ -0,0 +1,71 @@
+package cmdparse
+
+import "fmt"
+
+// Middleware wraps a callback, returning a callback that does something before or after
+// calling ‘next’, or instead of it. It handles concerns that apply to many commands, such
+// as authorization, logging, timing and asking for confirmation, in one place, for
+// example:
+//
+//    cmds.Use(func(next Callback) Callback {
+//        return func(match Match, ctx interface{}) {
+//            log.Printf("running %s", match.Syntax())
+//            next(match, ctx)
+//        }
+//    })
+//
+// The Match tells which command is being run through its Syntax and ID. Use lists the
+// callbacks that middleware wraps. The Result of a command is the one its callback returns
+// if ‘next’ is called, and the zero Result otherwise.
+type Middleware func(next Callback) Callback
+
+// Use adds middleware that wraps the callback of every command. The middleware added first
+// is the outermost, and is called first. Middleware of the Cmds wraps the middleware
+// added to single commands with UseFor.
+//
+// Middleware wraps the callbacks of the commands added with Add, AddWithHelp, AddBound,
+// AddWithResult and AddWithContext, of those loaded with LoadJSON, and of the built-in
+// commands installed by InstallBuiltins. The commands that source, repeat and watch run
+// are parsed again, so middleware wraps them as well as the builtin. The callback receives
+// the context value that middleware passes to ‘next’; a callback added with
+// AddWithContext receives it if it's a context.Context, and context.Background otherwise.
+// When a Recorder is set, middleware wraps the call to the Recorder instead of the
+// callback. Commands added with AddNamed
+// have no callback, so middleware isn't called for them, nor for ParseToMatch.
+func (c *Cmds) Use(mw ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.middleware = append(c.middleware, mw...)
+}
+
+// UseFor adds middleware that wraps the callback of the command whose definition is
+// ‘syntax’, exactly as it was passed to Add, such as a confirmation prompt for a command
+// that deletes things. The middleware added first is the outermost.
+func (c *Cmds) UseFor(syntax string, mw ...Middleware) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax == syntax {
+			cmd.middleware = append(cmd.middleware, mw...)
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// wrap returns the callback ‘cback’ of the command ‘cmd’ wrapped in the middleware of the
+// command and then of the Cmds.
+func (c *Cmds) wrap(cmd *command, cback Callback) Callback {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := len(cmd.middleware) - 1; i >= 0; i-- {
+		cback = cmd.middleware[i](cback)
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		cback = c.middleware[i](cback)
+	}
+	return cback
+}
@@ -0,0 +1,100 @@
+package cmdparse
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	tracer := func(name string) Middleware {
+		return func(next Callback) Callback {
+			return func(match Match, ctx interface{}) {
+				calls = append(calls, name+" "+match.Syntax())
+				next(match, ctx)
+			}
+		}
+	}
+	deny := func(next Callback) Callback {
+		return func(match Match, ctx interface{}) {
+			calls = append(calls, "denied "+match.Syntax())
+		}
+	}
+
+	cmds := &Cmds{}
+	cmds.Add("get <file>", func(m Match, ctx interface{}) { calls = append(calls, "get") })
+	cmds.Add("delete <file>", func(m Match, ctx interface{}) { calls = append(calls, "delete") })
+	cmds.AddWithResult("status", func(m Match, ctx interface{}) Result {
+		calls = append(calls, "status")
+		return Result{Status: StatusFailure}
+	})
+	cmds.AddWithContext("ping", func(ctx context.Context, m Match) error {
+		calls = append(calls, "ping")
+		return nil
+	})
+	if err := cmds.InstallBuiltins(); err != nil {
+		t.Fatalf("InstallBuiltins returned an error: %v", err)
+	}
+	cmds.Compile()
+	cmds.Use(tracer("outer"), tracer("inner"))
+	if err := cmds.UseFor("delete <file>", deny); err != nil {
+		t.Fatalf("UseFor returned an error: %v", err)
+	}
+	if err := cmds.UseFor("delete", deny); err == nil {
+		t.Fatalf("UseFor of a missing command didn't return an error")
+	}
+
+	tests := []struct {
+		input  string
+		calls  []string
+		status int
+	}{
+		{"get a", []string{"outer get <file>", "inner get <file>", "get"}, StatusOK},
+		{"delete a", []string{"outer delete <file>", "inner delete <file>", "denied delete <file>"}, StatusOK},
+		{"status", []string{"outer status", "inner status", "status"}, StatusFailure},
+		{"ping", []string{"outer ping", "inner ping", "ping"}, StatusOK},
+		{"repeat 2 get a", []string{
+			"outer repeat <n:int> <command:cmdline>", "inner repeat <n:int> <command:cmdline>",
+			"outer get <file>", "inner get <file>", "get",
+			"outer get <file>", "inner get <file>", "get",
+		}, StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			calls = nil
+			_, res, err := cmds.ParseWithResult(tc.input, nil)
+			if err != nil {
+				t.Fatalf("ParseWithResult returned an error: %v", err)
+			}
+			if !reflect.DeepEqual(calls, tc.calls) {
+				t.Fatalf("calls are %q but expected %q", calls, tc.calls)
+			}
+			if res.Status != tc.status {
+				t.Fatalf("status is %d but expected %d", res.Status, tc.status)
+			}
+		})
+	}
+}
+
+func TestMatchID(t *testing.T) {
+	var id, syntax string
+	cmds := &Cmds{}
+	cmds.AddNamed("list", "list <dir>")
+	cmds.Add("show <file>", func(m Match, ctx interface{}) { id, syntax = m.ID(), m.Syntax() })
+	cmds.Compile()
+
+	_, m, err := cmds.ParseToMatch("list a")
+	if err != nil {
+		t.Fatalf("ParseToMatch returned an error: %v", err)
+	}
+	if m.ID() != "list" || m.Syntax() != "list <dir>" {
+		t.Fatalf("ID and syntax are ‘%s’ and ‘%s’ but expected ‘list’ and ‘list <dir>’", m.ID(), m.Syntax())
+	}
+
+	cmds.Parse("show a", nil)
+	if id != "" || syntax != "show <file>" {
+		t.Fatalf("ID and syntax are ‘%s’ and ‘%s’ but expected ‘’ and ‘show <file>’", id, syntax)
+	}
+}
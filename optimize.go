@@ -0,0 +1,159 @@
+package cmdparse
+
+import (
+	"sort"
+	"strings"
+)
+
+// Optimize makes Parse find the commands an input may match using a trie of the keywords
+// that each command begins with, and then run only the programs of those commands. For
+// command sets with hundreds of commands that share leading keywords, such as
+//
+//    show interface <name>
+//    show ip route <prefix>
+//    show ip bgp neighbors
+//
+// this saves running the whole program on every input, which explores each command
+// until the input diverges from it. Commands that don't begin with a keyword are found
+// by their first word like with SetLazyCompilation, which Optimize can be combined with.
+//
+// Optimize may be called before or after Compile, and the trie is kept up to date as
+// commands are added and removed. Like with lazy compilation, each command is matched
+// separately, so a variable that avoids keywords only avoids those of its own command.
+func (c *Cmds) Optimize() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.optimized = true
+	c.relink()
+}
+
+// keywordTrie finds the commands that may match an input by the keywords it begins with.
+type keywordTrie struct {
+	root trieNode
+	// rest indexes the commands that don't begin with a keyword by their first word
+	rest *firstWordIndex
+	// order is the position of each command in the order they were added
+	order map[*command]int
+}
+
+// trieNode is reached by the input words that match the keywords on the path to it.
+type trieNode struct {
+	// edges are the keywords that may follow, sorted
+	edges []trieEdge
+	// cmds are the commands whose leading keywords are those on the path to the node
+	cmds []*command
+}
+
+// trieEdge leads from a trieNode to the node reached when the next input word matches
+// the keyword.
+type trieEdge struct {
+	keyword string
+	// exact is set if the keyword must be entered in full
+	exact bool
+	node  *trieNode
+}
+
+func newKeywordTrie(cmds []*command) *keywordTrie {
+	x := &keywordTrie{order: make(map[*command]int)}
+
+	var rest []*command
+	for i, cmd := range cmds {
+		x.order[cmd] = i
+		kws := leadingKeywords(cmd.tree)
+		if len(kws) == 0 {
+			rest = append(rest, cmd)
+			continue
+		}
+
+		n := &x.root
+		for _, kw := range kws {
+			n = n.child(kw)
+		}
+		n.cmds = append(n.cmds, cmd)
+	}
+
+	x.rest = newFirstWordIndex(rest)
+	return x
+}
+
+// child returns the node reached from ‘n’ by the keyword ‘kw’, adding it if needed.
+func (n *trieNode) child(kw trieEdge) *trieNode {
+	i := sort.Search(len(n.edges), func(i int) bool { return n.edges[i].keyword >= kw.keyword })
+	for j := i; j < len(n.edges) && n.edges[j].keyword == kw.keyword; j++ {
+		if n.edges[j].exact == kw.exact {
+			return n.edges[j].node
+		}
+	}
+
+	kw.node = &trieNode{}
+	n.edges = append(n.edges, trieEdge{})
+	copy(n.edges[i+1:], n.edges[i:])
+	n.edges[i] = kw
+	return kw.node
+}
+
+// candidates returns the commands that may match the input words ‘toks’, in the order
+// they were added. If ‘exact’ is set keywords must be entered in full.
+func (x *keywordTrie) candidates(toks []string, exact bool) []*command {
+	var cands []*command
+	if len(toks) == 0 {
+		cands = append(cands, x.rest.open...)
+	} else {
+		cands = x.rest.candidates(toks[0])
+	}
+
+	nodes := []*trieNode{&x.root}
+	for _, tok := range toks {
+		var next []*trieNode
+		for _, n := range nodes {
+			// Keywords that ‘tok’ is a prefix of are sorted next to each other
+			i := sort.Search(len(n.edges), func(i int) bool { return n.edges[i].keyword >= tok })
+			for ; i < len(n.edges) && strings.HasPrefix(n.edges[i].keyword, tok); i++ {
+				e := n.edges[i]
+				if (exact || e.exact) && e.keyword != tok {
+					continue
+				}
+				cands = append(cands, e.node.cmds...)
+				next = append(next, e.node)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		nodes = next
+	}
+
+	sort.Slice(cands, func(i, j int) bool {
+		return x.order[cands[i]] < x.order[cands[j]]
+	})
+	return cands
+}
+
+// leadingKeywords returns the keywords that the parse tree ‘tree’ must begin with.
+func leadingKeywords(tree interface{}) []trieEdge {
+	switch node := tree.(type) {
+	case word:
+		return []trieEdge{{keyword: string(node)}}
+	case exactWord:
+		return []trieEdge{{keyword: string(node), exact: true}}
+	case terms:
+		kws := leadingKeywords(node.Left)
+		if len(kws) == 0 || !isKeyword(node.Left) {
+			return kws
+		}
+		return append(kws, leadingKeywords(node.Right)...)
+	}
+	return nil
+}
+
+// isKeyword returns true if the parse tree ‘tree’ only matches a sequence of keywords.
+func isKeyword(tree interface{}) bool {
+	switch node := tree.(type) {
+	case word, exactWord:
+		return true
+	case terms:
+		return isKeyword(node.Left) && isKeyword(node.Right)
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package cmdparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLeadingKeywords(t *testing.T) {
+	tests := []struct {
+		syntax   string
+		expected string
+	}{
+		{"show ip route <prefix>", "show ip route"},
+		{"show !interface <name> brief", "show !interface"},
+		{"show (ip | ipv6) route", "show"},
+		{"show ip? route", "show"},
+		{"<file> open", ""},
+		{"(show | list) results", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.syntax, func(t *testing.T) {
+			var c Cmds
+			tree, err := c.scanAndParse(tc.syntax)
+			if err != nil {
+				t.Fatalf("Parsing the syntax failed: %v", err)
+			}
+
+			var kws []string
+			for _, e := range leadingKeywords(tree) {
+				if e.exact {
+					kws = append(kws, "!"+e.keyword)
+				} else {
+					kws = append(kws, e.keyword)
+				}
+			}
+			if strings.Join(kws, " ") != tc.expected {
+				t.Fatalf("Expected the leading keywords ‘%s’ but got %v", tc.expected, kws)
+			}
+		})
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	defs := []string{
+		"show ip route <prefix>",
+		"show ip bgp neighbors",
+		"show interface <name>",
+		"show !version",
+		"set <key> <value>",
+		"(list | ls) <dir>?",
+		"<file> open",
+		"verbose? stop",
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		exact bool
+	}{
+		{"full keywords", "show ip route 10.0.0.0/8", false},
+		{"abbreviated", "sh i b n", false},
+		{"abbreviated variable", "sh int eth0", false},
+		{"exact keyword", "show version", false},
+		{"abbreviated exact keyword", "show ver", false},
+		{"ambiguous", "show i", false},
+		{"too short", "show ip", false},
+		{"alternatives", "ls /tmp", false},
+		{"optional", "stop", false},
+		{"variable first", "x.txt open", false},
+		{"variable only", "x.txt", false},
+		{"empty", "", false},
+		{"exact keywords", "show ip route 10.0.0.0/8", true},
+		{"exact keywords abbreviated", "sh ip route 10.0.0.0/8", true},
+	}
+
+	parse := func(cmds *Cmds, input string, exact bool) []MatchInfo {
+		var infos []MatchInfo
+		toks, _ := cmds.scanInput(input)
+		for _, m := range cmds.match(toks, ParseOptions{ExactKeywords: exact}) {
+			infos = append(infos, matchInfo(m))
+		}
+		return infos
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var plain, optimized Cmds
+			for _, d := range defs {
+				plain.Add(d, nil)
+				optimized.Add(d, nil)
+			}
+			plain.Compile()
+			optimized.Optimize()
+			optimized.Compile()
+
+			expected := parse(&plain, tc.input, tc.exact)
+			got := parse(&optimized, tc.input, tc.exact)
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("Expected the matches %v but got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestOptimizeAfterCompile(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("show ip route", nil)
+	cmds.Compile()
+	cmds.Optimize()
+
+	cmds.Add("show ip bgp", nil)
+	if _, _, err := cmds.ParseToMatch("sh ip b"); err != nil {
+		t.Fatalf("A command added after Optimize wasn't matched: %v", err)
+	}
+
+	cmds.Remove("show ip route")
+	if _, _, err := cmds.ParseToMatch("sh ip r"); err == nil {
+		t.Fatalf("A command removed after Optimize was matched")
+	}
+}
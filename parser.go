@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"runtime/debug"
+	"strconv"
+	"strings"
 )
 
 /*
@@ -11,13 +13,32 @@ import (
 command → alternatives EOF
 alternatives → terms ( '|' alternatives )?
 terms → repetition ( terms )?
-repetition → group (  '*' |  '+' |  '?' )?
-group → '(' alternatives ')' | term
-term → var | WORD
-var → '<' WORD (':' WORD)? '>'
+repetition → group (  '*' |  '+' |  '?' | count )?
+count → '{' NUMBER ( ',' NUMBER? )? '}'
+group → '(' alternatives ')' ( ':' WORD )? | set | term
+set → '{' repetition+ '}'
+term → var | '!'? WORD aliases?
+aliases → '!' 'alias' '(' WORD ( '|' WORD )* ')'
+var → '<' WORD (':' WORD)? ( '!' WORD )* '>' | '<' WORD ':' '@' WORD args? '>'
+args → '(' WORD ( '|' WORD )* ')'
 
 Notes:
 	• If unspecified, a variable's type is str
+	• The words following a ! are flags for the variable, such as secret or prompt
+	• A keyword preceded by a ! must be entered in full
+	• The ! of the aliases of a keyword directly follows it, and the word alias and the (
+	  directly follow the !. Without them, a ( directly after a keyword begins a group.
+	• A WORD may be quoted with double quotes or contain backslash escapes; the scanner
+	  removes them
+	• The word following the @ of a variable is the name of a custom instruction that
+	  matches it, and the ( of its arguments directly follows it
+	• The word following the : after a group is the name of the group
+	• A count repeats the group exactly NUMBER times, or between the two NUMBERs of times. If
+	  the second NUMBER is omitted there is no maximum.
+	• The { of a count directly follows the group, while the { of a set follows a space or
+	  begins the command.
+	• The options of a set are its repetitions, except that variables belong to the option
+	  of the repetition before them. An option whose last repetition is a ? may be left out.
 
 */
 
@@ -109,6 +130,11 @@ func (p *parser) Repetition() interface{} {
 		case questionTok:
 			r.Op = repeatZeroOrOne
 		}
+	} else if p.followsDirectly(leftBraceTok) {
+		p.advance()
+		if !p.Count(&r) {
+			return r.Term
+		}
 	} else {
 		return r.Term
 	}
@@ -116,28 +142,239 @@ func (p *parser) Repetition() interface{} {
 	return r
 }
 
+// maxRepeatCount is the largest number of times a count may repeat a group. Counted
+// repetitions are compiled by repeating the instructions of the group, so this limits the
+// size of the program.
+const maxRepeatCount = 100
+
+// followsDirectly returns true if the next token is of type ‘typ’ and there is no space
+// between it and the previous token.
+func (p *parser) followsDirectly(typ tokenType) bool {
+	return p.check(typ) && p.peek().pos == p.previous().pos+p.previous().len()
+}
+
+// Count parses the count of a counted repetition into ‘r’, after the opening brace.
+func (p *parser) Count(r *rep) bool {
+	r.Op = repeatCounted
+
+	min, ok := p.Number()
+	if !ok {
+		p.addErrorAtPosition("expected a number after {")
+		p.skipCount()
+		return false
+	}
+	r.Min, r.Max = min, min
+
+	if p.match(commaTok) {
+		r.Max = -1
+		if p.check(wordTok) {
+			if r.Max, ok = p.Number(); !ok {
+				p.addErrorAtPosition("expected a number or } after ,")
+				p.skipCount()
+				return false
+			}
+		}
+	}
+
+	if !p.match(rightBraceTok) {
+		p.addMissingError("expected } to close the count", "}")
+		p.skipCount()
+		return false
+	}
+
+	switch {
+	case r.Max == 0:
+		p.addErrorAtPosition("the count must allow at least one repetition")
+		return false
+	case r.Max > 0 && r.Max < r.Min:
+		p.addErrorAtPosition("the maximum of the count is less than the minimum")
+		return false
+	case r.Max > maxRepeatCount || r.Min > maxRepeatCount:
+		p.addErrorAtPosition(fmt.Sprintf("a count may be at most %d", maxRepeatCount))
+		return false
+	}
+	return true
+}
+
+// skipCount consumes the rest of a count that has an error, so that parsing can continue
+// after it.
+func (p *parser) skipCount() {
+	for !p.atEnd() && !p.match(rightBraceTok) {
+		p.advance()
+	}
+}
+
+// Number parses a word that is a non-negative number.
+func (p *parser) Number() (int, bool) {
+	w := p.Word()
+	if w == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(w.(word)))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
 func (p *parser) Group() interface{} {
 	if p.match(leftParenTok) {
 		res := p.Alternatives()
 
 		if !p.match(rightParenTok) {
-			p.addErrorAtPosition("expected ) to close the group")
+			p.addMissingError("expected ) to close the group", ")")
+		}
+
+		if p.match(colonTok) {
+			name := p.Word()
+			if name == nil {
+				p.addErrorAtPosition("expected group name after :")
+				return nil
+			}
+			return group{Name: string(name.(word)), Term: res}
 		}
 
 		return res
 	}
 
+	if p.match(leftBraceTok) {
+		return p.Set()
+	}
+
 	return p.Term()
 }
 
+// maxSetOptions is the most options a set may have. The VM records which options of a
+// set have been entered in the bits of an int.
+const maxSetOptions = 32
+
+// Set parses the options of a set, after the opening brace.
+func (p *parser) Set() interface{} {
+	var s set
+	var opt []interface{}
+	endOption := func() {
+		if len(opt) == 0 {
+			return
+		}
+		// A ? on the last part makes the whole option optional
+		optional := false
+		if r, ok := opt[len(opt)-1].(rep); ok && r.Op == repeatZeroOrOne {
+			opt[len(opt)-1] = r.Term
+			optional = true
+		}
+		tree := opt[len(opt)-1]
+		for i := len(opt) - 2; i >= 0; i-- {
+			tree = terms{Left: opt[i], Right: tree}
+		}
+		s.Options = append(s.Options, tree)
+		s.Optional = append(s.Optional, optional)
+		opt = nil
+	}
+
+	for {
+		r := p.Repetition()
+		if r == nil {
+			break
+		}
+		if !isVariable(r) {
+			endOption()
+		}
+		opt = append(opt, r)
+	}
+	endOption()
+
+	if !p.match(rightBraceTok) {
+		p.addMissingError("expected } to close the set", "}")
+		return nil
+	}
+	switch {
+	case len(s.Options) == 0:
+		p.addErrorAtPosition("expected an option in the set")
+	case len(s.Options) > maxSetOptions:
+		p.addErrorAtPosition(fmt.Sprintf("a set may have at most %d options", maxSetOptions))
+	}
+	return s
+}
+
+// isVariable returns true if the parse tree ‘tree’ is a variable, which may be repeated.
+func isVariable(tree interface{}) bool {
+	if r, ok := tree.(rep); ok {
+		tree = r.Term
+	}
+	_, ok := tree.(variable)
+	return ok
+}
+
 func (p *parser) Term() interface{} {
 	r := p.Var()
+	if r == nil {
+		r = p.ExactWord()
+	}
 	if r == nil {
 		r = p.Word()
 	}
+	if isWord(r) && p.followsAliasMarker() {
+		r = p.Aliases(r)
+	}
 	return r
 }
 
+// followsAliasMarker returns true if the next tokens are the !alias( that begins the
+// aliases of a keyword, with no spaces between them or before them, and consumes them.
+func (p *parser) followsAliasMarker() bool {
+	if p.current+2 >= len(p.tokens) {
+		return false
+	}
+	marker := p.tokens[p.current : p.current+3]
+	end := p.previous().pos + p.previous().len()
+	for i, typ := range []tokenType{bangTok, wordTok, leftParenTok} {
+		if marker[i].typ != typ || marker[i].pos != end {
+			return false
+		}
+		end += marker[i].len()
+	}
+	if marker[1].value != "alias" {
+		return false
+	}
+	p.current += 3
+	return true
+}
+
+// isWord returns true if the parse tree ‘tree’ is a single keyword without aliases.
+func isWord(tree interface{}) bool {
+	switch tree.(type) {
+	case word, exactWord:
+		return true
+	}
+	return false
+}
+
+// Aliases parses the other spellings of the keyword ‘kw’, as in remove!alias(rm|del),
+// after the opening parenthesis.
+func (p *parser) Aliases(kw interface{}) interface{} {
+	aliases := p.alternatives("an alias")
+	if aliases == nil {
+		return nil
+	}
+	if w, ok := kw.(exactWord); ok {
+		return aliasedWord{Keyword: string(w), Aliases: aliases, Exact: true}
+	}
+	return aliasedWord{Keyword: string(kw.(word)), Aliases: aliases}
+}
+
+func (p *parser) ExactWord() interface{} {
+	if !p.match(bangTok) {
+		return nil
+	}
+
+	w := p.Word()
+	if w == nil {
+		p.addErrorAtPosition("expected keyword after !")
+		return nil
+	}
+	return exactWord(w.(word))
+}
+
 func (p *parser) Var() interface{} {
 	if !p.match(lessThanTok) {
 		return nil
@@ -154,6 +391,12 @@ func (p *parser) Var() interface{} {
 	if !p.match(colonTok) {
 		typ = "str"
 		hasColon = false
+	} else if p.match(atTok) {
+		return p.Custom(string(name.(word)))
+	} else if p.match(leftParenTok) {
+		if typ = p.Enum(); typ == "" {
+			return nil
+		}
 	} else {
 		w := p.Word()
 
@@ -164,16 +407,109 @@ func (p *parser) Var() interface{} {
 		typ = string(w.(word))
 	}
 
+	var flags VarFlags
+	var exclude []string
+	hasFlags := false
+	for p.match(bangTok) {
+		hasFlags = true
+		if p.match(leftParenTok) {
+			vals := p.alternatives("a word to exclude")
+			if vals == nil {
+				return nil
+			}
+			exclude = append(exclude, vals...)
+			continue
+		}
+		w := p.Word()
+		if w == nil {
+			p.addErrorAtPosition("expected variable flag after !")
+			return nil
+		}
+		f, ok := varFlagsByName[string(w.(word))]
+		if !ok {
+			// Keep going so that the rest of the variable definition is consumed
+			p.addErrorAtPosition(fmt.Sprintf("unknown variable flag '%s'", string(w.(word))))
+		}
+		flags |= f
+	}
+
 	if !p.match(greaterThanTok) {
-		if hasColon {
-			p.addErrorAtPosition("expected > to complete variable definition")
+		if hasColon || hasFlags {
+			p.addMissingError("expected > to complete variable definition", ">")
 		} else {
-			p.addErrorAtPosition("expected either : to specify variable type, or > to complete variable definition")
+			p.addMissingError("expected either : to specify variable type, or > to complete variable definition", ">")
 		}
 		return nil
 	}
 
-	return variable{string(name.(word)), typ}
+	return variable{Name: string(name.(word)), Type: typ, Flags: flags, Exclude: exclude}
+}
+
+// Custom parses the name and arguments of the custom instruction that matches the
+// variable ‘name’ following the @, as in <city:@dict(cities)>, up to the closing >.
+func (p *parser) Custom(name string) interface{} {
+	w := p.Word()
+	if w == nil {
+		p.addErrorAtPosition("expected instruction name after @")
+		return nil
+	}
+
+	var args []string
+	if p.followsDirectly(leftParenTok) {
+		p.advance()
+		if args = p.alternatives("an argument of the instruction"); args == nil {
+			return nil
+		}
+	}
+
+	if !p.match(greaterThanTok) {
+		p.addMissingError("expected > to complete variable definition", ">")
+		return nil
+	}
+	return custom{Name: name, Instr: string(w.(word)), Args: args}
+}
+
+// Enum parses the values of an enumerated variable type following the (, as in
+// <mode:(fast|slow)>, and returns the name of the type, or empty on error.
+func (p *parser) Enum() string {
+	vals := p.alternatives("a value of the enumeration")
+	if vals == nil {
+		return ""
+	}
+	return "(" + strings.Join(vals, "|") + ")"
+}
+
+// alternatives parses the words separated by | up to the ) in a variable, as in
+// <mode:(fast|slow)> or <name!(all|none)>, and returns them, or nil on error. ‘what’
+// describes each word for errors.
+func (p *parser) alternatives(what string) []string {
+	var vals []string
+	for {
+		w := p.Word()
+		if w == nil {
+			p.addErrorAtPosition("expected " + what)
+			p.skipVar()
+			return nil
+		}
+		vals = append(vals, string(w.(word)))
+
+		if p.match(rightParenTok) {
+			return vals
+		}
+		if !p.match(pipeTok) {
+			p.addErrorAtPosition("expected | or ) after the value")
+			p.skipVar()
+			return nil
+		}
+	}
+}
+
+// skipVar consumes the rest of a variable that has an error, so that parsing can continue
+// after it.
+func (p *parser) skipVar() {
+	for !p.atEnd() && !p.match(greaterThanTok) {
+		p.advance()
+	}
 }
 
 func (p *parser) Word() interface{} {
@@ -244,7 +580,15 @@ func (p *parser) addError(e error) {
 }
 
 func (p *parser) addErrorAtPosition(msg string) {
-	p.addError(fmt.Errorf("At character %d: %s", p.runePosition()+1, msg))
+	p.addMissingError(msg, "")
+}
+
+// addMissingError adds the error ‘msg’ at the current position, where the text ‘missing’
+// should be inserted to fix it.
+func (p *parser) addMissingError(msg, missing string) {
+	pos := p.runePosition()
+	p.addError(&definitionError{start: pos, end: pos, msg: msg, missing: missing,
+		err: fmt.Errorf("At character %d: %s", pos+1, msg)})
 }
 
 func (p *parser) abortAndPrintState() {
@@ -286,6 +630,9 @@ func (a terms) Children() []interface{} {
 type rep struct {
 	Op   repOp
 	Term interface{}
+	// Min and Max are the number of times a repeatCounted repetition repeats Term. Max is
+	// negative when there is no maximum.
+	Min, Max int
 }
 
 func (a rep) String() string {
@@ -296,6 +643,61 @@ func (a rep) Children() []interface{} {
 	return []interface{}{a.Term}
 }
 
+// unrolled returns a parse tree without counted repetitions that matches the same input as
+// the repeatCounted repetition ‘a’. The repetitions after the minimum are nested, as in
+// ‘x (x (x)?)?’, so that each input matches them in only one way.
+func (a rep) unrolled() interface{} {
+	var tree interface{}
+	if a.Max < 0 {
+		tree = rep{Op: repeatZeroOrMore, Term: a.Term}
+	}
+	for i := a.Min; i < a.Max; i++ {
+		if tree == nil {
+			tree = rep{Op: repeatZeroOrOne, Term: a.Term}
+		} else {
+			tree = rep{Op: repeatZeroOrOne, Term: terms{Left: a.Term, Right: tree}}
+		}
+	}
+	for i := 0; i < a.Min; i++ {
+		if tree == nil {
+			tree = a.Term
+		} else {
+			tree = terms{Left: a.Term, Right: tree}
+		}
+	}
+	return tree
+}
+
+// group is a part of a command in parentheses that is named, so that what it matched can
+// be found using Match.Group.
+type group struct {
+	Name string
+	Term interface{}
+}
+
+func (g group) String() string {
+	return "group " + g.Name
+}
+
+func (g group) Children() []interface{} {
+	return []interface{}{g.Term}
+}
+
+// set is an unordered set of options, each of which may be entered at most once, in any
+// order. Options that aren't optional must be entered.
+type set struct {
+	Options  []interface{}
+	Optional []bool
+}
+
+func (s set) String() string {
+	return "set"
+}
+
+func (s set) Children() []interface{} {
+	return s.Options
+}
+
 type repOp int
 
 const (
@@ -303,6 +705,7 @@ const (
 	repeatZeroOrMore
 	repeatOneOrMore
 	repeatZeroOrOne
+	repeatCounted
 )
 
 func (r repOp) String() string {
@@ -315,6 +718,8 @@ func (r repOp) String() string {
 		return "+"
 	case repeatZeroOrOne:
 		return "?"
+	case repeatCounted:
+		return "{}"
 	default:
 		return "<unknown>"
 	}
@@ -330,19 +735,128 @@ func (w word) Children() []interface{} {
 	return nil
 }
 
+// exactWord is a keyword that must be entered in full.
+type exactWord string
+
+func (w exactWord) String() string {
+	return `!"` + string(w) + `"`
+}
+
+func (w exactWord) Children() []interface{} {
+	return nil
+}
+
+// aliasedWord is a keyword that may also be entered as one of its aliases. Matches report
+// the keyword whichever spelling was entered.
+type aliasedWord struct {
+	Keyword string
+	Aliases []string
+	// Exact is set if the keyword and its aliases must be entered in full
+	Exact bool
+}
+
+func (w aliasedWord) String() string {
+	s := `"` + w.Keyword + `"!alias(` + strings.Join(w.Aliases, "|") + ")"
+	if w.Exact {
+		s = "!" + s
+	}
+	return s
+}
+
+func (w aliasedWord) Children() []interface{} {
+	return nil
+}
+
 type variable struct {
-	Name string
-	Type string
+	Name  string
+	Type  string
+	Flags VarFlags
+	// Exclude are the words the variable doesn't match
+	Exclude []string
 }
 
 func (v variable) String() string {
-	return v.Name + ":" + v.Type
+	s := v.Name + ":" + v.Type
+	if v.Flags != 0 {
+		s += " " + v.Flags.String()
+	}
+	if len(v.Exclude) > 0 {
+		s += " !(" + strings.Join(v.Exclude, "|") + ")"
+	}
+	return s
+}
+
+// VarFlags are the annotations that may follow the type of a variable in a command
+// definition, as in <password:str!secret>.
+type VarFlags int
+
+const (
+	// VarPrompt marks a variable that an interactive frontend should ask the user for.
+	VarPrompt VarFlags = 1 << iota
+	// VarSecret marks a variable whose value should be entered with hidden echo and
+	// never be recorded in history or logs.
+	VarSecret
+	// VarSensitive marks a variable whose value should be replaced by a placeholder
+	// wherever the input is recorded, such as history, telemetry and trace output.
+	VarSensitive
+	// VarNoKeyword marks a variable that doesn't match a word that is exactly a keyword
+	// that could be matched in the same position.
+	VarNoKeyword
+)
+
+var varFlagsByName = map[string]VarFlags{
+	"prompt":    VarPrompt,
+	"secret":    VarSecret,
+	"sensitive": VarSensitive,
+	"nokeyword": VarNoKeyword,
+}
+
+// Has returns true if all the flags in ‘f2’ are set in ‘f’.
+func (f VarFlags) Has(f2 VarFlags) bool {
+	return f&f2 == f2
+}
+
+// IsSensitive returns true if a value with these flags must not be recorded. Secret
+// variables are always sensitive.
+func (f VarFlags) IsSensitive() bool {
+	return f.Has(VarSecret) || f.Has(VarSensitive)
+}
+
+func (f VarFlags) String() string {
+	var buf strings.Builder
+	for _, name := range []string{"prompt", "secret", "sensitive", "nokeyword"} {
+		if f.Has(varFlagsByName[name]) {
+			buf.WriteRune('!')
+			buf.WriteString(name)
+		}
+	}
+	return buf.String()
 }
 
 func (v variable) Children() []interface{} {
 	return nil
 }
 
+// custom is a variable matched by the custom instruction named Instr, which is compiled
+// with the arguments Args.
+type custom struct {
+	Name  string
+	Instr string
+	Args  []string
+}
+
+func (v custom) String() string {
+	s := v.Name + ":@" + v.Instr
+	if len(v.Args) > 0 {
+		s += "(" + strings.Join(v.Args, "|") + ")"
+	}
+	return s
+}
+
+func (v custom) Children() []interface{} {
+	return nil
+}
+
 type childrener interface {
 	Children() []interface{}
 }
@@ -22,10 +22,13 @@ func ensureTreesEqual(t *testing.T, exp, act interface{}) {
 		if e.Op != a.Op {
 			t.Fatalf("In parse tree: expected Rep op to be %d but found %d", e.Op, a.Op)
 		}
+		if e.Min != a.Min || e.Max != a.Max {
+			t.Fatalf("In parse tree: expected Rep count to be %d to %d but found %d to %d", e.Min, e.Max, a.Min, a.Max)
+		}
 		ensureTreesEqual(t, e.Term, a.Term)
 	case variable:
 		a := act.(variable)
-		if e.Name != a.Name || e.Type != e.Type {
+		if e.Name != a.Name || e.Type != e.Type || e.Flags != a.Flags {
 			t.Fatalf("In parse tree: expected Var to be %s but found %s", e, a)
 		}
 	case word:
@@ -33,6 +36,28 @@ func ensureTreesEqual(t *testing.T, exp, act interface{}) {
 		if string(e) != string(a) {
 			t.Fatalf("In parse tree: expected Word to be %s but found %s", string(e), string(a))
 		}
+	case exactWord:
+		a := act.(exactWord)
+		if string(e) != string(a) {
+			t.Fatalf("In parse tree: expected exact Word to be %s but found %s", string(e), string(a))
+		}
+	case aliasedWord:
+		a := act.(aliasedWord)
+		if !reflect.DeepEqual(e, a) {
+			t.Fatalf("In parse tree: expected aliased Word to be %s but found %s", e, a)
+		}
+	case group:
+		a := act.(group)
+		if e.Name != a.Name {
+			t.Fatalf("In parse tree: expected group %s but found %s", e.Name, a.Name)
+		}
+		ensureTreesEqual(t, e.Term, a.Term)
+	case set:
+		a := act.(set)
+		if !reflect.DeepEqual(e.Optional, a.Optional) {
+			t.Fatalf("In parse tree: expected set options to be optional %v but found %v", e.Optional, a.Optional)
+		}
+		ensureSliceEqual(t, e.Children(), a.Children())
 	case nil:
 		if act != nil {
 			t.Fatalf("In parse tree: expected nil but found %T", act)
@@ -224,6 +249,198 @@ func TestParser(t *testing.T) {
 			ok:    true,
 			error: "",
 		},
+		{
+			name:  "login <user> <password:str!secret>",
+			input: "login <user> <password:str!secret>",
+			expected: terms{
+				word("login"),
+				terms{
+					variable{Name: "user", Type: "str"},
+					variable{Name: "password", Type: "str", Flags: VarSecret},
+				},
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:     "<password!prompt!secret>",
+			input:    "<password!prompt!secret>",
+			expected: variable{Name: "password", Type: "str", Flags: VarPrompt | VarSecret},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "<file!nokeyword>",
+			input:    "<file!nokeyword>",
+			expected: variable{Name: "file", Type: "str", Flags: VarNoKeyword},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "<name!(all|none)>",
+			input:    "<name!(all|none)>",
+			expected: variable{Name: "name", Type: "str", Exclude: []string{"all", "none"}},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "<n:int!(0)!sensitive>",
+			input:    "<n:int!(0)!sensitive>",
+			expected: variable{Name: "n", Type: "int", Flags: VarSensitive, Exclude: []string{"0"}},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "remove!alias(rm|del)",
+			input:    "remove!alias(rm|del)",
+			expected: aliasedWord{Keyword: "remove", Aliases: []string{"rm", "del"}},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "show(logs|links)",
+			input:    "show(logs|links)",
+			expected: terms{word("show"), alts{word("logs"), word("links")}},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "show!alias (logs|links)",
+			input:    "show!alias (logs|links)",
+			expected: terms{word("show"), terms{exactWord("alias"), alts{word("logs"), word("links")}}},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:  "!remove!alias(rm) (a|b)",
+			input: "!remove!alias(rm) (a|b)",
+			expected: terms{
+				aliasedWord{Keyword: "remove", Aliases: []string{"rm"}, Exact: true},
+				alts{word("a"), word("b")},
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:  "<file>(a|b)",
+			input: "<file>(a|b)",
+			expected: terms{
+				variable{Name: "file", Type: "str"},
+				alts{word("a"), word("b")},
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:  "!delete <name>",
+			input: "!delete <name>",
+			expected: terms{
+				exactWord("delete"),
+				variable{Name: "name", Type: "str"},
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:  "get (from <host>):src?",
+			input: "get (from <host>):src?",
+			expected: terms{
+				word("get"),
+				rep{
+					Op: repeatZeroOrOne,
+					Term: group{
+						Name: "src",
+						Term: terms{
+							word("from"),
+							variable{Name: "host", Type: "str"},
+						},
+					},
+				},
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:     "<ip:int>{4}",
+			input:    "<ip:int>{4}",
+			expected: rep{Op: repeatCounted, Term: variable{Name: "ip", Type: "int"}, Min: 4, Max: 4},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "<arg>{1,3}",
+			input:    "<arg>{1,3}",
+			expected: rep{Op: repeatCounted, Term: variable{Name: "arg", Type: "str"}, Min: 1, Max: 3},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:     "(a b){2,}",
+			input:    "(a b){2,}",
+			expected: rep{Op: repeatCounted, Term: terms{word("a"), word("b")}, Min: 2, Max: -1},
+			ok:       true,
+			error:    "",
+		},
+		{
+			name:  "copy <src> { verbose? limit <n:int>? (to <dst>) }",
+			input: "copy <src> { verbose? limit <n:int>? (to <dst>) }",
+			expected: terms{
+				word("copy"),
+				terms{
+					variable{Name: "src", Type: "str"},
+					set{
+						Options: []interface{}{
+							word("verbose"),
+							terms{word("limit"), variable{Name: "n", Type: "int"}},
+							terms{word("to"), variable{Name: "dst", Type: "str"}},
+						},
+						Optional: []bool{true, true, false},
+					},
+				},
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:  "{<a> b <c>* d?}{2}",
+			input: "{<a> b <c>* d?}{2}",
+			expected: rep{
+				Op: repeatCounted,
+				Term: set{
+					Options: []interface{}{
+						variable{Name: "a", Type: "str"},
+						terms{word("b"), rep{Op: repeatZeroOrMore, Term: variable{Name: "c", Type: "str"}}},
+						word("d"),
+					},
+					Optional: []bool{false, false, true},
+				},
+				Min: 2,
+				Max: 2,
+			},
+			ok:    true,
+			error: "",
+		},
+		{
+			name:     "a { }",
+			input:    "a { }",
+			expected: nil,
+			ok:       false,
+			error:    "At character 6: expected an option in the set",
+		},
+		{
+			name:     "a { b",
+			input:    "a { b",
+			expected: nil,
+			ok:       false,
+			error:    "At character 6: expected } to close the set",
+		},
+		{
+			name:     "<mode:(fast|slow|auto)>",
+			input:    "<mode:(fast|slow|auto)>",
+			expected: variable{Name: "mode", Type: "(fast|slow|auto)"},
+			ok:       true,
+			error:    "",
+		},
 		// Failures
 		{
 			name:     "this** extra repeat",
@@ -260,6 +477,104 @@ func TestParser(t *testing.T) {
 			ok:       false,
 			error:    "At character 7: expected variable type after :",
 		},
+		{
+			name:     "<var!",
+			input:    "<var!",
+			expected: nil,
+			ok:       false,
+			error:    "At character 6: expected variable flag after !",
+		},
+		{
+			name:     "(a):",
+			input:    "(a):",
+			expected: nil,
+			ok:       false,
+			error:    "At character 5: expected group name after :",
+		},
+		{
+			name:     "a{x}",
+			input:    "a{x}",
+			expected: nil,
+			ok:       false,
+			error:    "At character 4: expected a number after {",
+		},
+		{
+			name:     "a{1",
+			input:    "a{1",
+			expected: nil,
+			ok:       false,
+			error:    "At character 4: expected } to close the count",
+		},
+		{
+			name:     "a{3,1}",
+			input:    "a{3,1}",
+			expected: nil,
+			ok:       false,
+			error:    "At character 7: the maximum of the count is less than the minimum",
+		},
+		{
+			name:     "a{x} b",
+			input:    "a{x} b",
+			expected: nil,
+			ok:       false,
+			error:    "At character 4: expected a number after {",
+		},
+		{
+			name:     "a{0}",
+			input:    "a{0}",
+			expected: nil,
+			ok:       false,
+			error:    "At character 5: the count must allow at least one repetition",
+		},
+		{
+			name:     "delete !",
+			input:    "delete !",
+			expected: nil,
+			ok:       false,
+			error:    "At character 9: expected keyword after !",
+		},
+		{
+			name:     "<var!loud>",
+			input:    "<var!loud>",
+			expected: nil,
+			ok:       false,
+			error:    "At character 10: unknown variable flag 'loud'",
+		},
+		{
+			name:     "<mode:(fast|)>",
+			input:    "<mode:(fast|)>",
+			expected: nil,
+			ok:       false,
+			error:    "At character 13: expected a value of the enumeration",
+		},
+		{
+			name:     "<mode:(fast slow)>",
+			input:    "<mode:(fast slow)>",
+			expected: nil,
+			ok:       false,
+			error:    "At character 12: expected | or ) after the value",
+		},
+		{
+			name:     "<name!(all|)>",
+			input:    "<name!(all|)>",
+			expected: nil,
+			ok:       false,
+			error:    "At character 12: expected a word to exclude",
+		},
+		{
+			name:     "remove!alias(rm|)",
+			input:    "remove!alias(rm|)",
+			expected: nil,
+			ok:       false,
+			error:    "At character 17: expected an alias",
+		},
+		{
+			name:     "<var!secret",
+			input:    "<var!secret",
+			expected: nil,
+			ok:       false,
+			error:    "At character 12: expected > to complete variable definition",
+		},
 		{
 			name:     "( word*",
 			input:    "( word*",
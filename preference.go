@@ -0,0 +1,124 @@
+package cmdparse
+
+// MatchPreference compares two matches of ambiguous input, ‘a’ and ‘b’, whose commands
+// were added in that order or are the same command. It returns a negative number if ‘a’
+// is preferred, a positive number if ‘b’ is preferred, and zero if neither is.
+type MatchPreference func(a, b MatchInfo) int
+
+// PreferKeywordOverVariable prefers the match that matched a keyword at the first word
+// that one match matched with a keyword and the other with a variable. With the commands
+// ‘get <file>’ and ‘get verbose’ it runs ‘get verbose’ for the input ‘get v’.
+var PreferKeywordOverVariable MatchPreference = func(a, b MatchInfo) int {
+	ka, kb := keywordWords(a.Match), keywordWords(b.Match)
+	for w := 0; w < len(ka) || w < len(kb); w++ {
+		inA, inB := w < len(ka) && ka[w] != "", w < len(kb) && kb[w] != ""
+		switch {
+		case inA && !inB:
+			return -1
+		case inB && !inA:
+			return 1
+		}
+	}
+	return 0
+}
+
+// PreferFirstRegistered prefers the match of the command that was added first, like the
+// FirstAddedWins collision policy. Matches of the same command are still ambiguous.
+var PreferFirstRegistered MatchPreference = func(a, b MatchInfo) int {
+	if a.Syntax != b.Syntax || a.ID != b.ID {
+		return -1
+	}
+	return 0
+}
+
+// PreferLongestKeyword prefers the match that matched the longer keyword at the first word
+// that both matched with keywords of different lengths, so that an abbreviation runs the
+// most specific keyword. With the commands ‘show int’ and ‘show interfaces’ it runs
+// ‘show interfaces’ for the input ‘sh int’.
+var PreferLongestKeyword MatchPreference = func(a, b MatchInfo) int {
+	ka, kb := keywordWords(a.Match), keywordWords(b.Match)
+	for w := 0; w < len(ka) && w < len(kb); w++ {
+		if ka[w] == "" || kb[w] == "" || len(ka[w]) == len(kb[w]) {
+			continue
+		}
+		if len(ka[w]) > len(kb[w]) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// keywordWords returns the keyword that each input word matched in ‘m’, indexed by the
+// position of the word, or empty for words that matched a variable.
+func keywordWords(m Match) []string {
+	var words []string
+	for _, kw := range m.Keywords() {
+		for len(words) <= kw.Span.Word {
+			words = append(words, "")
+		}
+		words[kw.Span.Word] = kw.Name
+	}
+	return words
+}
+
+// SetMatchPreferences sets how Parse and ParseToMatch choose between the matches of input
+// that matches in more than one way, so that benign ambiguities can still run a command
+// deterministically. One match is preferred to another by the first of ‘prefs’ that
+// prefers either, and the matches that no other match is preferred to are kept; the input
+// is only run if one remains. Preferences are applied after the collision policy and
+// before the Resolver, which is only called if the input is still ambiguous. Calling it
+// without preferences removes them.
+//
+// The preferences may be any of PreferKeywordOverVariable, PreferFirstRegistered and
+// PreferLongestKeyword, or functions that compare the matches in other ways, for example:
+//
+//    cmds.SetMatchPreferences(cmdparse.PreferKeywordOverVariable, cmdparse.PreferFirstRegistered)
+func (c *Cmds) SetMatchPreferences(prefs ...MatchPreference) {
+	c.preferences = prefs
+}
+
+// applyPreferences returns the ‘matches’ that no other match is preferred to. The matches
+// must be sorted in the order their commands were added.
+func (c *Cmds) applyPreferences(matches []match) []match {
+	if len(c.preferences) == 0 || len(matches) < 2 {
+		return matches
+	}
+
+	infos := make([]MatchInfo, len(matches))
+	for i, m := range matches {
+		infos[i] = matchInfo(m)
+	}
+	compare := func(i, j int) int {
+		for _, p := range c.preferences {
+			if r := p(infos[i], infos[j]); r != 0 {
+				return r
+			}
+		}
+		return 0
+	}
+
+	beaten := make([]bool, len(matches))
+	for i := range matches {
+		for j := i + 1; j < len(matches); j++ {
+			switch r := compare(i, j); {
+			case r < 0:
+				beaten[j] = true
+			case r > 0:
+				beaten[i] = true
+			}
+		}
+	}
+
+	var kept []match
+	for i, m := range matches {
+		if !beaten[i] {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == 0 {
+		// The preferences go round in a circle, so the input is still ambiguous
+		return matches
+	}
+	return kept
+}
@@ -0,0 +1,85 @@
+package cmdparse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchPreferences(t *testing.T) {
+	// bySyntaxLength prefers the command with the shorter definition
+	bySyntaxLength := func(a, b MatchInfo) int { return len(a.Syntax) - len(b.Syntax) }
+
+	tests := []struct {
+		name  string
+		defs  []string
+		prefs []MatchPreference
+		input string
+		// expected is the command run, or empty if the input is still ambiguous
+		expected string
+	}{
+		{"none", []string{"get <file>", "get verbose"}, nil, "get v", ""},
+		{"keyword", []string{"get <file>", "get verbose"}, []MatchPreference{PreferKeywordOverVariable}, "get v", "get verbose"},
+		{"keyword later", []string{"get <a> <b>", "get <a> now"}, []MatchPreference{PreferKeywordOverVariable}, "get x n", "get <a> now"},
+		{"keyword first word", []string{"<x> stop", "go <y>"}, []MatchPreference{PreferKeywordOverVariable}, "go stop", "go <y>"},
+		{"first", []string{"get <file>", "get verbose"}, []MatchPreference{PreferFirstRegistered}, "get v", "get <file>"},
+		{"first same command", []string{"get <a>? <b>?"}, []MatchPreference{PreferFirstRegistered}, "get x", ""},
+		{"longest", []string{"show int", "show interfaces"}, []MatchPreference{PreferLongestKeyword}, "sh in", "show interfaces"},
+		{"longest equal", []string{"show intx", "show inty"}, []MatchPreference{PreferLongestKeyword}, "sh in", ""},
+		{"chain", []string{"get <a>", "get <b>", "get verbose"}, []MatchPreference{PreferKeywordOverVariable, PreferFirstRegistered}, "get v", "get verbose"},
+		{"chain falls through", []string{"get <a>", "get <b>"}, []MatchPreference{PreferKeywordOverVariable, PreferFirstRegistered}, "get v", "get <a>"},
+		{"custom", []string{"set <a> <b>", "set <a> x"}, []MatchPreference{bySyntaxLength}, "set 1 x", "set <a> x"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var ran string
+			for _, def := range tc.defs {
+				def := def
+				cmds.Add(def, func(match Match, ctx interface{}) { ran = def })
+			}
+			cmds.SetMatchPreferences(tc.prefs...)
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if tc.expected == "" {
+				if ok {
+					t.Fatalf("Expected ‘%s’ to be ambiguous but it ran ‘%s’", tc.input, ran)
+				}
+				if _, ok := cmds.ParseErr(tc.input, nil).(*AmbiguityError); !ok {
+					t.Fatalf("Expected an *AmbiguityError for ‘%s’", tc.input)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if ran != tc.expected {
+				t.Fatalf("Expected ‘%s’ to run ‘%s’ but it ran ‘%s’", tc.input, tc.expected, ran)
+			}
+		})
+	}
+}
+
+func TestMatchPreferencesCircular(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	for _, def := range []string{"a <x>", "a <y>", "a <z>"} {
+		cmds.Add(def, cback)
+	}
+	// Each command is preferred to the next, and the last to the first
+	next := func(a, b MatchInfo) int {
+		ia, ib := strings.Index("xyz", a.Syntax[3:4]), strings.Index("xyz", b.Syntax[3:4])
+		if (ia+1)%3 == ib {
+			return -1
+		}
+		return 1
+	}
+	cmds.SetMatchPreferences(next)
+	cmds.Compile()
+
+	err := cmds.ParseErr("a 1", nil)
+	if amb, ok := err.(*AmbiguityError); !ok || len(amb.Candidates) != 3 {
+		t.Fatalf("Expected the input to be ambiguous between all three commands but got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package cmdparse
+
+// RecordedCall is a command that Parse would have run, passed to the Recorder set with
+// SetRecorder in place of calling its callback.
+type RecordedCall struct {
+	// Syntax is the definition of the command as it was passed to Add.
+	Syntax string
+	// ID is the identifier the command was added with using AddNamed, or empty.
+	ID string
+	// Bound are the keywords and variables that matched the input, in input order. The
+	// values of sensitive variables are redacted; Match has them.
+	Bound []BoundElement
+	// Match is the match that would have been passed to the callback.
+	Match Match
+	// Ctx is the context value passed to Parse.
+	Ctx interface{}
+}
+
+// Recorder receives the commands that Parse would have run.
+type Recorder func(call RecordedCall)
+
+// SetRecorder makes Parse and the other functions that run commands match the input as
+// usual, including running validators and middleware, but then pass the command to ‘rec’
+// instead of calling its callback. This lets integration tests of an application check
+// which commands its input would run, and with what values, without their side effects:
+//
+//    var calls []cmdparse.RecordedCall
+//    cmds.SetRecorder(func(call cmdparse.RecordedCall) { calls = append(calls, call) })
+//    app.HandleLine("copy a b")
+//
+// Commands added with AddWithResult return the zero Result, and those added with
+// AddWithContext return no error. Passing nil makes commands run again.
+func (c *Cmds) SetRecorder(rec Recorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.recorder = rec
+}
+
+// recorded returns a callback that passes the match ‘mm’ to the recorder ‘rec’.
+func recorded(rec Recorder, mm match) Callback {
+	cmd := mm.meta.(*command)
+	return func(match Match, ctx interface{}) {
+		rec(RecordedCall{Syntax: cmd.syntax, ID: cmd.id, Bound: boundElements(mm), Match: match, Ctx: ctx})
+	}
+}
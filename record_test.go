@@ -0,0 +1,144 @@
+package cmdparse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSetRecorder(t *testing.T) {
+	var ran []string
+	cmds := &Cmds{}
+	cmds.Add("copy <src> <dst>?", func(m Match, ctx interface{}) { ran = append(ran, "copy") })
+	cmds.AddWithResult("status", func(m Match, ctx interface{}) Result {
+		ran = append(ran, "status")
+		return Result{Status: 3}
+	})
+	cmds.AddNamed("quit", "quit")
+	cmds.Add("delete <name>", func(m Match, ctx interface{}) { ran = append(ran, "delete") })
+	cmds.SetValidator("delete <name>", func(m Match) error {
+		if m.Var("name")[0].Value == "root" {
+			return errors.New("can't delete root")
+		}
+		return nil
+	})
+	cmds.Compile()
+
+	var calls []RecordedCall
+	cmds.SetRecorder(func(call RecordedCall) { calls = append(calls, call) })
+
+	tests := []struct {
+		name   string
+		input  string
+		ok     bool
+		syntax string
+		bound  []BoundElement
+	}{
+		{
+			"callback",
+			"co a b",
+			true,
+			"copy <src> <dst>?",
+			[]BoundElement{{Element: "copy", Value: "co"}, {Element: "<src>", Value: "a"}, {Element: "<dst>", Value: "b"}},
+		},
+		{
+			"result callback",
+			"status",
+			true,
+			"status",
+			[]BoundElement{{Element: "status", Value: "status"}},
+		},
+		{
+			"named",
+			"quit",
+			true,
+			"",
+			nil,
+		},
+		{
+			"validated",
+			"delete x",
+			true,
+			"delete <name>",
+			[]BoundElement{{Element: "delete", Value: "delete"}, {Element: "<name>", Value: "x"}},
+		},
+		{
+			"invalid",
+			"delete root",
+			false,
+			"",
+			nil,
+		},
+		{
+			"no match",
+			"move a",
+			false,
+			"",
+			nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls = nil
+			if ok := cmds.Parse(tc.input, "ctx"); ok != tc.ok {
+				t.Fatalf("Parse returned %v, expected %v", ok, tc.ok)
+			}
+
+			if tc.syntax == "" {
+				if len(calls) != 0 {
+					t.Fatalf("recorded %v, expected nothing", calls)
+				}
+				return
+			}
+			if len(calls) != 1 {
+				t.Fatalf("recorded %d calls, expected 1", len(calls))
+			}
+			call := calls[0]
+			if call.Syntax != tc.syntax {
+				t.Fatalf("recorded ‘%s’, expected ‘%s’", call.Syntax, tc.syntax)
+			}
+			if !reflect.DeepEqual(call.Bound, tc.bound) {
+				t.Fatalf("recorded %v, expected %v", call.Bound, tc.bound)
+			}
+			if call.Ctx != "ctx" {
+				t.Fatalf("recorded context %v, expected ctx", call.Ctx)
+			}
+		})
+	}
+
+	if len(ran) != 0 {
+		t.Fatalf("callbacks %v ran while recording", ran)
+	}
+
+	_, res, err := cmds.ParseWithResult("status", nil)
+	if err != nil || res.Status != StatusOK {
+		t.Fatalf("ParseWithResult returned %v, %v while recording, expected the zero Result", res, err)
+	}
+
+	cmds.SetRecorder(nil)
+	calls = nil
+	cmds.Parse("copy a", nil)
+	if len(calls) != 0 || !reflect.DeepEqual(ran, []string{"copy"}) {
+		t.Fatalf("after removing the recorder recorded %v and ran %v", calls, ran)
+	}
+}
+
+func TestSetRecorderMiddleware(t *testing.T) {
+	cmds := &Cmds{}
+	cmds.Add("reboot", func(m Match, ctx interface{}) {})
+	cmds.Add("uptime", func(m Match, ctx interface{}) {})
+	cmds.UseFor("reboot", func(next Callback) Callback {
+		// Deny the command
+		return func(m Match, ctx interface{}) {}
+	})
+	cmds.Compile()
+
+	var calls []string
+	cmds.SetRecorder(func(call RecordedCall) { calls = append(calls, call.Syntax) })
+	cmds.Parse("reboot", nil)
+	cmds.Parse("uptime", nil)
+	if !reflect.DeepEqual(calls, []string{"uptime"}) {
+		t.Fatalf("recorded %v, expected the command the middleware allowed", calls)
+	}
+}
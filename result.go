@@ -0,0 +1,85 @@
+package cmdparse
+
+import "reflect"
+
+// The exit statuses returned by ExitStatus.
+const (
+	// StatusOK is the status of a command that succeeded.
+	StatusOK = 0
+	// StatusFailure is the status of a command that failed, when there is no more specific
+	// status.
+	StatusFailure = 1
+	// StatusUsage is the status of input that couldn't be run because it doesn't match
+	// a command, is ambiguous, or is invalid, as for misused shell builtins.
+	StatusUsage = 2
+)
+
+// Result is the outcome of running a command, returned by callbacks of commands added
+// with AddWithResult. It follows the convention of process exit statuses, so that scripts
+// and servers can tell whether each command succeeded.
+type Result struct {
+	// Status is zero if the command succeeded, and otherwise a code that says how it
+	// failed, like the exit status of a process.
+	Status int
+	// Message describes the outcome for the user.
+	Message string
+	// Data is any value the command produced.
+	Data interface{}
+}
+
+// OK returns true if the Result is a success.
+func (r Result) OK() bool {
+	return r.Status == StatusOK
+}
+
+// ResultCallback is a callback that returns the Result of running the command.
+type ResultCallback func(match Match, ctx interface{}) Result
+
+// resultType is the type of handlers' Results.
+var resultType = reflect.TypeOf(Result{})
+
+// AddWithResult registers the command definition ‘cmd’ like Add, with a callback that
+// returns the Result of running the command. ParseWithResult returns the Result.
+func (c *Cmds) AddWithResult(cmd string, cback ResultCallback) error {
+	t, err := c.scanAndParse(cmd)
+	if err != nil {
+		return err
+	}
+
+	c.addCommand(&command{syntax: cmd, rcback: cback, tree: t})
+	return nil
+}
+
+// ExitStatus returns the exit status for the Result ‘res’ and error ‘err’ returned by
+// ParseWithResult: the status of the Result if the command ran, StatusFailure if its
+// callback returned a *CallbackError, and otherwise StatusUsage, since every other error
+// is about input that couldn't be run as entered.
+func ExitStatus(res Result, err error) int {
+	switch err.(type) {
+	case nil:
+		return res.Status
+	case *CallbackError:
+		return StatusFailure
+	}
+	return StatusUsage
+}
+
+// HTTPStatus returns the HTTP status code for the Result ‘res’ and error ‘err’ returned
+// by ParseWithResult: 200 if the command succeeded and 500 if it failed or its callback
+// returned a *CallbackError, 422 if the input was rejected by a constraint or validator,
+// and 400 for other errors.
+func HTTPStatus(res Result, err error) int {
+	// The codes are written out rather than using net/http, which isn't otherwise needed
+	switch err.(type) {
+	case nil:
+		if res.OK() {
+			return 200
+		}
+		return 500
+	case *ConstraintError, *ValidationError:
+		return 422
+	case *CallbackError:
+		return 500
+	}
+	return 400
+}
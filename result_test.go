@@ -0,0 +1,85 @@
+package cmdparse
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseWithResult(t *testing.T) {
+	type args struct {
+		N int `cmd:"n"`
+	}
+
+	tests := []struct {
+		name   string
+		input  string
+		syntax string
+		res    Result
+		exit   int
+		http   int
+	}{
+		{"success", "copy a b", "copy <src> <dst>", Result{Message: "copied a"}, 0, 200},
+		{"failure", "copy x b", "copy <src> <dst>", Result{Status: 4, Message: "x is missing"}, 4, 500},
+		{"bound", "count 3", "count <n:int>", Result{Data: 6}, 0, 200},
+		{"plain callback", "ping", "ping", Result{}, 0, 200},
+		{"no match", "bogus", "", Result{}, StatusUsage, 400},
+		{"ambiguous", "p", "", Result{}, StatusUsage, 400},
+		{"constraint", "copy a a", "", Result{}, StatusUsage, 422},
+		{"validation", "count 0", "", Result{}, StatusUsage, 422},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.AddWithResult("copy <src> <dst>", func(match Match, ctx interface{}) Result {
+				src := match.Var("src")[0].Value
+				if src == "x" {
+					return Result{Status: 4, Message: "x is missing"}
+				}
+				return Result{Message: "copied " + src}
+			})
+			cmds.AddConstraint("copy <src> <dst>", "src != dst")
+			err := cmds.AddBound("count <n:int>", func(a args, ctx interface{}) Result {
+				return Result{Data: a.N * 2}
+			})
+			if err != nil {
+				t.Fatalf("AddBound failed: %v", err)
+			}
+			cmds.SetValidator("count <n:int>", func(m Match) error {
+				if n, _ := m.Var("n")[0].Int(); n <= 0 {
+					return fmt.Errorf("the count must be positive")
+				}
+				return nil
+			})
+			cmds.Add("ping", func(match Match, ctx interface{}) {})
+			cmds.Add("pong", func(match Match, ctx interface{}) {})
+			cmds.Compile()
+
+			info, res, err := cmds.ParseWithResult(tc.input, nil)
+			if tc.syntax != "" && err != nil {
+				t.Fatalf("ParseWithResult failed: %v", err)
+			}
+			if info.Syntax != tc.syntax {
+				t.Fatalf("Expected the command ‘%s’ but got ‘%s’", tc.syntax, info.Syntax)
+			}
+			if res != tc.res {
+				t.Fatalf("Expected the result %+v but got %+v", tc.res, res)
+			}
+			if s := ExitStatus(res, err); s != tc.exit {
+				t.Fatalf("Expected the exit status %d but got %d", tc.exit, s)
+			}
+			if s := HTTPStatus(res, err); s != tc.http {
+				t.Fatalf("Expected the HTTP status %d but got %d", tc.http, s)
+			}
+		})
+	}
+}
+
+func TestAddBoundResultErrors(t *testing.T) {
+	var cmds Cmds
+	type args struct{}
+	err := cmds.AddBound("x", func(a args, ctx interface{}) error { return nil })
+	if err == nil {
+		t.Fatalf("AddBound accepted a handler that returns an error rather than a Result")
+	}
+}
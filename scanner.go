@@ -20,6 +20,9 @@ type token struct {
 	// pos is the index of the rune in the input
 	// where the token started
 	pos int
+	// size is the number of runes of the input a word token was scanned from, which
+	// differs from the length of the value when it's quoted or has escapes
+	size int
 }
 
 func (t token) tokenType() tokenType {
@@ -28,6 +31,9 @@ func (t token) tokenType() tokenType {
 
 func (t token) len() int {
 	if t.typ == wordTok {
+		if t.size > 0 {
+			return t.size
+		}
 		return len(t.value)
 	} else {
 		return 1
@@ -107,11 +113,37 @@ func (s *scanner) next() (tok token, err error) {
 	case ':':
 		s.pos++
 		tok.typ = colonTok
+	case '!':
+		s.pos++
+		tok.typ = bangTok
+	case '{':
+		s.pos++
+		tok.typ = leftBraceTok
+	case '}':
+		s.pos++
+		tok.typ = rightBraceTok
+	case ',':
+		s.pos++
+		tok.typ = commaTok
+	case '@':
+		s.pos++
+		tok.typ = atTok
+	case '"':
+		p := s.pos
+		tok, err = s.quoted()
+		if err != nil {
+			missing := ""
+			if s.atEnd() {
+				missing = `"`
+			}
+			return tok, s.errorFrom(p, missing, err)
+		}
+		tok.pos = p
 	default:
 		p := s.pos
 		tok, err = s.word()
 		if err != nil {
-			return
+			return tok, s.errorFrom(p, "", err)
 		}
 		tok.pos = p
 	}
@@ -119,30 +151,76 @@ func (s *scanner) next() (tok token, err error) {
 	return tok, nil
 }
 
+// errorFrom returns the error ‘err’ about the input from the rune at ‘start’ up to the
+// current position, where the text ‘missing’ would fix it.
+func (s *scanner) errorFrom(start int, missing string, err error) error {
+	return &definitionError{start: start, end: s.pos, msg: err.Error(), missing: missing, err: err}
+}
+
 func (s *scanner) atEnd() bool {
 	return s.pos >= len(s.input)
 }
 
 func (s *scanner) word() (token, error) {
 	var buf bytes.Buffer
+	start := s.pos
 	r := s.input[s.pos]
 
-	if !s.isValidWordRune(r) {
+	if !s.isValidWordRune(r) && r != '\\' {
 		s.pos++ // Consume this bad character
 		return nilToken, fmt.Errorf("Invalid character '%c' encountered", r)
 	}
 
-	for s.isValidWordRune(r) {
+	for s.isValidWordRune(r) || r == '\\' {
+		if r == '\\' {
+			// A backslash makes the next character part of the word
+			s.pos++
+			if s.atEnd() {
+				return nilToken, fmt.Errorf("Expected a character after the backslash at character %d", s.pos)
+			}
+			r = s.input[s.pos]
+		}
 		buf.WriteRune(r)
 		s.pos++
 
 		if s.atEnd() {
-			return token{typ: wordTok, value: buf.String()}, nil
+			break
 		}
 		r = s.input[s.pos]
 	}
 
-	return token{typ: wordTok, value: buf.String()}, nil
+	return token{typ: wordTok, value: buf.String(), size: s.pos - start}, nil
+}
+
+// quoted scans a keyword in double quotes, which may contain any characters. Within the
+// quotes a backslash makes the next character part of the keyword, so that it can contain
+// a double quote.
+func (s *scanner) quoted() (token, error) {
+	var buf bytes.Buffer
+	start := s.pos
+	s.pos++ // The opening quote
+
+	for !s.atEnd() {
+		r := s.input[s.pos]
+		s.pos++
+
+		switch r {
+		case '"':
+			if buf.Len() == 0 {
+				return nilToken, fmt.Errorf("Empty quotes at character %d", start+1)
+			}
+			return token{typ: wordTok, value: buf.String(), size: s.pos - start}, nil
+		case '\\':
+			if s.atEnd() {
+				break
+			}
+			r = s.input[s.pos]
+			s.pos++
+		}
+		buf.WriteRune(r)
+	}
+
+	return nilToken, fmt.Errorf("Unterminated quote starting at character %d", start+1)
 }
 
 func (s *scanner) isValidWordRune(r rune) bool {
@@ -170,6 +248,11 @@ const (
 	leftParenTok
 	rightParenTok
 	colonTok
+	bangTok
+	leftBraceTok
+	rightBraceTok
+	commaTok
+	atTok
 
 	wordTok
 )
@@ -196,6 +279,16 @@ func (t tokenType) String() string {
 		return "rightParenTok"
 	case colonTok:
 		return "colonTok"
+	case bangTok:
+		return "bangTok"
+	case leftBraceTok:
+		return "leftBraceTok"
+	case rightBraceTok:
+		return "rightBraceTok"
+	case commaTok:
+		return "commaTok"
+	case atTok:
+		return "atTok"
 	case wordTok:
 		return "wordTok"
 	}
@@ -92,12 +92,61 @@ func TestScanner(t *testing.T) {
 			ok:       true,
 			errors:   []string{},
 		},
+		{
+			name:     "<p!secret>",
+			input:    "<p!secret>",
+			expected: []token{{typ: lessThanTok}, {typ: wordTok, value: "p"}, {typ: bangTok}, {typ: wordTok, value: "secret"}, {typ: greaterThanTok}},
+			ok:       true,
+			errors:   []string{},
+		},
+		{
+			name:     "a{1,3}",
+			input:    "a{1,3}",
+			expected: []token{{typ: wordTok, value: "a"}, {typ: leftBraceTok}, {typ: wordTok, value: "1"}, {typ: commaTok}, {typ: wordTok, value: "3"}, {typ: rightBraceTok}},
+			ok:       true,
+			errors:   []string{},
+		},
 		{
 			name:     "alts with quotes",
 			input:    "set \"<a>\"",
+			expected: []token{{typ: wordTok, value: "set"}, {typ: wordTok, value: "<a>"}},
+			ok:       true,
+			errors:   []string{},
+		},
+		{
+			name:     "quoted with escapes",
+			input:    `"say \"hi\" \\ (now)"`,
+			expected: []token{{typ: wordTok, value: `say "hi" \ (now)`}},
+			ok:       true,
+			errors:   []string{},
+		},
+		{
+			name:     "escapes",
+			input:    `a\|b \<c`,
+			expected: []token{{typ: wordTok, value: "a|b"}, {typ: wordTok, value: "<c"}},
+			ok:       true,
+			errors:   []string{},
+		},
+		{
+			name:     "unterminated quote",
+			input:    `say "hi`,
+			expected: nil,
+			ok:       false,
+			errors:   []string{"Unterminated quote starting at character 5"},
+		},
+		{
+			name:     "empty quotes",
+			input:    `say ""`,
+			expected: nil,
+			ok:       false,
+			errors:   []string{"Empty quotes at character 5"},
+		},
+		{
+			name:     "trailing backslash",
+			input:    `say\`,
 			expected: nil,
 			ok:       false,
-			errors:   []string{"Invalid character '\"' encountered", "Invalid character '\"' encountered"},
+			errors:   []string{"Expected a character after the backslash at character 4"},
 		},
 	}
 
@@ -0,0 +1,291 @@
+package cmdparse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Script runs batches of commands against a Cmds, one command per line. In addition to the
+// registered commands a script may use a few built-in constructs:
+//
+//    # a comment
+//    let <name> <value>
+//    if <condition> then
+//      ...
+//    else
+//      ...
+//    end
+//
+// A variable set using let is substituted wherever $name or ${name} appears in a later line.
+// The condition of an if is a command registered with AddCondition. Blocks may be nested.
+//
+// The built-in words are matched exactly and are checked before the registered commands, so
+// a command whose first keyword is ‘if’, ‘else’, ‘end’ or ‘let’ can't be run from a script.
+type Script struct {
+	cmds  *Cmds
+	conds Cmds
+	vars  map[string]string
+
+	// condResult is set by the condition callback wrappers when a condition is parsed
+	condResult bool
+}
+
+// Condition is a function that gets called when the condition of an if is evaluated. It
+// returns whether the condition holds.
+type Condition func(match Match, ctx interface{}) bool
+
+// NewScript returns a Script that runs the commands registered in ‘cmds’. The Cmds must
+// already be compiled.
+func NewScript(cmds *Cmds) *Script {
+	return &Script{
+		cmds: cmds,
+		vars: make(map[string]string),
+	}
+}
+
+// AddCondition registers the condition definition ‘cmd’ for use in an if. The syntax is the
+// same as for Cmds.Add. When the condition is matched, ‘cond’ is called to evaluate it.
+func (s *Script) AddCondition(cmd string, cond Condition) error {
+	return s.conds.Add(cmd, func(match Match, ctx interface{}) {
+		s.condResult = cond(match, ctx)
+	})
+}
+
+// Compile compiles the registered conditions. It must be called after the last call to
+// AddCondition and before Run.
+func (s *Script) Compile() {
+	s.conds.Compile()
+}
+
+// Var returns the value of the script variable ‘name’, and whether it was set.
+func (s *Script) Var(name string) (value string, ok bool) {
+	value, ok = s.vars[name]
+	return
+}
+
+// Run executes the script read from ‘r’, passing ‘ctx’ to the callbacks. It stops at the
+// first line that fails and returns an error that includes the line number.
+func (s *Script) Run(r io.Reader, ctx interface{}) error {
+	var blocks scriptBlocks
+	lineNo := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		err := s.runLine(scanner.Text(), lineNo, &blocks, ctx)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(blocks) > 0 {
+		return fmt.Errorf("line %d: missing end for the if on line %d", lineNo, blocks.top().line)
+	}
+
+	return nil
+}
+
+func (s *Script) runLine(line string, lineNo int, blocks *scriptBlocks, ctx interface{}) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return nil
+	}
+
+	switch fields[0] {
+	case "if":
+		if len(fields) < 3 || fields[len(fields)-1] != "then" {
+			return fmt.Errorf("expected ‘if <condition> then’")
+		}
+		if !blocks.active() {
+			// Don't evaluate conditions in blocks that are skipped
+			blocks.push(scriptBlock{line: lineNo, parentActive: false})
+			return nil
+		}
+		cond := strings.TrimSpace(line)
+		cond = strings.TrimSpace(cond[len("if") : len(cond)-len("then")])
+		taken, err := s.evalCondition(cond, ctx)
+		if err != nil {
+			return err
+		}
+		blocks.push(scriptBlock{line: lineNo, parentActive: true, taken: taken})
+	case "else":
+		if len(fields) != 1 {
+			return fmt.Errorf("unexpected words after else")
+		}
+		if len(*blocks) == 0 {
+			return fmt.Errorf("else without if")
+		}
+		b := blocks.top()
+		if b.inElse {
+			return fmt.Errorf("more than one else for the if on line %d", b.line)
+		}
+		b.inElse = true
+	case "end":
+		if len(fields) != 1 {
+			return fmt.Errorf("unexpected words after end")
+		}
+		if len(*blocks) == 0 {
+			return fmt.Errorf("end without if")
+		}
+		blocks.pop()
+	case "let":
+		if !blocks.active() {
+			return nil
+		}
+		return s.let(line)
+	default:
+		if !blocks.active() {
+			return nil
+		}
+		cmd, err := s.substitute(line)
+		if err != nil {
+			return err
+		}
+		if !s.cmds.Parse(cmd, ctx) {
+			return fmt.Errorf("no command matched ‘%s’", strings.TrimSpace(cmd))
+		}
+	}
+
+	return nil
+}
+
+func (s *Script) evalCondition(cond string, ctx interface{}) (bool, error) {
+	cond, err := s.substitute(cond)
+	if err != nil {
+		return false, err
+	}
+
+	s.condResult = false
+	if !s.conds.Parse(cond, ctx) {
+		return false, fmt.Errorf("no condition matched ‘%s’", cond)
+	}
+	return s.condResult, nil
+}
+
+func (s *Script) let(line string) error {
+	rest := strings.TrimSpace(line)[len("let"):]
+	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+
+	i := strings.IndexFunc(rest, unicode.IsSpace)
+	if i < 0 {
+		return fmt.Errorf("expected ‘let <name> <value>’")
+	}
+	name := rest[:i]
+	if !isScriptVarName(name) {
+		return fmt.Errorf("invalid variable name ‘%s’", name)
+	}
+
+	value, err := s.substitute(strings.TrimSpace(rest[i:]))
+	if err != nil {
+		return err
+	}
+	s.vars[name] = value
+	return nil
+}
+
+// substitute replaces references to script variables in ‘line’ with their values.
+func (s *Script) substitute(line string) (string, error) {
+	var buf strings.Builder
+	runes := []rune(line)
+
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '$' {
+			buf.WriteRune(runes[i])
+			continue
+		}
+
+		var name string
+		if i+1 < len(runes) && runes[i+1] == '{' {
+			end := i + 2
+			for end < len(runes) && runes[end] != '}' {
+				end++
+			}
+			if end >= len(runes) {
+				return "", fmt.Errorf("missing } in variable reference")
+			}
+			name = string(runes[i+2 : end])
+			i = end
+		} else {
+			end := i + 1
+			for end < len(runes) && isScriptVarRune(runes[end]) {
+				end++
+			}
+			name = string(runes[i+1 : end])
+			i = end - 1
+		}
+
+		if name == "" {
+			// A lone $ is left alone
+			buf.WriteRune('$')
+			continue
+		}
+
+		v, ok := s.vars[name]
+		if !ok {
+			return "", fmt.Errorf("undefined variable ‘%s’", name)
+		}
+		buf.WriteString(v)
+	}
+
+	return buf.String(), nil
+}
+
+func isScriptVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !isScriptVarRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isScriptVarRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// scriptBlock is the state of an if that is being executed
+type scriptBlock struct {
+	// line is the line number of the if
+	line int
+	// parentActive is true if the block containing the if is being executed
+	parentActive bool
+	// taken is the result of the condition
+	taken  bool
+	inElse bool
+}
+
+func (b scriptBlock) active() bool {
+	return b.parentActive && b.taken != b.inElse
+}
+
+type scriptBlocks []scriptBlock
+
+func (b *scriptBlocks) push(blk scriptBlock) {
+	*b = append(*b, blk)
+}
+
+func (b *scriptBlocks) pop() {
+	*b = (*b)[:len(*b)-1]
+}
+
+func (b scriptBlocks) top() *scriptBlock {
+	return &b[len(b)-1]
+}
+
+// active returns true if the lines in the current block should be executed.
+func (b scriptBlocks) active() bool {
+	if len(b) == 0 {
+		return true
+	}
+	return b.top().active()
+}
@@ -0,0 +1,159 @@
+package cmdparse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		ok       bool
+		error    string
+		expected []string
+	}{
+		{
+			name: "commands and comments",
+			script: `
+				# say things
+				say hello
+				say there
+			`,
+			ok:       true,
+			expected: []string{"hello", "there"},
+		},
+		{
+			name: "let",
+			script: `
+				let who world
+				say $who
+				say ${who}s
+			`,
+			ok:       true,
+			expected: []string{"world", "worlds"},
+		},
+		{
+			name: "if true",
+			script: `
+				if is on then
+					say yes
+				else
+					say no
+				end
+				say done
+			`,
+			ok:       true,
+			expected: []string{"yes", "done"},
+		},
+		{
+			name: "if false",
+			script: `
+				if is off then
+					say yes
+				else
+					say no
+				end
+			`,
+			ok:       true,
+			expected: []string{"no"},
+		},
+		{
+			name: "nested",
+			script: `
+				let state on
+				if is off then
+					if is $state then
+						say a
+					end
+				else
+					if is $state then
+						say b
+					else
+						say c
+					end
+				end
+			`,
+			ok:       true,
+			expected: []string{"b"},
+		},
+		{
+			name: "skipped lines are not checked",
+			script: `
+				if is off then
+					bogus $undefined
+				end
+			`,
+			ok: true,
+		},
+		{
+			name: "bad command",
+			script: `say hi
+				bogus`,
+			ok:       false,
+			error:    "line 2: no command matched ‘bogus’",
+			expected: []string{"hi"},
+		},
+		{
+			name:   "undefined variable",
+			script: `say $nope`,
+			ok:     false,
+			error:  "line 1: undefined variable ‘nope’",
+		},
+		{
+			name: "missing end",
+			script: `if is on then
+				say hi`,
+			ok:       false,
+			error:    "line 2: missing end for the if on line 1",
+			expected: []string{"hi"},
+		},
+		{
+			name:   "end without if",
+			script: `end`,
+			ok:     false,
+			error:  "line 1: end without if",
+		},
+		{
+			name:   "unknown condition",
+			script: `if maybe then`,
+			ok:     false,
+			error:  "line 1: no condition matched ‘maybe’",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var said []string
+
+			cmds.Add("say <what>", func(match Match, ctx interface{}) {
+				said = append(said, match.Var("what")[0].Value)
+			})
+			cmds.Compile()
+
+			s := NewScript(&cmds)
+			s.AddCondition("is <state>", func(match Match, ctx interface{}) bool {
+				return match.Var("state")[0].Value == "on"
+			})
+			s.Compile()
+
+			err := s.Run(strings.NewReader(tc.script), nil)
+			if tc.ok && err != nil {
+				t.Fatalf("Run failed when it should succeed. Error: %v", err)
+			}
+			if !tc.ok {
+				if err == nil {
+					t.Fatalf("Run succeeded when it should have failed")
+				}
+				if err.Error() != tc.error {
+					t.Fatalf("Run failed as expected, but with wrong error. Expected '%s' but got '%s'", tc.error, err.Error())
+				}
+			}
+
+			if strings.Join(said, ",") != strings.Join(tc.expected, ",") {
+				t.Fatalf("Expected %v to be said but %v was", tc.expected, said)
+			}
+		})
+	}
+}
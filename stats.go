@@ -0,0 +1,43 @@
+package cmdparse
+
+// Stats counts the work done to match input against the commands, as returned by
+// Cmds.Stats. Dividing the counts by Inputs gives the work per Parse, which shows the
+// effect of changes to the commands or of options such as Optimize.
+type Stats struct {
+	// Inputs is the number of inputs matched, by Parse and the other methods that match
+	// input against the commands, such as ParseToMatch and Classify.
+	Inputs int64
+	// Threads is the number of VM threads started, including the first thread of each
+	// program that was run.
+	Threads int64
+	// Instructions is the number of VM instructions executed.
+	Instructions int64
+	// Matches is the number of matches found, including those of only the start of an
+	// input and those of every command for ambiguous input.
+	Matches int64
+}
+
+// PerInput returns the average number of threads started, instructions executed and
+// matches found for each input.
+func (s Stats) PerInput() (threads, instructions, matches float64) {
+	if s.Inputs == 0 {
+		return 0, 0, 0
+	}
+	n := float64(s.Inputs)
+	return float64(s.Threads) / n, float64(s.Instructions) / n, float64(s.Matches) / n
+}
+
+// Stats returns the counts of the work done matching input since the Cmds was created or
+// ResetStats was last called.
+func (c *Cmds) Stats() Stats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.stats
+}
+
+// ResetStats sets the counts returned by Stats to zero.
+func (c *Cmds) ResetStats() {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats = Stats{}
+}
@@ -0,0 +1,55 @@
+package cmdparse
+
+import "testing"
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		optimize bool
+		expected Stats
+	}{
+		{"none", nil, false, Stats{}},
+		{"one", []string{"get a"}, false, Stats{Inputs: 1, Threads: 2, Instructions: 7, Matches: 1}},
+		{"no match", []string{"zap"}, false, Stats{Inputs: 1, Threads: 2, Instructions: 5}},
+		{"two", []string{"get a", "put a b"}, false, Stats{Inputs: 2, Threads: 6, Instructions: 21, Matches: 3}},
+		// Only the program of ‘put’ runs
+		{"optimized", []string{"put a b"}, true, Stats{Inputs: 1, Threads: 3, Instructions: 9, Matches: 2}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cback := func(match Match, ctx interface{}) {}
+			cmds.Add("get <file>", cback)
+			cmds.Add("put <file>+", cback)
+			cmds.Compile()
+			if tc.optimize {
+				cmds.Optimize()
+			}
+
+			for _, input := range tc.inputs {
+				cmds.Parse(input, nil)
+			}
+			stats := cmds.Stats()
+			if stats != tc.expected {
+				t.Fatalf("Expected the stats %+v but got %+v", tc.expected, stats)
+			}
+
+			cmds.ResetStats()
+			if stats := cmds.Stats(); stats != (Stats{}) {
+				t.Fatalf("Expected no stats after ResetStats but got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestStatsPerInput(t *testing.T) {
+	threads, instrs, matches := Stats{Inputs: 4, Threads: 10, Instructions: 30, Matches: 2}.PerInput()
+	if threads != 2.5 || instrs != 7.5 || matches != 0.5 {
+		t.Fatalf("Expected 2.5, 7.5 and 0.5 per input but got %v, %v and %v", threads, instrs, matches)
+	}
+	if threads, instrs, matches := (Stats{}).PerInput(); threads != 0 || instrs != 0 || matches != 0 {
+		t.Fatalf("Expected no work per input without inputs but got %v, %v and %v", threads, instrs, matches)
+	}
+}
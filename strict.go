@@ -0,0 +1,171 @@
+package cmdparse
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CompileStrict compiles the commands like Compile, and then checks the whole set of
+// commands for problems that make some of them unusable, so that a program can refuse to
+// start, or a test can fail, rather than users finding them. It returns a *CompileError
+// listing commands that are the same as an earlier one, variables whose type isn't known
+// and so match any word, variables whose custom instruction isn't known or fails to
+// compile and so match no words, commands that can't be run because every input tried also
+// matches other commands, and pairs of commands that some input matches both of, unless
+// the collision policy chooses between them.
+//
+// The warnings are those that Compile returns, apart from collisions and invalid
+// instructions which are in the error. Commands are checked using inputs made from the
+// paths through them like Analyze, which takes much longer than compiling them.
+func (c *Cmds) CompileStrict() (Warnings, error) {
+	var warnings, problems Warnings
+	for _, w := range c.Compile() {
+		switch w.Kind {
+		case CollisionWarning:
+		case InstructionWarning:
+			problems = append(problems, w)
+		default:
+			warnings = append(warnings, w)
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bad := make(map[*command]bool)
+	for i, cmd := range c.commands {
+		for _, other := range c.commands[:i] {
+			if cmd.sharesGrammar(other) && reflect.DeepEqual(cmd.tree, other.tree) {
+				problems = append(problems, Warning{
+					Kind:    DuplicateCommandWarning,
+					Syntax:  cmd.syntax,
+					Message: fmt.Sprintf("the command is the same as ‘%s’", other.syntax),
+				})
+				bad[cmd] = true
+				break
+			}
+		}
+
+		for _, v := range variables(cmd.tree) {
+			if lookupType(v.Type, c.types) == nil {
+				problems = append(problems, Warning{
+					Kind:    UnknownTypeWarning,
+					Syntax:  cmd.syntax,
+					Message: fmt.Sprintf("the type ‘%s’ of <%s> isn't known, so it matches any word", v.Type, v.Name),
+				})
+			}
+		}
+	}
+
+	problems = append(problems, c.unreachableWarnings(bad)...)
+	if c.collisionPolicy == AmbiguousCollisions || c.collisionPolicy == ReportCollisions {
+		problems = append(problems, c.collisionWarnings(bad)...)
+	}
+	if len(problems) == 0 {
+		return warnings, nil
+	}
+
+	order := make(map[string]int)
+	for i := len(c.commands) - 1; i >= 0; i-- {
+		order[c.commands[i].syntax] = i
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return order[problems[i].Syntax] < order[problems[j].Syntax]
+	})
+	return warnings, &CompileError{Problems: problems}
+}
+
+// unreachableWarnings returns an UnreachableCommandWarning for each command, other than
+// those in ‘skip’, that none of the inputs made from the paths through it would run. The
+// commands in ‘skip’ are left out of the matches, so that a command isn't reported
+// because of its duplicate. Commands that aren't run are added to ‘skip’ afterwards.
+func (c *Cmds) unreachableWarnings(skip map[*command]bool) (w Warnings) {
+	prog := c.program().instrs
+	sample := analysisStrSample(prog)
+
+	var unreachable []*command
+	for _, cmd := range c.commands {
+		if skip[cmd] {
+			continue
+		}
+
+		tried, reachable := 0, false
+		var conflict *command
+		for _, path := range analysisPaths(prog, c.spanOf(cmd).Start) {
+			if i := restIndex(path); i >= 0 && i < len(path)-1 {
+				continue
+			}
+			input, ok := analysisInput(path, sample)
+			if !ok {
+				continue
+			}
+
+			var matches []match
+			for _, m := range c.match(input, ParseOptions{}) {
+				if !skip[m.meta.(*command)] {
+					matches = append(matches, m)
+				}
+			}
+			if !matchesCommand(matches, cmd) {
+				// The sample values don't lead to the command
+				continue
+			}
+			tried++
+			if len(matches) > 1 {
+				c.sortByAddOrder(matches)
+				matches = c.applyCollisionPolicy(matches)
+				matches = c.applyPreferences(matches)
+			}
+			if len(matches) == 1 && matches[0].meta.(*command) == cmd {
+				reachable = true
+				break
+			}
+			for _, m := range matches {
+				if other := m.meta.(*command); other != cmd && conflict == nil {
+					conflict = other
+				}
+			}
+		}
+		if tried == 0 || reachable {
+			continue
+		}
+
+		msg := "every input tried matches the command in more than one way"
+		if conflict != nil {
+			msg = fmt.Sprintf("every input tried also matches other commands, such as ‘%s’", conflict.syntax)
+		}
+		w = append(w, Warning{Kind: UnreachableCommandWarning, Syntax: cmd.syntax, Message: msg})
+		unreachable = append(unreachable, cmd)
+	}
+	for _, cmd := range unreachable {
+		skip[cmd] = true
+	}
+	return
+}
+
+// matchesCommand returns true if one of the ‘matches’ is of ‘cmd’.
+func matchesCommand(matches []match, cmd *command) bool {
+	for _, m := range matches {
+		if m.meta.(*command) == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+// CompileError is the error returned by CompileStrict when some of the commands are
+// unusable.
+type CompileError struct {
+	// Problems are the problems found, by command in the order the commands were added.
+	Problems Warnings
+}
+
+func (e *CompileError) Error() string {
+	s := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		s[i] = p.String()
+	}
+	return strings.Join(s, "\n")
+}
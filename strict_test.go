@@ -0,0 +1,118 @@
+package cmdparse
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompileStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		defs     []string
+		policy   CollisionPolicy
+		problems []string
+	}{
+		{
+			"no problems",
+			[]string{"show logs", "set <name> <value:int>", "copy <src> <dst>?"},
+			AmbiguousCollisions,
+			nil,
+		},
+		{
+			"duplicate",
+			[]string{"show logs", "show  logs"},
+			AmbiguousCollisions,
+			[]string{"duplicate command in ‘show  logs’: the command is the same as ‘show logs’"},
+		},
+		{
+			"unknown type",
+			[]string{"ping <host:ipv4>"},
+			AmbiguousCollisions,
+			[]string{"unknown type in ‘ping <host:ipv4>’: the type ‘ipv4’ of <host> isn't known, so it matches any word"},
+		},
+		{
+			"unreachable",
+			[]string{"get <file>", "get <n:int>"},
+			FirstAddedWins,
+			[]string{"unreachable command in ‘get <n:int>’: every input tried also matches other commands, such as ‘get <file>’"},
+		},
+		{
+			"ambiguous with itself",
+			[]string{"get (<a> | <b>)"},
+			AmbiguousCollisions,
+			[]string{"unreachable command in ‘get (<a> | <b>)’: every input tried matches the command in more than one way"},
+		},
+		{
+			"ambiguous",
+			[]string{"get <file>", "get verbose"},
+			AmbiguousCollisions,
+			[]string{"unreachable command in ‘get verbose’: every input tried also matches other commands, such as ‘get <file>’"},
+		},
+		{
+			"collision",
+			[]string{"get <file>", "get verbose <n:int>?"},
+			AmbiguousCollisions,
+			[]string{"collision in ‘get verbose <n:int>?’: input such as ‘get verbose’ also matches ‘get <file>’"},
+		},
+		{
+			"collision resolved by the policy",
+			[]string{"get verbose", "get <file>"},
+			FirstAddedWins,
+			nil,
+		},
+		{
+			"in command order",
+			[]string{"a <x:nope>", "b", "b", "c <y:nope>"},
+			AmbiguousCollisions,
+			[]string{
+				"unknown type in ‘a <x:nope>’: the type ‘nope’ of <x> isn't known, so it matches any word",
+				"duplicate command in ‘b’: the command is the same as ‘b’",
+				"unknown type in ‘c <y:nope>’: the type ‘nope’ of <y> isn't known, so it matches any word",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			for _, def := range tc.defs {
+				if err := cmds.Add(def, func(m Match, ctx interface{}) {}); err != nil {
+					t.Fatalf("adding ‘%s’ failed: %v", def, err)
+				}
+			}
+			cmds.SetCollisionPolicy(tc.policy)
+
+			_, err := cmds.CompileStrict()
+			var problems []string
+			if err != nil {
+				var ce *CompileError
+				if !errors.As(err, &ce) {
+					t.Fatalf("returned the error %v", err)
+				}
+				for _, p := range ce.Problems {
+					problems = append(problems, p.String())
+				}
+			}
+			if !reflect.DeepEqual(problems, tc.problems) {
+				t.Fatalf("found %q, expected %q", problems, tc.problems)
+			}
+		})
+	}
+}
+
+func TestCompileStrictWarnings(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("show (logs | lo)", func(m Match, ctx interface{}) {})
+	cmds.Add("get <file>", func(m Match, ctx interface{}) {})
+	cmds.Add("get verbose", func(m Match, ctx interface{}) {})
+	cmds.SetCollisionPolicy(ReportCollisions)
+
+	warnings, err := cmds.CompileStrict()
+	if len(warnings) != 1 || warnings[0].Kind != ShadowedKeywordWarning {
+		t.Fatalf("returned the warnings %v, expected only the shadowed keyword", warnings)
+	}
+	if err == nil {
+		t.Fatalf("the collision wasn't returned as an error")
+	}
+}
@@ -0,0 +1,77 @@
+package cmdparse
+
+import "sort"
+
+// maxSuggestions is the most keywords LongestMatch suggests for a misspelled word.
+const maxSuggestions = 3
+
+// suggestions returns the keywords in ‘keywords’ that ‘word’ may be a misspelling of, the
+// closest first. Short words aren't corrected, since most keywords are a few edits from
+// them.
+func suggestions(word string, keywords []string) []string {
+	max := 2
+	switch n := len([]rune(word)); {
+	case n < 3:
+		return nil
+	case n < 6:
+		max = 1
+	}
+
+	type candidate struct {
+		keyword  string
+		distance int
+	}
+	var cands []candidate
+	for _, kw := range keywords {
+		if d := editDistance(word, kw); d <= max {
+			cands = append(cands, candidate{kw, d})
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return cands[i].distance < cands[j].distance })
+
+	var sugg []string
+	for _, c := range cands {
+		if len(sugg) == maxSuggestions {
+			break
+		}
+		sugg = appendUnique(sugg, c.keyword)
+	}
+	return sugg
+}
+
+// editDistance returns the number of runes that must be inserted, deleted, replaced, or
+// swapped with the next one to turn ‘a’ into ‘b’.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+
+	// d[i][j] is the distance between the first i runes of s and the first j of t
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
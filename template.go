@@ -0,0 +1,44 @@
+package cmdparse
+
+import "strings"
+
+// Template returns the matched command with each keyword written in full and each variable
+// replaced by its name in angle brackets, as in:
+//
+//    interface <name> mtu <n>
+//
+// Values repeated by a * or + in a row are written once followed by ..., as in
+// ‘load <file>...’. The Template doesn't contain anything the user entered, so logs and
+// metrics can count commands by their shape without recording user data. It's empty if
+// the MatchInfo has no Match.
+func (m MatchInfo) Template() string {
+	cm, ok := m.Match.(cmdMatch)
+	if !ok {
+		return ""
+	}
+
+	var elems []string
+	repeated := false
+	for i, item := range cm.items {
+		var elem string
+		switch w := item.(type) {
+		case keywordValue:
+			elem = quoteIfNeeded(w.Name)
+		case VarValue:
+			elem = "<" + w.Name + ">"
+			if i > 0 && cm.instrs[i] == cm.instrs[i-1] {
+				repeated = true
+				continue
+			}
+		}
+		if repeated {
+			elems[len(elems)-1] += "..."
+			repeated = false
+		}
+		elems = append(elems, elem)
+	}
+	if repeated {
+		elems[len(elems)-1] += "..."
+	}
+	return strings.Join(elems, " ")
+}
@@ -0,0 +1,41 @@
+package cmdparse
+
+import "testing"
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   string
+		input    string
+		template string
+	}{
+		{"keywords and variables", "interface <name> mtu <n:int>", "int eth0 mtu 1500", "interface <name> mtu <n>"},
+		{"alias", "remove!alias(rm) <file>", "rm a", "remove <file>"},
+		{"repeated", "load <n:int>* (verbose)?", "load 1 2 3 verbose", "load <n>... verbose"},
+		{"not repeated", "load <file>* (verbose)?", "load a", "load <file>"},
+		{"different variables", "copy <src> <dst>", "copy a b", "copy <src> <dst>"},
+		{"rest", "run <cmd:rest>", "run ls -l", "run <cmd>"},
+		{"secret", "login <user> <password!secret>", "login me hunter2", "login <user> <password>"},
+		{"quoted keyword", `"show all" <x>`, `"show all" x`, `"show all" <x>`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			cmds.Add(tc.syntax, func(m Match, ctx interface{}) {})
+			cmds.Compile()
+
+			info, ok := cmds.ParseWithMatch(tc.input, nil)
+			if !ok {
+				t.Fatalf("‘%s’ didn't match", tc.input)
+			}
+			if s := info.Template(); s != tc.template {
+				t.Fatalf("template was ‘%s’, expected ‘%s’", s, tc.template)
+			}
+		})
+	}
+
+	if s := (MatchInfo{}).Template(); s != "" {
+		t.Fatalf("template of an empty MatchInfo was ‘%s’", s)
+	}
+}
@@ -0,0 +1,104 @@
+package cmdparse
+
+// TokenKind is the kind of a Token of a command definition.
+type TokenKind int
+
+// The kinds of tokens returned by Tokenize.
+const (
+	// WordToken is a keyword, a variable name or type, or a flag, possibly quoted.
+	WordToken        = TokenKind(wordTok)
+	LessThanToken    = TokenKind(lessThanTok)
+	GreaterThanToken = TokenKind(greaterThanTok)
+	PipeToken        = TokenKind(pipeTok)
+	StarToken        = TokenKind(starTok)
+	PlusToken        = TokenKind(plusTok)
+	QuestionToken    = TokenKind(questionTok)
+	LeftParenToken   = TokenKind(leftParenTok)
+	RightParenToken  = TokenKind(rightParenTok)
+	ColonToken       = TokenKind(colonTok)
+	BangToken        = TokenKind(bangTok)
+	LeftBraceToken   = TokenKind(leftBraceTok)
+	RightBraceToken  = TokenKind(rightBraceTok)
+	CommaToken       = TokenKind(commaTok)
+	AtToken          = TokenKind(atTok)
+)
+
+// String returns ‘word’ for a WordToken, and the punctuation of the other kinds.
+func (k TokenKind) String() string {
+	switch k {
+	case WordToken:
+		return "word"
+	case LessThanToken:
+		return "<"
+	case GreaterThanToken:
+		return ">"
+	case PipeToken:
+		return "|"
+	case StarToken:
+		return "*"
+	case PlusToken:
+		return "+"
+	case QuestionToken:
+		return "?"
+	case LeftParenToken:
+		return "("
+	case RightParenToken:
+		return ")"
+	case ColonToken:
+		return ":"
+	case BangToken:
+		return "!"
+	case LeftBraceToken:
+		return "{"
+	case RightBraceToken:
+		return "}"
+	case CommaToken:
+		return ","
+	case AtToken:
+		return "@"
+	}
+	return "unknown"
+}
+
+// Token is a token of a command definition, as returned by Tokenize.
+type Token struct {
+	Kind TokenKind
+	// Value is the word without quotes or escapes for a WordToken, and empty otherwise.
+	Value string
+	// Text is the token as it's written in the definition.
+	Text string
+	// Start is the offset in runes of the start of the token in the definition, and End
+	// the offset just past its end.
+	Start, End int
+}
+
+// Tokenize splits the command definition ‘syntax’ into the tokens that Add parses it from,
+// so that tools such as editors and syntax highlighters for files of definitions can use
+// the same rules as the package. Tokenize only scans the definition; it doesn't check that
+// the tokens form a valid definition.
+//
+// If parts of the definition can't be scanned, such as an unterminated quote, the tokens
+// that could be scanned are returned along with a ScanError that describes each part.
+func Tokenize(syntax string) ([]Token, error) {
+	var s scanner
+	toks, ok := s.Scan(syntax)
+
+	tokens := make([]Token, 0, len(toks))
+	for _, t := range toks {
+		if t.typ == nilTok {
+			// The token couldn't be scanned
+			continue
+		}
+		tok := Token{Kind: TokenKind(t.typ), Start: t.pos, End: t.pos + t.len()}
+		tok.Text = string(s.input[tok.Start:tok.End])
+		if t.typ == wordTok {
+			tok.Value = t.value
+		}
+		tokens = append(tokens, tok)
+	}
+
+	if !ok {
+		return tokens, ScanError(s.errs)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,65 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   string
+		expected []Token
+		err      string
+	}{
+		{
+			name:     "empty",
+			syntax:   "",
+			expected: []Token{},
+		},
+		{
+			name:   "variable",
+			syntax: "get <file:int>?",
+			expected: []Token{
+				{Kind: WordToken, Value: "get", Text: "get", Start: 0, End: 3},
+				{Kind: LessThanToken, Text: "<", Start: 4, End: 5},
+				{Kind: WordToken, Value: "file", Text: "file", Start: 5, End: 9},
+				{Kind: ColonToken, Text: ":", Start: 9, End: 10},
+				{Kind: WordToken, Value: "int", Text: "int", Start: 10, End: 13},
+				{Kind: GreaterThanToken, Text: ">", Start: 13, End: 14},
+				{Kind: QuestionToken, Text: "?", Start: 14, End: 15},
+			},
+		},
+		{
+			name:   "quoted",
+			syntax: `(x-1 | "a \"b\"")`,
+			expected: []Token{
+				{Kind: LeftParenToken, Text: "(", Start: 0, End: 1},
+				{Kind: WordToken, Value: "x-1", Text: "x-1", Start: 1, End: 4},
+				{Kind: PipeToken, Text: "|", Start: 5, End: 6},
+				{Kind: WordToken, Value: `a "b"`, Text: `"a \"b\""`, Start: 7, End: 16},
+				{Kind: RightParenToken, Text: ")", Start: 16, End: 17},
+			},
+		},
+		{
+			name:   "unterminated",
+			syntax: `show "all`,
+			expected: []Token{
+				{Kind: WordToken, Value: "show", Text: "show", Start: 0, End: 4},
+			},
+			err: "Unterminated quote starting at character 6\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			toks, err := Tokenize(tc.syntax)
+			if (err == nil) != (tc.err == "") || (err != nil && err.Error() != tc.err) {
+				t.Fatalf("Tokenize returned the error ‘%v’ but expected ‘%s’", err, tc.err)
+			}
+			if !reflect.DeepEqual(toks, tc.expected) {
+				t.Fatalf("Tokenize returned %+v but expected %+v", toks, tc.expected)
+			}
+		})
+	}
+}
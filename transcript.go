@@ -0,0 +1,216 @@
+package cmdparse
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Transcript is a recording of inputs given to a Cmds along with how each was handled. A
+// transcript recorded using Record can be checked into a repository and replayed in tests
+// using Replay, so that changes in how commands are matched or in what they print are
+// caught.
+//
+// The text form of a transcript, as written by WriteTo and read by ReadTranscript, is a
+// line for each input followed by lines describing the result:
+//
+//    > copy a "b c"
+//    command copy <src> <dst>
+//    bind copy "copy"
+//    bind <src> "a"
+//    bind <dst> "b c"
+//    output 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//    > bogus
+//    nomatch
+//
+// The command is the definition of the matched command, and the bind lines are the
+// keywords and variables it matched along with the quoted input words. The output line
+// is the SHA-256 hash of what the callback wrote, and is left out if it wrote nothing.
+// Lines beginning with # are comments.
+//
+// Transcripts don't contain the values of sensitive variables, so that they can be checked
+// in. When an input binds one, the input is recorded as Match.Redacted returns it, and its
+// bind line has the placeholder that replaces it. Replaying the transcript runs the
+// command with the placeholder as the value.
+type Transcript struct {
+	Entries []TranscriptEntry
+}
+
+// TranscriptEntry is the result of one input in a Transcript.
+type TranscriptEntry struct {
+	Input string
+	// Matched is false if the input didn't match a command.
+	Matched bool
+	// Command is the definition of the matched command.
+	Command string
+	Bound   []BoundElement
+	// OutputHash is the hex SHA-256 hash of the output of the callback, or empty if there
+	// was no output.
+	OutputHash string
+}
+
+// Record parses each line read from ‘r’ using ‘cmds’ and returns a Transcript of the
+// results. Blank lines are skipped. The callbacks are passed a *bytes.Buffer as their
+// context, and what they write to it is recorded as their output.
+func Record(cmds *Cmds, r io.Reader) (Transcript, error) {
+	var t Transcript
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		t.Entries = append(t.Entries, runTranscriptInput(cmds, line))
+	}
+	return t, scanner.Err()
+}
+
+// Replay parses the inputs of the transcript ‘t’ using ‘cmds’ like Record, and returns an
+// error describing the first input whose result differs from the one in the transcript.
+func Replay(cmds *Cmds, t Transcript) error {
+	for i, want := range t.Entries {
+		got := runTranscriptInput(cmds, want.Input)
+		if err := compareTranscriptEntries(want, got); err != nil {
+			return fmt.Errorf("entry %d (‘%s’): %v", i+1, want.Input, err)
+		}
+	}
+	return nil
+}
+
+func runTranscriptInput(cmds *Cmds, input string) (e TranscriptEntry) {
+	e.Input = input
+
+	d, m, ok := cmds.describe(input)
+	if !ok {
+		return
+	}
+	if bindsSensitive(m) {
+		e.Input = cmdMatch(m).Redacted()
+	}
+	e.Matched = true
+	e.Command = d.Syntax
+	e.Bound = d.Bound
+
+	var out bytes.Buffer
+	cmds.Parse(input, &out)
+	if out.Len() > 0 {
+		sum := sha256.Sum256(out.Bytes())
+		e.OutputHash = hex.EncodeToString(sum[:])
+	}
+	return
+}
+
+// bindsSensitive returns true if the match ‘m’ binds a variable flagged as secret or
+// sensitive.
+func bindsSensitive(m match) bool {
+	for _, item := range m.items {
+		if v, ok := item.(VarValue); ok && v.Flags.IsSensitive() {
+			return true
+		}
+	}
+	return false
+}
+
+func compareTranscriptEntries(want, got TranscriptEntry) error {
+	if want.Matched != got.Matched {
+		if want.Matched {
+			return fmt.Errorf("expected a match with ‘%s’ but nothing matched", want.Command)
+		}
+		return fmt.Errorf("expected no match but matched ‘%s’", got.Command)
+	}
+	if want.Command != got.Command {
+		return fmt.Errorf("expected a match with ‘%s’ but matched ‘%s’", want.Command, got.Command)
+	}
+	if len(want.Bound) != len(got.Bound) {
+		return fmt.Errorf("expected %d bound elements but got %d", len(want.Bound), len(got.Bound))
+	}
+	for i := range want.Bound {
+		if want.Bound[i] != got.Bound[i] {
+			return fmt.Errorf("expected %s to be bound to ‘%s’ but got %s bound to ‘%s’",
+				want.Bound[i].Element, want.Bound[i].Value, got.Bound[i].Element, got.Bound[i].Value)
+		}
+	}
+	if want.OutputHash != got.OutputHash {
+		return fmt.Errorf("the output differs")
+	}
+	return nil
+}
+
+// WriteTo writes the text form of the transcript to ‘w’.
+func (t Transcript) WriteTo(w io.Writer) (n int64, err error) {
+	var buf bytes.Buffer
+	for _, e := range t.Entries {
+		fmt.Fprintf(&buf, "> %s\n", e.Input)
+		if !e.Matched {
+			buf.WriteString("nomatch\n")
+			continue
+		}
+		fmt.Fprintf(&buf, "command %s\n", e.Command)
+		for _, b := range e.Bound {
+			fmt.Fprintf(&buf, "bind %s %s\n", b.Element, strconv.Quote(b.Value))
+		}
+		if e.OutputHash != "" {
+			fmt.Fprintf(&buf, "output %s\n", e.OutputHash)
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// ReadTranscript reads the text form of a transcript from ‘r’.
+func ReadTranscript(r io.Reader) (t Transcript, err error) {
+	var cur *TranscriptEntry
+	lineNo := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "> ") {
+			t.Entries = append(t.Entries, TranscriptEntry{Input: line[len("> "):]})
+			cur = &t.Entries[len(t.Entries)-1]
+			continue
+		}
+
+		if cur == nil {
+			return t, fmt.Errorf("line %d: expected an input line beginning with ‘> ’", lineNo)
+		}
+
+		keyword, rest := line, ""
+		if i := strings.IndexRune(line, ' '); i >= 0 {
+			keyword, rest = line[:i], line[i+1:]
+		}
+
+		switch keyword {
+		case "nomatch":
+			cur.Matched = false
+		case "command":
+			cur.Matched = true
+			cur.Command = rest
+		case "bind":
+			i := strings.IndexRune(rest, ' ')
+			if i < 0 {
+				return t, fmt.Errorf("line %d: expected ‘bind <element> <quoted value>’", lineNo)
+			}
+			val, err := strconv.Unquote(rest[i+1:])
+			if err != nil {
+				return t, fmt.Errorf("line %d: invalid quoted value: %v", lineNo, err)
+			}
+			cur.Bound = append(cur.Bound, BoundElement{Element: rest[:i], Value: val})
+		case "output":
+			cur.OutputHash = rest
+		default:
+			return t, fmt.Errorf("line %d: unknown transcript line ‘%s’", lineNo, keyword)
+		}
+	}
+
+	return t, scanner.Err()
+}
@@ -0,0 +1,126 @@
+package cmdparse
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func transcriptCmds(greeting string) *Cmds {
+	var cmds Cmds
+	cmds.Add("copy <src> <dst>", func(match Match, ctx interface{}) {})
+	cmds.Add("say <what>", func(match Match, ctx interface{}) {
+		fmt.Fprintf(ctx.(*bytes.Buffer), "%s %s\n", greeting, match.Var("what")[0].Value)
+	})
+	cmds.Compile()
+	return &cmds
+}
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	input := "copy a \"b c\"\n\nsay world\nbogus\n"
+
+	tr, err := Record(transcriptCmds("hello"), strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	tr.WriteTo(&buf)
+
+	expected := `> copy a "b c"
+command copy <src> <dst>
+bind copy "copy"
+bind <src> "a"
+bind <dst> "b c"
+> say world
+command say <what>
+bind say "say"
+bind <what> "world"
+output `
+	if !strings.HasPrefix(buf.String(), expected) {
+		t.Fatalf("Expected the transcript to begin with:\n%s\nbut it was:\n%s", expected, buf.String())
+	}
+	if !strings.HasSuffix(buf.String(), "> bogus\nnomatch\n") {
+		t.Fatalf("Expected the transcript to end with the unmatched input but it was:\n%s", buf.String())
+	}
+
+	tr2, err := ReadTranscript(&buf)
+	if err != nil {
+		t.Fatalf("ReadTranscript failed: %v", err)
+	}
+
+	if err := Replay(transcriptCmds("hello"), tr2); err != nil {
+		t.Fatalf("Replay failed when it should succeed. Error: %v", err)
+	}
+
+	err = Replay(transcriptCmds("hi"), tr2)
+	if err == nil {
+		t.Fatalf("Replay succeeded when the output changed")
+	}
+	if err.Error() != "entry 2 (‘say world’): the output differs" {
+		t.Fatalf("Replay failed with the wrong error: %v", err)
+	}
+}
+
+func TestReadTranscriptErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		error string
+	}{
+		{"no input", "command x", "line 1: expected an input line beginning with ‘> ’"},
+		{"bad keyword", "> x\nfoo", "line 2: unknown transcript line ‘foo’"},
+		{"bad bind", "> x\nbind x", "line 2: expected ‘bind <element> <quoted value>’"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadTranscript(strings.NewReader(tc.text))
+			if err == nil {
+				t.Fatalf("ReadTranscript succeeded when it should have failed")
+			}
+			if err.Error() != tc.error {
+				t.Fatalf("Expected error '%s' but got '%s'", tc.error, err.Error())
+			}
+		})
+	}
+}
+
+func TestTranscriptRedactsSensitive(t *testing.T) {
+	newCmds := func() *Cmds {
+		var cmds Cmds
+		cmds.Add("login <user> <pass!secret>", func(match Match, ctx interface{}) {})
+		cmds.Compile()
+		return &cmds
+	}
+
+	tr, err := Record(newCmds(), strings.NewReader("login bob hunter2\n"))
+	if err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	tr.WriteTo(&buf)
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatalf("The transcript contains the secret:\n%s", buf.String())
+	}
+	expected := `> login bob <redacted>
+command login <user> <pass!secret>
+bind login "login"
+bind <user> "bob"
+bind <pass> "<redacted>"
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected the transcript:\n%s\nbut it was:\n%s", expected, buf.String())
+	}
+
+	tr2, err := ReadTranscript(&buf)
+	if err != nil {
+		t.Fatalf("ReadTranscript failed: %v", err)
+	}
+	if err := Replay(newCmds(), tr2); err != nil {
+		t.Fatalf("Replay failed when it should succeed. Error: %v", err)
+	}
+}
@@ -0,0 +1,565 @@
+package cmdparse
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of a variable in a command definition. A variable only matches words
+// that are valid values of its type. Custom types are added using Cmds.AddType, and are
+// used by writing their name after the colon in a variable, as in <addr:ipv4>.
+type Type interface {
+	// Name returns the name of the type as it's written in command definitions.
+	Name() string
+	// Validate returns an error if ‘val’ is not a valid value of the type.
+	Validate(val string) error
+	// Convert converts the valid value ‘val’ to a Go value, which is made available in
+	// VarValue.Converted.
+	Convert(val string) (interface{}, error)
+	// Complete returns the values of the type that begin with ‘prefix’, or nil if the
+	// values can't be listed.
+	Complete(prefix string) []string
+	// Describe returns a short description of the values of the type, for use in help.
+	Describe() string
+}
+
+// restType is implemented by types whose variables consume all of the remaining input.
+type restType interface {
+	Type
+	consumesRest()
+}
+
+// quotedRestType is implemented by rest types whose value splits into the remaining words
+// again. When it's also a rawRestType the value is the input as it was entered if that's
+// known, and otherwise the remaining words quoted where needed.
+type quotedRestType interface {
+	restType
+	quotesWords()
+}
+
+// rawRestType is implemented by rest types whose value is the remaining input as it was
+// entered, rather than the remaining words.
+type rawRestType interface {
+	restType
+	keepsSpacing()
+}
+
+// partsType is implemented by types whose converted values are the parts of the value,
+// made available in VarValue.Elems, Bytes or Groups. They are converted while matching
+// even when conversion is lazy.
+type partsType interface {
+	Type
+	hasParts()
+}
+
+// builtinTypes are the types that are always available, apart from the list types.
+var builtinTypes = map[string]Type{
+	"str":       strType{},
+	"int":       intType{},
+	"float":     floatType{},
+	"bool":      boolType{},
+	"map":       mapType{},
+	"json":      jsonType{},
+	"hex":       hexType{},
+	"base64":    base64Type{},
+	"expr":      exprType{},
+	"rest":      restLineType{},
+	"freq":      freqType,
+	"bandwidth": bandwidthType,
+}
+
+// lookupType returns the Type named ‘name’, or nil if there is no such type. ‘types’ are
+// the types added to the Cmds, which take precedence over the built-in types.
+func lookupType(name string, types map[string]Type) Type {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	if t, ok := builtinTypes[name]; ok {
+		return t
+	}
+	if elemTyp, ok := listElemType(name); ok {
+		return listType{name: name, elemTyp: builtinTypes[elemTyp]}
+	}
+	if vals, ok := enumValues(name); ok {
+		return enumType{name: name, values: vals}
+	}
+	return nil
+}
+
+type strType struct{}
+
+func (strType) Name() string                            { return "str" }
+func (strType) Validate(val string) error               { return nil }
+func (strType) Convert(val string) (interface{}, error) { return val, nil }
+func (strType) Complete(prefix string) []string         { return nil }
+func (strType) Describe() string                        { return "a word" }
+
+// intType is the type of decimal integers, with an optional sign. Leading zeros don't
+// change the base, so 010 is ten, and prefixes such as 0x and digit separators aren't
+// accepted. Its values convert to an int64.
+type intType struct{}
+
+func (intType) Name() string { return "int" }
+
+func (t intType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (intType) Convert(val string) (interface{}, error) {
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("‘%s’ is not an integer", val)
+	}
+	return i, nil
+}
+
+func (intType) Complete(prefix string) []string { return nil }
+func (intType) Describe() string                { return "an integer" }
+
+// floatType is the type of floating point numbers. Its values convert to a float64.
+type floatType struct{}
+
+func (floatType) Name() string { return "float" }
+
+func (t floatType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (floatType) Convert(val string) (interface{}, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return nil, fmt.Errorf("‘%s’ is not a number", val)
+	}
+	return f, nil
+}
+
+func (floatType) Complete(prefix string) []string { return nil }
+func (floatType) Describe() string                { return "a number" }
+
+// boolType is the type of booleans, written as true or false or any of the other forms
+// accepted by strconv.ParseBool. Its values convert to a bool.
+type boolType struct{}
+
+func (boolType) Name() string { return "bool" }
+
+func (t boolType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (boolType) Convert(val string) (interface{}, error) {
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return nil, fmt.Errorf("‘%s’ is not true or false", val)
+	}
+	return b, nil
+}
+
+func (boolType) Complete(prefix string) []string {
+	var vals []string
+	for _, v := range []string{"false", "true"} {
+		if strings.HasPrefix(v, prefix) {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+func (boolType) Describe() string { return "true or false" }
+
+// listElemTypes are the names of the types that may be used for the elements of a list.
+var listElemTypes = map[string]bool{
+	"str":   true,
+	"int":   true,
+	"float": true,
+	"bool":  true,
+}
+
+// listType is the type of list literals. Its values convert to their elements.
+type listType struct {
+	name    string
+	elemTyp Type
+}
+
+func (t listType) Name() string { return t.name }
+
+func (t listType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (listType) hasParts() {}
+
+func (t listType) Convert(val string) (interface{}, error) {
+	elems, err := parseList(val)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elems {
+		if err := t.elemTyp.Validate(e); err != nil {
+			return nil, fmt.Errorf("list element ‘%s’ is not a valid %s", e, t.elemTyp.Name())
+		}
+	}
+	return elems, nil
+}
+
+func (t listType) Complete(prefix string) []string { return nil }
+
+func (t listType) Describe() string {
+	return fmt.Sprintf("a list of %s such as [a, b, c]", t.elemTyp.Name())
+}
+
+// listElemType returns the element type of the list type ‘typ’. List types are written
+// as ‘list’, which is a list of str, or ‘list-’ followed by the element type, as in
+// ‘list-int’.
+func listElemType(typ string) (elemTyp string, ok bool) {
+	if typ == "list" {
+		return "str", true
+	}
+	if strings.HasPrefix(typ, "list-") {
+		elemTyp = typ[len("list-"):]
+		ok = listElemTypes[elemTyp]
+		return
+	}
+	return
+}
+
+// parseList parses a list literal such as [a, b, "c d"] into its elements.
+func parseList(val string) (elems []string, err error) {
+	if len(val) < 2 || val[0] != '[' || val[len(val)-1] != ']' {
+		return nil, fmt.Errorf("‘%s’ is not a list", val)
+	}
+
+	inner := strings.TrimSpace(val[1 : len(val)-1])
+	elems = []string{}
+	if inner == "" {
+		return
+	}
+
+	var buf strings.Builder
+	inQuotes := false
+	quoted := false
+	add := func() error {
+		e := buf.String()
+		if !quoted {
+			e = strings.TrimSpace(e)
+			if e == "" {
+				return fmt.Errorf("empty element in list ‘%s’", val)
+			}
+		}
+		elems = append(elems, e)
+		buf.Reset()
+		quoted = false
+		return nil
+	}
+
+	for _, r := range inner {
+		switch {
+		case r == '"':
+			if !inQuotes && strings.TrimSpace(buf.String()) == "" {
+				buf.Reset()
+			}
+			inQuotes = !inQuotes
+			quoted = true
+		case inQuotes:
+			buf.WriteRune(r)
+		case r == ',':
+			if err = add(); err != nil {
+				return nil, err
+			}
+		case quoted:
+			if r != ' ' && r != '\t' {
+				return nil, fmt.Errorf("unexpected ‘%c’ after quoted element in list ‘%s’", r, val)
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in list ‘%s’", val)
+	}
+	if err = add(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// enumType is the type of enumerated values, written as the values in parentheses
+// separated by |, as in ‘(fast|slow|auto)’. Its values must be entered in full, and
+// convert to themselves.
+type enumType struct {
+	name   string
+	values []string
+}
+
+func (t enumType) Name() string { return t.name }
+
+func (t enumType) Validate(val string) error {
+	for _, v := range t.values {
+		if v == val {
+			return nil
+		}
+	}
+	return fmt.Errorf("‘%s’ is not one of %s", val, strings.Join(t.values, ", "))
+}
+
+func (t enumType) Convert(val string) (interface{}, error) { return val, nil }
+
+func (t enumType) Complete(prefix string) []string {
+	var vals []string
+	for _, v := range t.values {
+		if strings.HasPrefix(v, prefix) {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+func (t enumType) Describe() string {
+	return "one of " + strings.Join(t.values, ", ")
+}
+
+// enumValues returns the values of the enumerated type ‘typ’.
+func enumValues(typ string) (vals []string, ok bool) {
+	if len(typ) < 2 || typ[0] != '(' || typ[len(typ)-1] != ')' {
+		return nil, false
+	}
+	return strings.Split(typ[1:len(typ)-1], "|"), true
+}
+
+// mapType is the type of key=value pairs, which are collected by Match.Map. Its values
+// convert to a [2]string of the key and value.
+type mapType struct{}
+
+func (mapType) Name() string { return "map" }
+
+func (mapType) Validate(val string) error {
+	_, _, err := splitKeyValue(val)
+	return err
+}
+
+func (mapType) Convert(val string) (interface{}, error) {
+	key, value, err := splitKeyValue(val)
+	if err != nil {
+		return nil, err
+	}
+	return [2]string{key, value}, nil
+}
+
+func (mapType) Complete(prefix string) []string { return nil }
+func (mapType) Describe() string                { return "a key=value pair" }
+
+// splitKeyValue splits the key=value pair ‘val’ at the first =.
+func splitKeyValue(val string) (key, value string, err error) {
+	i := strings.IndexRune(val, '=')
+	if i < 1 {
+		return "", "", fmt.Errorf("‘%s’ is not a key=value pair", val)
+	}
+	return val[:i], val[i+1:], nil
+}
+
+// jsonType is the type of any JSON value. Its values convert to a json.RawMessage.
+type jsonType struct{}
+
+func (jsonType) Name() string { return "json" }
+
+func (jsonType) Validate(val string) error {
+	if !json.Valid([]byte(val)) {
+		return fmt.Errorf("‘%s’ is not valid JSON", val)
+	}
+	return nil
+}
+
+func (t jsonType) Convert(val string) (interface{}, error) {
+	if err := t.Validate(val); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(val), nil
+}
+
+func (jsonType) Complete(prefix string) []string { return nil }
+func (jsonType) Describe() string                { return "a JSON value" }
+
+// jsonGoType is the type of JSON that decodes into a Go type. Its values convert to a
+// pointer to the decoded value.
+type jsonGoType struct {
+	name string
+	typ  reflect.Type
+}
+
+func (t jsonGoType) Name() string { return t.name }
+
+func (t jsonGoType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (t jsonGoType) Convert(val string) (interface{}, error) {
+	p := reflect.New(t.typ)
+	err := json.Unmarshal([]byte(val), p.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return p.Interface(), nil
+}
+
+func (t jsonGoType) Complete(prefix string) []string { return nil }
+
+func (t jsonGoType) Describe() string {
+	return fmt.Sprintf("a JSON %s", t.typ)
+}
+
+// funcType is a type whose values are validated and converted by a function, as added
+// with Cmds.RegisterType.
+type funcType struct {
+	name     string
+	validate func(string) (interface{}, error)
+}
+
+func (t funcType) Name() string { return t.name }
+
+func (t funcType) Validate(val string) error {
+	_, err := t.validate(val)
+	return err
+}
+
+func (t funcType) Convert(val string) (interface{}, error) { return t.validate(val) }
+func (t funcType) Complete(prefix string) []string         { return nil }
+func (t funcType) Describe() string                        { return "a " + t.name }
+
+// hexType is the type of hexadecimal bytes, optionally prefixed with 0x. Its values
+// convert to a []byte.
+type hexType struct{}
+
+func (hexType) Name() string { return "hex" }
+
+func (t hexType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (hexType) Convert(val string) (interface{}, error) {
+	if strings.HasPrefix(val, "0x") || strings.HasPrefix(val, "0X") {
+		val = val[2:]
+	}
+	return hex.DecodeString(val)
+}
+
+func (hexType) Complete(prefix string) []string { return nil }
+func (hexType) hasParts()                       {}
+func (hexType) Describe() string                { return "hexadecimal bytes" }
+
+// base64Encodings are the encodings accepted by the base64 type, in the order they're tried.
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.RawStdEncoding,
+	base64.URLEncoding,
+	base64.RawURLEncoding,
+}
+
+// base64Type is the type of standard or URL-safe base64, with or without padding. Its
+// values convert to a []byte.
+type base64Type struct{}
+
+func (base64Type) Name() string { return "base64" }
+
+func (t base64Type) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (base64Type) Convert(val string) (interface{}, error) {
+	for _, enc := range base64Encodings {
+		if b, err := enc.DecodeString(val); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("‘%s’ is not valid base64", val)
+}
+
+func (base64Type) Complete(prefix string) []string { return nil }
+func (base64Type) hasParts()                       {}
+func (base64Type) Describe() string                { return "base64 bytes" }
+
+// patternType is the type of the rest of the input when it matches a regular expression.
+// Its values convert to the values of the capture groups.
+type patternType struct {
+	name string
+	re   *regexp.Regexp
+}
+
+func (t patternType) Name() string { return t.name }
+
+func (t patternType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (t patternType) Convert(val string) (interface{}, error) {
+	groups := t.re.FindStringSubmatch(val)
+	if groups == nil {
+		return nil, fmt.Errorf("‘%s’ doesn't match %s", val, t.re)
+	}
+	return groups, nil
+}
+
+func (t patternType) Complete(prefix string) []string { return nil }
+
+func (t patternType) Describe() string {
+	return fmt.Sprintf("text matching %s", t.re)
+}
+
+func (t patternType) consumesRest() {}
+func (t patternType) hasParts()     {}
+
+// cmdlineType is the type of the rest of the input when it's a command to run, as used by
+// the repeat and watch builtins.
+type cmdlineType struct{}
+
+func (cmdlineType) Name() string                            { return "cmdline" }
+func (cmdlineType) Validate(val string) error               { return nil }
+func (cmdlineType) Convert(val string) (interface{}, error) { return val, nil }
+func (cmdlineType) Complete(prefix string) []string         { return nil }
+func (cmdlineType) Describe() string                        { return "a command" }
+func (cmdlineType) consumesRest()                           {}
+func (cmdlineType) quotesWords()                            {}
+func (cmdlineType) keepsSpacing()                           {}
+
+// restLineType is the type of the rest of the input, which is kept as it was entered.
+type restLineType struct{}
+
+func (restLineType) Name() string                            { return "rest" }
+func (restLineType) Validate(val string) error               { return nil }
+func (restLineType) Convert(val string) (interface{}, error) { return val, nil }
+func (restLineType) Complete(prefix string) []string         { return nil }
+func (restLineType) Describe() string                        { return "the rest of the line" }
+func (restLineType) consumesRest()                           {}
+func (restLineType) keepsSpacing()                           {}
+
+// durationType is the type of durations such as 1m30s. Its values convert to a
+// time.Duration.
+type durationType struct{}
+
+func (durationType) Name() string { return "duration" }
+
+func (t durationType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (durationType) Convert(val string) (interface{}, error) {
+	return time.ParseDuration(val)
+}
+
+func (durationType) Complete(prefix string) []string { return nil }
+func (durationType) Describe() string                { return "a duration such as 1m30s" }
@@ -0,0 +1,465 @@
+package cmdparse
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		ok       bool
+	}{
+		{`[]`, []string{}, true},
+		{`[a]`, []string{"a"}, true},
+		{`[a, b,c ]`, []string{"a", "b", "c"}, true},
+		{`["a, b", "" , c d]`, []string{"a, b", "", "c d"}, true},
+		{`[a,,b]`, nil, false},
+		{`[a,]`, nil, false},
+		{`["a" b]`, nil, false},
+		{`["a]`, nil, false},
+		{`a, b`, nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			elems, err := parseList(tc.input)
+			if (err == nil) != tc.ok {
+				t.Fatalf("Expected ok to be %v but the error was %v", tc.ok, err)
+			}
+			if strings.Join(elems, "|") != strings.Join(tc.expected, "|") || len(elems) != len(tc.expected) {
+				t.Fatalf("Expected elements %q but got %q", tc.expected, elems)
+			}
+		})
+	}
+}
+
+func TestListLiterals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected []string
+	}{
+		{"strs", `tag [a, "b c", d]`, true, []string{"a", "b c", "d"}},
+		{"empty", `tag []`, true, []string{}},
+		{"ints", `ports [80, 443]`, true, []string{"80", "443"}},
+		{"bad int", `ports [80, https]`, false, nil},
+		{"not a list", `ports 80`, false, nil},
+		{"unterminated", `tag [a, b`, false, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var elems []string
+
+			cback := func(match Match, ctx interface{}) {
+				elems = match.Var("l")[0].Elems
+			}
+			cmds.Add("tag <l:list>", cback)
+			cmds.Add("ports <l:list-int>", cback)
+			cmds.Compile()
+			cmds.SetListLiterals(true)
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if strings.Join(elems, "|") != strings.Join(tc.expected, "|") || len(elems) != len(tc.expected) {
+				t.Fatalf("Expected elements %q but got %q", tc.expected, elems)
+			}
+		})
+	}
+}
+
+func TestMapType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected map[string]string
+	}{
+		{"none", "label", true, map[string]string{}},
+		{"one", "label env=prod", true, map[string]string{"env": "prod"}},
+		{"many", `label env=prod "owner=a b" empty= env=dev`, true,
+			map[string]string{"env": "dev", "owner": "a b", "empty": ""}},
+		{"equals in value", "label expr=a=b", true, map[string]string{"expr": "a=b"}},
+		{"not a pair", "label env", false, nil},
+		{"no key", "label =prod", false, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var m map[string]string
+
+			cmds.Add("label <kv:map>*", func(match Match, ctx interface{}) {
+				m = match.Map("kv")
+			})
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if !tc.ok {
+				return
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Fatalf("Expected map %v but got %v", tc.expected, m)
+			}
+		})
+	}
+}
+
+func TestJSONType(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		ok        bool
+		expected  interface{}
+		posix     bool
+		noLiteral bool
+	}{
+		{"object", `post {"a": [1, {"b": "c }"}]}`, true, json.RawMessage(`{"a": [1, {"b": "c }"}]}`), false, false},
+		{"escaped quote", `post {"a": "\"}"}`, true, json.RawMessage(`{"a": "\"}"}`), false, false},
+		{"number", `post 42`, true, json.RawMessage(`42`), false, false},
+		{"quoted", `post '{"a": 1}'`, true, json.RawMessage(`{"a": 1}`), true, true},
+		{"invalid", `post {a: 1}`, false, nil, false, false},
+		{"unterminated", `post {"a": 1`, false, nil, false, false},
+		{"no literals", `post {"a": 1}`, false, nil, false, true},
+		{"user", `create {"Name": "Al", "Age": 3}`, true, &user{Name: "Al", Age: 3}, false, false},
+		{"bad user", `create {"Name": 3}`, false, nil, false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var conv interface{}
+
+			cback := func(match Match, ctx interface{}) {
+				conv = match.Var("j")[0].Converted
+			}
+			cmds.AddJSONType("user", user{})
+			cmds.Add("post <j:json>", cback)
+			cmds.Add("create <j:user>", cback)
+			cmds.Compile()
+			cmds.SetJSONLiterals(!tc.noLiteral)
+			cmds.SetPosixSplitting(tc.posix)
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if !reflect.DeepEqual(conv, tc.expected) {
+				t.Fatalf("Expected value %#v but got %#v", tc.expected, conv)
+			}
+		})
+	}
+}
+
+func TestRestType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected string
+		posix    bool
+	}{
+		{"one word", "comment hi", true, "hi", false},
+		{"spacing", "comment  fix   the  build ", true, "fix   the  build", false},
+		{"quotes", `comment say "a  b"`, true, `say "a  b"`, false},
+		{"posix quotes", `comment it's 'ok'`, false, "", true},
+		{"posix", `comment 'it  is'   ok`, true, `'it  is'   ok`, true},
+		{"after keyword", "note to self  buy milk", true, "buy milk", false},
+		{"missing", "comment", false, "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var got string
+
+			cback := func(match Match, ctx interface{}) {
+				got = match.Var("text")[0].Value
+			}
+			cmds.Add("comment <text:rest>", cback)
+			cmds.Add("note to self <text:rest>", cback)
+			cmds.Compile()
+			cmds.SetPosixSplitting(tc.posix)
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if got != tc.expected {
+				t.Fatalf("Expected the value ‘%s’ but got ‘%s’", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestBinaryTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected []byte
+	}{
+		{"hex", "key 00ff10", true, []byte{0, 0xff, 0x10}},
+		{"hex 0x", "key 0xABcd", true, []byte{0xab, 0xcd}},
+		{"bad hex", "key 0fg", false, nil},
+		{"odd hex", "key 0f0", false, nil},
+		{"base64", "blob aGk/Pz8=", true, []byte("hi???")},
+		{"base64 raw url", "blob aGk_Pz8", true, []byte("hi???")},
+		{"bad base64", "blob a*b", false, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var b []byte
+
+			cback := func(match Match, ctx interface{}) {
+				b = match.Var("b")[0].Bytes
+			}
+			cmds.Add("key <b:hex>", cback)
+			cmds.Add("blob <b:base64>", cback)
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if !reflect.DeepEqual(b, tc.expected) {
+				t.Fatalf("Expected bytes %v but got %v", tc.expected, b)
+			}
+		})
+	}
+}
+
+func TestScalarTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected string
+	}{
+		{"int", "add 42", true, "42"},
+		{"negative int", "add -7", true, "-7"},
+		{"leading zero", "add 010", true, "10"},
+		{"leading zero not octal", "add 08", true, "8"},
+		{"hex int", "add 0x10", false, ""},
+		{"digit separators", "add 1_000", false, ""},
+		{"bad int", "add x", false, ""},
+		{"float", "scale 1.5", true, "1.5"},
+		{"bad float", "scale big", false, ""},
+		{"bool", "enable true", true, "true"},
+		{"bool short", "enable F", true, "false"},
+		{"bad bool", "enable maybe", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var got string
+
+			cmds.Add("add <v:int>", func(match Match, ctx interface{}) {
+				i, err := match.Var("v")[0].Int()
+				got = fmt.Sprint(i, err)
+			})
+			cmds.Add("scale <v:float>", func(match Match, ctx interface{}) {
+				f, err := match.Var("v")[0].Float()
+				got = fmt.Sprint(f, err)
+			})
+			cmds.Add("enable <v:bool>", func(match Match, ctx interface{}) {
+				b, err := match.Var("v")[0].Bool()
+				got = fmt.Sprint(b, err)
+			})
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if ok && got != tc.expected+" <nil>" {
+				t.Fatalf("Expected the value %s but got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestVarValueAccessors(t *testing.T) {
+	v := VarValue{Name: "v", Type: "str", Value: "12"}
+	if i, err := v.Int(); i != 12 || err != nil {
+		t.Fatalf("Expected Int to return 12 but got %v, %v", i, err)
+	}
+	if f, err := v.Float(); f != 12 || err != nil {
+		t.Fatalf("Expected Float to return 12 but got %v, %v", f, err)
+	}
+	if _, err := v.Bool(); err == nil {
+		t.Fatalf("Expected Bool to fail")
+	}
+}
+
+type colorType struct{}
+
+func (colorType) Name() string { return "color" }
+
+func (colorType) Validate(val string) error {
+	for _, c := range (colorType{}).Complete("") {
+		if c == val {
+			return nil
+		}
+	}
+	return fmt.Errorf("‘%s’ is not a color", val)
+}
+
+func (colorType) Convert(val string) (interface{}, error) {
+	return strings.ToUpper(val), nil
+}
+
+func (colorType) Complete(prefix string) []string {
+	var res []string
+	for _, c := range []string{"red", "green", "blue"} {
+		if strings.HasPrefix(c, prefix) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (colorType) Describe() string { return "a color" }
+
+func TestAddType(t *testing.T) {
+	var cmds Cmds
+	var conv interface{}
+
+	cmds.AddType(colorType{})
+	cmds.Add("paint <c:color>", func(match Match, ctx interface{}) {
+		conv = match.Var("c")[0].Converted
+	})
+	cmds.Compile()
+
+	if !cmds.Parse("paint green", nil) {
+		t.Fatalf("Parse failed")
+	}
+	if conv != "GREEN" {
+		t.Fatalf("Expected the converted value to be GREEN but it was %v", conv)
+	}
+
+	if cmds.Parse("paint mauve", nil) {
+		t.Fatalf("Parse succeeded with an invalid color")
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		syntax   string
+		expected interface{}
+	}{
+		{"valid", "set 10.0.0.1", "set <addr:ipv4>", []int{10, 0, 0, 1}},
+		{"invalid falls through", "set 10", "set <n:int>", int64(10)},
+		{"out of range", "set 10.0.0.300", "", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var syntax string
+			var conv interface{}
+
+			cmds.RegisterType("ipv4", func(s string) (interface{}, error) {
+				parts := strings.Split(s, ".")
+				if len(parts) != 4 {
+					return nil, fmt.Errorf("‘%s’ is not an IPv4 address", s)
+				}
+				ip := make([]int, 4)
+				for i, p := range parts {
+					if _, err := fmt.Sscanf(p, "%d", &ip[i]); err != nil || ip[i] > 255 {
+						return nil, fmt.Errorf("‘%s’ is not an IPv4 address", s)
+					}
+				}
+				return ip, nil
+			})
+			cmds.Add("set <addr:ipv4>", func(match Match, ctx interface{}) {
+				syntax = "set <addr:ipv4>"
+				conv = match.Var("addr")[0].Converted
+			})
+			cmds.Add("set <n:int>", func(match Match, ctx interface{}) {
+				syntax = "set <n:int>"
+				conv = match.Var("n")[0].Converted
+			})
+			cmds.Compile()
+
+			if ok := cmds.Parse(tc.input, nil); ok != (tc.syntax != "") {
+				t.Fatalf("Parse returned %v", ok)
+			}
+			if syntax != tc.syntax {
+				t.Fatalf("Expected ‘%s’ to run but ‘%s’ ran", tc.syntax, syntax)
+			}
+			if !reflect.DeepEqual(conv, tc.expected) {
+				t.Fatalf("Expected the converted value %#v but got %#v", tc.expected, conv)
+			}
+		})
+	}
+}
+
+func TestEnumType(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		ok    bool
+		mode  string
+	}{
+		{"value", "run slow", true, "slow"},
+		{"other value", "run auto", true, "auto"},
+		{"abbreviated", "run sl", false, ""},
+		{"not a value", "run quick", false, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var mode string
+
+			cmds.Add("run <mode:(fast|slow|auto)>", func(match Match, ctx interface{}) {
+				mode = match.Var("mode")[0].Value
+			})
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if mode != tc.mode {
+				t.Fatalf("Expected the mode ‘%s’ but got ‘%s’", tc.mode, mode)
+			}
+		})
+	}
+
+	var cmds Cmds
+	cmds.Add("run <mode:(fast|slow|auto)>", nil)
+	cmds.Compile()
+	var vals []string
+	for _, c := range cmds.Complete("run f").Items {
+		if c.Kind == ValueCompletion {
+			vals = append(vals, c.Text)
+		}
+	}
+	if !reflect.DeepEqual(vals, []string{"fast"}) {
+		t.Fatalf("Expected the completions [fast] but got %q", vals)
+	}
+}
@@ -0,0 +1,183 @@
+package cmdparse
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddUnitType adds the variable type ‘typ’ whose values are numbers followed by one of the
+// ‘units’, such as 2.4GHz. Each unit maps to the factor that scales a number in that unit
+// to the canonical unit, and the value scaled to the canonical unit is available as a
+// float64 in VarValue.Converted and from VarValue.Float, so that handlers don't need to
+// know about units. A unit that is the empty string allows numbers without a unit. For
+// example:
+//
+//	cmds.AddUnitType("duration-ms", map[string]float64{"ms": 1, "s": 1000, "min": 60000})
+//	cmds.Add("timeout <t:duration-ms>", cback)
+//
+// Units are matched exactly, or ignoring case if that only matches one unit, so ‘ghz’ is
+// GHz but ‘m’ is only ‘M’ if there is no unit ‘m’. The built-in types freq, whose
+// canonical unit is Hz, and bandwidth, whose canonical unit is bit/s, are unit types. Unit
+// types must be added before Compile is called.
+func (c *Cmds) AddUnitType(typ string, units map[string]float64) error {
+	t, err := newUnitType(typ, units)
+	if err != nil {
+		return err
+	}
+	c.AddType(t)
+	return nil
+}
+
+// unitType is the type of numbers with units. Its values convert to a float64 in the
+// canonical unit.
+type unitType struct {
+	name  string
+	units map[string]float64
+	// sorted are the units in increasing order of scale, for describing and completing
+	sorted []string
+}
+
+func newUnitType(typ string, units map[string]float64) (unitType, error) {
+	t := unitType{name: typ, units: units}
+	if len(units) == 0 {
+		return t, fmt.Errorf("the unit type ‘%s’ has no units", typ)
+	}
+	for u, scale := range units {
+		if scale <= 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+			return t, fmt.Errorf("the unit ‘%s’ of the type ‘%s’ must have a positive scale", u, typ)
+		}
+		if strings.IndexFunc(u, isUnitNumberRune) == 0 {
+			return t, fmt.Errorf("the unit ‘%s’ of the type ‘%s’ can't begin like a number", u, typ)
+		}
+		t.sorted = append(t.sorted, u)
+	}
+
+	sort.Slice(t.sorted, func(i, j int) bool {
+		a, b := t.sorted[i], t.sorted[j]
+		if units[a] != units[b] {
+			return units[a] < units[b]
+		}
+		return a < b
+	})
+	return t, nil
+}
+
+// isUnitNumberRune returns true if ‘r’ may be part of the number before a unit.
+func isUnitNumberRune(r rune) bool {
+	return r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+'
+}
+
+func (t unitType) Name() string { return t.name }
+
+func (t unitType) Validate(val string) error {
+	_, err := t.Convert(val)
+	return err
+}
+
+func (t unitType) Convert(val string) (interface{}, error) {
+	// Try the units that are spelled exactly as in the value first
+	for _, exact := range []bool{true, false} {
+		var scales []float64
+		var num string
+		for u, scale := range t.units {
+			if len(u) > len(val) {
+				continue
+			}
+			suffix := val[len(val)-len(u):]
+			if suffix == u || !exact && strings.EqualFold(suffix, u) {
+				if n := val[:len(val)-len(u)]; isUnitNumber(n) {
+					scales = append(scales, scale)
+					num = n
+				}
+			}
+		}
+		if len(scales) == 1 {
+			f, _ := strconv.ParseFloat(num, 64)
+			return f * scales[0], nil
+		}
+		if len(scales) > 1 {
+			break
+		}
+	}
+	return nil, fmt.Errorf("‘%s’ is not a number with one of the units %s", val, strings.Join(t.named(), ", "))
+}
+
+// isUnitNumber returns true if ‘s’ is a finite number in decimal.
+func isUnitNumber(s string) bool {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return !isUnitNumberRune(r) && r != 'e' && r != 'E'
+	}) >= 0 {
+		return false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsInf(f, 0)
+}
+
+// named returns the units that aren't the empty string.
+func (t unitType) named() []string {
+	var units []string
+	for _, u := range t.sorted {
+		if u != "" {
+			units = append(units, u)
+		}
+	}
+	return units
+}
+
+// Complete returns the number at the start of ‘prefix’ followed by each unit that begins
+// with the rest of it.
+func (t unitType) Complete(prefix string) []string {
+	i := len(prefix)
+	for i > 0 && !isUnitNumber(prefix[:i]) {
+		i--
+	}
+	if i == 0 {
+		return nil
+	}
+
+	var vals []string
+	for _, u := range t.named() {
+		if strings.HasPrefix(strings.ToLower(u), strings.ToLower(prefix[i:])) {
+			vals = append(vals, prefix[:i]+u)
+		}
+	}
+	return vals
+}
+
+func (t unitType) Describe() string {
+	named := t.named()
+	if len(named) == 0 {
+		return "a number"
+	}
+	return "a number with a unit such as 1" + named[0]
+}
+
+// freqType is the type of frequencies, whose canonical unit is Hz.
+var freqType = mustUnitType("freq", map[string]float64{
+	"Hz":  1,
+	"kHz": 1e3,
+	"MHz": 1e6,
+	"GHz": 1e9,
+	"THz": 1e12,
+})
+
+// bandwidthType is the type of data rates, whose canonical unit is bit/s. The units are
+// decimal, as is usual for data rates.
+var bandwidthType = mustUnitType("bandwidth", map[string]float64{
+	"bps":  1,
+	"kbps": 1e3,
+	"Mbps": 1e6,
+	"Gbps": 1e9,
+	"Tbps": 1e12,
+})
+
+func mustUnitType(typ string, units map[string]float64) unitType {
+	t, err := newUnitType(typ, units)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,105 @@
+package cmdparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnitTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		ok       bool
+		expected float64
+	}{
+		{"freq", "tune 2.4GHz", true, 2.4e9},
+		{"freq lower case", "tune 100mhz", true, 100e6},
+		{"freq exponent", "tune 1e3kHz", true, 1e6},
+		{"freq without unit", "tune 100", false, 0},
+		{"freq unknown unit", "tune 5Mbps", false, 0},
+		{"bandwidth", "limit 100Mbps", true, 100e6},
+		{"bandwidth kilo", "limit 64kbps", true, 64e3},
+		{"custom", "wait 1.5s", true, 1500},
+		{"custom exact case", "wait 2m", true, 4},
+		{"custom other case", "wait 2M", true, 120000},
+		{"custom case ambiguous", "wait 2MS", false, 0},
+		{"custom without unit", "wait 250", true, 250},
+		{"not a number", "wait fastms", false, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var got float64
+			cback := func(match Match, ctx interface{}) {
+				for _, name := range []string{"f", "b", "t"} {
+					if v := match.Var(name); len(v) > 0 {
+						got, _ = v[0].Float()
+					}
+				}
+			}
+
+			err := cmds.AddUnitType("ms", map[string]float64{"": 1, "ms": 1, "Ms": 1e-3, "s": 1000, "m": 2, "M": 60000})
+			if err != nil {
+				t.Fatalf("AddUnitType failed: %v", err)
+			}
+			cmds.Add("tune <f:freq>", cback)
+			cmds.Add("limit <b:bandwidth>", cback)
+			cmds.Add("wait <t:ms>", cback)
+			cmds.Compile()
+
+			ok := cmds.Parse(tc.input, nil)
+			if ok != tc.ok {
+				t.Fatalf("Parse returned %v when it should have returned %v", ok, tc.ok)
+			}
+			if ok && got != tc.expected {
+				t.Fatalf("Expected the value %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnitTypeComplete(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"2", []string{"2Hz", "2kHz", "2MHz", "2GHz", "2THz"}},
+		{"2.4g", []string{"2.4GHz"}},
+		{"1e", []string{}},
+		{"GHz", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.prefix, func(t *testing.T) {
+			got := freqType.Complete(tc.prefix)
+			if len(got) != 0 || len(tc.expected) != 0 {
+				if !reflect.DeepEqual(got, tc.expected) {
+					t.Fatalf("Expected %q but got %q", tc.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAddUnitTypeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		units map[string]float64
+		error string
+	}{
+		{"no units", nil, "the unit type ‘t’ has no units"},
+		{"zero scale", map[string]float64{"x": 0}, "the unit ‘x’ of the type ‘t’ must have a positive scale"},
+		{"number", map[string]float64{"2x": 1}, "the unit ‘2x’ of the type ‘t’ can't begin like a number"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			err := cmds.AddUnitType("t", tc.units)
+			if err == nil || err.Error() != tc.error {
+				t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+			}
+		})
+	}
+}
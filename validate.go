@@ -0,0 +1,68 @@
+package cmdparse
+
+import "fmt"
+
+// Validator checks a match of a command before its callback is called, and returns an
+// error if the values entered are invalid together.
+type Validator func(m Match) error
+
+// SetValidator sets the function that checks each match of the command whose definition is
+// ‘syntax’, exactly as it was passed to Add, before its callback is called. It keeps
+// semantic checks that involve more than one part of the command, such as ‘either all or
+// a name but not both’, out of the callbacks, for example:
+//
+//    cmds.Add("delete all? <name!nokeyword>*", del)
+//    cmds.SetValidator("delete all? <name!nokeyword>*", func(m Match) error {
+//        if m.KeywordPresent("all") && len(m.Var("name")) > 0 {
+//            return fmt.Errorf("either all or names can be deleted, not both")
+//        }
+//        return nil
+//    })
+//
+// When the validator returns an error the callback isn't called, Parse returns false, and
+// ParseErr and ParseToMatch return a *ValidationError. Unlike a constraint added with
+// AddConstraint, a validator doesn't stop the input matching the command, so it doesn't
+// resolve ambiguity, and input that fails validation is reported as such rather than as
+// not matching. Passing a nil validator removes it.
+func (c *Cmds) SetValidator(syntax string, v Validator) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax == syntax {
+			cmd.validator = v
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// validate calls the validator of the command matched by ‘m’, if it has one.
+func validate(m match) error {
+	cmd := m.meta.(*command)
+	if cmd.validator == nil {
+		return nil
+	}
+	if err := cmd.validator(cmdMatch(m)); err != nil {
+		return &ValidationError{Syntax: cmd.syntax, Err: err}
+	}
+	return nil
+}
+
+// ValidationError is the error returned when input matches a command but the validator
+// set with SetValidator rejects it.
+type ValidationError struct {
+	// Syntax is the definition of the command.
+	Syntax string
+	// Err is the error returned by the validator.
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid input for ‘%s’: %v", e.Syntax, e.Err)
+}
+
+// Unwrap returns the error returned by the validator.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,84 @@
+package cmdparse
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSetValidator(t *testing.T) {
+	errBoth := fmt.Errorf("either all or names, not both")
+
+	tests := []struct {
+		name   string
+		input  string
+		called bool
+		error  string
+	}{
+		{"valid", "delete x y", true, ""},
+		{"valid keyword", "delete all", true, ""},
+		{"invalid", "delete all x", false, "invalid input for ‘delete all? <name!nokeyword>*’: either all or names, not both"},
+		{"no match", "remove", false, "unexpected word 'remove' at position 1, expected one of: delete, show"},
+		{"no validator", "show x", true, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			called := false
+			cback := func(match Match, ctx interface{}) { called = true }
+
+			cmds.Add("delete all? <name!nokeyword>*", cback)
+			cmds.Add("show <name>", cback)
+			err := cmds.SetValidator("delete all? <name!nokeyword>*", func(m Match) error {
+				if m.KeywordPresent("all") && len(m.Var("name")) > 0 {
+					return errBoth
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("SetValidator failed: %v", err)
+			}
+			cmds.Compile()
+
+			err = cmds.ParseErr(tc.input, nil)
+			if called != tc.called {
+				t.Fatalf("The callback was called: %v; expected %v", called, tc.called)
+			}
+			if tc.error == "" {
+				if err != nil {
+					t.Fatalf("ParseErr failed: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.error {
+				t.Fatalf("Expected the error ‘%s’ but got %v", tc.error, err)
+			}
+
+			_, _, mErr := cmds.ParseToMatch(tc.input)
+			if mErr == nil || mErr.Error() != tc.error {
+				t.Fatalf("Expected ParseToMatch to return the error ‘%s’ but got %v", tc.error, mErr)
+			}
+			if _, ok := err.(*ValidationError); ok && !errors.Is(err, errBoth) {
+				t.Fatalf("The validation error doesn't wrap the validator's error")
+			}
+		})
+	}
+}
+
+func TestSetValidatorErrors(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("show", nil)
+
+	err := cmds.SetValidator("list", func(m Match) error { return nil })
+	if err == nil || err.Error() != "there is no command ‘list’" {
+		t.Fatalf("Expected an error for an unknown command but got %v", err)
+	}
+
+	cmds.SetValidator("show", func(m Match) error { return fmt.Errorf("no") })
+	cmds.SetValidator("show", nil)
+	cmds.Compile()
+	if err := cmds.ParseErr("show", nil); err != nil {
+		t.Fatalf("Removing the validator failed: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package cmdparse
+
+// VarIterator iterates over the values of a variable, as returned by Match.VarIter:
+//
+//    for it := match.VarIter("id"); it.Next(); {
+//        del(it.Value().Value)
+//    }
+type VarIterator struct {
+	items []interface{}
+	name  string
+	// pos is the index in items of the current value, and index its position among the
+	// values of the variable
+	pos   int
+	index int
+	cur   VarValue
+}
+
+// Next advances to the next value, and returns false when there are no more.
+func (it *VarIterator) Next() bool {
+	for it.pos++; it.pos < len(it.items); it.pos++ {
+		if v, ok := it.items[it.pos].(VarValue); ok && v.Name == it.name {
+			it.index++
+			it.cur = v
+			return true
+		}
+	}
+	it.cur = VarValue{}
+	return false
+}
+
+// Value returns the current value. It's changed by the next call to Next, so it must be
+// copied to be kept.
+func (it *VarIterator) Value() *VarValue {
+	return &it.cur
+}
+
+// Index returns the position of the current value among the values of the variable,
+// counting from 0.
+func (it *VarIterator) Index() int {
+	return it.index
+}
+
+// Skip advances past the next ‘n’ values without returning them, so that a page of values
+// can be read, and returns the number skipped, which is less than ‘n’ at the end.
+func (it *VarIterator) Skip(n int) int {
+	skipped := 0
+	for skipped < n && it.Next() {
+		skipped++
+	}
+	return skipped
+}
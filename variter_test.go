@@ -0,0 +1,72 @@
+package cmdparse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVarIter(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		// skip values are skipped before reading up to limit values
+		skip, limit int
+		expected    []string
+		count       int
+	}{
+		{"all", "delete a b c", 0, 10, []string{"0:a", "1:b", "2:c"}, 3},
+		{"page", "delete a b c d e", 2, 2, []string{"2:c", "3:d"}, 5},
+		{"past end", "delete a b", 5, 2, nil, 2},
+		{"other variable", "delete a b from x", 0, 10, []string{"0:a", "1:b"}, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			var got []string
+			var count int
+			cmds.Add("delete <id!(from)>+ (from <src>)?", func(match Match, ctx interface{}) {
+				count = match.VarCount("id")
+				it := match.VarIter("id")
+				it.Skip(tc.skip)
+				for i := 0; i < tc.limit && it.Next(); i++ {
+					got = append(got, fmt.Sprintf("%d:%s", it.Index(), it.Value().Value))
+				}
+			})
+			cmds.Compile()
+
+			if !cmds.Parse(tc.input, nil) {
+				t.Fatalf("Parse of ‘%s’ failed", tc.input)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Fatalf("Expected the values %v but got %v", tc.expected, got)
+			}
+			if count != tc.count {
+				t.Fatalf("Expected %d values but got %d", tc.count, count)
+			}
+		})
+	}
+}
+
+func TestVarIterAllocs(t *testing.T) {
+	var cmds Cmds
+	var allocs float64
+	cmds.Add("delete <id>+", func(match Match, ctx interface{}) {
+		allocs = testing.AllocsPerRun(10, func() {
+			for it := match.VarIter("id"); it.Next(); {
+				_ = it.Value().Value
+			}
+		})
+	})
+	cmds.Compile()
+
+	if !cmds.Parse("delete"+strings.Repeat(" x", 200), nil) {
+		t.Fatalf("Parse failed")
+	}
+	// Only the iterator is allocated, however many values there are
+	if allocs > 1 {
+		t.Fatalf("Expected at most 1 allocation to iterate but there were %v", allocs)
+	}
+}
@@ -0,0 +1,170 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetVersion sets the version of the software that the commands are running for, such as
+// ‘2.4.1’, so that one set of command definitions can serve many versions of a firmware
+// or program. Commands and named groups whose versions are set with SetVersions and
+// SetGroupVersions are then only matched, completed and described in the versions that
+// they are available in, for example:
+//
+//    cmds.Add("show ports (detail):more?", showPorts)
+//    cmds.Add("show vlans", showVlans)
+//    cmds.SetVersions("show vlans", "2.0", "")
+//    cmds.SetGroupVersions("show ports (detail):more?", "more", "1.5", "3.0")
+//    cmds.SetVersion("1.8")
+//
+// accepts ‘show ports detail’ but not ‘show vlans’. Versions are compared by their parts
+// separated by dots, numerically where both parts are numbers, so ‘1.10’ is after ‘1.9’.
+// When the version is empty, which is the default, everything is available.
+func (c *Cmds) SetVersion(version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version = version
+}
+
+// SetVersions sets the versions that the command whose definition is ‘syntax’, exactly as
+// it was passed to Add, is available in: from the version ‘introduced’ up to but not
+// including the version ‘removed’. Either may be empty, for a command that has always
+// been available or that hasn't been removed.
+func (c *Cmds) SetVersions(syntax, introduced, removed string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax == syntax {
+			cmd.versions = versionRange{introduced: introduced, removed: removed}
+			return nil
+		}
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// SetGroupVersions sets the versions that the named group ‘group’ of the command whose
+// definition is ‘syntax’ is available in, like SetVersions does for a whole command. This
+// is how keywords and variables added to a command in later versions are annotated: input
+// that enters the group only matches in the versions that the group is available in.
+func (c *Cmds) SetGroupVersions(syntax, group, introduced, removed string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cmd := range c.commands {
+		if cmd.syntax != syntax {
+			continue
+		}
+		if !groupNames(cmd.tree)[group] {
+			return fmt.Errorf("the command ‘%s’ has no group ‘%s’", syntax, group)
+		}
+		if cmd.groupVersions == nil {
+			cmd.groupVersions = make(map[string]versionRange)
+		}
+		cmd.groupVersions[group] = versionRange{introduced: introduced, removed: removed}
+		return nil
+	}
+	return fmt.Errorf("there is no command ‘%s’", syntax)
+}
+
+// versionRange are the versions from introduced up to but not including removed. Either
+// may be empty for no bound.
+type versionRange struct {
+	introduced, removed string
+}
+
+// contains returns true if ‘version’ is in the range. Every version is in the range when
+// ‘version’ is empty.
+func (r versionRange) contains(version string) bool {
+	if version == "" {
+		return true
+	}
+	if r.introduced != "" && compareVersions(version, r.introduced) < 0 {
+		return false
+	}
+	return r.removed == "" || compareVersions(version, r.removed) < 0
+}
+
+// availableIn returns true if the command is available in ‘version’.
+func (c *command) availableIn(version string) bool {
+	return c.versions.contains(version)
+}
+
+// groupAvailableIn returns true if the named group ‘group’ of the command is available in
+// ‘version’.
+func (c *command) groupAvailableIn(group, version string) bool {
+	r, ok := c.groupVersions[group]
+	return !ok || r.contains(version)
+}
+
+// compareVersions returns a negative number if the version ‘a’ is before ‘b’, a positive
+// number if it's after it, and zero if they are the same. The versions are compared by
+// their parts separated by dots, as numbers if both parts are and otherwise as strings. A
+// version that has more parts than another that it begins with is after it.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				return na - nb
+			}
+		case pa[i] != pb[i]:
+			return strings.Compare(pa[i], pb[i])
+		}
+	}
+	return len(pa) - len(pb)
+}
+
+// groupNames returns the names of the named groups in the parse tree ‘tree’.
+func groupNames(tree interface{}) map[string]bool {
+	names := make(map[string]bool)
+
+	var walk func(tree interface{})
+	walk = func(tree interface{}) {
+		switch node := tree.(type) {
+		case alts:
+			walk(node.Left)
+			walk(node.Right)
+		case terms:
+			walk(node.Left)
+			walk(node.Right)
+		case rep:
+			walk(node.Term)
+		case group:
+			names[node.Name] = true
+			walk(node.Term)
+		case set:
+			for _, opt := range node.Options {
+				walk(opt)
+			}
+		}
+	}
+	walk(tree)
+	return names
+}
+
+// availableElements returns the elements ‘elems’ of the command without the named groups
+// that aren't available in ‘version’.
+func (c *command) availableElements(elems []Element, version string) []Element {
+	var avail []Element
+	for _, e := range elems {
+		if e.Kind == SequenceElement && e.Group != "" && !c.groupAvailableIn(e.Group, version) {
+			continue
+		}
+		e.Elements = c.availableElements(e.Elements, version)
+		if e.Choices != nil {
+			choices := make([][]Element, len(e.Choices))
+			for i, ch := range e.Choices {
+				choices[i] = c.availableElements(ch, version)
+			}
+			e.Choices = choices
+		}
+		avail = append(avail, e)
+	}
+	return avail
+}
@@ -0,0 +1,115 @@
+package cmdparse
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.9", "1.10", -1},
+		{"2", "1.10", 1},
+		{"1.2", "1.2.1", -1},
+		{"1.2-rc1", "1.2-rc2", -1},
+		{"1.b", "1.a", 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			r := compareVersions(tc.a, tc.b)
+			if (r < 0 && tc.expected >= 0) || (r > 0 && tc.expected <= 0) || (r == 0 && tc.expected != 0) {
+				t.Fatalf("Expected comparing ‘%s’ and ‘%s’ to give %d but got %d", tc.a, tc.b, tc.expected, r)
+			}
+		})
+	}
+}
+
+func TestVersions(t *testing.T) {
+	tests := []struct {
+		version string
+		input   string
+		ok      bool
+	}{
+		{"", "show vlans", true},
+		{"", "show ports detail", true},
+		{"1.0", "show vlans", false},
+		{"2.0", "show vlans", true},
+		{"1.0", "show ports", true},
+		{"1.0", "show ports detail", false},
+		{"1.5", "show ports detail", true},
+		{"3.0", "show ports detail", false},
+		{"3.0", "reboot", false},
+		{"2.9.9", "reboot", true},
+	}
+
+	for _, tc := range tests {
+		for _, optimize := range []bool{false, true} {
+			t.Run(tc.version+" "+tc.input, func(t *testing.T) {
+				var cmds Cmds
+				cback := func(match Match, ctx interface{}) {}
+				cmds.Add("show ports (detail):more?", cback)
+				cmds.Add("show vlans", cback)
+				cmds.Add("reboot", cback)
+				cmds.SetVersions("show vlans", "2.0", "")
+				cmds.SetVersions("reboot", "", "3.0")
+				if err := cmds.SetGroupVersions("show ports (detail):more?", "more", "1.5", "3.0"); err != nil {
+					t.Fatalf("SetGroupVersions failed: %v", err)
+				}
+				cmds.Compile()
+				if optimize {
+					cmds.Optimize()
+				}
+				cmds.SetVersion(tc.version)
+
+				if ok := cmds.Parse(tc.input, nil); ok != tc.ok {
+					t.Fatalf("Expected Parse of ‘%s’ in version ‘%s’ to return %v", tc.input, tc.version, tc.ok)
+				}
+			})
+		}
+	}
+}
+
+func TestVersionsHelpAndCompletion(t *testing.T) {
+	var cmds Cmds
+	cback := func(match Match, ctx interface{}) {}
+	cmds.Add("show ports (detail):more?", cback)
+	cmds.Add("show vlans", cback)
+	cmds.SetVersions("show vlans", "2.0", "")
+	cmds.SetGroupVersions("show ports (detail):more?", "more", "1.5", "")
+	cmds.Compile()
+	cmds.SetVersion("1.0")
+
+	if comps := completionsToStr(cmds.Complete("show ").Items); comps != "ports(keyword)" {
+		t.Fatalf("Expected only ports to be completed but got ‘%s’", comps)
+	}
+	if comps := completionsToStr(cmds.Complete("show ports ").Items); comps != "" {
+		t.Fatalf("Expected nothing to be completed after ports but got ‘%s’", comps)
+	}
+
+	infos := cmds.Commands()
+	if infos[0].Unavailable || len(infos[0].Elements) != 2 {
+		t.Fatalf("Expected ‘show ports’ to be available without its group but got %+v", infos[0])
+	}
+	if !infos[1].Unavailable || infos[1].Introduced != "2.0" {
+		t.Fatalf("Expected ‘show vlans’ to be unavailable until 2.0 but got %+v", infos[1])
+	}
+
+	cmds.SetVersion("2.0")
+	if comps := completionsToStr(cmds.Complete("show ").Items); comps != "ports(keyword) vlans(keyword)" {
+		t.Fatalf("Expected both commands to be completed but got ‘%s’", comps)
+	}
+}
+
+func TestSetGroupVersionsErrors(t *testing.T) {
+	var cmds Cmds
+	cmds.Add("show ports (detail):more?", func(match Match, ctx interface{}) {})
+
+	if err := cmds.SetGroupVersions("show ports", "more", "1.0", ""); err == nil || err.Error() != "there is no command ‘show ports’" {
+		t.Fatalf("Expected an error for a missing command but got %v", err)
+	}
+	err := cmds.SetGroupVersions("show ports (detail):more?", "less", "1.0", "")
+	if err == nil || err.Error() != "the command ‘show ports (detail):more?’ has no group ‘less’" {
+		t.Fatalf("Expected an error for a missing group but got %v", err)
+	}
+}
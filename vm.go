@@ -1,9 +1,12 @@
 package cmdparse
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"time"
 )
 
 // TODO: instead of matchedThreads, make a slice of match structs. Each has the bindings,
@@ -13,22 +16,109 @@ import (
 type vm struct {
 	prog  prog
 	input []string
+	// raw is the text the input was split from, or nil if it isn't known
+	raw *rawInput
 	// currentThreads are the threads to run this iteration
 	currentThreads *threadList
 	// nextThreads are the threads to run next iteration
 	nextThreads *threadList
 	// List of threads that matched in the last iteration
 	matches []match
-	// gen is the current generation, used to tell if we already added a thread to one of the
-	// thread lists
-	gen int
 
 	// thread is the currently executing thread
 	thread *thread
 
+	// hasSensitive is true if the program saves any sensitive variables. In that case
+	// the input words are not printed in the trace.
+	hasSensitive bool
+
 	wordIndex int
 
 	traceWriter io.Writer
+
+	// avoidKeywords is set when no variable matches a word that is exactly a keyword that
+	// could be matched at the same position
+	avoidKeywords bool
+	// wordIsKeyword is set when the current word is exactly a keyword that some thread
+	// tried to match
+	wordIsKeyword bool
+	// deferredSaves are the threads that are saving the current word into a variable that
+	// avoids keywords. They continue after all the threads have run on the word, once it's
+	// known whether the word is a keyword.
+	deferredSaves []*thread
+
+	// exactKeywords is set when input words must match keywords exactly, rather than
+	// being allowed to be prefixes of them
+	exactKeywords bool
+
+	// maxAmbiguity is the number of complete matches after which execution stops,
+	// since the input is ambiguous anyway. Zero means no limit.
+	maxAmbiguity int
+	// completeMatches is the number of matches found that consumed all the input
+	completeMatches int
+	// stopped is set when execution was stopped early because of maxAmbiguity, or
+	// because ctx was cancelled
+	stopped bool
+	// ctx, if set, stops execution when it's cancelled
+	ctx context.Context
+	// err is the error of ctx if execution was stopped because it was cancelled
+	err error
+	// free are threads that stopped running, which are reused for new threads
+	free []*thread
+	// gen is incremented after each word, when the threads that are still running are
+	// marked with it
+	gen int
+
+	// version is the version of the software, which commands and groups must be
+	// available in to match
+	version string
+
+	// lazyConversion is set when values are only validated while matching, and converted
+	// when VarValue.Convert is called
+	lazyConversion bool
+	// posix is set when the words were split following the rules of a POSIX shell, so that
+	// values of the type cmdline are quoted to split the same way again
+	posix bool
+
+	// threads, instrs and found count the threads started, the instructions executed and
+	// the matches found, for Cmds.Stats
+	threads, instrs, found int
+
+	// checkMatch, if set, returns an error for matches that must be dropped
+	checkMatch func(m match) error
+	// rejected is the first error returned by checkMatch for a match of all the input
+	rejected error
+
+	// collecting is set when the instructions that would consume the next word are
+	// being collected into expected rather than executed
+	collecting bool
+	expected   []*instr
+	// expectedBy are the threads that would execute each of the expected instructions
+	expectedBy []*thread
+	// collectFor, if set, limits the collected instructions to those of threads with
+	// this metadata
+	collectFor interface{}
+	// metaFilter, if set, stops threads whose metadata it returns false for
+	metaFilter func(meta interface{}) bool
+
+	// incremental is set when the input is fed a word at a time, so that the rest of the
+	// input isn't known yet. Threads that would consume it are parked instead.
+	incremental bool
+	// parked are copies of the threads that reached an instruction that consumes the rest
+	// of the input, while running incrementally
+	parked []*thread
+
+	// wordTimes is the time spent on each input word, with the time spent after the
+	// end of the input last. It's only recorded when tracing.
+	wordTimes []time.Duration
+	// opStats is the time spent and number of executions for each opcode. It's only
+	// recorded when tracing.
+	opStats map[opcode]*opStat
+}
+
+type opStat struct {
+	count int
+	time  time.Duration
 }
 
 type threadList []*thread
@@ -37,19 +127,59 @@ type thread struct {
 	pc int
 	// items are the sequence of matched keywords or variables
 	items []binding
+	// words is the number of input words consumed by the items
+	words int
+	// wait is the number of input words the thread must skip because they were
+	// already consumed by an instruction that consumes the rest of the input
+	wait int
+	// sets are the options matched of each set the thread is in
+	sets []setOptions
+	// gen is the generation of the VM when the thread was last known to be running
+	gen int
 
 	meta interface{}
 }
 
+// setOptions are the options of the set ‘id’ that a thread has matched, as bits.
+type setOptions struct {
+	id      int
+	matched int
+}
+
 func (t thread) clone() *thread {
 	var t2 thread
 	t2.pc = t.pc
+	t2.words = t.words
+	t2.wait = t.wait
 	t2.meta = t.meta
+	if t.sets != nil {
+		t2.sets = append([]setOptions{}, t.sets...)
+	}
 	t2.items = make([]binding, len(t.items))
 	copy(t2.items, t.items)
 	return &t2
 }
 
+// clone returns a copy of the thread ‘t’, reusing a thread that stopped running if there
+// is one.
+func (v *vm) clone(t *thread) *thread {
+	v.threads++
+	if len(v.free) == 0 {
+		return t.clone()
+	}
+
+	t2 := v.free[len(v.free)-1]
+	v.free = v.free[:len(v.free)-1]
+	items, sets := t2.items[:0], t2.sets[:0]
+	*t2 = *t
+	t2.items = append(items, t.items...)
+	t2.sets = nil
+	if t.sets != nil {
+		t2.sets = append(sets, t.sets...)
+	}
+	return t2
+}
+
 func (t *thread) setPc(pc int) *thread {
 	t.pc = pc
 	return t
@@ -58,29 +188,145 @@ func (t *thread) setPc(pc int) *thread {
 func (t *thread) bind(instr *instr, val *string) {
 	if t.items == nil {
 		t.items = make([]binding, 1, 10)
-		t.items[0].instr = instr
-		t.items[0].val = val
+		t.items[0] = binding{instr: instr, val: val, word: t.words, words: 1}
 	} else {
-		t.items = append(t.items, binding{instr, val})
+		t.items = append(t.items, binding{instr: instr, val: val, word: t.words, words: 1})
 	}
+	t.words++
+}
+
+// mark records that the thread passed the start or end of a named group.
+func (t *thread) mark(instr *instr) {
+	t.items = append(t.items, binding{instr: instr})
+}
+
+// bindRest binds ‘val’, which was made from the ‘words’ remaining input words, along with
+// the groups captured from it.
+func (t *thread) bindRest(instr *instr, val string, groups []string, words int) {
+	t.items = append(t.items, binding{instr: instr, val: &val, groups: groups, word: t.words, words: words})
+	t.words += words
+	t.wait = words - 1
 }
 
 type match struct {
 	items []interface{}
+	// instrs are the instructions that matched each item
+	instrs []*instr
+	// groups are the items matched by each named group
+	groups []groupSpan
+	// words is the number of input words matched
+	words int
 	meta  interface{}
 }
 
+// groupSpan is the items of a match, from items[start] up to items[end], that were
+// matched by the named group ‘name’.
+type groupSpan struct {
+	name       string
+	start, end int
+}
+
 type VarValue struct {
 	Name  string
 	Type  string
 	Value string
+	// Flags are the flags the variable was annotated with in the command definition.
+	Flags VarFlags
+	// Groups are the values of the capture groups when the type of the variable is a
+	// pattern added with Cmds.AddPattern. Groups[0] is the whole value.
+	Groups []string
+	// Elems are the elements of the value when the variable has a list type.
+	Elems []string
+	// Bytes is the decoded value when the variable has the type hex or base64.
+	Bytes []byte
+	// Converted is the value converted to a Go value for types that convert their
+	// values. For the json type it's a json.RawMessage, and for types added with
+	// Cmds.AddJSONType it's a pointer to the decoded value. It's nil when conversion is
+	// deferred with Cmds.SetLazyConversion; Convert returns it either way.
+	Converted interface{}
+	// Span is where the value is in the input.
+	Span Span
+
+	// lazy converts the value when Convert is called, if conversion is lazy
+	lazy *lazyConversion
 }
 
-type keywordValue struct {
-	Name  string
+// Span is where in the input a keyword or variable was matched.
+type Span struct {
+	// Word is the index of the first input word matched.
+	Word int
+	// Words is the number of input words matched, which is more than one only for
+	// variables whose type consumes the rest of the input or that are matched by a custom
+	// instruction.
+	Words int
+	// Start is the offset in runes of the start of the first word in the input, and End
+	// the offset just past the end of the last word, including any quotes. They are -1
+	// when the words weren't split from text, as for Classify.
+	Start, End int
+}
+
+// Redacted returns the value, or a placeholder if the variable is sensitive.
+func (v VarValue) Redacted() string {
+	if v.Flags.IsSensitive() {
+		return redacted
+	}
+	return v.Value
+}
+
+// Int returns the value as an integer. For variables of the type int this is the
+// converted value; otherwise the value is parsed, and an error is returned if it's not an
+// integer.
+func (v VarValue) Int() (int64, error) {
+	if i, ok := v.converted().(int64); ok {
+		return i, nil
+	}
+	i, err := intType{}.Convert(v.Value)
+	if err != nil {
+		return 0, err
+	}
+	return i.(int64), nil
+}
+
+// Float returns the value as a floating point number. For variables of the type float
+// this is the converted value; otherwise the value is parsed, and an error is returned if
+// it's not a number.
+func (v VarValue) Float() (float64, error) {
+	if f, ok := v.converted().(float64); ok {
+		return f, nil
+	}
+	f, err := floatType{}.Convert(v.Value)
+	if err != nil {
+		return 0, err
+	}
+	return f.(float64), nil
+}
+
+// Bool returns the value as a boolean. For variables of the type bool this is the
+// converted value; otherwise the value is parsed, and an error is returned if it's not
+// true or false.
+func (v VarValue) Bool() (bool, error) {
+	if b, ok := v.converted().(bool); ok {
+		return b, nil
+	}
+	b, err := boolType{}.Convert(v.Value)
+	if err != nil {
+		return false, err
+	}
+	return b.(bool), nil
+}
+
+// Keyword is a keyword that was matched.
+type Keyword struct {
+	// Name is the keyword as it's written in the command definition.
+	Name string
+	// Value is the input word, which may be an abbreviation of the keyword.
 	Value string
+	// Span is where the word is in the input.
+	Span Span
 }
 
+type keywordValue Keyword
+
 // binding is a binding of a keyword to the value the user entered for it,
 // or a variable name and type to the value the user entered.
 // The pointer to an instruction defines the keyword or name and type of the variable,
@@ -88,49 +334,153 @@ type keywordValue struct {
 type binding struct {
 	instr *instr
 	val   *string
+	// groups are the capture groups when the instruction matched a pattern
+	groups []string
+	// conv is the converted value for variables whose type converts values
+	conv interface{}
+	// lazy is the type to convert the value with when conversion was deferred
+	lazy Type
+	// word is the index of the first input word bound, and words the number of words
+	word, words int
 }
 
 // input are the space-separated words of the command the user entered, split on spaces.
 func (v *vm) execute(prog prog, input []string) {
+	v.start(prog, input)
+	v.processInput()
+	v.processWord(nil)
+	v.finishThreads()
+
+	v.traceTimings()
+}
+
+// expectations runs the program on ‘input’ and then returns the instructions that could
+// consume the next word, instead of matching. The returned instructions include the
+// opMatch instruction if the input is a complete command.
+func (v *vm) expectations(prog prog, input []string) []*instr {
+	v.start(prog, input)
+	v.processInput()
+	v.collecting = true
+	v.processWord(nil)
+	v.collecting = false
+	return v.expected
+}
+
+// start prepares the VM to run ‘prog’ on ‘input’.
+func (v *vm) start(prog prog, input []string) {
 	v.prog = prog
 	v.input = input
 
 	v.makeThreadLists()
-	v.matches = make([]match, 0, 10)
+	if v.matches == nil {
+		v.matches = make([]match, 0, 10)
+	}
+	v.matches = v.matches[:0]
 
-	v.gen = 1
+	v.completeMatches = 0
+	v.stopped = false
+	v.err = nil
+	v.hasSensitive = prog.sensitive
 
-	v.addThread(v.currentThreads, &thread{pc: 0})
-	for v.wordIndex = range input {
-		v.processWord(&input[v.wordIndex])
+	if v.traceWriter != nil {
+		v.wordTimes = make([]time.Duration, len(input)+1)
+		v.opStats = make(map[opcode]*opStat)
 	}
-	v.processWord(nil)
-	v.finishThreads()
 
+	v.expected = nil
+	v.expectedBy = nil
+
+	v.addThread(v.currentThreads, v.clone(&thread{pc: 0}))
+}
+
+// processInput runs the threads on each word of the input.
+func (v *vm) processInput() {
+	for v.wordIndex = range v.input {
+		if v.stopped {
+			break
+		}
+		v.processWord(&v.input[v.wordIndex])
+	}
 }
 
 func (v *vm) makeThreadLists() {
-	l := make(threadList, 0, len(v.prog))
+	if v.currentThreads != nil && cap(*v.currentThreads) >= len(v.prog.instrs) && cap(*v.nextThreads) >= len(v.prog.instrs) {
+		v.clear(v.currentThreads)
+		v.clear(v.nextThreads)
+		return
+	}
+
+	l := make(threadList, 0, len(v.prog.instrs))
 	v.currentThreads = &l
-	l2 := make(threadList, 0, len(v.prog))
+	l2 := make(threadList, 0, len(v.prog.instrs))
 	v.nextThreads = &l2
 }
 
 func (v *vm) processWord(word *string) {
+	if v.traceWriter != nil {
+		start := time.Now()
+		defer func() {
+			i := len(v.wordTimes) - 1
+			if word != nil {
+				i = v.wordIndex
+			}
+			v.wordTimes[i] += time.Since(start)
+		}()
+	}
 
-	v.gen++
 	// New threads may get appended to the currentThreads while we are iterating it
 	// Thus we use an index-based iteration.
-	for i := 0; i < len(*v.currentThreads); i++ {
+	for i := 0; i < len(*v.currentThreads) && !v.stopped; i++ {
+		// Checking the context is slower than running an instruction, so it's only
+		// checked now and then
+		if v.ctx != nil && i%ctxCheckInterval == 0 && v.cancelled() {
+			break
+		}
 
 		v.thread = (*v.currentThreads)[i]
 		v.continu(word)
 	}
+	v.finishDeferredSaves(word)
+	v.recycle()
 
 	v.swap(v.currentThreads, v.nextThreads)
 	v.clear(v.nextThreads)
 }
 
+// ctxCheckInterval is the number of threads run between checks of whether the context
+// was cancelled, so that pathological inputs with many threads per word can be stopped.
+const ctxCheckInterval = 1024
+
+// cancelled stops execution and returns true if the context of the VM was cancelled.
+func (v *vm) cancelled() bool {
+	if err := v.ctx.Err(); err != nil {
+		v.err = err
+		v.stopped = true
+		return true
+	}
+	return false
+}
+
+// recycle adds the threads that ran on the current word and stopped running to the free
+// list. Threads whose expectations are being collected are kept, since they are returned.
+func (v *vm) recycle() {
+	if v.collecting {
+		return
+	}
+
+	v.gen++
+	for _, t := range *v.nextThreads {
+		t.gen = v.gen
+	}
+	for _, t := range *v.currentThreads {
+		// A thread may be in the list more than once
+		if t.gen != v.gen {
+			t.gen = v.gen
+			v.free = append(v.free, t)
+		}
+	}
+}
+
 func (v *vm) finishThreads() {
 	// We need to continue the threads one last time since on the final word of the input
 	// the thread completes executing the final opCmp or opSave instruction, but is then
@@ -145,23 +495,68 @@ func (v *vm) continu(word *string) {
 	// current input word). Some are instead added to the nextThreads list because they
 	// must match the next word only.
 
+	if v.thread.wait > 0 {
+		// The word was already consumed
+		v.thread.wait--
+		v.addThread(v.nextThreads, v.thread)
+		return
+	}
+
 	instr := v.currentinstr()
+	v.instrs++
 	v.trace()
+	if v.traceWriter != nil {
+		defer v.recordOp(instr.opcode, time.Now())
+	}
+
+	if v.collecting {
+		switch instr.opcode {
+		case opCmp, opSave, opSaveRest, opCustom, opMatch:
+			if v.collectFor == nil || v.thread.meta == v.collectFor {
+				v.expected = append(v.expected, instr)
+				v.expectedBy = append(v.expectedBy, v.thread)
+			}
+			return
+		}
+	}
+
 	switch instr.opcode {
 	case opNop:
 		return
 	case opJmp:
 		v.doJmp(instr)
 	case opMatch:
+		if v.incremental && word != nil {
+			// The thread matched the input before the word, which is no longer of interest
+			return
+		}
 		v.addMatch(v.thread)
 	case opSplit:
 		v.doSplit(instr)
 	case opCmp:
 		v.doCmp(instr, word)
 	case opSave:
+		if word != nil && (v.avoidKeywords || VarFlags(instr.ints[0]).Has(VarNoKeyword)) {
+			v.deferredSaves = append(v.deferredSaves, v.thread)
+			return
+		}
 		v.doSave(instr, word)
+	case opSaveRest:
+		if v.incremental && word != nil {
+			v.parked = append(v.parked, v.thread.clone())
+			return
+		}
+		v.doSaveRest(instr, word)
+	case opCustom:
+		v.doCustom(instr, word)
 	case opMeta:
 		v.doMeta(instr)
+	case opGroupStart, opGroupEnd:
+		v.doGroup(instr)
+	case opSetOption:
+		v.doSetOption(instr)
+	case opSetEnd:
+		v.doSetEnd(instr)
 	default:
 		panic(fmt.Sprintf("Unknown instruction %v", instr))
 	}
@@ -173,14 +568,22 @@ func (v *vm) doJmp(instr *instr) {
 }
 
 func (v *vm) doSplit(instr *instr) {
-	t2 := v.thread.clone().setPc(instr.ints[1])
+	t2 := v.clone(v.thread).setPc(instr.ints[1])
 	v.thread.pc = instr.ints[0]
 	v.addThread(v.currentThreads, v.thread)
 	v.addThread(v.currentThreads, t2)
 }
 
 func (v *vm) doCmp(instr *instr, word *string) {
-	if word != nil && strings.HasPrefix(instr.strs[0], *word) {
+	if word == nil {
+		return
+	}
+	exact := v.exactKeywords || instr.ints[0] == cmpExact
+	matched := v.cmpKeyword(instr.strs[0], *word, exact)
+	for _, alias := range instr.aliases {
+		matched = v.cmpKeyword(alias, *word, exact) || matched
+	}
+	if matched {
 		v.thread.bind(instr, word)
 		v.traceBind()
 		v.thread.pc++
@@ -188,27 +591,211 @@ func (v *vm) doCmp(instr *instr, word *string) {
 	}
 }
 
+// cmpKeyword returns true if ‘word’ matches the spelling ‘kw’ of a keyword. If ‘exact’ is
+// set the word must be spelled in full.
+func (v *vm) cmpKeyword(kw, word string, exact bool) bool {
+	if word == kw {
+		v.wordIsKeyword = true
+		return true
+	}
+	return !exact && strings.HasPrefix(kw, word)
+}
+
 func (v *vm) doSave(instr *instr, word *string) {
-	if word != nil {
-		v.thread.bind(instr, word)
-		v.traceBind()
-		v.thread.pc++
-		v.addThread(v.nextThreads, v.thread)
+	if word == nil {
+		return
 	}
+
+	if instr.excludes(*word) {
+		return
+	}
+
+	var conv interface{}
+	var lazy Type
+	if t, ok := instr.intf.(Type); ok {
+		if t.Validate(*word) != nil {
+			return
+		}
+		if !v.convertNow(t) {
+			lazy = t
+		} else {
+			var err error
+			if conv, err = t.Convert(*word); err != nil {
+				return
+			}
+		}
+	}
+
+	v.thread.bind(instr, word)
+	b := &v.thread.items[len(v.thread.items)-1]
+	b.conv, b.lazy = conv, lazy
+	v.traceBind()
+	v.thread.pc++
+	v.addThread(v.nextThreads, v.thread)
+}
+
+// finishDeferredSaves continues the threads whose save of ‘word’ was deferred, unless the
+// word turned out to be a keyword.
+func (v *vm) finishDeferredSaves(word *string) {
+	if !v.wordIsKeyword {
+		for _, t := range v.deferredSaves {
+			v.thread = t
+			v.doSave(v.currentinstr(), word)
+		}
+	}
+	v.deferredSaves = v.deferredSaves[:0]
+	v.wordIsKeyword = false
+}
+
+func (v *vm) doSaveRest(instr *instr, word *string) {
+	if word == nil {
+		return
+	}
+
+	rest := v.input[v.wordIndex:]
+	val := strings.Join(rest, " ")
+	text, haveRaw := v.raw.from(v.wordIndex)
+	if _, ok := instr.intf.(rawRestType); ok && haveRaw {
+		val = text
+	} else if _, ok := instr.intf.(quotedRestType); ok {
+		quote := quoteIfNeeded
+		if v.posix {
+			quote = posixQuoteIfNeeded
+		}
+		quoted := make([]string, len(rest))
+		for i, w := range rest {
+			quoted[i] = quote(w)
+		}
+		val = strings.Join(quoted, " ")
+	}
+
+	if instr.excludes(val) {
+		return
+	}
+
+	var groups []string
+	var conv interface{}
+	var lazy Type
+	if t, ok := instr.intf.(Type); ok {
+		if t.Validate(val) != nil {
+			return
+		}
+		if !v.convertNow(t) {
+			lazy = t
+		} else {
+			var err error
+			if conv, err = t.Convert(val); err != nil {
+				return
+			}
+			// The values of patterns are their capture groups
+			if groups, _ = conv.([]string); groups != nil {
+				conv = nil
+			}
+		}
+	}
+
+	v.thread.bindRest(instr, val, groups, len(rest))
+	b := &v.thread.items[len(v.thread.items)-1]
+	b.conv, b.lazy = conv, lazy
+	v.traceBind()
+	v.thread.pc++
+	v.addThread(v.nextThreads, v.thread)
+}
+
+// doCustom binds the words from ‘word’ on that the custom instruction ‘instr’ matches. An
+// instruction that failed to compile has no operand and doesn't match.
+func (v *vm) doCustom(instr *instr, word *string) {
+	ci, ok := instr.intf.(compiledInstruction)
+	if word == nil || !ok {
+		return
+	}
+
+	rest := v.input[v.wordIndex:]
+	n := ci.inst.Match(ci.operand, rest)
+	if n <= 0 || n > len(rest) {
+		return
+	}
+
+	v.thread.bindRest(instr, strings.Join(rest[:n], " "), nil, n)
+	v.traceBind()
+	v.thread.pc++
+	v.addThread(v.nextThreads, v.thread)
 }
 
 func (v *vm) doMeta(instr *instr) {
+	if v.metaFilter != nil && !v.metaFilter(instr.intf) {
+		return
+	}
+	if cmd, ok := instr.intf.(*command); ok && !cmd.availableIn(v.version) {
+		return
+	}
 	v.thread.meta = instr.intf
 	v.thread.pc++
 	v.addThread(v.currentThreads, v.thread)
 }
 
+func (v *vm) doGroup(instr *instr) {
+	if cmd, ok := v.thread.meta.(*command); ok && instr.opcode == opGroupStart && !cmd.groupAvailableIn(instr.strs[0], v.version) {
+		return
+	}
+	v.thread.mark(instr)
+	v.thread.pc++
+	v.addThread(v.currentThreads, v.thread)
+}
+
+func (v *vm) doSetOption(instr *instr) {
+	t := v.thread
+	bit := 1 << uint(instr.ints[1])
+	i := t.setIndex(instr.ints[0])
+	if i < 0 {
+		t.sets = append(t.sets, setOptions{id: instr.ints[0]})
+		i = len(t.sets) - 1
+	}
+	if t.sets[i].matched&bit != 0 {
+		// Each option may only be entered once
+		return
+	}
+	t.sets[i].matched |= bit
+	t.pc++
+	v.addThread(v.currentThreads, t)
+}
+
+func (v *vm) doSetEnd(instr *instr) {
+	t := v.thread
+	matched := 0
+	if i := t.setIndex(instr.ints[0]); i >= 0 {
+		matched = t.sets[i].matched
+		// The set may be entered again if it's repeated
+		t.sets = append(t.sets[:i:i], t.sets[i+1:]...)
+	}
+	if matched&instr.ints[1] != instr.ints[1] {
+		return
+	}
+	t.pc++
+	v.addThread(v.currentThreads, t)
+}
+
+// setIndex returns the index in t.sets of the set ‘id’, or -1 if the thread hasn't matched
+// any of its options.
+func (t *thread) setIndex(id int) int {
+	for i := range t.sets {
+		if t.sets[i].id == id {
+			return i
+		}
+	}
+	return -1
+}
+
 func (v *vm) trace() {
 	if v.traceWriter == nil {
 		return
 	}
 
-	word := v.input[v.wordIndex]
+	word := v.traceWord()
+	if v.hasSensitive {
+		// Any word might end up bound to a sensitive variable
+		word = redacted
+	}
 	fmt.Fprintf(v.traceWriter, "trace: thread pc=%d %v on word '%s'\n",
 		v.thread.pc, v.currentinstr(), word)
 }
@@ -218,35 +805,143 @@ func (v *vm) traceBind() {
 		return
 	}
 
-	word := v.input[v.wordIndex]
+	word := v.traceWord()
+	if v.hasSensitive {
+		word = redacted
+	}
 	fmt.Fprintf(v.traceWriter, "trace:     binding %s (%d items)\n",
 		word, len(v.thread.items))
 }
 
+// traceWord returns the current input word for the trace.
+func (v *vm) traceWord() string {
+	if len(v.input) == 0 {
+		return ""
+	}
+	return v.input[v.wordIndex]
+}
+
+func (v *vm) recordOp(op opcode, start time.Time) {
+	st, ok := v.opStats[op]
+	if !ok {
+		st = &opStat{}
+		v.opStats[op] = st
+	}
+	st.count++
+	st.time += time.Since(start)
+}
+
+// traceTimings prints the time spent on each word, and the time spent on each
+// opcode with the most expensive first.
+func (v *vm) traceTimings() {
+	if v.traceWriter == nil {
+		return
+	}
+
+	for i, d := range v.wordTimes {
+		if i == len(v.input) {
+			fmt.Fprintf(v.traceWriter, "trace: timing: end of input took %v\n", d)
+			continue
+		}
+		word := v.input[i]
+		if v.hasSensitive {
+			word = redacted
+		}
+		fmt.Fprintf(v.traceWriter, "trace: timing: word %d '%s' took %v\n", i, word, d)
+	}
+
+	ops := make([]opcode, 0, len(v.opStats))
+	for op := range v.opStats {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return v.opStats[ops[i]].time > v.opStats[ops[j]].time
+	})
+
+	for _, op := range ops {
+		st := v.opStats[op]
+		fmt.Fprintf(v.traceWriter, "trace: timing: %s executed %d times took %v\n", op, st.count, st.time)
+	}
+}
+
+// redacted is printed in place of values that must not be logged.
+const redacted = "<redacted>"
+
 func (v *vm) addMatch(t *thread) {
+	m := t.toMatch(v.raw)
+	if v.checkMatch != nil {
+		if err := v.checkMatch(m); err != nil {
+			if m.words == len(v.input) && v.rejected == nil {
+				v.rejected = err
+			}
+			return
+		}
+	}
+	v.matches = append(v.matches, m)
+	v.found++
+
+	if m.words == len(v.input) {
+		v.completeMatches++
+		if v.maxAmbiguity > 0 && v.completeMatches > v.maxAmbiguity {
+			v.stopped = true
+			if v.traceWriter != nil {
+				fmt.Fprintf(v.traceWriter, "trace: stopping: more than %d complete matches\n", v.maxAmbiguity)
+			}
+		}
+	}
+}
+
+// toMatch returns a match made of what the thread has matched so far. The spans of the
+// items are found in ‘raw’, which may be nil if the input wasn't split from text.
+func (t *thread) toMatch(raw *rawInput) match {
 	var m match
+	var open []int
 	for _, b := range t.items {
 		var item interface{}
 		switch b.instr.opcode {
+		case opGroupStart:
+			open = append(open, len(m.groups))
+			m.groups = append(m.groups, groupSpan{name: b.instr.strs[0], start: len(m.items)})
+			continue
+		case opGroupEnd:
+			m.groups[open[len(open)-1]].end = len(m.items)
+			open = open[:len(open)-1]
+			continue
 		case opCmp:
-			item = keywordValue{Name: b.instr.strs[0], Value: *b.val}
-		case opSave:
-			item = VarValue{Name: b.instr.strs[0],
-				Type:  b.instr.strs[1],
-				Value: *b.val,
+			item = keywordValue{Name: b.instr.strs[0], Value: *b.val, Span: raw.span(b.word, b.words)}
+		case opSave, opSaveRest, opCustom:
+			vv := VarValue{Name: b.instr.strs[0],
+				Type:      b.instr.strs[1],
+				Value:     *b.val,
+				Flags:     VarFlags(b.instr.ints[0]),
+				Groups:    b.groups,
+				Converted: b.conv,
+				Span:      raw.span(b.word, b.words),
+			}
+			switch conv := b.conv.(type) {
+			case []string:
+				vv.Elems = conv
+			case []byte:
+				vv.Bytes = conv
+			}
+			if b.lazy != nil {
+				vv.lazy = &lazyConversion{typ: b.lazy}
 			}
+			item = vv
 		default:
 			panic("Unsupported opcode in thread bindings")
 		}
 
 		m.items = append(m.items, item)
+		m.instrs = append(m.instrs, b.instr)
 	}
+	m.words = t.words
 	m.meta = t.meta
-	v.matches = append(v.matches, m)
+	return m
 }
 
 func (v *vm) currentinstr() *instr {
-	return &v.prog[v.thread.pc]
+	return &v.prog.instrs[v.thread.pc]
 }
 
 func (v *vm) currentWord() *string {
@@ -262,13 +957,9 @@ func (v *vm) clear(l *threadList) {
 }
 
 func (v *vm) addThread(l *threadList, t *thread) {
-	if len(v.prog) == 0 {
+	if len(v.prog.instrs) == 0 {
 		return
 	}
-	instr := &v.prog[t.pc]
-	if instr.gen == v.gen {
-		return // already on the list
-	}
 	*l = append(*l, t)
 }
 
@@ -276,10 +967,10 @@ func (v *vm) longestMatches() []match {
 	count := 0
 	mlen := 0
 	for _, m := range v.matches {
-		if len(m.items) > mlen {
+		if m.words > mlen {
 			count = 1
-			mlen = len(m.items)
-		} else if len(m.items) == mlen {
+			mlen = m.words
+		} else if m.words == mlen {
 			count++
 		}
 	}
@@ -287,7 +978,7 @@ func (v *vm) longestMatches() []match {
 	matches := make([]match, count)
 	i := 0
 	for _, m := range v.matches {
-		if len(m.items) == mlen {
+		if m.words == mlen {
 			matches[i] = m
 			i++
 		}
@@ -298,7 +989,7 @@ func (v *vm) longestMatches() []match {
 
 func (v *vm) maximalMatches() []match {
 	m := v.longestMatches()
-	if len(m) > 0 && len(m[0].items) != len(v.input) {
+	if len(m) > 0 && m[0].words != len(v.input) {
 		m = []match{}
 	}
 	return m
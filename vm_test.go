@@ -3,6 +3,8 @@ package cmdparse
 import (
 	"bytes"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -53,8 +55,7 @@ func TestVmClear(t *testing.T) {
 func TestVmAddThread(t *testing.T) {
 	var v vm
 	v.makeThreadLists()
-	v.prog = make([]instr, 10)
-	v.gen = 1
+	v.prog = newProg(make([]instr, 10))
 	v.addThread(v.currentThreads, &thread{pc: 0})
 
 	if (*v.currentThreads)[0] == nil {
@@ -77,7 +78,7 @@ func TestVm(t *testing.T) {
 			input:  []string{"show"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"show", "show"}}},
+				{items: []interface{}{keywordValue{Name: "show", Value: "show"}}},
 			},
 		},
 		{
@@ -86,7 +87,7 @@ func TestVm(t *testing.T) {
 			input:  []string{"show", "something"},
 			valid:  false,
 			expected: []match{
-				{items: []interface{}{keywordValue{"show", "show"}}},
+				{items: []interface{}{keywordValue{Name: "show", Value: "show"}}},
 			},
 		},
 		{
@@ -95,7 +96,7 @@ func TestVm(t *testing.T) {
 			input:  []string{"te"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"tell", "te"}}},
+				{items: []interface{}{keywordValue{Name: "tell", Value: "te"}}},
 			},
 		},
 		{
@@ -104,8 +105,8 @@ func TestVm(t *testing.T) {
 			input:  []string{"get", "hat"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"get", "get"},
-					keywordValue{"hat", "hat"}}},
+				{items: []interface{}{keywordValue{Name: "get", Value: "get"},
+					keywordValue{Name: "hat", Value: "hat"}}},
 			},
 		},
 		{
@@ -114,8 +115,8 @@ func TestVm(t *testing.T) {
 			input:  []string{"get", "a.html"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"get", "get"},
-					VarValue{"file", "str", "a.html"}}},
+				{items: []interface{}{keywordValue{Name: "get", Value: "get"},
+					VarValue{Name: "file", Type: "str", Value: "a.html"}}},
 			},
 		},
 		{
@@ -124,9 +125,9 @@ func TestVm(t *testing.T) {
 			input:  []string{"get", "a.html", "v"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"get", "get"},
-					VarValue{"file", "str", "a.html"},
-					keywordValue{"verbose", "v"}}},
+				{items: []interface{}{keywordValue{Name: "get", Value: "get"},
+					VarValue{Name: "file", Type: "str", Value: "a.html"},
+					keywordValue{Name: "verbose", Value: "v"}}},
 			},
 		},
 		{
@@ -138,10 +139,10 @@ func TestVm(t *testing.T) {
 			input:  []string{"get", "v"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"get", "get"},
-					keywordValue{"verbose", "v"}}},
-				{items: []interface{}{keywordValue{"get", "get"},
-					VarValue{"file", "str", "v"}}},
+				{items: []interface{}{keywordValue{Name: "get", Value: "get"},
+					keywordValue{Name: "verbose", Value: "v"}}},
+				{items: []interface{}{keywordValue{Name: "get", Value: "get"},
+					VarValue{Name: "file", Type: "str", Value: "v"}}},
 			},
 		},
 		{
@@ -151,10 +152,10 @@ func TestVm(t *testing.T) {
 			input:  []string{"do", "thing"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"do", "do"},
-					VarValue{"v", "str", "thing"}}},
-				{items: []interface{}{keywordValue{"do", "do"},
-					keywordValue{"thing", "thing"}}},
+				{items: []interface{}{keywordValue{Name: "do", Value: "do"},
+					VarValue{Name: "v", Type: "str", Value: "thing"}}},
+				{items: []interface{}{keywordValue{Name: "do", Value: "do"},
+					keywordValue{Name: "thing", Value: "thing"}}},
 			},
 		},
 		{
@@ -164,13 +165,23 @@ func TestVm(t *testing.T) {
 			input:  []string{"a", "1", "2", "3"},
 			valid:  true,
 			expected: []match{
-				{items: []interface{}{keywordValue{"add", "a"},
-					VarValue{"n", "int", "1"},
-					VarValue{"n", "int", "2"},
-					VarValue{"n", "int", "3"}},
+				{items: []interface{}{keywordValue{Name: "add", Value: "a"},
+					VarValue{Name: "n", Type: "int", Value: "1", Converted: int64(1)},
+					VarValue{Name: "n", Type: "int", Value: "2", Converted: int64(2)},
+					VarValue{Name: "n", Type: "int", Value: "3", Converted: int64(3)}},
 				},
 			},
 		},
+		{
+			name:   "login <password!secret>",
+			syntax: "login <password!secret>",
+			input:  []string{"login", "hunter2"},
+			valid:  true,
+			expected: []match{
+				{items: []interface{}{keywordValue{Name: "login", Value: "login"},
+					VarValue{Name: "password", Type: "str", Value: "hunter2", Flags: VarSecret}}},
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -272,7 +283,9 @@ func (c MatchComparer) ensureItemEqual(exp, act interface{}) {
 		if !ok {
 			c.fail("Expected match %v but actual match is %v", c.exp, c.act)
 		}
-		if expReal != actReal {
+		// Spans are tested separately
+		actReal.Span = Span{}
+		if !reflect.DeepEqual(expReal, actReal) {
 			c.fail("Expected match %v but actual match is %v", c.exp, c.act)
 		}
 	}
@@ -290,3 +303,70 @@ func (c MatchComparer) progToStr() string {
 	c.prog.Print(&buf)
 	return buf.String()
 }
+
+func TestVmTraceTimings(t *testing.T) {
+	var s scanner
+	tokens, _ := s.Scan("get <file>")
+
+	var p parser
+	ptree, _ := p.Parse(tokens)
+
+	var c compiler
+	c.compile(ptree)
+
+	var buf bytes.Buffer
+	var v vm
+	v.traceWriter = &buf
+	v.execute(c.prog(), []string{"get", "a.txt"})
+
+	for _, exp := range []string{
+		"trace: timing: word 0 'get' took",
+		"trace: timing: word 1 'a.txt' took",
+		"trace: timing: end of input took",
+		"trace: timing: cmp executed 1 times took",
+		"trace: timing: save executed 1 times took",
+		"trace: timing: match executed 1 times took",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Fatalf("Expected the trace to contain ‘%s’. Trace:\n%s", exp, buf.String())
+		}
+	}
+}
+
+func TestVmMaxAmbiguity(t *testing.T) {
+	var s scanner
+	tokens, _ := s.Scan("set (<a> | <b> | <c> | <d>)")
+
+	var p parser
+	ptree, _ := p.Parse(tokens)
+
+	var c compiler
+	c.compile(ptree)
+
+	tests := []struct {
+		name         string
+		maxAmbiguity int
+		matches      int
+		stopped      bool
+	}{
+		{"unlimited", 0, 4, false},
+		{"one", 1, 2, true},
+		{"two", 2, 3, true},
+		{"four", 4, 4, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var v vm
+			v.maxAmbiguity = tc.maxAmbiguity
+			v.execute(c.prog(), []string{"set", "x"})
+
+			if len(v.maximalMatches()) != tc.matches {
+				t.Fatalf("Expected %d matches but found %d", tc.matches, len(v.maximalMatches()))
+			}
+			if v.stopped != tc.stopped {
+				t.Fatalf("Expected stopped to be %v but it was %v", tc.stopped, v.stopped)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package cmdparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxBranchesWithoutWarning is the most ways a command may match before Compile warns
+// that it has a huge number of branches. Repetitions are counted as being matched zero
+// or one times.
+const maxBranchesWithoutWarning = 10000
+
+// WarningKind tells what kind of problem a Warning is about.
+type WarningKind int
+
+const (
+	// ShadowedKeywordWarning is about a keyword that is an alternative to another keyword
+	// that it's the same as or a prefix of, so that entering it is ambiguous.
+	ShadowedKeywordWarning WarningKind = iota
+	// NullableRepetitionWarning is about a repetition of something that may match no
+	// words, such as ‘(a?)*’, which matches the same input in many ways.
+	NullableRepetitionWarning
+	// BranchCountWarning is about a command with a huge number of branches, which is slow
+	// to match.
+	BranchCountWarning
+	// InvalidExampleWarning is about an example added with AddExample that doesn't match
+	// only the command it's an example of.
+	InvalidExampleWarning
+	// CollisionWarning is about two commands that match the same input, which is only
+	// looked for with the ReportCollisions policy.
+	CollisionWarning
+	// DuplicateCommandWarning is about a command that is the same as an earlier one. It's
+	// only returned by CompileStrict.
+	DuplicateCommandWarning
+	// UnknownTypeWarning is about a variable whose type isn't built in or added with
+	// AddType, so that it matches any word. It's only returned by CompileStrict.
+	UnknownTypeWarning
+	// UnreachableCommandWarning is about a command that no input can run, because the
+	// input also matches other commands. It's only returned by CompileStrict.
+	UnreachableCommandWarning
+	// InstructionWarning is about a variable whose custom instruction wasn't added with
+	// AddInstruction or fails to compile, so that it matches no words.
+	InstructionWarning
+)
+
+func (k WarningKind) String() string {
+	switch k {
+	case ShadowedKeywordWarning:
+		return "shadowed keyword"
+	case NullableRepetitionWarning:
+		return "nullable repetition"
+	case BranchCountWarning:
+		return "branch count"
+	case InvalidExampleWarning:
+		return "invalid example"
+	case CollisionWarning:
+		return "collision"
+	case DuplicateCommandWarning:
+		return "duplicate command"
+	case UnknownTypeWarning:
+		return "unknown type"
+	case UnreachableCommandWarning:
+		return "unreachable command"
+	case InstructionWarning:
+		return "invalid instruction"
+	}
+	return "<unknown>"
+}
+
+// Warning is a possible mistake in a command definition found by Compile. Unlike an
+// error, a warning doesn't stop the command from being used.
+type Warning struct {
+	Kind WarningKind
+	// Syntax is the definition of the command.
+	Syntax  string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s in ‘%s’: %s", w.Kind, w.Syntax, w.Message)
+}
+
+// Warnings are the warnings returned by Compile, in the order the commands were added.
+type Warnings []Warning
+
+func (w Warnings) String() string {
+	s := make([]string, len(w))
+	for i, warning := range w {
+		s[i] = warning.String()
+	}
+	return strings.Join(s, "\n")
+}
+
+// warnings returns the warnings for the parse tree of the command ‘cmd’. ‘exact’ is set
+// when keywords can't be abbreviated.
+func (cmd *command) warnings(exact bool) (w Warnings) {
+	add := func(kind WarningKind, format string, args ...interface{}) {
+		w = append(w, Warning{Kind: kind, Syntax: cmd.syntax, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var walk func(tree interface{})
+	walk = func(tree interface{}) {
+		switch node := tree.(type) {
+		case alts:
+			chs := alternatives(node)
+			var kws []alternativeKeyword
+			for _, ch := range chs {
+				switch n := ch.(type) {
+				case word:
+					kws = append(kws, alternativeKeyword{kw: string(n)})
+				case exactWord:
+					kws = append(kws, alternativeKeyword{kw: string(n), exact: true})
+				case aliasedWord:
+					kws = append(kws, alternativeKeyword{kw: n.Keyword, exact: n.Exact})
+				}
+			}
+
+			for i, a := range kws {
+				for _, b := range kws[:i] {
+					if a.kw == b.kw {
+						add(ShadowedKeywordWarning, "the alternative ‘%s’ is the same as an earlier one", a.kw)
+						break
+					}
+				}
+				for _, b := range kws {
+					if !exact && !b.exact && a.kw != b.kw && strings.HasPrefix(b.kw, a.kw) {
+						add(ShadowedKeywordWarning, "the alternative ‘%s’ can't be entered without also matching ‘%s’", a.kw, b.kw)
+						break
+					}
+				}
+			}
+			for _, ch := range chs {
+				walk(ch)
+			}
+		case terms:
+			walk(node.Left)
+			walk(node.Right)
+		case rep:
+			once := node.Op == repeatZeroOrOne || (node.Op == repeatCounted && node.Max == 1)
+			if _, nullable, _ := firstWords(node.Term); nullable && !once {
+				add(NullableRepetitionWarning, "the repeated part may match no words, so input can match it in many ways")
+			}
+			walk(node.Term)
+		case group:
+			walk(node.Term)
+		case set:
+			for _, opt := range node.Options {
+				walk(opt)
+			}
+		}
+	}
+	walk(cmd.tree)
+
+	if n := branchCount(cmd.tree); n > maxBranchesWithoutWarning {
+		add(BranchCountWarning, "the command has more than %d branches, which makes it slow to match", maxBranchesWithoutWarning)
+	}
+	return
+}
+
+// alternativeKeyword is an alternative that is a single keyword.
+type alternativeKeyword struct {
+	kw    string
+	exact bool
+}
+
+// alternatives returns the alternatives of ‘a’, including those of alternatives nested
+// directly within it, as in ‘a | b | c’.
+func alternatives(a alts) (chs []interface{}) {
+	for _, ch := range []interface{}{a.Left, a.Right} {
+		if node, ok := ch.(alts); ok {
+			chs = append(chs, alternatives(node)...)
+		} else {
+			chs = append(chs, ch)
+		}
+	}
+	return
+}
+
+// branchCount returns the number of ways the parse tree ‘tree’ may match, counting
+// repetitions as matching zero or one times. Counting stops once the count is more than
+// maxBranchesWithoutWarning.
+func branchCount(tree interface{}) int {
+	limit := func(n int) int {
+		if n > maxBranchesWithoutWarning {
+			return maxBranchesWithoutWarning + 1
+		}
+		return n
+	}
+
+	switch node := tree.(type) {
+	case alts:
+		return limit(branchCount(node.Left) + branchCount(node.Right))
+	case terms:
+		return limit(branchCount(node.Left) * branchCount(node.Right))
+	case rep:
+		if node.Op == repeatCounted {
+			return branchCount(node.unrolled())
+		}
+		if node.Op == repeatOneOrMore {
+			return branchCount(node.Term)
+		}
+		return limit(1 + branchCount(node.Term))
+	case group:
+		return branchCount(node.Term)
+	case set:
+		// Count the options as if they were in a fixed order
+		n := 1
+		for i, opt := range node.Options {
+			m := branchCount(opt)
+			if node.Optional[i] {
+				m++
+			}
+			n = limit(n * m)
+		}
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,45 @@
+package cmdparse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		syntax   string
+		exact    bool
+		expected []string
+	}{
+		{"clean", "show (status | version) <v>* <w>?", false, nil},
+		{"abbreviation", "(show | sh) status", false, []string{"shadowed keyword in ‘(show | sh) status’: the alternative ‘sh’ can't be entered without also matching ‘show’"}},
+		{"abbreviation exact", "(show | sh) status", true, nil},
+		{"abbreviation of exact keyword", "(!show | sh) status", false, nil},
+		{"duplicate", "get (a | b | a)", false, []string{"shadowed keyword in ‘get (a | b | a)’: the alternative ‘a’ is the same as an earlier one"}},
+		{"nullable repetition", "add (<v>?)*", false, []string{"nullable repetition in ‘add (<v>?)*’: the repeated part may match no words, so input can match it in many ways"}},
+		{"optional optional", "add (<v>?)?", false, nil},
+		{"branches", strings.Repeat("(a | b | c | d) ", 7), false, []string{"branch count in ‘" + strings.Repeat("(a | b | c | d) ", 7) + "’: the command has more than 10000 branches, which makes it slow to match"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var cmds Cmds
+			if err := cmds.Add(tc.syntax, func(match Match, ctx interface{}) {}); err != nil {
+				t.Fatalf("Adding the command failed: %v", err)
+			}
+			if tc.exact {
+				cmds.SetKeywordMatching(ExactMatching)
+			}
+
+			var warnings []string
+			for _, w := range cmds.Compile() {
+				warnings = append(warnings, w.String())
+			}
+			if !reflect.DeepEqual(warnings, tc.expected) {
+				t.Fatalf("Expected warnings %q but got %q", tc.expected, warnings)
+			}
+		})
+	}
+}